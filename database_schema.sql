@@ -7,15 +7,46 @@ CREATE TABLE administrators (
     username VARCHAR(50) NOT NULL UNIQUE,
     password_hash VARCHAR(255) NOT NULL,
     email VARCHAR(100) NOT NULL UNIQUE,
+    -- owner: 全権限と管理者の管理、author: 問題の作成・編集、host: 進行と参加者の管理、viewer: 閲覧のみ
+    -- 権限の導入前の管理者は全権限を持っていたため、既定はowner
+    role VARCHAR(20) NOT NULL DEFAULT 'owner' CHECK (role IN ('owner', 'author', 'host', 'viewer')),
+    disabled_at TIMESTAMP,  -- 無効化された管理者はログインできない
+    invited_by BIGINT,
+    invite_token_hash VARCHAR(64) UNIQUE,  -- 招待を承諾するまで設定（トークンのSHA-256）
+    invite_expires_at TIMESTAMP,
+    totp_secret VARCHAR(64),  -- 二段階認証（TOTP）の秘密鍵（Base32）。設定を始めた時点で保存される
+    totp_enabled_at TIMESTAMP,  -- 最初のコードを確認して有効にした日時。NULLなら二段階認証なし
+    totp_last_step BIGINT,  -- 最後に受け付けたコードの時間ステップ（同じコードの再利用を防ぐ）
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (invited_by) REFERENCES administrators(id) ON DELETE SET NULL
+);
+
+-- チームテーブル（セッション毎のチーム対抗戦）
+CREATE TABLE teams (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    session_id BIGINT,  -- チームが属するセッション
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 -- 参加者テーブル（匿名、ニックネームのみ）
 CREATE TABLE participants (
     id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
     nickname VARCHAR(50) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    nickname_key VARCHAR(200),  -- 重複判定用の正規化キー（紛らわしい文字を同一視）
+    session_id BIGINT,  -- 登録時のセッション（ニックネームの一意性の範囲）
+    recovery_pin_hash VARCHAR(255),  -- 端末復帰用PIN（bcrypt）
+    is_hidden BOOLEAN NOT NULL DEFAULT FALSE,  -- 管理者がニックネームを非表示にした
+    kicked_at TIMESTAMP,  -- 管理者が退場させた日時
+    answers_excluded BOOLEAN NOT NULL DEFAULT FALSE,  -- 回答を集計・ランキングから除外
+    team_id BIGINT,  -- 所属チーム（チーム対抗戦のみ）
+    approval_status VARCHAR(10) NOT NULL DEFAULT 'approved' CHECK (approval_status IN ('pending', 'approved', 'rejected')),  -- 参加承認
+    last_seen_at TIMESTAMP,  -- 接続・ハートビートを最後に確認した日時（接続中の判定）
+    eliminated_at TIMESTAMP,  -- サバイバル形式で脱落した日時（以降は観戦のみ）
+    eliminated_quiz_id BIGINT,  -- 脱落した問題
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE SET NULL
 );
 
 -- クイズテーブル（問題文、選択肢、正解、メディアURL）
@@ -38,12 +69,28 @@ CREATE TABLE answers (
     id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
     participant_id BIGINT NOT NULL,
     quiz_id BIGINT NOT NULL,
-    selected_option CHAR(1) NOT NULL CHECK (selected_option IN ('A', 'B', 'C', 'D')),
+    selected_option CHAR(1) CHECK (selected_option IN ('A', 'B', 'C', 'D')),  -- スキップした問題はNULL
     is_correct BOOLEAN NOT NULL,
+    lifeline VARCHAR(20) CHECK (lifeline IN ('fifty_fifty', 'skip', 'double')),  -- この問題で使ったライフライン
     answered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (participant_id) REFERENCES participants(id) ON DELETE CASCADE,
     FOREIGN KEY (quiz_id) REFERENCES quizzes(id) ON DELETE CASCADE,
-    UNIQUE(participant_id, quiz_id)  -- 一人の参加者が同じ問題に複数回答することを防ぐ
+    UNIQUE(participant_id, quiz_id),  -- 一人の参加者が同じ問題に複数回答することを防ぐ
+    CHECK (selected_option IS NOT NULL OR lifeline = 'skip')
+);
+
+-- ライフライン使用履歴（1問につき1つまで）
+CREATE TABLE lifeline_uses (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    participant_id BIGINT NOT NULL,
+    quiz_id BIGINT,  -- ダブルは次の問題が出題されるまでNULL
+    lifeline VARCHAR(20) NOT NULL CHECK (lifeline IN ('fifty_fifty', 'skip', 'double')),
+    hidden_options TEXT[],  -- 50/50で隠した選択肢
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (participant_id) REFERENCES participants(id) ON DELETE CASCADE,
+    FOREIGN KEY (quiz_id) REFERENCES quizzes(id) ON DELETE CASCADE,
+    UNIQUE(participant_id, quiz_id),
+    CHECK (quiz_id IS NOT NULL OR lifeline = 'double')
 );
 
 -- セッション管理テーブル（現在の問題番号、投票受付状態）
@@ -51,16 +98,221 @@ CREATE TABLE quiz_sessions (
     id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
     current_quiz_id BIGINT,
     is_accepting_answers BOOLEAN DEFAULT FALSE,
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('lobby', 'active', 'ended')),  -- 待機中・進行中・終了
+    max_participants INT,  -- 参加人数の上限（NULLは無制限）
+    require_approval BOOLEAN NOT NULL DEFAULT FALSE,  -- 参加に管理者の承認が必要
+    game_mode VARCHAR(20) NOT NULL DEFAULT 'standard' CHECK (game_mode IN ('standard', 'elimination')),  -- 通常・サバイバル
+    question_limit INT,  -- サバイバル形式の出題数（NULLは問題がなくなるまで）
+    lifeline_fifty_fifty INT NOT NULL DEFAULT 0,  -- 参加者1人あたりのライフライン使用回数の上限（0は使用不可）
+    lifeline_skip INT NOT NULL DEFAULT 0,
+    lifeline_double INT NOT NULL DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (current_quiz_id) REFERENCES quizzes(id) ON DELETE SET NULL
 );
 
+-- サバイバル形式の判定記録（1問につき1回）
+CREATE TABLE elimination_rounds (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    session_id BIGINT NOT NULL,
+    quiz_id BIGINT NOT NULL,
+    survivors_before INT NOT NULL,  -- 判定前の生存者数
+    eliminated_count INT NOT NULL DEFAULT 0,
+    voided BOOLEAN NOT NULL DEFAULT FALSE,  -- 生存者全員が不正解のため脱落なし
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES quiz_sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (quiz_id) REFERENCES quizzes(id) ON DELETE CASCADE,
+    UNIQUE(session_id, quiz_id)
+);
+
+-- 入場禁止テーブル（参加者IDまたはIPアドレス、セッション終了まで有効）
+CREATE TABLE participant_bans (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    session_id BIGINT,  -- 禁止したセッション
+    participant_id BIGINT,
+    ip_address VARCHAR(45),
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    banned_by BIGINT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    lifted_at TIMESTAMP,  -- 解除日時
+    FOREIGN KEY (participant_id) REFERENCES participants(id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_by) REFERENCES administrators(id) ON DELETE SET NULL,
+    CHECK (participant_id IS NOT NULL OR ip_address IS NOT NULL)
+);
+
+-- モデレーション監査ログ（ニックネーム変更、非表示、退場、入場禁止）
+CREATE TABLE moderation_audit_log (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    session_id BIGINT,
+    admin_id BIGINT,
+    action VARCHAR(20) NOT NULL,
+    participant_id BIGINT,  -- 参加者の統合・削除後も記録を残すため外部キーなし
+    ip_address VARCHAR(45),
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    details JSONB,  -- MySQL: JSON
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES administrators(id) ON DELETE SET NULL
+);
+
+-- 失効した管理者トークン（ログアウト）。トークンの有効期限を過ぎた行は自動で削除される
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,  -- トークンID（JWTのjtiクレーム）
+    expires_at TIMESTAMP NOT NULL,  -- トークンの有効期限
+    revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 管理者のログインセッション（リフレッシュトークンのファミリー）。ログインごとに1つ作られる
+CREATE TABLE refresh_token_families (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    admin_id BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,  -- 最後にトークンを更新した日時
+    revoked_at TIMESTAMP,  -- 失効したファミリーのトークンは更新できない
+    revoked_reason VARCHAR(20),  -- logout, logout_all, reuse, disabled, password_changed, deleted, role_changed
+    FOREIGN KEY (admin_id) REFERENCES administrators(id) ON DELETE CASCADE
+);
+
+-- 発行したリフレッシュトークン。更新のたびに使用済みになり、同じファミリーに新しいトークンが追加される
+CREATE TABLE refresh_tokens (
+    jti VARCHAR(64) PRIMARY KEY,  -- トークンID（JWTのjtiクレーム）
+    family_id BIGINT NOT NULL,
+    access_jti VARCHAR(64) NOT NULL,  -- 同時に発行したアクセストークンのID（ファミリーの失効時に失効させる）
+    access_expires_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,  -- 使用済みのトークンが再び使われたらファミリーを失効させる
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (family_id) REFERENCES refresh_token_families(id) ON DELETE CASCADE
+);
+
+-- 二段階認証のリカバリーコード。認証アプリを使えないときに1回だけ使える
+CREATE TABLE admin_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    admin_id BIGINT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,  -- コードのSHA-256
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES administrators(id) ON DELETE CASCADE
+);
+
+-- オーナーが設定するセキュリティポリシー（1行のみ）
+CREATE TABLE security_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    require_two_factor BOOLEAN NOT NULL DEFAULT FALSE,  -- すべての管理者に二段階認証を必須にする
+    updated_by BIGINT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (updated_by) REFERENCES administrators(id) ON DELETE SET NULL
+);
+
+-- 管理者ログインの失敗回数とロック（ユーザー名ごと・IPアドレスごと）。しばらく失敗がなければ削除される
+CREATE TABLE login_throttle (
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('user', 'ip', 'pin')),
+    key VARCHAR(100) NOT NULL,  -- ユーザー名、IPアドレス（存在しないユーザー名も含む）または参加者ID（復帰PIN）
+    failures INTEGER NOT NULL DEFAULT 0,  -- 連続した失敗回数
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,  -- この日時までログインを受け付けない
+    PRIMARY KEY (scope, key)
+);
+
+-- 管理者のログイン記録（成功・失敗）
+CREATE TABLE login_events (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    admin_id BIGINT,  -- ユーザー名が管理者のものであれば設定
+    username VARCHAR(100) NOT NULL,  -- 入力されたユーザー名
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(30) NOT NULL,  -- password, two_factor, oidc, invalid_credentials, invalid_two_factor_code, admin_disabled, locked_out, oidc_rejected
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES administrators(id) ON DELETE SET NULL
+);
+
+-- OpenID Connectのログイン開始から完了までの状態（1回だけ使える）
+CREATE TABLE oidc_login_states (
+    state_hash VARCHAR(64) PRIMARY KEY,  -- stateのSHA-256
+    browser_secret_hash VARCHAR(64) NOT NULL,  -- ログインを開始したブラウザが持つ秘密値のSHA-256
+    code_verifier VARCHAR(128) NOT NULL,  -- PKCEの検証コード
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- IDプロバイダーの利用者と管理者の紐付け
+CREATE TABLE admin_identities (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    admin_id BIGINT NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,  -- IDトークンのsub
+    email VARCHAR(255) NOT NULL DEFAULT '',  -- 最後のログイン時のメールアドレス
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (issuer, subject),
+    FOREIGN KEY (admin_id) REFERENCES administrators(id) ON DELETE CASCADE
+);
+
+-- スクリプトや外部連携用のAPIキー。作成した管理者として、許可された権限の範囲で使える
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,  -- キーの先頭（表示用）
+    key_hash VARCHAR(64) NOT NULL UNIQUE,  -- キーのSHA-256
+    permissions TEXT[] NOT NULL,  -- read, edit_quizzes, run_session, moderate_participants
+    created_by BIGINT NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(45),
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES administrators(id) ON DELETE CASCADE
+);
+
+-- 管理者の操作の監査ログ（問題の作成・更新・削除、セッションの操作）。操作前後の対象の状態を残す
+CREATE TABLE audit_logs (
+    id BIGSERIAL PRIMARY KEY,  -- MySQL: BIGINT AUTO_INCREMENT PRIMARY KEY
+    admin_id BIGINT,
+    username VARCHAR(100) NOT NULL DEFAULT '',  -- 管理者を削除しても残す
+    api_key_id BIGINT,  -- APIキーで操作した場合
+    action VARCHAR(50) NOT NULL,  -- quiz.create, session.start など
+    target_type VARCHAR(30) NOT NULL,  -- quiz, session
+    target_id BIGINT,  -- 対象を削除しても記録を残すため外部キーなし
+    before_data JSONB,  -- MySQL: JSON
+    after_data JSONB,  -- MySQL: JSON
+    request_id VARCHAR(64) NOT NULL DEFAULT '',  -- X-Request-ID
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES administrators(id) ON DELETE SET NULL,
+    FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE SET NULL
+);
+
 -- インデックス作成（パフォーマンス向上）
 CREATE INDEX idx_answers_participant_id ON answers(participant_id);
 CREATE INDEX idx_answers_quiz_id ON answers(quiz_id);
 CREATE INDEX idx_answers_answered_at ON answers(answered_at);
+CREATE INDEX idx_lifeline_uses_quiz_id ON lifeline_uses(quiz_id);
+-- 次の問題に使うダブルは参加者ごとに1つまで
+CREATE UNIQUE INDEX idx_lifeline_uses_pending_double ON lifeline_uses(participant_id) WHERE quiz_id IS NULL;
 CREATE INDEX idx_quiz_sessions_current_quiz_id ON quiz_sessions(current_quiz_id);
+CREATE INDEX idx_participant_bans_session_id ON participant_bans(session_id);
+CREATE INDEX idx_moderation_audit_log_participant_id ON moderation_audit_log(participant_id);
+CREATE INDEX idx_moderation_audit_log_created_at ON moderation_audit_log(created_at);
+CREATE INDEX idx_participants_team_id ON participants(team_id);
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+CREATE INDEX idx_refresh_token_families_admin_id ON refresh_token_families(admin_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_access_jti ON refresh_tokens(access_jti);
+CREATE INDEX idx_admin_recovery_codes_admin_id ON admin_recovery_codes(admin_id);
+CREATE INDEX idx_login_events_created_at ON login_events(created_at);
+CREATE INDEX idx_login_events_admin_id ON login_events(admin_id);
+CREATE INDEX idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
+CREATE INDEX idx_admin_identities_admin_id ON admin_identities(admin_id);
+CREATE INDEX idx_api_keys_created_by ON api_keys(created_by);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
+CREATE INDEX idx_audit_logs_admin_id ON audit_logs(admin_id);
+CREATE INDEX idx_audit_logs_target ON audit_logs(target_type, target_id);
+CREATE INDEX idx_participants_session_last_seen ON participants ((COALESCE(session_id, 0)), last_seen_at);
+-- チーム名はセッション内で一意
+CREATE UNIQUE INDEX idx_teams_session_name ON teams ((COALESCE(session_id, 0)), name);
+-- ニックネームはセッション内で一意（退場させた参加者は除く）
+CREATE UNIQUE INDEX idx_participants_session_nickname ON participants ((COALESCE(session_id, 0)), nickname_key) WHERE kicked_at IS NULL;
 
 -- MySQL用の自動更新トリガー（PostgreSQLでは不要）
 -- MySQL使用時のみ以下を実行
@@ -134,7 +134,7 @@ func setupTestDatabase() {
 
 	// テーブルが存在するか確認
 	fmt.Printf("Checking table existence before setup...\n")
-	tables := []string{"answers", "quiz_sessions", "participants", "quizzes", "administrators"}
+	tables := []string{"audit_logs", "api_keys", "admin_identities", "oidc_login_states", "login_events", "login_throttle", "security_settings", "admin_recovery_codes", "refresh_tokens", "refresh_token_families", "revoked_tokens", "moderation_audit_log", "participant_bans", "elimination_rounds", "lifeline_uses", "answers", "quiz_sessions", "participants", "teams", "quizzes", "administrators"}
 	for _, table := range tables {
 		var exists bool
 		err := testDB.QueryRow("SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = $1)", table).Scan(&exists)
@@ -231,6 +231,14 @@ func createTablesIfNotExists() {
 				username VARCHAR(50) NOT NULL UNIQUE,
 				password_hash VARCHAR(255) NOT NULL,
 				email VARCHAR(100) NOT NULL UNIQUE,
+				role VARCHAR(20) NOT NULL DEFAULT 'owner' CHECK (role IN ('owner', 'author', 'host', 'viewer')),
+				disabled_at TIMESTAMP,
+				invited_by BIGINT REFERENCES administrators(id) ON DELETE SET NULL,
+				invite_token_hash VARCHAR(64) UNIQUE,
+				invite_expires_at TIMESTAMP,
+				totp_secret VARCHAR(64),
+				totp_enabled_at TIMESTAMP,
+				totp_last_step BIGINT,
 				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			)`,
@@ -238,6 +246,24 @@ func createTablesIfNotExists() {
 			CREATE TABLE IF NOT EXISTS participants (
 				id BIGSERIAL PRIMARY KEY,
 				nickname VARCHAR(50) NOT NULL,
+				nickname_key VARCHAR(200),
+				session_id BIGINT,
+				recovery_pin_hash VARCHAR(255),
+				is_hidden BOOLEAN NOT NULL DEFAULT FALSE,
+				kicked_at TIMESTAMP,
+				answers_excluded BOOLEAN NOT NULL DEFAULT FALSE,
+				team_id BIGINT REFERENCES teams(id) ON DELETE SET NULL,
+				approval_status VARCHAR(10) NOT NULL DEFAULT 'approved' CHECK (approval_status IN ('pending', 'approved', 'rejected')),
+				last_seen_at TIMESTAMP,
+				eliminated_at TIMESTAMP,
+				eliminated_quiz_id BIGINT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"teams": `
+			CREATE TABLE IF NOT EXISTS teams (
+				id BIGSERIAL PRIMARY KEY,
+				session_id BIGINT,
+				name VARCHAR(50) NOT NULL,
 				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			)`,
 		"quizzes": `
@@ -259,6 +285,14 @@ func createTablesIfNotExists() {
 				id BIGSERIAL PRIMARY KEY,
 				current_quiz_id BIGINT,
 				is_accepting_answers BOOLEAN DEFAULT FALSE,
+				status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('lobby', 'active', 'ended')),
+				max_participants INT,
+				require_approval BOOLEAN NOT NULL DEFAULT FALSE,
+				game_mode VARCHAR(20) NOT NULL DEFAULT 'standard' CHECK (game_mode IN ('standard', 'elimination')),
+				question_limit INT,
+				lifeline_fifty_fifty INT NOT NULL DEFAULT 0,
+				lifeline_skip INT NOT NULL DEFAULT 0,
+				lifeline_double INT NOT NULL DEFAULT 0,
 				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			)`,
@@ -267,15 +301,172 @@ func createTablesIfNotExists() {
 				id BIGSERIAL PRIMARY KEY,
 				participant_id BIGINT NOT NULL,
 				quiz_id BIGINT NOT NULL,
-				selected_option CHAR(1) NOT NULL CHECK (selected_option IN ('A', 'B', 'C', 'D')),
+				selected_option CHAR(1) CHECK (selected_option IN ('A', 'B', 'C', 'D')),
 				is_correct BOOLEAN NOT NULL,
+				lifeline VARCHAR(20) CHECK (lifeline IN ('fifty_fifty', 'skip', 'double')),
 				answered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-				UNIQUE(participant_id, quiz_id)
+				UNIQUE(participant_id, quiz_id),
+				CHECK (selected_option IS NOT NULL OR lifeline = 'skip')
+			)`,
+		"lifeline_uses": `
+			CREATE TABLE IF NOT EXISTS lifeline_uses (
+				id BIGSERIAL PRIMARY KEY,
+				participant_id BIGINT NOT NULL REFERENCES participants(id) ON DELETE CASCADE,
+				quiz_id BIGINT REFERENCES quizzes(id) ON DELETE CASCADE,
+				lifeline VARCHAR(20) NOT NULL CHECK (lifeline IN ('fifty_fifty', 'skip', 'double')),
+				hidden_options TEXT[],
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(participant_id, quiz_id),
+				CHECK (quiz_id IS NOT NULL OR lifeline = 'double')
+			)`,
+		"elimination_rounds": `
+			CREATE TABLE IF NOT EXISTS elimination_rounds (
+				id BIGSERIAL PRIMARY KEY,
+				session_id BIGINT NOT NULL REFERENCES quiz_sessions(id) ON DELETE CASCADE,
+				quiz_id BIGINT NOT NULL REFERENCES quizzes(id) ON DELETE CASCADE,
+				survivors_before INT NOT NULL,
+				eliminated_count INT NOT NULL DEFAULT 0,
+				voided BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(session_id, quiz_id)
+			)`,
+		"participant_bans": `
+			CREATE TABLE IF NOT EXISTS participant_bans (
+				id BIGSERIAL PRIMARY KEY,
+				session_id BIGINT,
+				participant_id BIGINT REFERENCES participants(id) ON DELETE CASCADE,
+				ip_address VARCHAR(45),
+				reason VARCHAR(255) NOT NULL DEFAULT '',
+				banned_by BIGINT REFERENCES administrators(id) ON DELETE SET NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				lifted_at TIMESTAMP,
+				CHECK (participant_id IS NOT NULL OR ip_address IS NOT NULL)
+			)`,
+		"moderation_audit_log": `
+			CREATE TABLE IF NOT EXISTS moderation_audit_log (
+				id BIGSERIAL PRIMARY KEY,
+				session_id BIGINT,
+				admin_id BIGINT REFERENCES administrators(id) ON DELETE SET NULL,
+				action VARCHAR(20) NOT NULL,
+				participant_id BIGINT,
+				ip_address VARCHAR(45),
+				reason VARCHAR(255) NOT NULL DEFAULT '',
+				details JSONB,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"revoked_tokens": `
+			CREATE TABLE IF NOT EXISTS revoked_tokens (
+				jti VARCHAR(64) PRIMARY KEY,
+				expires_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"refresh_token_families": `
+			CREATE TABLE IF NOT EXISTS refresh_token_families (
+				id BIGSERIAL PRIMARY KEY,
+				admin_id BIGINT NOT NULL REFERENCES administrators(id) ON DELETE CASCADE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				last_used_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				revoked_reason VARCHAR(20)
+			)`,
+		"refresh_tokens": `
+			CREATE TABLE IF NOT EXISTS refresh_tokens (
+				jti VARCHAR(64) PRIMARY KEY,
+				family_id BIGINT NOT NULL REFERENCES refresh_token_families(id) ON DELETE CASCADE,
+				access_jti VARCHAR(64) NOT NULL,
+				access_expires_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"admin_recovery_codes": `
+			CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+				id BIGSERIAL PRIMARY KEY,
+				admin_id BIGINT NOT NULL REFERENCES administrators(id) ON DELETE CASCADE,
+				code_hash VARCHAR(64) NOT NULL,
+				used_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"security_settings": `
+			CREATE TABLE IF NOT EXISTS security_settings (
+				id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+				require_two_factor BOOLEAN NOT NULL DEFAULT FALSE,
+				updated_by BIGINT REFERENCES administrators(id) ON DELETE SET NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"login_throttle": `
+			CREATE TABLE IF NOT EXISTS login_throttle (
+				scope VARCHAR(10) NOT NULL CHECK (scope IN ('user', 'ip', 'pin')),
+				key VARCHAR(100) NOT NULL,
+				failures INTEGER NOT NULL DEFAULT 0,
+				last_failure_at TIMESTAMP NOT NULL,
+				locked_until TIMESTAMP,
+				PRIMARY KEY (scope, key)
+			)`,
+		"login_events": `
+			CREATE TABLE IF NOT EXISTS login_events (
+				id BIGSERIAL PRIMARY KEY,
+				admin_id BIGINT REFERENCES administrators(id) ON DELETE SET NULL,
+				username VARCHAR(100) NOT NULL,
+				success BOOLEAN NOT NULL,
+				reason VARCHAR(30) NOT NULL,
+				ip_address VARCHAR(45) NOT NULL,
+				user_agent VARCHAR(255) NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"oidc_login_states": `
+			CREATE TABLE IF NOT EXISTS oidc_login_states (
+				state_hash VARCHAR(64) PRIMARY KEY,
+				browser_secret_hash VARCHAR(64) NOT NULL,
+				code_verifier VARCHAR(128) NOT NULL,
+				nonce VARCHAR(64) NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"admin_identities": `
+			CREATE TABLE IF NOT EXISTS admin_identities (
+				id BIGSERIAL PRIMARY KEY,
+				admin_id BIGINT NOT NULL REFERENCES administrators(id) ON DELETE CASCADE,
+				issuer VARCHAR(255) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				email VARCHAR(255) NOT NULL DEFAULT '',
+				last_login_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (issuer, subject)
+			)`,
+		"api_keys": `
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id BIGSERIAL PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				key_prefix VARCHAR(20) NOT NULL,
+				key_hash VARCHAR(64) NOT NULL UNIQUE,
+				permissions TEXT[] NOT NULL,
+				created_by BIGINT NOT NULL REFERENCES administrators(id) ON DELETE CASCADE,
+				expires_at TIMESTAMP,
+				last_used_at TIMESTAMP,
+				last_used_ip VARCHAR(45),
+				revoked_at TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		"audit_logs": `
+			CREATE TABLE IF NOT EXISTS audit_logs (
+				id BIGSERIAL PRIMARY KEY,
+				admin_id BIGINT REFERENCES administrators(id) ON DELETE SET NULL,
+				username VARCHAR(100) NOT NULL DEFAULT '',
+				api_key_id BIGINT REFERENCES api_keys(id) ON DELETE SET NULL,
+				action VARCHAR(50) NOT NULL,
+				target_type VARCHAR(30) NOT NULL,
+				target_id BIGINT,
+				before_data JSONB,
+				after_data JSONB,
+				request_id VARCHAR(64) NOT NULL DEFAULT '',
+				ip_address VARCHAR(45) NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 			)`,
 	}
 
 	// Create tables in order (dependencies matter)
-	tableOrder := []string{"administrators", "participants", "quizzes", "quiz_sessions", "answers"}
+	tableOrder := []string{"administrators", "teams", "participants", "quizzes", "quiz_sessions", "answers", "lifeline_uses", "elimination_rounds", "participant_bans", "moderation_audit_log", "revoked_tokens", "refresh_token_families", "refresh_tokens", "admin_recovery_codes", "security_settings", "login_throttle", "login_events", "oidc_login_states", "admin_identities", "api_keys", "audit_logs"}
 
 	for _, tableName := range tableOrder {
 		sql := tables[tableName]
@@ -310,7 +501,29 @@ func createTablesIfNotExists() {
 		"CREATE INDEX IF NOT EXISTS idx_answers_participant_id ON answers(participant_id)",
 		"CREATE INDEX IF NOT EXISTS idx_answers_quiz_id ON answers(quiz_id)",
 		"CREATE INDEX IF NOT EXISTS idx_answers_answered_at ON answers(answered_at)",
+		"CREATE INDEX IF NOT EXISTS idx_lifeline_uses_quiz_id ON lifeline_uses(quiz_id)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_lifeline_uses_pending_double ON lifeline_uses(participant_id) WHERE quiz_id IS NULL",
 		"CREATE INDEX IF NOT EXISTS idx_quiz_sessions_current_quiz_id ON quiz_sessions(current_quiz_id)",
+		"CREATE INDEX IF NOT EXISTS idx_participant_bans_session_id ON participant_bans(session_id)",
+		"CREATE INDEX IF NOT EXISTS idx_moderation_audit_log_participant_id ON moderation_audit_log(participant_id)",
+		"CREATE INDEX IF NOT EXISTS idx_moderation_audit_log_created_at ON moderation_audit_log(created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_participants_team_id ON participants(team_id)",
+		"CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_token_families_admin_id ON refresh_token_families(admin_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_access_jti ON refresh_tokens(access_jti)",
+		"CREATE INDEX IF NOT EXISTS idx_admin_recovery_codes_admin_id ON admin_recovery_codes(admin_id)",
+		"CREATE INDEX IF NOT EXISTS idx_login_events_created_at ON login_events(created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_login_events_admin_id ON login_events(admin_id)",
+		"CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states(expires_at)",
+		"CREATE INDEX IF NOT EXISTS idx_admin_identities_admin_id ON admin_identities(admin_id)",
+		"CREATE INDEX IF NOT EXISTS idx_api_keys_created_by ON api_keys(created_by)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_logs_admin_id ON audit_logs(admin_id)",
+		"CREATE INDEX IF NOT EXISTS idx_audit_logs_target ON audit_logs(target_type, target_id)",
+		"CREATE INDEX IF NOT EXISTS idx_participants_session_last_seen ON participants ((COALESCE(session_id, 0)), last_seen_at)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_session_name ON teams ((COALESCE(session_id, 0)), name)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_participants_session_nickname ON participants ((COALESCE(session_id, 0)), nickname_key) WHERE kicked_at IS NULL",
 	}
 
 	for _, indexSQL := range indexes {
@@ -363,7 +576,7 @@ func teardownTestDatabase() {
 	dbMutex.Lock()
 	defer dbMutex.Unlock()
 
-	tables := []string{"answers", "quiz_sessions", "participants", "quizzes", "administrators"}
+	tables := []string{"audit_logs", "api_keys", "admin_identities", "oidc_login_states", "login_events", "login_throttle", "security_settings", "admin_recovery_codes", "refresh_tokens", "refresh_token_families", "revoked_tokens", "moderation_audit_log", "participant_bans", "elimination_rounds", "lifeline_uses", "answers", "quiz_sessions", "participants", "teams", "quizzes", "administrators"}
 	for _, table := range tables {
 		_, _ = testDB.Exec(fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE", table))
 	}
@@ -373,6 +586,9 @@ func setupTestRouter() *gin.Engine {
 	// データベースを設定
 	database.SetTestDB(testDB)
 
+	jwtService := services.NewJWTService()
+	handlers.UseJWTService(jwtService)
+
 	r := gin.New()
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
@@ -390,7 +606,6 @@ func setupTestRouter() *gin.Engine {
 
 		// Admin routes (protected)
 		admin := api.Group("/admin")
-		jwtService := services.NewJWTService()
 		admin.Use(middleware.JWTAuth(jwtService))
 		{
 			admin.POST("/logout", handlers.AdminLogout)
@@ -419,15 +634,17 @@ func setupTestRouter() *gin.Engine {
 		api.GET("/session/status", handlers.GetSessionStatus)
 
 		// Participants (public)
+		participantTokenService := services.NewParticipantTokenService()
 		participants := api.Group("/participants")
 		{
 			participants.POST("/register", handlers.RegisterParticipant)
 			participants.GET("/:id", handlers.GetParticipant)
-			participants.GET("/:id/answers", handlers.GetParticipantAnswers)
+			participants.GET("/:id/answers", middleware.ParticipantAuth(participantTokenService), handlers.GetParticipantAnswers)
 		}
 
-		// Answers (public)
+		// Answers (participant token)
 		answers := api.Group("/answers")
+		answers.Use(middleware.ParticipantAuth(participantTokenService))
 		{
 			answers.POST("", handlers.SubmitAnswer)
 			answers.PUT("/:id", handlers.UpdateAnswer)
@@ -586,6 +803,7 @@ func TestIntegrationQuizFlow(t *testing.T) {
 		t.Fatal("Failed to parse participant ID")
 	}
 	participantID := int64(participantIDFloat)
+	participantToken, _ := participantData["token"].(string)
 
 	// 5. 回答送信
 	answerReq := models.AnswerRequest{
@@ -597,6 +815,7 @@ func TestIntegrationQuizFlow(t *testing.T) {
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("POST", "/api/answers", bytes.NewBuffer(answerBody))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+participantToken)
 	testRouter.ServeHTTP(w, req)
 
 	if w.Code != http.StatusCreated {
@@ -787,6 +1006,10 @@ func TestIntegrationParticipantFlow(t *testing.T) {
 		t.Fatalf("Failed to parse participant ID from data: %+v", participantData)
 	}
 	participantID := int64(participantIDFloat)
+	participantToken, ok := participantData["token"].(string)
+	if !ok || participantToken == "" {
+		t.Fatalf("Expected a participant token in: %+v", participantData)
+	}
 
 	// 参加者情報取得
 	w = httptest.NewRecorder()
@@ -797,9 +1020,18 @@ func TestIntegrationParticipantFlow(t *testing.T) {
 		t.Fatalf("Get participant failed: %d", w.Code)
 	}
 
-	// 参加者回答履歴取得
+	// 参加者回答履歴取得（トークンなしは拒否）
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/participants/%d/answers", participantID), nil)
+	testRouter.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without participant token, got %d", w.Code)
+	}
+
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/participants/%d/answers", participantID), nil)
+	req.Header.Set("Authorization", "Bearer "+participantToken)
 	testRouter.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
@@ -902,6 +1134,7 @@ func TestIntegrationConcurrentAnswers(t *testing.T) {
 				_ = json.Unmarshal(w.Body.Bytes(), &participantResp) // テスト用なのでエラーハンドリング不要
 				participantData := participantResp.Data.(map[string]interface{})
 				participantID := int64(participantData["participant_id"].(float64))
+				participantToken, _ := participantData["token"].(string)
 
 				// 回答送信
 				answerReq := models.AnswerRequest{
@@ -913,6 +1146,7 @@ func TestIntegrationConcurrentAnswers(t *testing.T) {
 				w = httptest.NewRecorder()
 				req, _ = http.NewRequest("POST", "/api/answers", bytes.NewBuffer(answerBody))
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+participantToken)
 				testRouter.ServeHTTP(w, req)
 			}
 
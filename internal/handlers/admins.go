@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// adminIDParam parses the administrator ID path parameter, writing an error response if it is invalid
+func adminIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid administrator ID",
+			},
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondAdminError writes the response for an error from the administrator management service
+func respondAdminError(c *gin.Context, err error, message string) {
+	status, code := http.StatusInternalServerError, "DATABASE_ERROR"
+	switch {
+	case errors.Is(err, services.ErrAdminNotFound):
+		status, code, message = http.StatusNotFound, "ADMIN_NOT_FOUND", "Administrator not found"
+	case errors.Is(err, services.ErrAdminExists):
+		status, code, message = http.StatusConflict, "ADMIN_EXISTS", "Username or email is already in use"
+	case errors.Is(err, services.ErrLastOwner):
+		status, code, message = http.StatusConflict, "LAST_OWNER", "At least one active owner is required"
+	case errors.Is(err, services.ErrInvitationInvalid):
+		status, code, message = http.StatusBadRequest, "INVALID_INVITATION", "The invitation is invalid or has expired"
+	case errors.Is(err, services.ErrInvalidPassword):
+		status, code, message = http.StatusBadRequest, "INVALID_PASSWORD", "Password must be 8 to 72 bytes"
+	case errors.Is(err, services.ErrInvalidCredentials):
+		status, code, message = http.StatusBadRequest, "INVALID_CURRENT_PASSWORD", "Current password is incorrect"
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		status, code, message = http.StatusBadRequest, "INVALID_TWO_FACTOR_CODE", "The authentication code is invalid or was already used"
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		status, code, message = http.StatusConflict, "TWO_FACTOR_ALREADY_ENABLED", "Two-factor authentication is already enabled"
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		status, code, message = http.StatusConflict, "TWO_FACTOR_NOT_ENROLLED", "Two-factor authentication setup has not been started"
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		status, code, message = http.StatusConflict, "TWO_FACTOR_NOT_ENABLED", "Two-factor authentication is not enabled"
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		status, code, message = http.StatusForbidden, "TWO_FACTOR_REQUIRED", "Two-factor authentication is required for all administrators"
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		status, code, message = http.StatusNotFound, "API_KEY_NOT_FOUND", "API key not found"
+	default:
+		log.Printf("%s: %v", message, err)
+	}
+
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// revokeAdminSessions signs an administrator out of their sessions after a change to their
+// account, except the session of exceptAccessTokenID. Failures are logged because the change
+// itself has been made.
+func revokeAdminSessions(adminID int64, reason, exceptAccessTokenID string) {
+	if _, err := newSessionService().RevokeAllSessions(adminID, reason, exceptAccessTokenID); err != nil {
+		log.Printf("Failed to revoke sessions of admin %d: %v", adminID, err)
+	}
+}
+
+// ListAdmins lists every administrator with their role and state (owner only)
+func ListAdmins(c *gin.Context) {
+	admins, err := services.NewAuthService().ListAdmins()
+	if err != nil {
+		respondAdminError(c, err, "Failed to list administrators")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    admins,
+	})
+}
+
+// CreateAdmin creates an administrator with a role and a password chosen by the owner (owner only)
+func CreateAdmin(c *gin.Context) {
+	var req models.CreateAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	admin, err := services.NewAuthService().CreateAdminWithRole(req.Username, req.Password, req.Email, req.Role)
+	if err != nil {
+		respondAdminError(c, err, "Failed to create administrator")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "管理者を作成しました",
+		Data:    admin,
+	})
+}
+
+// InviteAdmin creates an administrator with a role and returns a one-time invitation token
+// for them to set their password (owner only)
+func InviteAdmin(c *gin.Context) {
+	var req models.InviteAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	var invitedBy int64
+	if id := adminIDFromContext(c); id != nil {
+		invitedBy = *id
+	}
+
+	admin, token, err := services.NewAuthService().InviteAdmin(invitedBy, req.Username, req.Email, req.Role)
+	if err != nil {
+		respondAdminError(c, err, "Failed to invite administrator")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "管理者を招待しました",
+		Data: models.InviteAdminResponse{
+			Admin:       *admin,
+			InviteToken: token,
+			ExpiresAt:   *admin.InviteExpiresAt,
+		},
+	})
+}
+
+// AcceptInvitation sets the password of an invited administrator and signs them in
+func AcceptInvitation(c *gin.Context) {
+	var req models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	admin, err := services.NewAuthService().AcceptInvitation(req.Token, req.Password)
+	if err != nil {
+		respondAdminError(c, err, "Failed to accept invitation")
+		return
+	}
+
+	response, err := newSessionService().StartSession(admin)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate authentication tokens",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "招待を承諾しました",
+		Data:    response,
+	})
+}
+
+// UpdateAdminRole changes an administrator's role (owner only).
+// Changing the role revokes the administrator's sessions, so that tokens with the old role stop working.
+func UpdateAdminRole(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.AdminRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	authService := services.NewAuthService()
+	previous, err := authService.GetAdminByID(id)
+	if err != nil {
+		respondAdminError(c, err, "Failed to get administrator")
+		return
+	}
+	admin, err := authService.SetAdminRole(id, req.Role)
+	if err != nil {
+		respondAdminError(c, err, "Failed to change role")
+		return
+	}
+	// Access tokens carry the role, so the administrator signs in again to use the new one.
+	// Otherwise a demoted owner could keep their permissions until the token expires.
+	if admin.Role != previous.Role {
+		revokeAdminSessions(id, services.RevokeReasonRoleChanged, "")
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ロールを変更しました",
+		Data:    admin,
+	})
+}
+
+// DisableAdmin disables an administrator so that they can no longer sign in or refresh
+// their tokens (owner only). Owners cannot disable themselves.
+func DisableAdmin(c *gin.Context) {
+	setAdminDisabled(c, true)
+}
+
+// EnableAdmin re-enables a disabled administrator (owner only)
+func EnableAdmin(c *gin.Context) {
+	setAdminDisabled(c, false)
+}
+
+// setAdminDisabled disables or re-enables the administrator in the path
+func setAdminDisabled(c *gin.Context, disabled bool) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	if self := adminIDFromContext(c); disabled && self != nil && *self == id {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "CANNOT_DISABLE_SELF",
+				Message: "You cannot disable your own account",
+			},
+		})
+		return
+	}
+
+	admin, err := services.NewAuthService().SetAdminDisabled(id, disabled)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update administrator")
+		return
+	}
+	if disabled {
+		revokeAdminSessions(id, services.RevokeReasonDisabled, "")
+	}
+
+	message := "管理者を有効にしました"
+	if disabled {
+		message = "管理者を無効にしました"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    admin,
+	})
+}
+
+// UpdateAdmin changes an administrator's username, email or password (owner only)
+func UpdateAdmin(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	admin, err := services.NewAuthService().UpdateAdmin(id, req.Username, req.Email, req.Password)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update administrator")
+		return
+	}
+	if req.Password != nil {
+		revokeAdminSessions(id, services.RevokeReasonPasswordChanged, "")
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "管理者を更新しました",
+		Data:    admin,
+	})
+}
+
+// DeleteAdmin deletes an administrator (owner only). Owners cannot delete themselves.
+func DeleteAdmin(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	if self := adminIDFromContext(c); self != nil && *self == id {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "CANNOT_DELETE_SELF",
+				Message: "You cannot delete your own account",
+			},
+		})
+		return
+	}
+
+	// Revoke the access tokens first; deleting the administrator deletes their sessions
+	revokeAdminSessions(id, services.RevokeReasonDeleted, "")
+	if err := services.NewAuthService().DeleteAdmin(id); err != nil {
+		respondAdminError(c, err, "Failed to delete administrator")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "管理者を削除しました",
+	})
+}
+
+// ChangeOwnPassword changes the signed-in administrator's password after checking the current one
+func ChangeOwnPassword(c *gin.Context) {
+	id := adminIDFromContext(c)
+	if id == nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "UNAUTHORIZED",
+				Message: "Authentication required",
+			},
+		})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	if err := services.NewAuthService().ChangePassword(*id, req.CurrentPassword, req.NewPassword); err != nil {
+		respondAdminError(c, err, "Failed to change password")
+		return
+	}
+
+	// Sign out every other device; the current session stays signed in
+	var current string
+	if claims, ok := c.Get("token_claims"); ok {
+		current = claims.(*models.JWTClaims).ID
+	}
+	revokeAdminSessions(*id, services.RevokeReasonPasswordChanged, current)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "パスワードを変更しました",
+	})
+}
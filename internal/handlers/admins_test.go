@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminManagement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	suffix := os.Getpid()
+	owner, err := services.NewAuthService().CreateAdmin(fmt.Sprintf("owner%d", suffix), "ownerpassword", fmt.Sprintf("owner%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create owner: %v", err)
+	}
+	createdIDs := []int64{owner.ID}
+	defer func() {
+		for _, id := range createdIDs {
+			_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", id)
+		}
+		// テストのリクエストにはIPアドレスがないため、空のIPアドレスの失敗回数を消す
+		_, _ = db.Exec("DELETE FROM login_throttle WHERE scope = 'ip' AND key = ''")
+	}()
+	if owner.Role != models.AdminRoleOwner {
+		t.Errorf("Expected a created admin to be an owner, got %q", owner.Role)
+	}
+
+	send := func(handler gin.HandlerFunc, id int64, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		c.Request, _ = http.NewRequest("POST", "/admin/admins", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+		c.Set("admin_id", owner.ID)
+		c.Set("admin_role", owner.Role)
+		handler(c)
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		var response models.APIResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Error == nil {
+			return ""
+		}
+		return response.Error.Code
+	}
+	login := func(username, password string) *httptest.ResponseRecorder {
+		return send(AdminLogin, 0, models.LoginRequest{Username: username, Password: password})
+	}
+
+	// 進行役を招待
+	hostName := fmt.Sprintf("host%d", suffix)
+	invite := models.InviteAdminRequest{Username: hostName, Email: fmt.Sprintf("host%d@example.com", suffix), Role: models.AdminRoleHost}
+	w := send(InviteAdmin, 0, invite)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Invite failed: %d %s", w.Code, w.Body.String())
+	}
+	var invited struct {
+		Data models.InviteAdminResponse `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &invited)
+	host := invited.Data.Admin
+	createdIDs = append(createdIDs, host.ID)
+	if invited.Data.InviteToken == "" || host.Role != models.AdminRoleHost || host.InvitedBy == nil || *host.InvitedBy != owner.ID {
+		t.Errorf("Unexpected invitation %+v", invited.Data)
+	}
+	if w := send(InviteAdmin, 0, invite); w.Code != http.StatusConflict || errorCode(w) != "ADMIN_EXISTS" {
+		t.Errorf("Expected a duplicate invitation to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 承諾するまでログインできず、招待トークンは一度だけ使える
+	if w := login(hostName, "anypassword"); w.Code != http.StatusUnauthorized {
+		t.Error("Expected a pending invitation to be unable to sign in")
+	}
+	accept := models.AcceptInvitationRequest{Token: invited.Data.InviteToken, Password: "hostpassword"}
+	w = send(AcceptInvitation, 0, accept)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Accept invitation failed: %d %s", w.Code, w.Body.String())
+	}
+	var accepted struct {
+		Data models.LoginResponse `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &accepted)
+	if accepted.Data.AccessToken == "" || accepted.Data.Admin.Role != models.AdminRoleHost || accepted.Data.Admin.InviteExpiresAt != nil {
+		t.Errorf("Unexpected sign in after accepting %+v", accepted.Data)
+	}
+	if w := send(AcceptInvitation, 0, accept); w.Code != http.StatusBadRequest || errorCode(w) != "INVALID_INVITATION" {
+		t.Errorf("Expected a used invitation to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if w := login(hostName, "hostpassword"); w.Code != http.StatusOK {
+		t.Errorf("Login failed after accepting: %d %s", w.Code, w.Body.String())
+	}
+
+	// ロールを閲覧者に変更
+	w = send(UpdateAdminRole, host.ID, models.AdminRoleRequest{Role: models.AdminRoleViewer})
+	var updated struct {
+		Data models.Administrator `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &updated)
+	if w.Code != http.StatusOK || updated.Data.Role != models.AdminRoleViewer {
+		t.Errorf("Role change failed: %d %s", w.Code, w.Body.String())
+	}
+	// ロールを変更するとそれまでのログインセッションは失効する
+	if w := send(RefreshToken, 0, models.RefreshTokenRequest{RefreshToken: accepted.Data.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the role change to revoke the session, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(UpdateAdminRole, host.ID, models.AdminRoleRequest{Role: "superuser"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown role to be refused, got %d", w.Code)
+	}
+
+	// 無効化した管理者はログインできない。自分自身は無効化できない
+	if w := send(DisableAdmin, owner.ID, nil); w.Code != http.StatusBadRequest || errorCode(w) != "CANNOT_DISABLE_SELF" {
+		t.Errorf("Expected an owner to be unable to disable themselves, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(DisableAdmin, host.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("Disable failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(hostName, "hostpassword"); w.Code != http.StatusForbidden || errorCode(w) != "ADMIN_DISABLED" {
+		t.Errorf("Expected a disabled admin to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(EnableAdmin, host.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("Enable failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(hostName, "hostpassword"); w.Code != http.StatusOK {
+		t.Errorf("Expected a re-enabled admin to sign in, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 一覧には招待した管理者も含まれる
+	w = send(ListAdmins, 0, nil)
+	var list struct {
+		Data []models.Administrator `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	found := false
+	for _, admin := range list.Data {
+		if admin.ID == host.ID {
+			found = admin.Role == models.AdminRoleViewer && admin.DisabledAt == nil
+		}
+	}
+	if !found {
+		t.Errorf("Expected the invited admin in the list, got %s", w.Body.String())
+	}
+
+	if w := send(UpdateAdminRole, host.ID+1000000, models.AdminRoleRequest{Role: models.AdminRoleHost}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown admin, got %d", w.Code)
+	}
+
+	// パスワードを指定して作成し、そのままログインできる
+	authorName := fmt.Sprintf("author%d", suffix)
+	create := models.CreateAdminRequest{Username: authorName, Email: fmt.Sprintf("author%d@example.com", suffix), Password: "authorpassword", Role: models.AdminRoleAuthor}
+	w = send(CreateAdmin, 0, create)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Create failed: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data models.Administrator `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	author := created.Data
+	createdIDs = append(createdIDs, author.ID)
+	if author.Role != models.AdminRoleAuthor {
+		t.Errorf("Unexpected created admin %+v", author)
+	}
+	if w := send(CreateAdmin, 0, create); w.Code != http.StatusConflict || errorCode(w) != "ADMIN_EXISTS" {
+		t.Errorf("Expected a duplicate username to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if w := login(authorName, "authorpassword"); w.Code != http.StatusOK {
+		t.Errorf("Login failed after creating: %d %s", w.Code, w.Body.String())
+	}
+
+	// 指定した項目だけを更新する
+	newEmail, newPassword := fmt.Sprintf("author%d@example.org", suffix), "resetpassword"
+	w = send(UpdateAdmin, author.ID, models.UpdateAdminRequest{Email: &newEmail, Password: &newPassword})
+	updated.Data = models.Administrator{}
+	_ = json.Unmarshal(w.Body.Bytes(), &updated)
+	if w.Code != http.StatusOK || updated.Data.Email != newEmail || updated.Data.Username != authorName {
+		t.Errorf("Update failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(authorName, "resetpassword"); w.Code != http.StatusOK {
+		t.Errorf("Login with the reset password failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := send(UpdateAdmin, author.ID, models.UpdateAdminRequest{Username: &hostName}); w.Code != http.StatusConflict {
+		t.Errorf("Expected a username in use to be refused, got %d", w.Code)
+	}
+
+	// 自分のパスワード変更には現在のパスワードが必要
+	changeOwn := func(current, next string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: current, NewPassword: next})
+		c.Request, _ = http.NewRequest("PUT", "/admin/me/password", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("admin_id", author.ID)
+		ChangeOwnPassword(c)
+		return w
+	}
+	if w := changeOwn("wrongpassword", "changedpassword"); w.Code != http.StatusBadRequest || errorCode(w) != "INVALID_CURRENT_PASSWORD" {
+		t.Errorf("Expected a wrong current password to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if w := changeOwn("resetpassword", "short"); w.Code != http.StatusBadRequest || errorCode(w) != "VALIDATION_ERROR" {
+		t.Errorf("Expected a short new password to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if w := changeOwn("resetpassword", "changedpassword"); w.Code != http.StatusOK {
+		t.Fatalf("Password change failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(authorName, "resetpassword"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to stop working, got %d", w.Code)
+	}
+	if w := login(authorName, "changedpassword"); w.Code != http.StatusOK {
+		t.Errorf("Login with the changed password failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// 削除。自分自身は削除できない
+	if w := send(DeleteAdmin, owner.ID, nil); w.Code != http.StatusBadRequest || errorCode(w) != "CANNOT_DELETE_SELF" {
+		t.Errorf("Expected an owner to be unable to delete themselves, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(DeleteAdmin, author.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("Delete failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := send(DeleteAdmin, author.ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted admin, got %d", w.Code)
+	}
+	if w := login(authorName, "changedpassword"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a deleted admin to be unable to sign in, got %d", w.Code)
+	}
+}
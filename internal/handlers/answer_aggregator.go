@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+)
+
+const (
+	// DefaultAnswerStatusFlushInterval is how often coalesced answer_status updates are broadcast
+	DefaultAnswerStatusFlushInterval = 250 * time.Millisecond
+	// DefaultAnswerStatusReconcileInterval is how often in-memory counts are reloaded from the database
+	DefaultAnswerStatusReconcileInterval = 5 * time.Second
+	// answerTallyIdleTimeout is how long a quiz may go without answers before its tally is dropped
+	answerTallyIdleTimeout = 10 * time.Minute
+)
+
+// AnswerTally holds the in-memory answer counts for a single quiz.
+// Participant counts cover the current session only.
+type AnswerTally struct {
+	TotalParticipants     int
+	ConnectedParticipants int
+	AnsweredCount         int
+	AnswerCounts          map[string]int
+
+	dirty      bool // changed since the last flush
+	active     bool // changed since the last reconciliation
+	lastActive time.Time
+}
+
+// AnswerTallyLoader loads authoritative answer counts for a quiz
+type AnswerTallyLoader func(quizID int64) (*AnswerTally, error)
+
+// AnswerStatusPublisher broadcasts a coalesced answer status
+type AnswerStatusPublisher func(quizID int64, totalParticipants, connectedParticipants, answeredCount int, answerCounts map[string]int)
+
+// AnswerAggregator keeps per-quiz answer counts in memory, updates them incrementally
+// on every submission and broadcasts at most one answer_status per quiz per flush interval.
+// The database stays the source of truth: counts are seeded from it and periodically reconciled.
+// With several replicas each one counts only the submissions it received until it reconciles.
+type AnswerAggregator struct {
+	flushInterval     time.Duration
+	reconcileInterval time.Duration
+	load              AnswerTallyLoader
+	publish           AnswerStatusPublisher
+
+	mu      sync.Mutex
+	quizzes map[int64]*AnswerTally
+}
+
+// NewAnswerAggregator creates a new AnswerAggregator instance
+func NewAnswerAggregator(flushInterval, reconcileInterval time.Duration, load AnswerTallyLoader, publish AnswerStatusPublisher) *AnswerAggregator {
+	return &AnswerAggregator{
+		flushInterval:     flushInterval,
+		reconcileInterval: reconcileInterval,
+		load:              load,
+		publish:           publish,
+		quizzes:           make(map[int64]*AnswerTally),
+	}
+}
+
+var (
+	answerAggregator     *AnswerAggregator
+	answerAggregatorOnce sync.Once
+)
+
+// getAnswerAggregator returns the process-wide aggregator, starting it on first use
+// so that its configuration is read after the environment has been loaded
+func getAnswerAggregator() *AnswerAggregator {
+	answerAggregatorOnce.Do(func() {
+		answerAggregator = NewAnswerAggregator(
+			durationFromEnv("ANSWER_STATUS_FLUSH_MS", time.Millisecond, DefaultAnswerStatusFlushInterval),
+			durationFromEnv("ANSWER_STATUS_RECONCILE_SECONDS", time.Second, DefaultAnswerStatusReconcileInterval),
+			loadAnswerTally,
+			func(quizID int64, totalParticipants, connectedParticipants, answeredCount int, answerCounts map[string]int) {
+				BroadcastAnswerStatus(quizID, quizID, totalParticipants, connectedParticipants, answeredCount, answerCounts)
+			},
+		)
+		go answerAggregator.Run()
+	})
+	return answerAggregator
+}
+
+// durationFromEnv reads a positive integer from the environment in the given unit
+func durationFromEnv(key string, unit, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return time.Duration(n) * unit
+		}
+	}
+	return defaultValue
+}
+
+// RecordAnswer applies a submission to the quiz's counts. previousOption is empty for
+// a new answer and holds the replaced option when an answer is changed.
+// selectedOption is empty for a skipped question, which counts as answered but not towards any option.
+func (a *AnswerAggregator) RecordAnswer(quizID int64, previousOption, selectedOption string) {
+	a.mu.Lock()
+	tally, exists := a.quizzes[quizID]
+	if exists {
+		a.applyLocked(tally, previousOption, selectedOption)
+		a.mu.Unlock()
+		return
+	}
+	a.mu.Unlock()
+
+	// First answer seen for this quiz: seed from the database, which already includes it
+	seeded, err := a.load(quizID)
+	if err != nil {
+		log.Printf("Failed to load answer counts for quiz %d: %v", quizID, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if tally, exists := a.quizzes[quizID]; exists {
+		// Another submission seeded the tally concurrently; reconciliation corrects any overlap
+		a.applyLocked(tally, previousOption, selectedOption)
+		return
+	}
+	a.quizzes[quizID] = seeded
+	a.touchLocked(seeded)
+}
+
+// applyLocked applies a single submission to a tally
+func (a *AnswerAggregator) applyLocked(tally *AnswerTally, previousOption, selectedOption string) {
+	if previousOption == "" {
+		tally.AnsweredCount++
+	} else if tally.AnswerCounts[previousOption] > 0 {
+		tally.AnswerCounts[previousOption]--
+	}
+	if selectedOption != "" {
+		tally.AnswerCounts[selectedOption]++
+	}
+	a.touchLocked(tally)
+}
+
+// touchLocked marks a tally as changed
+func (a *AnswerAggregator) touchLocked(tally *AnswerTally) {
+	tally.dirty = true
+	tally.active = true
+	tally.lastActive = time.Now()
+}
+
+// Run flushes and reconciles the counts until the process exits
+func (a *AnswerAggregator) Run() {
+	flushTicker := time.NewTicker(a.flushInterval)
+	defer flushTicker.Stop()
+	reconcileTicker := time.NewTicker(a.reconcileInterval)
+	defer reconcileTicker.Stop()
+
+	for {
+		select {
+		case <-flushTicker.C:
+			a.Flush()
+		case <-reconcileTicker.C:
+			a.Reconcile()
+		}
+	}
+}
+
+// Flush broadcasts one answer_status for every quiz that changed since the last flush
+func (a *AnswerAggregator) Flush() {
+	type snapshot struct {
+		quizID                int64
+		totalParticipants     int
+		connectedParticipants int
+		answeredCount         int
+		answerCounts          map[string]int
+	}
+
+	a.mu.Lock()
+	var pending []snapshot
+	for quizID, tally := range a.quizzes {
+		if !tally.dirty {
+			continue
+		}
+		counts := make(map[string]int, len(tally.AnswerCounts))
+		for option, count := range tally.AnswerCounts {
+			counts[option] = count
+		}
+		pending = append(pending, snapshot{quizID, tally.TotalParticipants, tally.ConnectedParticipants, tally.AnsweredCount, counts})
+		tally.dirty = false
+	}
+	a.mu.Unlock()
+
+	for _, s := range pending {
+		a.publish(s.quizID, s.totalParticipants, s.connectedParticipants, s.answeredCount, s.answerCounts)
+	}
+}
+
+// Reconcile reloads the counts of recently active quizzes from the database and
+// drops tallies that have been idle for a long time
+func (a *AnswerAggregator) Reconcile() {
+	a.mu.Lock()
+	var active []int64
+	for quizID, tally := range a.quizzes {
+		switch {
+		case tally.active:
+			active = append(active, quizID)
+			tally.active = false
+		case time.Since(tally.lastActive) > answerTallyIdleTimeout:
+			delete(a.quizzes, quizID)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, quizID := range active {
+		fresh, err := a.load(quizID)
+		if err != nil {
+			log.Printf("Failed to reconcile answer counts for quiz %d: %v", quizID, err)
+			continue
+		}
+
+		a.mu.Lock()
+		if tally, exists := a.quizzes[quizID]; exists {
+			if !sameTally(tally, fresh) {
+				tally.dirty = true
+			}
+			tally.TotalParticipants = fresh.TotalParticipants
+			tally.ConnectedParticipants = fresh.ConnectedParticipants
+			tally.AnsweredCount = fresh.AnsweredCount
+			tally.AnswerCounts = fresh.AnswerCounts
+		}
+		a.mu.Unlock()
+	}
+}
+
+// Reload replaces a quiz's counts with the database counts right away, for changes that
+// do not come from submissions such as answers being excluded by an admin
+func (a *AnswerAggregator) Reload(quizID int64) {
+	a.mu.Lock()
+	_, exists := a.quizzes[quizID]
+	a.mu.Unlock()
+	if !exists {
+		// Seeded from the database on the next submission
+		return
+	}
+
+	fresh, err := a.load(quizID)
+	if err != nil {
+		log.Printf("Failed to reload answer counts for quiz %d: %v", quizID, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if tally, exists := a.quizzes[quizID]; exists {
+		tally.TotalParticipants = fresh.TotalParticipants
+		tally.ConnectedParticipants = fresh.ConnectedParticipants
+		tally.AnsweredCount = fresh.AnsweredCount
+		tally.AnswerCounts = fresh.AnswerCounts
+		a.touchLocked(tally)
+	}
+}
+
+// RefreshPresence schedules every tracked quiz for reconciliation so that answer rates follow
+// participants connecting and disconnecting between submissions
+func (a *AnswerAggregator) RefreshPresence() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, tally := range a.quizzes {
+		if time.Since(tally.lastActive) <= answerTallyIdleTimeout {
+			tally.active = true
+		}
+	}
+}
+
+// sameTally reports whether two tallies hold the same counts
+func sameTally(a, b *AnswerTally) bool {
+	if a.TotalParticipants != b.TotalParticipants || a.ConnectedParticipants != b.ConnectedParticipants ||
+		a.AnsweredCount != b.AnsweredCount {
+		return false
+	}
+	for option, count := range a.AnswerCounts {
+		if b.AnswerCounts[option] != count {
+			return false
+		}
+	}
+	for option, count := range b.AnswerCounts {
+		if a.AnswerCounts[option] != count {
+			return false
+		}
+	}
+	return true
+}
+
+// loadAnswerTally loads the authoritative counts for a quiz from the database
+func loadAnswerTally(quizID int64) (*AnswerTally, error) {
+	db := database.GetDB()
+	if db == nil {
+		return nil, errDatabaseNotInitialized
+	}
+
+	tally := &AnswerTally{AnswerCounts: make(map[string]int)}
+
+	sessionID := currentSessionID()
+	participants, err := loadParticipantCounts(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tally.TotalParticipants = participants.Registered
+	tally.ConnectedParticipants = participants.Connected
+
+	// Only answers from the current session count, and not those excluded by an admin
+	countQuery := `SELECT COALESCE(a.selected_option, ''), COUNT(*)
+				   FROM answers a
+				   JOIN participants p ON a.participant_id = p.id
+				   WHERE a.quiz_id = $1 AND COALESCE(p.session_id, 0) = $2 AND NOT p.answers_excluded
+				   GROUP BY a.selected_option`
+
+	rows, err := db.Query(countQuery, quizID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	for rows.Next() {
+		var option string
+		var count int
+		if err := rows.Scan(&option, &count); err != nil {
+			return nil, err
+		}
+		if option != "" {
+			tally.AnswerCounts[option] = count
+		}
+		tally.AnsweredCount += count
+	}
+
+	return tally, rows.Err()
+}
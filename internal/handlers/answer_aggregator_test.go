@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type publishedStatus struct {
+	quizID                int64
+	totalParticipants     int
+	connectedParticipants int
+	answeredCount         int
+	answerCounts          map[string]int
+}
+
+func newTestAggregator(load AnswerTallyLoader) (*AnswerAggregator, *[]publishedStatus) {
+	var mu sync.Mutex
+	published := []publishedStatus{}
+	aggregator := NewAnswerAggregator(time.Hour, time.Hour, load,
+		func(quizID int64, totalParticipants, connectedParticipants, answeredCount int, answerCounts map[string]int) {
+			mu.Lock()
+			defer mu.Unlock()
+			published = append(published, publishedStatus{quizID, totalParticipants, connectedParticipants, answeredCount, answerCounts})
+		})
+	return aggregator, &published
+}
+
+func TestAnswerAggregatorCoalescesSubmissions(t *testing.T) {
+	loads := 0
+	aggregator, published := newTestAggregator(func(_ int64) (*AnswerTally, error) {
+		loads++
+		// The database already contains the first answer when the tally is seeded
+		return &AnswerTally{TotalParticipants: 70, AnsweredCount: 1, AnswerCounts: map[string]int{"A": 1}}, nil
+	})
+
+	aggregator.RecordAnswer(1, "", "A")
+	aggregator.RecordAnswer(1, "", "B")
+	aggregator.RecordAnswer(1, "", "B")
+	aggregator.RecordAnswer(1, "B", "C") // changed answer
+
+	if loads != 1 {
+		t.Errorf("Expected a single database load, got %d", loads)
+	}
+	if len(*published) != 0 {
+		t.Fatalf("Nothing should be broadcast before a flush, got %d", len(*published))
+	}
+
+	aggregator.Flush()
+	if len(*published) != 1 {
+		t.Fatalf("Expected one coalesced broadcast, got %d", len(*published))
+	}
+
+	status := (*published)[0]
+	if status.answeredCount != 3 {
+		t.Errorf("Expected 3 answered, got %d", status.answeredCount)
+	}
+	want := map[string]int{"A": 1, "B": 1, "C": 1}
+	for option, count := range want {
+		if status.answerCounts[option] != count {
+			t.Errorf("Option %s: expected %d, got %d", option, count, status.answerCounts[option])
+		}
+	}
+	if status.totalParticipants != 70 {
+		t.Errorf("Expected 70 participants, got %d", status.totalParticipants)
+	}
+
+	// Nothing changed since the last flush
+	aggregator.Flush()
+	if len(*published) != 1 {
+		t.Errorf("Expected no broadcast without changes, got %d", len(*published))
+	}
+}
+
+func TestAnswerAggregatorReconcilesWithDatabase(t *testing.T) {
+	dbCounts := &AnswerTally{TotalParticipants: 10, AnsweredCount: 1, AnswerCounts: map[string]int{"A": 1}}
+	aggregator, published := newTestAggregator(func(_ int64) (*AnswerTally, error) {
+		counts := make(map[string]int)
+		for option, count := range dbCounts.AnswerCounts {
+			counts[option] = count
+		}
+		return &AnswerTally{
+			TotalParticipants: dbCounts.TotalParticipants,
+			AnsweredCount:     dbCounts.AnsweredCount,
+			AnswerCounts:      counts,
+		}, nil
+	})
+
+	aggregator.RecordAnswer(2, "", "A")
+	aggregator.Flush()
+
+	// Another replica accepted answers that this process never saw
+	dbCounts.AnsweredCount = 4
+	dbCounts.AnswerCounts = map[string]int{"A": 1, "D": 3}
+
+	aggregator.Reconcile()
+	aggregator.Flush()
+
+	if len(*published) != 2 {
+		t.Fatalf("Expected a broadcast after reconciliation, got %d", len(*published))
+	}
+	latest := (*published)[1]
+	if latest.answeredCount != 4 || latest.answerCounts["D"] != 3 {
+		t.Errorf("Expected database counts after reconciliation, got %+v", latest)
+	}
+
+	// Quizzes without new answers are not reloaded
+	aggregator.Reconcile()
+	aggregator.Flush()
+	if len(*published) != 2 {
+		t.Errorf("Expected no broadcast for an idle quiz, got %d", len(*published))
+	}
+}
+
+func TestAnswerAggregatorLoadFailure(t *testing.T) {
+	aggregator, published := newTestAggregator(func(_ int64) (*AnswerTally, error) {
+		return nil, errDatabaseNotInitialized
+	})
+
+	aggregator.RecordAnswer(3, "", "A")
+	aggregator.Flush()
+
+	if len(*published) != 0 {
+		t.Errorf("Expected no broadcast when counts cannot be loaded, got %d", len(*published))
+	}
+}
+
+func TestAnswerAggregatorReload(t *testing.T) {
+	dbCounts := &AnswerTally{TotalParticipants: 3, AnsweredCount: 2, AnswerCounts: map[string]int{"A": 1, "B": 1}}
+	aggregator, published := newTestAggregator(func(_ int64) (*AnswerTally, error) {
+		return &AnswerTally{
+			TotalParticipants: dbCounts.TotalParticipants,
+			AnsweredCount:     dbCounts.AnsweredCount,
+			AnswerCounts:      map[string]int{"A": dbCounts.AnswerCounts["A"], "B": dbCounts.AnswerCounts["B"]},
+		}, nil
+	})
+
+	// Quizzes without a tally are left to be seeded by the next submission
+	aggregator.Reload(5)
+	aggregator.Flush()
+	if len(*published) != 0 {
+		t.Fatalf("Expected no broadcast for an unknown quiz, got %d", len(*published))
+	}
+
+	aggregator.RecordAnswer(5, "", "B")
+	aggregator.Flush()
+
+	// An admin excluded the participant who answered A
+	dbCounts.TotalParticipants = 2
+	dbCounts.AnsweredCount = 1
+	dbCounts.AnswerCounts = map[string]int{"B": 1}
+
+	aggregator.Reload(5)
+	aggregator.Flush()
+
+	if len(*published) != 2 {
+		t.Fatalf("Expected a broadcast after reload, got %d", len(*published))
+	}
+	latest := (*published)[1]
+	if latest.totalParticipants != 2 || latest.answeredCount != 1 || latest.answerCounts["A"] != 0 {
+		t.Errorf("Expected reloaded counts, got %+v", latest)
+	}
+}
+
+func TestAnswerAggregatorRefreshPresence(t *testing.T) {
+	connected := 10
+	aggregator, published := newTestAggregator(func(_ int64) (*AnswerTally, error) {
+		return &AnswerTally{TotalParticipants: 12, ConnectedParticipants: connected, AnsweredCount: 1, AnswerCounts: map[string]int{"A": 1}}, nil
+	})
+
+	aggregator.RecordAnswer(6, "", "A")
+	aggregator.Flush()
+	aggregator.Reconcile()
+	aggregator.Flush()
+	if len(*published) != 1 {
+		t.Fatalf("Expected one broadcast, got %d", len(*published))
+	}
+
+	// Without new answers a reconciliation only follows a presence change
+	connected = 7
+	aggregator.Reconcile()
+	aggregator.Flush()
+	if len(*published) != 1 {
+		t.Fatalf("Expected no broadcast before the presence refresh, got %d", len(*published))
+	}
+
+	aggregator.RefreshPresence()
+	aggregator.Reconcile()
+	aggregator.Flush()
+	if len(*published) != 2 {
+		t.Fatalf("Expected a broadcast after the presence refresh, got %d", len(*published))
+	}
+	latest := (*published)[1]
+	if latest.connectedParticipants != 7 || latest.totalParticipants != 12 {
+		t.Errorf("Expected the refreshed connected count, got %+v", latest)
+	}
+}
+
+func TestAnswerAggregatorSkippedAnswers(t *testing.T) {
+	aggregator, published := newTestAggregator(func(_ int64) (*AnswerTally, error) {
+		return &AnswerTally{TotalParticipants: 5, AnsweredCount: 1, AnswerCounts: map[string]int{"A": 1}}, nil
+	})
+
+	aggregator.RecordAnswer(7, "", "A")
+	aggregator.RecordAnswer(7, "", "B")
+	aggregator.RecordAnswer(7, "", "")  // skipped without answering
+	aggregator.RecordAnswer(7, "B", "") // answer replaced by a skip
+	aggregator.Flush()
+
+	if len(*published) != 1 {
+		t.Fatalf("Expected one broadcast, got %d", len(*published))
+	}
+	status := (*published)[0]
+	if status.answeredCount != 3 {
+		t.Errorf("Expected skipped questions to count as answered, got %d", status.answeredCount)
+	}
+	if status.answerCounts["A"] != 1 || status.answerCounts["B"] != 0 || len(status.answerCounts) != 2 {
+		t.Errorf("Expected skipped questions not to count towards an option, got %v", status.answerCounts)
+	}
+}
+
+func TestSameTally(t *testing.T) {
+	base := &AnswerTally{AnsweredCount: 2, AnswerCounts: map[string]int{"A": 1, "E": 1}}
+	for _, tt := range []struct {
+		counts map[string]int
+		want   bool
+	}{
+		{map[string]int{"A": 1, "E": 1}, true},
+		{map[string]int{"A": 1, "E": 1, "B": 0}, true},
+		{map[string]int{"A": 1, "F": 1}, false},
+		{map[string]int{"A": 2}, false},
+	} {
+		other := &AnswerTally{AnsweredCount: 2, AnswerCounts: tt.counts}
+		if got := sameTally(base, other); got != tt.want {
+			t.Errorf("sameTally(%v, %v) = %v, want %v", base.AnswerCounts, tt.counts, got, tt.want)
+		}
+	}
+}
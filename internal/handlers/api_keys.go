@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// ListAPIKeys lists every API key with its permissions, expiry and last use (owner only).
+// Keys themselves are never shown again after creation.
+func ListAPIKeys(c *gin.Context) {
+	keys, err := services.NewAPIKeyService().ListAPIKeys()
+	if err != nil {
+		respondAdminError(c, err, "Failed to list API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    keys,
+	})
+}
+
+// CreateAPIKey creates an API key that acts for the signed-in owner with the requested
+// permissions (owner only). The key is returned only in this response.
+func CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: []models.ValidationError{{Field: "expires_at", Message: "有効期限は未来の日時を指定してください"}},
+			},
+		})
+		return
+	}
+
+	adminID, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	apiKey, key, err := services.NewAPIKeyService().CreateAPIKey(adminID, req.Name, req.Permissions, req.ExpiresAt)
+	if err != nil {
+		respondAdminError(c, err, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "APIキーを作成しました。キーは再表示できないため安全な場所に保存してください",
+		Data: models.CreateAPIKeyResponse{
+			APIKey: *apiKey,
+			Key:    key,
+		},
+	})
+}
+
+// RevokeAPIKey revokes an API key immediately (owner only)
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid API key ID",
+			},
+		})
+		return
+	}
+
+	apiKey, err := services.NewAPIKeyService().RevokeAPIKey(id)
+	if err != nil {
+		respondAdminError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "APIキーを無効にしました",
+		Data:    apiKey,
+	})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/middleware"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	suffix := os.Getpid()
+	owner, err := services.NewAuthService().CreateAdmin(fmt.Sprintf("keyowner%d", suffix), "ownerpassword", fmt.Sprintf("keyowner%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create owner: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", owner.ID)
+	}()
+	tokens, err := newSessionService().StartSession(owner)
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: gin.H{"admin_id": c.GetInt64("admin_id")}})
+	}
+	router := gin.New()
+	admin := router.Group("/api/admin")
+	admin.Use(middleware.JWTAuth(jwtService))
+	admin.GET("/quizzes", middleware.RequirePermission(middleware.PermissionRead), ok)
+	admin.POST("/quizzes", middleware.RequirePermission(middleware.PermissionEditQuizzes), ok)
+	admin.POST("/session/start", middleware.RequirePermission(middleware.PermissionRunSession), ok)
+	admin.PUT("/me/password", middleware.RequireInteractiveLogin(), ok)
+	admin.GET("/api-keys", middleware.RequirePermission(middleware.PermissionManageAdmins), ListAPIKeys)
+	admin.POST("/api-keys", middleware.RequirePermission(middleware.PermissionManageAdmins), CreateAPIKey)
+	admin.DELETE("/api-keys/:id", middleware.RequirePermission(middleware.PermissionManageAdmins), RevokeAPIKey)
+
+	request := func(method, path string, header http.Header, requestBody interface{}) (*httptest.ResponseRecorder, models.APIResponse) {
+		body, _ := json.Marshal(requestBody)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header = header
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+	asOwner := http.Header{"Authorization": {"Bearer " + tokens.AccessToken}}
+
+	// オーナーがキーを作成する。キーには管理者の管理を許可できない
+	w, _ := request("POST", "/api/admin/api-keys", asOwner, models.CreateAPIKeyRequest{Name: "CI", Permissions: []string{"manage_admins"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected manage_admins to be rejected, got %d", w.Code)
+	}
+	past := time.Now().Add(-time.Hour)
+	w, _ = request("POST", "/api/admin/api-keys", asOwner, models.CreateAPIKeyRequest{Name: "CI", Permissions: []string{"read"}, ExpiresAt: &past})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a past expiry to be rejected, got %d", w.Code)
+	}
+	w, _ = request("POST", "/api/admin/api-keys", asOwner, models.CreateAPIKeyRequest{Name: "CI", Permissions: []string{"read", "edit_quizzes"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create API key: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data models.CreateAPIKeyResponse `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	key := created.Data.Key
+
+	// キーはBearerトークンとしてもX-API-Keyヘッダーとしても使え、作成したオーナーとして動作する
+	for _, header := range []http.Header{{"Authorization": {"Bearer " + key}}, {middleware.APIKeyHeader: {key}}} {
+		w, response := request("GET", "/api/admin/quizzes", header, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected the API key to be accepted, got %d %s", w.Code, w.Body.String())
+		}
+		if data, _ := response.Data.(map[string]interface{}); data["admin_id"] != float64(owner.ID) {
+			t.Errorf("Expected the key to act for the owner, got %v", response.Data)
+		}
+	}
+	asKey := http.Header{middleware.APIKeyHeader: {key}}
+	if w, _ := request("POST", "/api/admin/quizzes", asKey, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected a granted permission to be allowed, got %d", w.Code)
+	}
+
+	// キーに許可されていない操作・自分のアカウントの操作・キーの管理はできない
+	for _, tt := range []struct {
+		method, path, code string
+	}{
+		{"POST", "/api/admin/session/start", "INSUFFICIENT_PERMISSION"},
+		{"PUT", "/api/admin/me/password", "API_KEY_NOT_ALLOWED"},
+		{"GET", "/api/admin/api-keys", "INSUFFICIENT_PERMISSION"},
+	} {
+		w, response := request(tt.method, tt.path, asKey, nil)
+		if w.Code != http.StatusForbidden || response.Error == nil || response.Error.Code != tt.code {
+			t.Errorf("%s %s: expected 403 %s, got %d %s", tt.method, tt.path, tt.code, w.Code, w.Body.String())
+		}
+	}
+
+	// 無効にしたキーは使えない
+	if w, _ := request("DELETE", fmt.Sprintf("/api/admin/api-keys/%d", created.Data.APIKey.ID), asOwner, nil); w.Code != http.StatusOK {
+		t.Fatalf("Failed to revoke API key: %d %s", w.Code, w.Body.String())
+	}
+	w, response := request("GET", "/api/admin/quizzes", asKey, nil)
+	if w.Code != http.StatusUnauthorized || response.Error == nil || response.Error.Code != "INVALID_API_KEY" {
+		t.Errorf("Expected a revoked key to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// Audit log export formats
+const (
+	AuditExportFormatCSV   = "csv"
+	AuditExportFormatJSONL = "jsonl"
+)
+
+// recordAudit adds an administrator action to the audit log with the signed-in administrator,
+// the API key if one was used, and the request ID set by middleware.RequestID. before and after
+// are the target's state around the action; nil means there was none. The action has already
+// been applied, so a failure is logged rather than returned.
+func recordAudit(c *gin.Context, action, targetType string, targetID *int64, before, after interface{}) {
+	entry := models.AuditLog{
+		AdminID:    adminIDFromContext(c),
+		Username:   c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     auditState(before),
+		After:      auditState(after),
+		RequestID:  c.GetString("request_id"),
+		IPAddress:  c.ClientIP(),
+	}
+	if apiKeyID, ok := c.Get("api_key_id"); ok {
+		if id, ok := apiKeyID.(int64); ok {
+			entry.APIKeyID = &id
+		}
+	}
+
+	if err := services.NewAuditService().Record(entry); err != nil {
+		log.Printf("Failed to record audit log %s: %v", action, err)
+	}
+}
+
+// auditState encodes the state of an audit target, or returns nil if there is none
+func auditState(state interface{}) json.RawMessage {
+	if state == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil || string(encoded) == "null" {
+		return nil
+	}
+	return encoded
+}
+
+// sessionAuditState returns the state of the current session for the audit log, or nil if there
+// is no session
+func sessionAuditState(db *sql.DB) map[string]interface{} {
+	var sessionID int64
+	var currentQuizID *int64
+	var isAcceptingAnswers bool
+	var status, gameMode string
+	err := db.QueryRow(`SELECT id, current_quiz_id, is_accepting_answers, status, game_mode
+						FROM quiz_sessions ORDER BY id DESC LIMIT 1`).
+		Scan(&sessionID, &currentQuizID, &isAcceptingAnswers, &status, &gameMode)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get session state for audit log: %v", err)
+		}
+		return nil
+	}
+
+	return map[string]interface{}{
+		"session_id":           sessionID,
+		"current_quiz_id":      currentQuizID,
+		"is_accepting_answers": isAcceptingAnswers,
+		"status":               status,
+		"game_mode":            gameMode,
+	}
+}
+
+// sessionAuditTarget returns the session ID of a session audit state, or nil
+func sessionAuditTarget(state map[string]interface{}) *int64 {
+	if id, ok := state["session_id"].(int64); ok {
+		return &id
+	}
+	return nil
+}
+
+// auditLogFilter reads the audit log filter from the query parameters admin_id, action,
+// target_type, target_id, request_id and from/to (RFC 3339). It responds with 400 and
+// returns false if a parameter is invalid.
+func auditLogFilter(c *gin.Context) (services.AuditLogFilter, bool) {
+	params := newQueryFilter(c)
+	filter := services.AuditLogFilter{
+		AdminID:    params.id("admin_id"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   params.id("target_id"),
+		RequestID:  c.Query("request_id"),
+		From:       params.time("from"),
+		To:         params.time("to"),
+	}
+	return filter, params.ok()
+}
+
+// GetAuditLogs returns administrator actions, newest first (owner only).
+// Filter with admin_id, action, target_type, target_id, request_id and the from/to time range (RFC 3339).
+func GetAuditLogs(c *gin.Context) {
+	page, limit, _ := getPaginationParams(c)
+
+	filter, ok := auditLogFilter(c)
+	if !ok {
+		return
+	}
+
+	logs, total, err := services.NewAuditService().ListLogs(filter, page, limit)
+	if err != nil {
+		log.Printf("Failed to query audit logs: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query audit logs",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.PaginatedResponse{
+			Data:  logs,
+			Total: total,
+			Page:  page,
+			Limit: limit,
+		},
+	})
+}
+
+// ExportAuditLogs downloads every administrator action matching the same filters as
+// GetAuditLogs, oldest first, as CSV (format=csv, the default) or JSON Lines (format=jsonl)
+// (owner only).
+func ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", AuditExportFormatCSV)
+	if format != AuditExportFormatCSV && format != AuditExportFormatJSONL {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_PARAMETER",
+				Message: "Invalid format",
+			},
+		})
+		return
+	}
+
+	filter, ok := auditLogFilter(c)
+	if !ok {
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == AuditExportFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-log-%s.%s"`, time.Now().Format("20060102-150405"), format))
+	c.Status(http.StatusOK)
+
+	// Entries are streamed, so errors after the first entry can only be logged
+	var write func(models.AuditLog) error
+	var flush func() error
+	if format == AuditExportFormatJSONL {
+		encoder := json.NewEncoder(c.Writer)
+		write = func(entry models.AuditLog) error { return encoder.Encode(entry) }
+		flush = func() error { return nil }
+	} else {
+		writer := csv.NewWriter(c.Writer)
+		_ = writer.Write([]string{"id", "created_at", "admin_id", "username", "api_key_id", "action",
+			"target_type", "target_id", "request_id", "ip_address", "before", "after"})
+		write = func(entry models.AuditLog) error { return writer.Write(auditLogCSVRecord(entry)) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	}
+
+	err := services.NewAuditService().ExportLogs(filter, write)
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.Printf("Failed to export audit logs: %v", err)
+	}
+}
+
+// auditLogCSVRecord returns the CSV columns of an audit log entry
+func auditLogCSVRecord(entry models.AuditLog) []string {
+	optionalID := func(id *int64) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatInt(*id, 10)
+	}
+	return []string{
+		strconv.FormatInt(entry.ID, 10),
+		entry.CreatedAt.UTC().Format(time.RFC3339),
+		optionalID(entry.AdminID),
+		entry.Username,
+		optionalID(entry.APIKeyID),
+		entry.Action,
+		entry.TargetType,
+		optionalID(entry.TargetID),
+		entry.RequestID,
+		entry.IPAddress,
+		string(entry.Before),
+		string(entry.After),
+	}
+}
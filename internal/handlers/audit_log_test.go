@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/middleware"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditState(t *testing.T) {
+	var quiz *models.Quiz
+	if state := auditState(quiz); state != nil {
+		t.Errorf("Expected no state for a nil quiz, got %s", state)
+	}
+	if state := auditState(nil); state != nil {
+		t.Errorf("Expected no state for nil, got %s", state)
+	}
+	if state := auditState(map[string]interface{}{"status": "active"}); string(state) != `{"status":"active"}` {
+		t.Errorf("Unexpected state %s", state)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	suffix := os.Getpid()
+	owner, err := services.NewAuthService().CreateAdmin(fmt.Sprintf("auditowner%d", suffix), "ownerpassword", fmt.Sprintf("auditowner%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create owner: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM audit_logs WHERE admin_id = $1", owner.ID)
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", owner.ID)
+	}()
+	tokens, err := newSessionService().StartSession(owner)
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	admin := router.Group("/api/admin")
+	admin.Use(middleware.JWTAuth(jwtService))
+	admin.POST("/quizzes", CreateQuiz)
+	admin.PUT("/quizzes/:id", UpdateQuiz)
+	admin.DELETE("/quizzes/:id", DeleteQuiz)
+	admin.GET("/audit-logs", GetAuditLogs)
+	admin.GET("/audit-logs/export", ExportAuditLogs)
+
+	request := func(method, path, requestID string, requestBody interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(requestBody)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		if requestID != "" {
+			req.Header.Set(middleware.RequestIDHeader, requestID)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 問題の作成・更新・削除を記録する
+	requestID := fmt.Sprintf("audit-test-%d", suffix)
+	quiz := models.QuizRequest{QuestionText: "監査ログの確認", OptionA: "A", OptionB: "B", OptionC: "C", OptionD: "D", CorrectAnswer: "A"}
+	w := request("POST", "/api/admin/quizzes", requestID+"-create", quiz)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create quiz: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data models.Quiz `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	quizID := created.Data.ID
+
+	quiz.CorrectAnswer = "B"
+	if w := request("PUT", fmt.Sprintf("/api/admin/quizzes/%d", quizID), requestID+"-update", quiz); w.Code != http.StatusOK {
+		t.Fatalf("Failed to update quiz: %d %s", w.Code, w.Body.String())
+	}
+	if w := request("DELETE", fmt.Sprintf("/api/admin/quizzes/%d", quizID), requestID+"-delete", nil); w.Code != http.StatusOK {
+		t.Fatalf("Failed to delete quiz: %d %s", w.Code, w.Body.String())
+	}
+
+	// 対象で絞り込むと新しい順に3件
+	w = request("GET", fmt.Sprintf("/api/admin/audit-logs?target_type=quiz&target_id=%d", quizID), "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to get audit logs: %d %s", w.Code, w.Body.String())
+	}
+	var page struct {
+		Data struct {
+			Data  []models.AuditLog `json:"data"`
+			Total int               `json:"total"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Data.Total != 3 || len(page.Data.Data) != 3 {
+		t.Fatalf("Expected 3 audit logs, got %d", page.Data.Total)
+	}
+	actions := []string{services.AuditActionQuizDelete, services.AuditActionQuizUpdate, services.AuditActionQuizCreate}
+	for i, entry := range page.Data.Data {
+		if entry.Action != actions[i] || entry.AdminID == nil || *entry.AdminID != owner.ID || entry.Username != owner.Username {
+			t.Errorf("Unexpected audit log %+v, want action %s by the owner", entry, actions[i])
+		}
+	}
+	deleted, updated, createdLog := page.Data.Data[0], page.Data.Data[1], page.Data.Data[2]
+	if createdLog.Before != nil || createdLog.After == nil || deleted.Before == nil || deleted.After != nil {
+		t.Errorf("Expected no state before creation and after deletion, got %+v / %+v", createdLog, deleted)
+	}
+	var before, after models.Quiz
+	_ = json.Unmarshal(updated.Before, &before)
+	_ = json.Unmarshal(updated.After, &after)
+	if before.CorrectAnswer != "A" || after.CorrectAnswer != "B" {
+		t.Errorf("Expected the update to record the change, got %s -> %s", updated.Before, updated.After)
+	}
+	if updated.RequestID != requestID+"-update" {
+		t.Errorf("Expected request ID %s, got %s", requestID+"-update", updated.RequestID)
+	}
+
+	// リクエストIDで絞り込む
+	w = request("GET", "/api/admin/audit-logs?request_id="+requestID+"-delete", "", nil)
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Data.Total != 1 || page.Data.Data[0].Action != services.AuditActionQuizDelete {
+		t.Errorf("Expected the delete to be found by request ID, got %+v", page.Data.Data)
+	}
+
+	// 不正な絞り込み
+	if w := request("GET", "/api/admin/audit-logs?from=yesterday", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid filter to be rejected, got %d", w.Code)
+	}
+	if w := request("GET", "/api/admin/audit-logs/export?format=xml", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid format to be rejected, got %d", w.Code)
+	}
+
+	// CSVでは古い順に見出し行と3件
+	w = request("GET", fmt.Sprintf("/api/admin/audit-logs/export?target_type=quiz&target_id=%d", quizID), "", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("Failed to export CSV: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(records) != 4 || records[0][0] != "id" || records[1][5] != services.AuditActionQuizCreate {
+		t.Errorf("Unexpected CSV export %v (%v)", records, err)
+	}
+
+	// JSON Linesでは1行に1件
+	w = request("GET", fmt.Sprintf("/api/admin/audit-logs/export?format=jsonl&target_type=quiz&target_id=%d", quizID), "", nil)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var last models.AuditLog
+	if len(lines) != 3 || json.Unmarshal([]byte(lines[2]), &last) != nil || last.Action != services.AuditActionQuizDelete {
+		t.Errorf("Unexpected JSON Lines export %s", w.Body.String())
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, ".jsonl") {
+		t.Errorf("Expected a JSON Lines attachment, got %q", disposition)
+	}
+}
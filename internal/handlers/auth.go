@@ -2,6 +2,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -26,12 +28,33 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
+	// Locked usernames and addresses are refused before the password is checked
+	guard := services.NewLoginGuard()
+	if loginLocked(c, guard, req.Username) {
+		return
+	}
+
 	authService := services.NewAuthService()
-	jwtService := services.NewJWTService()
 
 	// Authenticate user
 	admin, err := authService.AuthenticateAdmin(req.Username, req.Password)
+	if errors.Is(err, services.ErrAdminDisabled) {
+		recordLoginEvent(c, guard, nil, req.Username, false, services.LoginReasonAdminDisabled)
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "ADMIN_DISABLED",
+				Message: "This administrator account has been disabled",
+			},
+		})
+		return
+	}
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			recordLoginFailure(c, guard, req.Username, services.LoginReasonInvalidCredentials)
+		} else {
+			log.Printf("Failed to authenticate admin: %v", err)
+		}
 		c.JSON(http.StatusUnauthorized, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
@@ -42,9 +65,16 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token pair
-	response, err := jwtService.GenerateTokenPair(admin)
+	// Administrators with two-factor authentication, or who must set it up, continue with
+	// a challenge token instead of receiving tokens
+	if continueWithTwoFactor(c, admin) {
+		return
+	}
+
+	// Generate JWT token pair in a new session
+	response, err := newSessionService().StartSession(admin)
 	if err != nil {
+		log.Printf("Failed to start session: %v", err)
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
@@ -55,6 +85,8 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
+	recordLoginSuccess(c, guard, admin, services.LoginReasonPassword)
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "ログインに成功しました",
@@ -65,8 +97,7 @@ func AdminLogin(c *gin.Context) {
 // AdminLogout handles admin logout
 func AdminLogout(c *gin.Context) {
 	// Get token from context (set by JWT middleware)
-	token, exists := c.Get("token")
-	if !exists {
+	if _, exists := c.Get("token_claims"); !exists {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
@@ -77,8 +108,23 @@ func AdminLogout(c *gin.Context) {
 		return
 	}
 
-	// Add token to blacklist
-	middleware.BlacklistToken(token.(string))
+	// Revoke the access token until it expires, and end its session so that
+	// its refresh token can no longer be used
+	err := middleware.LogoutUser(c)
+	if claims := c.MustGet("token_claims").(*models.JWTClaims); err == nil && claims.ID != "" {
+		err = newSessionService().EndSession(claims.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "LOGOUT_ERROR",
+				Message: "Failed to revoke token",
+			},
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -86,7 +132,8 @@ func AdminLogout(c *gin.Context) {
 	})
 }
 
-// RefreshToken handles token refresh
+// RefreshToken handles token refresh. The refresh token is rotated: it can be used only
+// once, and using it again revokes its session on every device that holds it.
 func RefreshToken(c *gin.Context) {
 	var req models.RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -101,26 +148,45 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	jwtService := services.NewJWTService()
-	authService := services.NewAuthService()
-
-	// Validate refresh token
-	claims, err := jwtService.ValidateRefreshToken(req.RefreshToken)
+	// Rotate the refresh token and generate a new pair with the current role
+	response, err := newSessionService().Refresh(req.RefreshToken)
 	if err != nil {
-		var errorCode, errorMessage string
-		switch err {
-		case services.ErrExpiredToken:
+		status, errorCode, errorMessage := http.StatusUnauthorized, "", ""
+		switch {
+		case errors.Is(err, services.ErrExpiredToken):
 			errorCode = "REFRESH_TOKEN_EXPIRED"
 			errorMessage = "Refresh token has expired"
-		case services.ErrInvalidTokenType:
+		case errors.Is(err, services.ErrInvalidTokenType):
 			errorCode = "INVALID_TOKEN_TYPE"
 			errorMessage = "Invalid token type"
-		default:
+		case errors.Is(err, services.ErrInvalidToken):
 			errorCode = "INVALID_REFRESH_TOKEN"
 			errorMessage = "Invalid refresh token"
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			errorCode = "REFRESH_TOKEN_REUSED"
+			errorMessage = "Refresh token was already used; the session has been revoked"
+		case errors.Is(err, services.ErrSessionRevoked):
+			errorCode = "SESSION_REVOKED"
+			errorMessage = "The session has been revoked"
+		case errors.Is(err, services.ErrAdminNotFound):
+			errorCode = "ADMIN_NOT_FOUND"
+			errorMessage = "Admin user not found"
+		case errors.Is(err, services.ErrAdminDisabled):
+			// Disabled administrators cannot refresh; their access tokens are revoked
+			errorCode = "ADMIN_DISABLED"
+			errorMessage = "This administrator account has been disabled"
+		case errors.Is(err, services.ErrTwoFactorSetupRequired):
+			status = http.StatusForbidden
+			errorCode = "TWO_FACTOR_SETUP_REQUIRED"
+			errorMessage = "Two-factor authentication is required; sign in again to set it up"
+		default:
+			log.Printf("Failed to refresh tokens: %v", err)
+			status = http.StatusInternalServerError
+			errorCode = "TOKEN_REFRESH_ERROR"
+			errorMessage = "Failed to refresh tokens"
 		}
 
-		c.JSON(http.StatusUnauthorized, models.APIResponse{
+		c.JSON(status, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
 				Code:    errorCode,
@@ -130,27 +196,40 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Get admin details
-	admin, err := authService.GetAdminByID(claims.AdminID)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.APIResponse{
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "トークンを更新しました",
+		Data:    response,
+	})
+}
+
+// LogoutAllDevices revokes every session of the signed-in administrator, including the
+// current one, so that no device can use or refresh its tokens
+func LogoutAllDevices(c *gin.Context) {
+	adminID := adminIDFromContext(c)
+	if adminID == nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
-				Code:    "ADMIN_NOT_FOUND",
-				Message: "Admin user not found",
+				Code:    "MISSING_TOKEN",
+				Message: "Token not found in request",
 			},
 		})
 		return
 	}
 
-	// Generate new token pair
-	response, err := jwtService.RefreshTokens(req.RefreshToken, admin)
+	revoked, err := newSessionService().RevokeAllSessions(*adminID, services.RevokeReasonLogoutAll, "")
+	if err == nil {
+		// Also covers a token issued before sessions were recorded
+		err = middleware.LogoutUser(c)
+	}
 	if err != nil {
+		log.Printf("Failed to log out all devices: %v", err)
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
-				Code:    "TOKEN_REFRESH_ERROR",
-				Message: "Failed to refresh tokens",
+				Code:    "LOGOUT_ERROR",
+				Message: "Failed to revoke sessions",
 			},
 		})
 		return
@@ -158,16 +237,41 @@ func RefreshToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
-		Message: "トークンを更新しました",
-		Data:    response,
+		Message: "すべての端末からログアウトしました",
+		Data: gin.H{
+			"revoked_sessions": revoked,
+		},
 	})
 }
 
+// GetJWKS serves the public keys that verify admin access tokens as a JSON Web Key Set,
+// including retired keys whose tokens may still be valid. It is empty with HS256 signing.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwtService.JWKS())
+}
+
+// jwtService signs and verifies admin tokens. It is set once by UseJWTService.
+var jwtService *services.JWTService
+
+// UseJWTService sets the service that signs and verifies admin tokens. It must be called
+// before the server starts handling requests.
+func UseJWTService(service *services.JWTService) {
+	jwtService = service
+}
+
+// newSessionService creates a session service that revokes access tokens in the
+// middleware's revocation store
+func newSessionService() *services.SessionService {
+	return services.NewSessionService(jwtService, middleware.TokenRevocationStore())
+}
+
 // VerifyToken verifies the current JWT token
 func VerifyToken(c *gin.Context) {
 	// Get admin info from context (set by JWT middleware)
 	adminID, _ := c.Get("admin_id")
 	username, _ := c.Get("username")
+	role, _ := c.Get("admin_role")
 
 	authService := services.NewAuthService()
 	admin, err := authService.GetAdminByID(adminID.(int64))
@@ -190,6 +294,7 @@ func VerifyToken(c *gin.Context) {
 			"context": map[string]interface{}{
 				"admin_id": adminID,
 				"username": username,
+				"role":     role,
 			},
 		},
 	})
@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/middleware"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+	middleware.UseRevocationStore(services.NewMemoryRevocationStore())
+
+	suffix := os.Getpid()
+	username := fmt.Sprintf("session%d", suffix)
+	admin, err := services.NewAuthService().CreateAdmin(username, "sessionpassword", fmt.Sprintf("session%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", admin.ID)
+	}()
+
+	router := gin.New()
+	router.POST("/api/auth/login", AdminLogin)
+	router.POST("/api/auth/refresh", RefreshToken)
+	authorized := router.Group("/api/admin", middleware.JWTAuth(jwtService))
+	authorized.GET("/verify", VerifyToken)
+	authorized.POST("/logout", AdminLogout)
+	authorized.POST("/logout-all", LogoutAllDevices)
+
+	request := func(method, path, token string, requestBody interface{}) (*httptest.ResponseRecorder, models.APIResponse) {
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+	errorCode := func(response models.APIResponse) string {
+		if response.Error == nil {
+			return ""
+		}
+		return response.Error.Code
+	}
+	login := func() models.LoginResponse {
+		w, _ := request("POST", "/api/auth/login", "", models.LoginRequest{Username: username, Password: "sessionpassword"})
+		var response struct {
+			Data models.LoginResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Login failed: %d %s", w.Code, w.Body.String())
+		}
+		return response.Data
+	}
+	refresh := func(refreshToken string) (*httptest.ResponseRecorder, models.RefreshTokenResponse, string) {
+		w, response := request("POST", "/api/auth/refresh", "", models.RefreshTokenRequest{RefreshToken: refreshToken})
+		var data struct {
+			Data models.RefreshTokenResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &data)
+		return w, data.Data, errorCode(response)
+	}
+
+	// 更新のたびにリフレッシュトークンが入れ替わる
+	laptop := login()
+	w, rotated, _ := refresh(laptop.RefreshToken)
+	if w.Code != http.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == laptop.RefreshToken {
+		t.Fatalf("Refresh failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := request("GET", "/api/admin/verify", rotated.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the rotated access token to work, got %d", w.Code)
+	}
+
+	// 使用済みのトークンが再び使われたらファミリー全体を失効させる
+	if w, _, code := refresh(laptop.RefreshToken); w.Code != http.StatusUnauthorized || code != "REFRESH_TOKEN_REUSED" {
+		t.Errorf("Expected reuse to be detected, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _, code := refresh(rotated.RefreshToken); w.Code != http.StatusUnauthorized || code != "SESSION_REVOKED" {
+		t.Errorf("Expected the family to be revoked, got %d %s", w.Code, w.Body.String())
+	}
+	if w, response := request("GET", "/api/admin/verify", rotated.AccessToken, nil); w.Code != http.StatusUnauthorized || errorCode(response) != "TOKEN_REVOKED" {
+		t.Errorf("Expected the family's access token to be revoked, got %d %s", w.Code, w.Body.String())
+	}
+
+	// ログアウトした端末のリフレッシュトークンは使えない。他の端末はそのまま
+	phone, tablet := login(), login()
+	if w, _ := request("POST", "/api/admin/logout", phone.AccessToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("Logout failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _, code := refresh(phone.RefreshToken); w.Code != http.StatusUnauthorized || code != "SESSION_REVOKED" {
+		t.Errorf("Expected a logged out session to be unable to refresh, got %d %s", w.Code, w.Body.String())
+	}
+	w, tablet2, _ := refresh(tablet.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected another device to stay signed in, got %d %s", w.Code, w.Body.String())
+	}
+
+	// すべての端末からログアウト
+	desktop := login()
+	w, response := request("POST", "/api/admin/logout-all", desktop.AccessToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Logout all failed: %d %s", w.Code, w.Body.String())
+	}
+	if data, _ := response.Data.(map[string]interface{}); data["revoked_sessions"] != float64(2) {
+		t.Errorf("Expected the tablet and desktop sessions to be revoked, got %v", response.Data)
+	}
+	for _, token := range []string{tablet2.AccessToken, desktop.AccessToken} {
+		if w, _ := request("GET", "/api/admin/verify", token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected every access token to be revoked, got %d", w.Code)
+		}
+	}
+	for _, token := range []string{tablet2.RefreshToken, desktop.RefreshToken} {
+		if w, _, code := refresh(token); w.Code != http.StatusUnauthorized || code != "SESSION_REVOKED" {
+			t.Errorf("Expected every refresh token to be revoked, got %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// 無効化するとその管理者のセッションはすべて失効する
+	session := login()
+	if _, err := services.NewAuthService().SetAdminDisabled(admin.ID, true); err != nil {
+		t.Fatalf("Failed to disable admin: %v", err)
+	}
+	revokeAdminSessions(admin.ID, services.RevokeReasonDisabled, "")
+	if w, _ := request("GET", "/api/admin/verify", session.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a disabled admin's access token to be revoked, got %d", w.Code)
+	}
+}
+
+func TestAdminLoginTwoFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+	middleware.UseRevocationStore(services.NewMemoryRevocationStore())
+
+	suffix := os.Getpid()
+	username := fmt.Sprintf("twofactor%d", suffix)
+	admin, err := services.NewAuthService().CreateAdmin(username, "twofactorpassword", fmt.Sprintf("twofactor%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", admin.ID)
+		_, _ = db.Exec("DELETE FROM security_settings")
+		_, _ = db.Exec("DELETE FROM login_throttle WHERE key IN ('', $1)", username)
+	}()
+
+	router := gin.New()
+	router.POST("/api/auth/login", AdminLogin)
+	router.POST("/api/auth/login/2fa", AdminLoginTwoFactor)
+	router.POST("/api/auth/2fa/setup", BeginTwoFactorSetup)
+	authorized := router.Group("/api/admin", middleware.JWTAuth(jwtService))
+	authorized.GET("/verify", VerifyToken)
+
+	request := func(method, path, token string, requestBody interface{}, data interface{}) (*httptest.ResponseRecorder, string) {
+		body, _ := json.Marshal(requestBody)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		var response struct {
+			Data  interface{}      `json:"data"`
+			Error *models.APIError `json:"error"`
+		}
+		response.Data = data
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Error != nil {
+			return w, response.Error.Code
+		}
+		return w, ""
+	}
+	login := func() models.TwoFactorChallengeResponse {
+		var challenge models.TwoFactorChallengeResponse
+		w, _ := request("POST", "/api/auth/login", "", models.LoginRequest{Username: username, Password: "twofactorpassword"}, &challenge)
+		if w.Code != http.StatusOK || challenge.ChallengeToken == "" {
+			t.Fatalf("Expected a challenge, got %d %s", w.Code, w.Body.String())
+		}
+		return challenge
+	}
+
+	// 二段階認証が必須になると、未設定の管理者はログイン時に設定する
+	if _, err := services.NewTwoFactorService().UpdateSecuritySettings(true, admin.ID); err != nil {
+		t.Fatalf("Failed to require two-factor authentication: %v", err)
+	}
+	challenge := login()
+	if !challenge.TwoFactorSetupRequired || challenge.TwoFactorRequired {
+		t.Fatalf("Expected setup to be required, got %+v", challenge)
+	}
+	var enrollment models.TwoFactorEnrollment
+	if w, _ := request("POST", "/api/auth/2fa/setup", "", models.TwoFactorChallengeRequest{ChallengeToken: challenge.ChallengeToken}, &enrollment); w.Code != http.StatusOK {
+		t.Fatalf("Setup failed: %d %s", w.Code, w.Body.String())
+	}
+	now := time.Now()
+	code, _ := services.TOTPCode(enrollment.Secret, now)
+	var setupLogin models.TwoFactorLoginResponse
+	w, _ := request("POST", "/api/auth/login/2fa", "", models.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code}, &setupLogin)
+	if w.Code != http.StatusOK || setupLogin.AccessToken == "" || len(setupLogin.RecoveryCodes) != services.RecoveryCodeCount {
+		t.Fatalf("Expected tokens and recovery codes after setup, got %d %s", w.Code, w.Body.String())
+	}
+
+	// チャレンジトークンではAPIを使えない
+	if w, _ := request("GET", "/api/admin/verify", challenge.ChallengeToken, nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a challenge token to be rejected, got %d", w.Code)
+	}
+
+	// 設定後のログインは認証アプリのコードかリカバリーコードで完了する
+	challenge = login()
+	if !challenge.TwoFactorRequired || challenge.TwoFactorSetupRequired {
+		t.Fatalf("Expected a code to be required, got %+v", challenge)
+	}
+	if w, code := request("POST", "/api/auth/login/2fa", "", models.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: "12345"}, nil); w.Code != http.StatusUnauthorized || code != "INVALID_TWO_FACTOR_CODE" {
+		t.Errorf("Expected a wrong code to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	code, _ = services.TOTPCode(enrollment.Secret, now.Add(30*time.Second))
+	var codeLogin models.TwoFactorLoginResponse
+	if w, _ := request("POST", "/api/auth/login/2fa", "", models.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code}, &codeLogin); w.Code != http.StatusOK || codeLogin.AccessToken == "" {
+		t.Errorf("Expected the login to complete with a code, got %d %s", w.Code, w.Body.String())
+	}
+	if len(codeLogin.RecoveryCodes) != 0 {
+		t.Error("Expected recovery codes only after setup")
+	}
+	if w, code := request("POST", "/api/auth/login/2fa", "", models.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code}, nil); w.Code != http.StatusUnauthorized || code != "INVALID_TWO_FACTOR_CODE" {
+		t.Errorf("Expected a used code to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	var recoveryLogin models.TwoFactorLoginResponse
+	if w, _ := request("POST", "/api/auth/login/2fa", "", models.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: setupLogin.RecoveryCodes[0]}, &recoveryLogin); w.Code != http.StatusOK || recoveryLogin.AccessToken == "" {
+		t.Errorf("Expected the login to complete with a recovery code, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminLoginLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+	t.Setenv("LOGIN_MAX_FAILURES_PER_USER", "3")
+
+	suffix := os.Getpid()
+	username := fmt.Sprintf("lockout%d", suffix)
+	ip := fmt.Sprintf("198.51.100.%d", suffix%250)
+	admin, err := services.NewAuthService().CreateAdmin(username, "lockoutpassword", fmt.Sprintf("lockout%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", admin.ID)
+		_, _ = db.Exec("DELETE FROM login_throttle WHERE key IN ($1, $2)", username, ip)
+		_, _ = db.Exec("DELETE FROM login_events WHERE username = $1", username)
+	}()
+
+	router := gin.New()
+	router.POST("/api/auth/login", AdminLogin)
+	router.POST("/api/admin/admins/:id/unlock", UnlockAdminLogin)
+	router.GET("/api/admin/login-events", GetLoginEvents)
+
+	request := func(method, path string, requestBody interface{}) (*httptest.ResponseRecorder, models.APIResponse) {
+		body, _ := json.Marshal(requestBody)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "lockout-test")
+		req.RemoteAddr = ip + ":1234"
+		router.ServeHTTP(w, req)
+		var response models.APIResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+	login := func(password string) (*httptest.ResponseRecorder, models.APIResponse) {
+		return request("POST", "/api/auth/login", models.LoginRequest{Username: username, Password: password})
+	}
+
+	// 続けて失敗するとロックされ、正しいパスワードでも拒否する
+	for i := 0; i < 3; i++ {
+		if w, _ := login("wrongpassword"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected a wrong password to be rejected, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	w, response := login("lockoutpassword")
+	if w.Code != http.StatusTooManyRequests || response.Error == nil || response.Error.Code != "LOGIN_LOCKED" {
+		t.Fatalf("Expected the login to be locked, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// オーナーがロックを解除するとログインできる
+	if w, _ := request("POST", fmt.Sprintf("/api/admin/admins/%d/unlock", admin.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("Unlock failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := login("lockoutpassword"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the login to succeed after unlocking, got %d %s", w.Code, w.Body.String())
+	}
+
+	// ログインの記録: 失敗3回、ロック1回、成功1回
+	w, response = request("GET", "/api/admin/login-events?limit=100&username="+username, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to get login events: %d %s", w.Code, w.Body.String())
+	}
+	var events struct {
+		Data struct {
+			Data  []models.LoginEvent `json:"data"`
+			Total int                 `json:"total"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &events)
+	reasons := map[string]int{}
+	for _, event := range events.Data.Data {
+		reasons[event.Reason]++
+		if event.AdminID == nil || *event.AdminID != admin.ID || event.IPAddress != ip || event.UserAgent != "lockout-test" {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	}
+	if events.Data.Total != 5 || reasons[services.LoginReasonInvalidCredentials] != 3 ||
+		reasons[services.LoginReasonLockedOut] != 1 || reasons[services.LoginReasonPassword] != 1 {
+		t.Errorf("Unexpected login events %v (total %d)", reasons, events.Data.Total)
+	}
+	if events.Data.Data[0].Reason != services.LoginReasonPassword || !events.Data.Data[0].Success {
+		t.Errorf("Expected the newest event first, got %+v", events.Data.Data[0])
+	}
+
+	if w, _ := request("GET", "/api/admin/login-events?success=maybe", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid filter to be rejected, got %d", w.Code)
+	}
+}
+
+func TestOIDCLoginNotConfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OIDC_ISSUER_URL", "")
+
+	router := gin.New()
+	router.GET("/api/auth/oidc/login", OIDCLogin)
+	router.POST("/api/auth/oidc/callback", OIDCCallback)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"login", "GET", "/api/auth/oidc/login", "", http.StatusNotFound, "OIDC_NOT_CONFIGURED"},
+		{"callback", "POST", "/api/auth/oidc/callback", `{"code":"code","state":"state","browser_secret":"secret"}`, http.StatusNotFound, "OIDC_NOT_CONFIGURED"},
+		{"callback without state", "POST", "/api/auth/oidc/callback", `{"code":"code","browser_secret":"secret"}`, http.StatusBadRequest, "VALIDATION_ERROR"},
+		{"callback without browser secret", "POST", "/api/auth/oidc/callback", `{"code":"code","state":"state"}`, http.StatusBadRequest, "VALIDATION_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			var response models.APIResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &response)
+			if w.Code != tt.wantStatus || response.Error == nil || response.Error.Code != tt.wantCode {
+				t.Errorf("Expected %d %s, got %d %s", tt.wantStatus, tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
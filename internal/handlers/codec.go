@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket subprotocols selecting the message encoding.
+// Clients that request none get JSON.
+const (
+	SubprotocolJSON    = "quiz.json"
+	SubprotocolMsgpack = "quiz.msgpack"
+)
+
+// MessageCodec encodes and decodes WebSocket messages.
+// Every codec writes the same schema as JSON: field names come from the json struct tags,
+// so the message types in this package are the single definition for all encodings.
+type MessageCodec interface {
+	// Subprotocol is the negotiated WebSocket subprotocol name
+	Subprotocol() string
+	// FrameType is the WebSocket message type used for encoded messages
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return SubprotocolJSON }
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Subprotocol() string { return SubprotocolMsgpack }
+
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+// Marshal converts v to its JSON form first so that both encodings carry identical
+// fields and values (for example timestamps stay RFC 3339 strings), then packs it
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	generic, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// codecs lists the supported encodings in server preference order
+var codecs = []MessageCodec{msgpackCodec{}, jsonCodec{}}
+
+// codecForSubprotocol returns the codec for a negotiated subprotocol, defaulting to JSON
+func codecForSubprotocol(subprotocol string) MessageCodec {
+	for _, codec := range codecs {
+		if codec.Subprotocol() == subprotocol {
+			return codec
+		}
+	}
+	return jsonCodec{}
+}
+
+// subprotocols returns the subprotocol names offered during the WebSocket handshake
+func subprotocols() []string {
+	names := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		names = append(names, codec.Subprotocol())
+	}
+	return names
+}
+
+// compressionEnabled reports whether permessage-deflate is used when the client offers it
+var compressionEnabled = sync.OnceValue(func() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("WS_COMPRESSION"))
+	return err != nil || enabled
+})
+
+// toJSONValue round-trips v through JSON into maps, slices and scalars.
+// Integral numbers become int64 so that compact encodings can pack them tightly.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(generic), nil
+}
+
+// normalizeNumbers replaces json.Number values with int64 or float64
+func normalizeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		if f, err := value.Float64(); err == nil {
+			if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				return int64(f)
+			}
+			return f
+		}
+		return value.String()
+	}
+	return v
+}
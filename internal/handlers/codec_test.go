@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMessageCodecsShareSchema(t *testing.T) {
+	message := WebSocketMessage{
+		Type: "answer_status",
+		Data: AnswerStatusUpdate{
+			QuizID:            1,
+			QuestionID:        1,
+			TotalParticipants: 70,
+			AnsweredCount:     35,
+			AnswerCounts:      map[string]int{"A": 20, "B": 15},
+			UpdatedAt:         time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}
+
+	jsonPayload, err := jsonCodec{}.Marshal(message)
+	if err != nil {
+		t.Fatalf("Failed to encode JSON: %v", err)
+	}
+	msgpackPayload, err := msgpackCodec{}.Marshal(message)
+	if err != nil {
+		t.Fatalf("Failed to encode MessagePack: %v", err)
+	}
+	if len(msgpackPayload) >= len(jsonPayload) {
+		t.Errorf("Expected MessagePack (%d bytes) to be smaller than JSON (%d bytes)", len(msgpackPayload), len(jsonPayload))
+	}
+
+	var fromJSON, fromMsgpack map[string]interface{}
+	if err := json.Unmarshal(jsonPayload, &fromJSON); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if err := msgpack.Unmarshal(msgpackPayload, &fromMsgpack); err != nil {
+		t.Fatalf("Failed to decode MessagePack: %v", err)
+	}
+
+	data := fromMsgpack["data"].(map[string]interface{})
+	for key := range fromJSON["data"].(map[string]interface{}) {
+		if _, ok := data[key]; !ok {
+			t.Errorf("MessagePack payload is missing field %q", key)
+		}
+	}
+	if data["updated_at"] != "2024-01-01T10:00:00Z" {
+		t.Errorf("Expected timestamps in JSON form, got %v", data["updated_at"])
+	}
+	if answered, ok := data["answered_count"].(int8); !ok || answered != 35 {
+		t.Errorf("Expected a compact integer, got %T %v", data["answered_count"], data["answered_count"])
+	}
+}
+
+func TestWebSocketMsgpackSubprotocol(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/ws", WebSocketResults)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	dialer := websocket.Dialer{
+		Subprotocols:      []string{SubprotocolMsgpack},
+		EnableCompression: true,
+	}
+	conn, resp, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != SubprotocolMsgpack {
+		t.Fatalf("Expected subprotocol %s, got %q", SubprotocolMsgpack, conn.Subprotocol())
+	}
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("Expected permessage-deflate to be negotiated, got %q", ext)
+	}
+
+	heartbeat, err := msgpack.Marshal(map[string]interface{}{"type": "heartbeat"})
+	if err != nil {
+		t.Fatalf("Failed to encode heartbeat: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, heartbeat); err != nil {
+		t.Fatalf("Failed to send heartbeat: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	messageType, payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read heartbeat_ack: %v", err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Errorf("Expected a binary frame, got type %d", messageType)
+	}
+
+	var reply WebSocketMessage
+	if err := (msgpackCodec{}).Unmarshal(payload, &reply); err != nil {
+		t.Fatalf("Failed to decode reply: %v", err)
+	}
+	if reply.Type != "heartbeat_ack" {
+		t.Errorf("Expected heartbeat_ack, got %q", reply.Type)
+	}
+}
+
+func TestWebSocketDefaultsToJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/ws", WebSocketResults)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(WebSocketMessage{Type: "heartbeat"}); err != nil {
+		t.Fatalf("Failed to send heartbeat: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	messageType, payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read heartbeat_ack: %v", err)
+	}
+	if messageType != websocket.TextMessage {
+		t.Errorf("Expected a text frame, got type %d", messageType)
+	}
+
+	var reply WebSocketMessage
+	if err := json.Unmarshal(payload, &reply); err != nil {
+		t.Fatalf("Failed to decode reply: %v", err)
+	}
+	if reply.Type != "heartbeat_ack" {
+		t.Errorf("Expected heartbeat_ack, got %q", reply.Type)
+	}
+}
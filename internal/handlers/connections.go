@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/middleware"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultMaxConnections is the default maximum number of concurrent WebSocket and SSE connections
+	DefaultMaxConnections = 150 // 最大接続数 - Increased for performance testing
+	// DefaultReservedConnections is the default capacity held back for each privileged role
+	DefaultReservedConnections = 5
+	// DefaultConnectionRetryAfter is the default Retry-After hint for rejected connections
+	DefaultConnectionRetryAfter = 5 * time.Second
+)
+
+// Connection roles
+const (
+	RoleParticipant = "participant"
+	RoleProjector   = "projector"
+	RoleAdmin       = "admin"
+)
+
+// Connection limit names reported when a connection is rejected
+const (
+	LimitTotal      = "max_connections"
+	LimitPerSession = "max_connections_per_session"
+	LimitPerIP      = "max_connections_per_ip"
+)
+
+// ConnectionLimits configures how many real-time connections are accepted.
+// Per-session and per-IP limits apply to participants only; projector and admin
+// connections also draw on their reserved capacity so participants cannot lock them out.
+type ConnectionLimits struct {
+	MaxTotal      int            `json:"max_total"`
+	MaxPerSession int            `json:"max_per_session"` // 0 means unlimited
+	MaxPerIP      int            `json:"max_per_ip"`      // 0 means unlimited
+	Reserved      map[string]int `json:"reserved"`
+	RetryAfter    time.Duration  `json:"-"`
+}
+
+// LoadConnectionLimits reads the connection limits from environment variables
+func LoadConnectionLimits() ConnectionLimits {
+	return ConnectionLimits{
+		MaxTotal:      intFromEnv("WS_MAX_CONNECTIONS", DefaultMaxConnections),
+		MaxPerSession: intFromEnv("WS_MAX_CONNECTIONS_PER_SESSION", 0),
+		MaxPerIP:      intFromEnv("WS_MAX_CONNECTIONS_PER_IP", 0),
+		Reserved: map[string]int{
+			RoleProjector: intFromEnv("WS_RESERVED_PROJECTOR", DefaultReservedConnections),
+			RoleAdmin:     intFromEnv("WS_RESERVED_ADMIN", DefaultReservedConnections),
+		},
+		RetryAfter: durationFromEnv("WS_RETRY_AFTER_SECONDS", time.Second, DefaultConnectionRetryAfter),
+	}
+}
+
+// connectionLimits returns the process-wide limits, read once after the environment is loaded
+var connectionLimits = sync.OnceValue(LoadConnectionLimits)
+
+// intFromEnv reads a non-negative integer from the environment
+func intFromEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// admit checks whether c may join the given clients. The caller holds the hub lock.
+func (l ConnectionLimits) admit(c *Client, clients map[*Client]struct{}) (string, bool) {
+	byRole := make(map[string]int)
+	sameSession, sameIP := 0, 0
+	for other := range clients {
+		byRole[other.Role]++
+		if other.Role != RoleParticipant {
+			continue
+		}
+		if c.SessionID != 0 && other.SessionID == c.SessionID {
+			sameSession++
+		}
+		if other.RemoteIP == c.RemoteIP {
+			sameIP++
+		}
+	}
+
+	// Unused reservations of other roles are not available to this client
+	held := 0
+	for role, reserved := range l.Reserved {
+		if role != c.Role && reserved > byRole[role] {
+			held += reserved - byRole[role]
+		}
+	}
+	if len(clients)+held >= l.MaxTotal {
+		return LimitTotal, false
+	}
+
+	if c.Role == RoleParticipant {
+		if l.MaxPerSession > 0 && sameSession >= l.MaxPerSession {
+			return LimitPerSession, false
+		}
+		if l.MaxPerIP > 0 && sameIP >= l.MaxPerIP {
+			return LimitPerIP, false
+		}
+	}
+	return "", true
+}
+
+// ConnectionInfo describes a live WebSocket or SSE connection
+type ConnectionInfo struct {
+	ID            string    `json:"id"`
+	Transport     string    `json:"transport"`
+	Role          string    `json:"role"`
+	RemoteIP      string    `json:"remote_ip"`
+	SessionID     int64     `json:"session_id"`
+	ParticipantID int64     `json:"participant_id,omitempty"`
+	Subscriptions []int64   `json:"subscriptions"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	QueueDepth    int       `json:"queue_depth"`
+	QueueCapacity int       `json:"queue_capacity"`
+}
+
+// ConnectionsResponse represents the admin connection listing
+type ConnectionsResponse struct {
+	Total       int              `json:"total"`
+	ByRole      map[string]int   `json:"by_role"`
+	Limits      ConnectionLimits `json:"limits"`
+	Connections []ConnectionInfo `json:"connections"`
+}
+
+// GetConnections lists the live connections held by this API instance
+func GetConnections(c *gin.Context) {
+	clients := hub.Clients()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+
+	response := ConnectionsResponse{
+		Total:       len(clients),
+		ByRole:      make(map[string]int),
+		Limits:      connectionLimits(),
+		Connections: make([]ConnectionInfo, 0, len(clients)),
+	}
+
+	for _, client := range clients {
+		subscriptions := []int64{}
+		if quizID := client.QuizID(); quizID != nil {
+			subscriptions = append(subscriptions, *quizID)
+		}
+
+		response.ByRole[client.Role]++
+		response.Connections = append(response.Connections, ConnectionInfo{
+			ID:            client.ID,
+			Transport:     client.Transport,
+			Role:          client.Role,
+			RemoteIP:      client.RemoteIP,
+			SessionID:     client.SessionID,
+			ParticipantID: client.ParticipantID,
+			Subscriptions: subscriptions,
+			ConnectedAt:   client.ConnectedAt,
+			LastHeartbeat: client.LastHeartbeat(),
+			QueueDepth:    client.QueueDepth(),
+			QueueCapacity: cap(client.send),
+		})
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// newClientFromRequest builds a hub client from the connection request.
+// Projector and admin roles require an admin access token in the token query parameter.
+// Participants may pass their participant token in participant_token so that moderation
+// messages reach them; banned and kicked participants are refused. Participants are always
+// placed in the current session; only projectors and admins may choose one with session_id.
+// On failure the error response has already been written.
+func newClientFromRequest(c *gin.Context, transport string) (*Client, bool) {
+	client := newClient(transport, c.ClientIP())
+
+	role := c.DefaultQuery("role", RoleParticipant)
+	switch role {
+	case RoleParticipant:
+		if token := c.Query("participant_token"); token != "" {
+			claims, err := services.NewParticipantTokenService().ValidateToken(token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, models.APIResponse{
+					Success: false,
+					Error: &models.APIError{
+						Code:    "INVALID_TOKEN",
+						Message: "Invalid participant token",
+					},
+				})
+				return nil, false
+			}
+			client.ParticipantID = claims.ParticipantID
+		}
+	case RoleProjector, RoleAdmin:
+		if !isValidAdminToken(c.Request.Context(), c.Query("token")) {
+			c.JSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "INVALID_TOKEN",
+					Message: "A valid admin token is required for this role",
+				},
+			})
+			return nil, false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ROLE",
+				Message: "Role must be participant, projector or admin",
+			},
+		})
+		return nil, false
+	}
+	client.Role = role
+
+	// Participants count against the per-session limit, so they cannot pick their own session
+	if sessionIDStr := c.Query("session_id"); sessionIDStr != "" && role != RoleParticipant {
+		sessionID, err := strconv.ParseInt(sessionIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "INVALID_ID",
+					Message: "Invalid session ID",
+				},
+			})
+			return nil, false
+		}
+		client.SessionID = sessionID
+	} else {
+		client.SessionID = currentSessionID()
+	}
+
+	if client.Role == RoleParticipant && !checkParticipantAccess(c, database.GetDB(), client.ParticipantID) {
+		return nil, false
+	}
+
+	return client, true
+}
+
+// admitClient registers a client with the hub if the connection limits allow it.
+// Rejected requests get a 503 with a Retry-After hint.
+func admitClient(c *gin.Context, client *Client) bool {
+	limits := connectionLimits()
+	if reason, ok := hub.Admit(client, limits); !ok {
+		retryAfter := int(limits.RetryAfter / time.Second)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Data: gin.H{
+				"limit":       reason,
+				"retry_after": retryAfter,
+			},
+			Error: &models.APIError{
+				Code:    "CONNECTION_LIMIT_REACHED",
+				Message: "Maximum connections reached",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// isValidAdminToken reports whether token is a valid, unrevoked admin access token
+func isValidAdminToken(ctx context.Context, token string) bool {
+	if token == "" {
+		return false
+	}
+	claims, err := jwtService.ValidateAccessToken(token)
+	if err != nil {
+		return false
+	}
+	revoked, err := middleware.IsTokenRevoked(ctx, claims)
+	return err == nil && !revoked
+}
+
+// openSessionID returns the session that new participants join: the latest session unless it
+// has ended, or 0 if none is open. Participants who join while none is open have no session until
+// the next session is created and adopts them.
+func openSessionID() int64 {
+	db := database.GetDB()
+	if db == nil {
+		return 0
+	}
+
+	var sessionID int64
+	query := `SELECT id FROM quiz_sessions WHERE id = (SELECT MAX(id) FROM quiz_sessions) AND status <> $1`
+	if err := db.QueryRow(query, SessionStatusEnded).Scan(&sessionID); err != nil {
+		return 0
+	}
+	return sessionID
+}
+
+// currentSessionID returns the latest quiz session ID, or 0 if there is none
+func currentSessionID() int64 {
+	db := database.GetDB()
+	if db == nil {
+		return 0
+	}
+
+	var sessionID int64
+	if err := db.QueryRow("SELECT id FROM quiz_sessions ORDER BY id DESC LIMIT 1").Scan(&sessionID); err != nil {
+		return 0
+	}
+	return sessionID
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestClient(role, remoteIP string, sessionID int64) *Client {
+	client := newClient(TransportWebSocket, remoteIP)
+	client.Role = role
+	client.SessionID = sessionID
+	return client
+}
+
+func TestConnectionLimitsReserveCapacity(t *testing.T) {
+	h, err := NewHub(EventHistorySize, services.NewMemoryBroker())
+	if err != nil {
+		t.Fatalf("Failed to create hub: %v", err)
+	}
+	limits := ConnectionLimits{
+		MaxTotal: 4,
+		Reserved: map[string]int{RoleProjector: 1, RoleAdmin: 1},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, ok := h.Admit(newTestClient(RoleParticipant, "10.0.0.1", 1), limits); !ok {
+			t.Fatalf("Participant %d should be admitted", i)
+		}
+	}
+	if reason, ok := h.Admit(newTestClient(RoleParticipant, "10.0.0.2", 1), limits); ok || reason != LimitTotal {
+		t.Errorf("Participants must not use reserved capacity, got ok=%v reason=%q", ok, reason)
+	}
+
+	if _, ok := h.Admit(newTestClient(RoleProjector, "10.0.0.3", 1), limits); !ok {
+		t.Error("Projector should use its reserved capacity")
+	}
+	if _, ok := h.Admit(newTestClient(RoleAdmin, "10.0.0.4", 1), limits); !ok {
+		t.Error("Admin should use its reserved capacity")
+	}
+	if _, ok := h.Admit(newTestClient(RoleAdmin, "10.0.0.5", 1), limits); ok {
+		t.Error("Expected rejection once the hub is full")
+	}
+}
+
+func TestConnectionLimitsPerSessionAndIP(t *testing.T) {
+	limits := ConnectionLimits{MaxTotal: 100, MaxPerSession: 2, MaxPerIP: 1}
+	clients := map[*Client]struct{}{
+		newTestClient(RoleParticipant, "10.0.0.1", 1): {},
+		newTestClient(RoleProjector, "10.0.0.9", 1):   {},
+	}
+
+	if reason, ok := limits.admit(newTestClient(RoleParticipant, "10.0.0.1", 2), clients); ok || reason != LimitPerIP {
+		t.Errorf("Expected per-IP rejection, got ok=%v reason=%q", ok, reason)
+	}
+	if _, ok := limits.admit(newTestClient(RoleParticipant, "10.0.0.2", 1), clients); !ok {
+		t.Error("Projectors should not count toward the session limit")
+	}
+
+	clients[newTestClient(RoleParticipant, "10.0.0.2", 1)] = struct{}{}
+	if reason, ok := limits.admit(newTestClient(RoleParticipant, "10.0.0.3", 1), clients); ok || reason != LimitPerSession {
+		t.Errorf("Expected per-session rejection, got ok=%v reason=%q", ok, reason)
+	}
+	if _, ok := limits.admit(newTestClient(RoleProjector, "10.0.0.1", 1), clients); !ok {
+		t.Error("Per-session and per-IP limits should not apply to projectors")
+	}
+}
+
+func TestEventStreamRejectsOverLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previousHub, previousLimits := hub, connectionLimits
+	defer func() {
+		hub, connectionLimits = previousHub, previousLimits
+	}()
+	hub = newMemoryHub()
+	connectionLimits = func() ConnectionLimits {
+		return ConnectionLimits{MaxTotal: 1, RetryAfter: 7 * time.Second}
+	}
+	hub.Register(newTestClient(RoleParticipant, "10.0.0.1", 0))
+
+	router := gin.New()
+	router.GET("/api/events", EventStream)
+	router.GET("/api/admin/connections", GetConnections)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events?session_id=1", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "7" {
+		t.Errorf("Expected Retry-After 7, got %q", got)
+	}
+	var response models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Error == nil || response.Error.Code != "CONNECTION_LIMIT_REACHED" {
+		t.Errorf("Expected CONNECTION_LIMIT_REACHED, got %+v", response.Error)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events?role=admin", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for admin role without token, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/connections", nil))
+	var listing struct {
+		Data ConnectionsResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if listing.Data.Total != 1 || listing.Data.ByRole[RoleParticipant] != 1 {
+		t.Errorf("Unexpected connection listing %+v", listing.Data)
+	}
+	if len(listing.Data.Connections) != 1 || listing.Data.Connections[0].QueueCapacity != clientSendBuffer {
+		t.Errorf("Unexpected connection info %+v", listing.Data.Connections)
+	}
+}
+
+func TestParticipantSessionIgnoresQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	// セッション毎の上限は現在のセッションがある場合のみ数える
+	if currentSessionID() == 0 {
+		if _, err := db.Exec("INSERT INTO quiz_sessions (is_accepting_answers, status) VALUES (false, $1)", SessionStatusEnded); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	sessionID := currentSessionID()
+
+	previousHub, previousLimits := hub, connectionLimits
+	defer func() {
+		hub, connectionLimits = previousHub, previousLimits
+	}()
+	hub = newMemoryHub()
+	connectionLimits = func() ConnectionLimits {
+		return ConnectionLimits{MaxTotal: 10, MaxPerSession: 1, RetryAfter: time.Second}
+	}
+	hub.Register(newTestClient(RoleParticipant, "10.0.0.1", sessionID))
+
+	router := gin.New()
+	router.GET("/api/events", EventStream)
+
+	// 別のセッションを指定しても現在のセッションの上限を回避できない
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	w := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/events?session_id=%d", sessionID+1000), nil).WithContext(ctx)
+	router.ServeHTTP(w, request)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", w.Code)
+	}
+	var response struct {
+		Data struct {
+			Limit string `json:"limit"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Data.Limit != LimitPerSession {
+		t.Errorf("Expected %s, got %q", LimitPerSession, response.Data.Limit)
+	}
+}
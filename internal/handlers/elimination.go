@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Game modes
+const (
+	GameModeStandard    = "standard"
+	GameModeElimination = "elimination" // a wrong or missing answer knocks the participant out
+)
+
+// Reasons a participant is eliminated
+const (
+	EliminationReasonWrongAnswer = "wrong_answer"
+	EliminationReasonNoAnswer    = "no_answer"
+)
+
+// Reasons an elimination game ends by itself
+const (
+	EliminationEndLastSurvivor       = "last_survivor"
+	EliminationEndQuestionsExhausted = "questions_exhausted"
+)
+
+// survivorCondition selects the participants p still in an elimination game.
+// Participants whose answers are excluded no longer compete.
+const survivorCondition = `p.eliminated_at IS NULL AND p.kicked_at IS NULL AND NOT p.answers_excluded
+						   AND p.approval_status = 'approved'`
+
+// eliminationSession holds the parts of the current session an elimination game depends on
+type eliminationSession struct {
+	id            int64
+	status        string
+	gameMode      string
+	currentQuizID *int64
+	questionLimit *int
+}
+
+// loadCurrentEliminationSession loads the latest session
+func loadCurrentEliminationSession(db *sql.DB) (eliminationSession, error) {
+	var session eliminationSession
+	query := `SELECT id, status, game_mode, current_quiz_id, question_limit
+			  FROM quiz_sessions ORDER BY id DESC LIMIT 1`
+	err := db.QueryRow(query).Scan(&session.id, &session.status, &session.gameMode, &session.currentQuizID, &session.questionLimit)
+	return session, err
+}
+
+// eliminatedParticipant is a participant knocked out by a round
+type eliminatedParticipant struct {
+	id     int64
+	reason string
+}
+
+// eliminationRound is the outcome of judging one question
+type eliminationRound struct {
+	survivorsBefore int
+	eliminated      []eliminatedParticipant
+	voided          bool
+}
+
+// judgeEliminationRound eliminates the survivors who did not answer the question correctly.
+// Survivors who skipped the question with a lifeline stay in the game.
+// If nobody answered correctly the round is voided and everyone survives.
+// Each question is judged once per session; it returns nil if it was judged before.
+func judgeEliminationRound(db *sql.DB, sessionID, quizID int64) (*eliminationRound, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after commit
+	}()
+
+	// The unique round claims the question, so concurrent calls judge it once
+	var roundID int64
+	claimQuery := `INSERT INTO elimination_rounds (session_id, quiz_id, survivors_before, created_at)
+				   VALUES ($1, $2, 0, CURRENT_TIMESTAMP)
+				   ON CONFLICT (session_id, quiz_id) DO NOTHING
+				   RETURNING id`
+	if err := tx.QueryRow(claimQuery, sessionID, quizID).Scan(&roundID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	survivorsQuery := `SELECT p.id, a.is_correct, a.lifeline
+					   FROM participants p
+					   LEFT JOIN answers a ON a.participant_id = p.id AND a.quiz_id = $2
+					   WHERE p.session_id = $1 AND ` + survivorCondition + `
+					   FOR UPDATE OF p`
+
+	rows, err := tx.Query(survivorsQuery, sessionID, quizID)
+	if err != nil {
+		return nil, err
+	}
+
+	round := &eliminationRound{}
+	for rows.Next() {
+		var participantID int64
+		var isCorrect sql.NullBool
+		var lifeline sql.NullString
+		if err := rows.Scan(&participantID, &isCorrect, &lifeline); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		round.survivorsBefore++
+		switch {
+		case lifeline.String == LifelineSkip:
+			// Skipping is neutral
+		case !isCorrect.Valid:
+			round.eliminated = append(round.eliminated, eliminatedParticipant{participantID, EliminationReasonNoAnswer})
+		case !isCorrect.Bool:
+			round.eliminated = append(round.eliminated, eliminatedParticipant{participantID, EliminationReasonWrongAnswer})
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(round.eliminated) == round.survivorsBefore {
+		round.voided = true
+		round.eliminated = nil
+	}
+
+	if len(round.eliminated) > 0 {
+		ids := make([]int64, len(round.eliminated))
+		for i, eliminated := range round.eliminated {
+			ids[i] = eliminated.id
+		}
+		eliminateQuery := `UPDATE participants SET eliminated_at = CURRENT_TIMESTAMP, eliminated_quiz_id = $2
+						   WHERE id = ANY($1)`
+		if _, err := tx.Exec(eliminateQuery, pq.Array(ids), quizID); err != nil {
+			return nil, err
+		}
+	}
+
+	roundQuery := `UPDATE elimination_rounds SET survivors_before = $1, eliminated_count = $2, voided = $3 WHERE id = $4`
+	if _, err := tx.Exec(roundQuery, round.survivorsBefore, len(round.eliminated), round.voided, roundID); err != nil {
+		return nil, err
+	}
+
+	return round, tx.Commit()
+}
+
+// questionsExhausted reports whether an elimination game has used its question limit or,
+// without a limit, every question in the quiz bank
+func questionsExhausted(db *sql.DB, session eliminationSession) (bool, error) {
+	var rounds, remaining int
+	query := `SELECT (SELECT COUNT(*) FROM elimination_rounds WHERE session_id = $1),
+					 (SELECT COUNT(*) FROM quizzes q
+					  WHERE NOT EXISTS (SELECT 1 FROM elimination_rounds r WHERE r.session_id = $1 AND r.quiz_id = q.id))`
+	if err := db.QueryRow(query, session.id).Scan(&rounds, &remaining); err != nil {
+		return false, err
+	}
+	if session.questionLimit != nil && rounds >= *session.questionLimit {
+		return true, nil
+	}
+	return remaining == 0, nil
+}
+
+// eliminationStarted reports whether a question of the session has been judged, after which
+// new participants can only watch
+func eliminationStarted(db *sql.DB, sessionID int64) (bool, error) {
+	var started bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM elimination_rounds WHERE session_id = $1)", sessionID).Scan(&started)
+	return started, err
+}
+
+// closeEliminationRound judges the current question of an elimination game when answers close.
+// Eliminated participants get a private notice, everyone gets the survivor count, and the
+// session ends once one survivor remains or the questions run out.
+// Standard sessions and questions that were already judged are left alone.
+func closeEliminationRound(db *sql.DB) {
+	session, err := loadCurrentEliminationSession(db)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to load session for elimination: %v", err)
+		}
+		return
+	}
+	if session.gameMode != GameModeElimination || session.status != SessionStatusActive || session.currentQuizID == nil {
+		return
+	}
+
+	round, err := judgeEliminationRound(db, session.id, *session.currentQuizID)
+	if err != nil {
+		log.Printf("Failed to judge elimination round for quiz %d: %v", *session.currentQuizID, err)
+		return
+	}
+	if round == nil {
+		return
+	}
+
+	var endReason string
+	survivors := round.survivorsBefore - len(round.eliminated)
+	if survivors <= 1 {
+		endReason = EliminationEndLastSurvivor
+	} else if exhausted, err := questionsExhausted(db, session); err != nil {
+		log.Printf("Failed to count remaining questions: %v", err)
+	} else if exhausted {
+		endReason = EliminationEndQuestionsExhausted
+	}
+
+	if endReason != "" {
+		if err := endCurrentSession(db); err != nil {
+			log.Printf("Failed to end elimination game: %v", err)
+			endReason = ""
+		}
+	}
+
+	eliminatedAt := time.Now()
+	for _, eliminated := range round.eliminated {
+		BroadcastEliminationNotice(eliminated.id, EliminationNotice{
+			SessionID:    session.id,
+			QuizID:       *session.currentQuizID,
+			Reason:       eliminated.reason,
+			Survivors:    survivors,
+			EliminatedAt: eliminatedAt,
+		})
+	}
+
+	status, err := getSurvivorStatus(db, session.id)
+	if err != nil {
+		log.Printf("Failed to load survivors: %v", err)
+		return
+	}
+	BroadcastSurvivorUpdate(status)
+
+	if endReason != "" {
+		broadcastSessionEnded(map[string]interface{}{
+			"reason":  endReason,
+			"winners": status.Survivors,
+		})
+		BroadcastTeamRanking()
+	}
+}
+
+// getSurvivorStatus returns the survivors of a session and how the elimination game stands
+func getSurvivorStatus(db *sql.DB, sessionID int64) (*models.SurvivorStatus, error) {
+	status := &models.SurvivorStatus{
+		SessionID: sessionID,
+		GameMode:  GameModeStandard,
+		Survivors: []models.Survivor{},
+		UpdatedAt: time.Now(),
+	}
+
+	var sessionStatus string
+	sessionQuery := `SELECT s.game_mode, s.status, s.question_limit,
+						    (SELECT COUNT(*) FROM elimination_rounds r WHERE r.session_id = s.id)
+					 FROM quiz_sessions s WHERE s.id = $1`
+	err := db.QueryRow(sessionQuery, sessionID).Scan(&status.GameMode, &sessionStatus, &status.QuestionLimit, &status.RoundsPlayed)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	status.Finished = sessionStatus == SessionStatusEnded
+
+	var lastRound models.EliminationRoundSummary
+	roundQuery := `SELECT quiz_id, survivors_before, eliminated_count, voided, created_at
+				   FROM elimination_rounds WHERE session_id = $1
+				   ORDER BY id DESC LIMIT 1`
+	err = db.QueryRow(roundQuery, sessionID).Scan(
+		&lastRound.QuizID,
+		&lastRound.SurvivorsBefore,
+		&lastRound.EliminatedCount,
+		&lastRound.Voided,
+		&lastRound.JudgedAt,
+	)
+	switch {
+	case err == nil:
+		status.LastRound = &lastRound
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	eliminatedQuery := `SELECT COUNT(*) FROM participants
+						WHERE session_id = $1 AND eliminated_at IS NOT NULL AND kicked_at IS NULL`
+	if err := db.QueryRow(eliminatedQuery, sessionID).Scan(&status.EliminatedCount); err != nil {
+		return nil, err
+	}
+
+	survivorsQuery := `SELECT p.id, p.nickname, p.is_hidden, p.team_id
+					   FROM participants p
+					   WHERE p.session_id = $1 AND ` + survivorCondition + `
+					   ORDER BY p.created_at, p.id`
+
+	rows, err := db.Query(survivorsQuery, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	for rows.Next() {
+		var survivor models.Survivor
+		var isHidden bool
+		if err := rows.Scan(&survivor.ParticipantID, &survivor.Nickname, &isHidden, &survivor.TeamID); err != nil {
+			return nil, err
+		}
+		survivor.Nickname = displayNickname(survivor.Nickname, isHidden)
+		status.Survivors = append(status.Survivors, survivor)
+	}
+	status.SurvivorCount = len(status.Survivors)
+	return status, rows.Err()
+}
+
+// checkGameModeChangeable refuses to change the game mode once a question has been judged.
+// It writes an error response and returns false if the game mode must not change.
+func checkGameModeChangeable(c *gin.Context, db *sql.DB) bool {
+	started, err := eliminationStarted(db, currentSessionID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query session",
+			},
+		})
+		return false
+	}
+	if started {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "GAME_IN_PROGRESS",
+				Message: "The game mode cannot change after the first question has been judged",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// checkEliminationGameRunning refuses further questions once an elimination game has ended.
+// It writes an error response and returns false if the game is over.
+func checkEliminationGameRunning(c *gin.Context, db *sql.DB) bool {
+	session, err := loadCurrentEliminationSession(db)
+	if err != nil {
+		// NextQuestion reports a missing session itself
+		return true
+	}
+	if session.gameMode == GameModeElimination && session.status == SessionStatusEnded {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "GAME_OVER",
+				Message: "The elimination game has ended",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// GetSurvivors returns the survivors of an elimination game. The session defaults to the current one.
+func GetSurvivors(c *gin.Context) {
+	sessionID, ok := sessionIDQuery(c)
+	if !ok {
+		return
+	}
+
+	status, err := getSurvivorStatus(database.GetDB(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query survivors",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
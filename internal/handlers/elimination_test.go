@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEliminationGame(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	send := func(handler gin.HandlerFunc, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		c.Request, _ = http.NewRequest("POST", "/admin/session", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler(c)
+		return w
+	}
+	survivors := func() models.SurvivorStatus {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/session/survivors", nil)
+		GetSurvivors(c)
+		var response struct {
+			Data models.SurvivorStatus `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode survivors: %v", err)
+		}
+		return response.Data
+	}
+
+	// 出題数3問のサバイバル形式で参加受付を開始
+	gameMode, questionLimit := GameModeElimination, 3
+	if w := send(OpenLobby, models.LobbyRequest{GameMode: &gameMode, QuestionLimit: &questionLimit}); w.Code != http.StatusCreated {
+		t.Fatalf("Open lobby failed: %d %s", w.Code, w.Body.String())
+	}
+	defer func() {
+		// 後続のテストの参加者が観戦者にならないよう通常形式のセッションに戻す
+		_, _ = db.Exec("INSERT INTO quiz_sessions (is_accepting_answers, status) VALUES (false, $1)", SessionStatusEnded)
+	}()
+
+	register := func(nickname string) (int64, bool) {
+		w := send(RegisterParticipant, models.ParticipantRequest{Nickname: nickname})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data struct {
+				ParticipantID int64 `json:"participant_id"`
+				Eliminated    bool  `json:"eliminated"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data.ParticipantID, response.Data.Eliminated
+	}
+	suffix := os.Getpid()
+	var players [4]int64
+	for i := range players {
+		players[i], _ = register(fmt.Sprintf("Survivor%c%d", 'A'+i, suffix))
+	}
+	alice, bob, carol, dave := players[0], players[1], players[2], players[3]
+
+	var quizIDs [3]int64
+	for i := range quizIDs {
+		err := db.QueryRow(`INSERT INTO quizzes (question_text, option_a, option_b, option_c, option_d, correct_answer)
+							VALUES ('Elimination Question?', 'A', 'B', 'C', 'D', 'A')
+							RETURNING id`).Scan(&quizIDs[i])
+		if err != nil {
+			t.Fatalf("Failed to create test quiz: %v", err)
+		}
+	}
+	answer := func(participantID, quizID int64, correct bool) {
+		option := "A"
+		if !correct {
+			option = "B"
+		}
+		_, err := db.Exec(`INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct) VALUES ($1, $2, $3, $4)`,
+			participantID, quizID, option, correct)
+		if err != nil {
+			t.Fatalf("Failed to create test answer: %v", err)
+		}
+	}
+	closeAnswers := func() {
+		if w := send(ToggleAnswers, models.ToggleAnswersRequest{IsAcceptingAnswers: false}); w.Code != http.StatusOK {
+			t.Fatalf("Toggle answers failed: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// 脱落の通知は本人の接続にだけ届く
+	bobClient := newClient(TransportWebSocket, "192.0.2.20")
+	bobClient.ParticipantID = bob
+	hub.Register(bobClient)
+	defer hub.Unregister(bobClient)
+
+	// 問題1: 不正解のBobと未回答のCarolが脱落
+	if w := send(StartSession, models.SessionStartRequest{QuizID: quizIDs[0]}); w.Code != http.StatusOK {
+		t.Fatalf("Start session failed: %d %s", w.Code, w.Body.String())
+	}
+	answer(alice, quizIDs[0], true)
+	answer(dave, quizIDs[0], true)
+	answer(bob, quizIDs[0], false)
+	closeAnswers()
+
+	status := survivors()
+	if status.SurvivorCount != 2 || status.EliminatedCount != 2 || status.RoundsPlayed != 1 || status.Finished {
+		t.Errorf("Unexpected survivors after round 1: %+v", status)
+	}
+
+	noticeReceived := false
+	for !noticeReceived {
+		select {
+		case ev := <-bobClient.send:
+			if ev.Type == "elimination_notice" {
+				noticeReceived = true
+				if notice, ok := ev.Data.(EliminationNotice); ok && notice.Reason != EliminationReasonWrongAnswer {
+					t.Errorf("Expected a wrong answer notice, got %+v", notice)
+				}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for the elimination notice")
+		}
+	}
+
+	// 脱落者は観戦のみ。途中参加者は観戦者として登録される
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/answers", nil)
+	if checkParticipantCanAnswer(c, db, carol) || w.Code != http.StatusForbidden {
+		t.Errorf("Expected an eliminated participant to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if !checkParticipantAccess(c, db, carol) {
+		t.Error("Expected an eliminated participant to be able to watch")
+	}
+	if _, eliminated := register(fmt.Sprintf("SurvivorLate%d", suffix)); !eliminated {
+		t.Error("Expected a latecomer to join as a spectator")
+	}
+
+	// 問題2: 生存者全員が不正解なら誰も脱落しない
+	if w := send(NextQuestion, models.SessionNextRequest{QuizID: quizIDs[1]}); w.Code != http.StatusOK {
+		t.Fatalf("Next question failed: %d %s", w.Code, w.Body.String())
+	}
+	answer(alice, quizIDs[1], false)
+	closeAnswers()
+	closeAnswers() // 同じ問題は一度だけ判定する
+
+	status = survivors()
+	if status.SurvivorCount != 2 || status.RoundsPlayed != 2 || status.LastRound == nil || !status.LastRound.Voided {
+		t.Errorf("Expected a voided round 2, got %+v", status)
+	}
+
+	// 問題3: 出題数に達したので生存者2人のまま終了
+	if w := send(NextQuestion, models.SessionNextRequest{QuizID: quizIDs[2]}); w.Code != http.StatusOK {
+		t.Fatalf("Next question failed: %d %s", w.Code, w.Body.String())
+	}
+	answer(alice, quizIDs[2], true)
+	answer(dave, quizIDs[2], true)
+	closeAnswers()
+
+	status = survivors()
+	if !status.Finished || status.SurvivorCount != 2 || status.RoundsPlayed != 3 {
+		t.Errorf("Expected the game to end when the questions ran out, got %+v", status)
+	}
+	if w := send(NextQuestion, models.SessionNextRequest{QuizID: quizIDs[0]}); w.Code != http.StatusConflict {
+		t.Errorf("Expected no more questions after the game ended, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sseRetryMillis is the reconnect delay suggested to EventSource clients
+	sseRetryMillis = 3000
+	// sseKeepAliveInterval is how often a comment line is sent to keep proxies from timing out
+	sseKeepAliveInterval = 15 * time.Second
+)
+
+// EventStream streams the same events as /ws over Server-Sent Events.
+// Use ?quiz_id= to subscribe to a quiz; Last-Event-ID resumes after a reconnect.
+func EventStream(c *gin.Context) {
+	var quizID *int64
+	if quizIDStr := c.Query("quiz_id"); quizIDStr != "" {
+		id, err := strconv.ParseInt(quizIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "INVALID_ID",
+					Message: "Invalid quiz ID",
+				},
+			})
+			return
+		}
+		quizID = &id
+	}
+
+	lastEventID, err := parseLastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_LAST_EVENT_ID",
+				Message: "Invalid Last-Event-ID",
+			},
+		})
+		return
+	}
+
+	client, ok := newClientFromRequest(c, TransportSSE)
+	if !ok {
+		return
+	}
+	if quizID != nil {
+		client.Subscribe(*quizID)
+	}
+
+	// Check connection limits (shared with WebSocket clients) and register
+	if !admitClient(c, client) {
+		return
+	}
+	presenceChanged(client)
+	defer func() {
+		hub.Unregister(client)
+		presenceChanged(client)
+	}()
+
+	// The stream outlives the server's WriteTimeout, so lift the deadline for this response
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable nginx buffering
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis); err != nil {
+		return
+	}
+
+	// Events published while replaying are also queued; skip them in the live loop
+	var replayedUpTo int64
+	if lastEventID > 0 {
+		missed, complete := hub.EventsSince(client, lastEventID)
+		if !complete {
+			// Events were dropped from the history; the client should refetch state over REST
+			_ = writeSSE(w, &Event{Type: "resync", Data: map[string]interface{}{
+				"last_event_id": lastEventID,
+			}})
+		}
+		for _, ev := range missed {
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			replayedUpTo = ev.ID
+		}
+	} else if quizID != nil {
+		// Send current results immediately, as /ws does on subscribe
+		if results, err := getCurrentQuizResults(*quizID); err == nil {
+			_ = writeSSE(w, &Event{Type: "result_update", QuizID: quizID, Data: results})
+		}
+	}
+	w.Flush()
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-client.send:
+			if ev.ID != 0 && ev.ID <= replayedUpTo {
+				continue
+			}
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			w.Flush()
+			if ev.closesConnection() {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+			client.Touch()
+		case <-client.Done():
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// parseLastEventID reads the resume position from the Last-Event-ID header or query
+func parseLastEventID(c *gin.Context) (int64, error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		// EventSource cannot set headers on the first connection
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid last event id %q", value)
+	}
+	return id, nil
+}
+
+// writeSSE writes an event in text/event-stream format using the WebSocket envelope as data
+func writeSSE(w io.Writer, ev *Event) error {
+	data, err := json.Marshal(WebSocketMessage{
+		Type: ev.Type,
+		Data: ev.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	if ev.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
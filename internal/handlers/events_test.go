@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseFrame is a parsed text/event-stream frame
+type sseFrame struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSEFrame reads lines until a blank line and returns the parsed frame.
+// Comment-only frames (keep-alives, retry hints) are skipped.
+func readSSEFrame(t *testing.T, r *bufio.Reader) sseFrame {
+	t.Helper()
+
+	var frame sseFrame
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read SSE stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "":
+			if frame.event != "" {
+				return frame
+			}
+		case strings.HasPrefix(line, "id: "):
+			frame.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			frame.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			frame.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openEventStream(t *testing.T, url string, lastEventID string) (*bufio.Reader, func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		cancel()
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Expected text/event-stream content type, got %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	// The retry hint is written after the client is registered with the hub
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "retry: ") {
+		t.Fatalf("Expected retry hint, got %q (%v)", line, err)
+	}
+
+	return reader, func() {
+		cancel()
+		_ = resp.Body.Close()
+	}
+}
+
+func TestEventStreamDeliversBroadcasts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/api/events", EventStream)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	reader, closeStream := openEventStream(t, server.URL+"/api/events?quiz_id=4242", "")
+	defer closeStream()
+
+	// Events for other quizzes must be filtered out
+	BroadcastAnswerStatus(4343, 4343, 10, 8, 1, map[string]int{"A": 1})
+	BroadcastAnswerStatus(4242, 4242, 10, 8, 2, map[string]int{"B": 2})
+	BroadcastSessionUpdate(map[string]interface{}{"status": "started"})
+
+	frame := readSSEFrame(t, reader)
+	if frame.event != "answer_status" {
+		t.Fatalf("Expected answer_status event, got %q", frame.event)
+	}
+	if frame.id == "" {
+		t.Error("Broadcast events should carry an id")
+	}
+	if !strings.Contains(frame.data, `"quiz_id":4242`) {
+		t.Errorf("Expected quiz 4242 in data, got %s", frame.data)
+	}
+
+	frame = readSSEFrame(t, reader)
+	if frame.event != "session_update" {
+		t.Fatalf("Expected session_update event, got %q", frame.event)
+	}
+	if !strings.Contains(frame.data, `"type":"session_update"`) {
+		t.Errorf("Expected WebSocket envelope in data, got %s", frame.data)
+	}
+}
+
+func TestEventStreamResumesFromLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/api/events", EventStream)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	first := hub.Publish("session_update", nil, map[string]interface{}{"status": "first"})
+	hub.Publish("session_update", nil, map[string]interface{}{"status": "missed"})
+
+	reader, closeStream := openEventStream(t, server.URL+"/api/events", strconv.FormatInt(first.ID, 10))
+	defer closeStream()
+
+	frame := readSSEFrame(t, reader)
+	if !strings.Contains(frame.data, "missed") {
+		t.Errorf("Expected the missed event to be replayed, got %s", frame.data)
+	}
+}
+
+func TestEventStreamRejectsInvalidParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		query       string
+		lastEventID string
+	}{
+		{name: "invalid quiz id", query: "?quiz_id=abc"},
+		{name: "invalid last event id", lastEventID: "xyz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/events"+tt.query, nil)
+			if tt.lastEventID != "" {
+				c.Request.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+
+			EventStream(c)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Tattsum/quiz/internal/models"
 	"github.com/gin-gonic/gin"
 	validator "github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
 )
 
 // parseValidationErrors converts validation errors to API error format
@@ -88,6 +92,84 @@ func getPaginationParams(c *gin.Context) (int, int, error) {
 	return page, limit, nil
 }
 
+// queryFilter reads optional list filters from the query parameters. Absent parameters leave
+// their filter at the zero value, which matches everything. The first invalid parameter is
+// recorded, and ok answers it with 400.
+type queryFilter struct {
+	c       *gin.Context
+	invalid string
+}
+
+// newQueryFilter reads list filters from the query parameters of c
+func newQueryFilter(c *gin.Context) *queryFilter {
+	return &queryFilter{c: c}
+}
+
+// id reads a positive ID, or 0 if param is absent
+func (f *queryFilter) id(param string) int64 {
+	value := f.c.Query(param)
+	if value == "" {
+		return 0
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		f.reject(param)
+		return 0
+	}
+	return id
+}
+
+// bool reads a boolean, or nil if param is absent
+func (f *queryFilter) bool(param string) *bool {
+	value := f.c.Query(param)
+	if value == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		f.reject(param)
+		return nil
+	}
+	return &b
+}
+
+// time reads an RFC 3339 time, or nil if param is absent. The offset is kept; the query
+// compares the time as TIMESTAMPTZ.
+func (f *queryFilter) time(param string) *time.Time {
+	value := f.c.Query(param)
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		f.reject(param)
+		return nil
+	}
+	return &t
+}
+
+// reject records the first invalid parameter
+func (f *queryFilter) reject(param string) {
+	if f.invalid == "" {
+		f.invalid = param
+	}
+}
+
+// ok reports whether every parameter read was valid. Otherwise it responds with 400.
+func (f *queryFilter) ok() bool {
+	if f.invalid == "" {
+		return true
+	}
+	f.c.JSON(http.StatusBadRequest, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "INVALID_PARAMETER",
+			Message: "Invalid " + f.invalid,
+		},
+	})
+	return false
+}
+
 // convertQuizToPublic converts Quiz model to QuizPublic (without correct answer)
 func convertQuizToPublic(quiz models.Quiz) models.QuizPublic {
 	return models.QuizPublic{
@@ -109,3 +191,9 @@ func calculatePercentage(part, total int) float64 {
 	}
 	return float64(part) / float64(total) * 100
 }
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
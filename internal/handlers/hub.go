@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/google/uuid"
+)
+
+const (
+	// EventHistorySize is the number of broadcast events kept for Last-Event-ID resume
+	EventHistorySize = 512
+	// clientSendBuffer is the number of events that may be queued for a single client
+	clientSendBuffer = 64
+	// brokerTimeout bounds a single publish round-trip to the event broker
+	brokerTimeout = 2 * time.Second
+)
+
+// Transport names used by hub clients
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// Event represents a single message fanned out to WebSocket and SSE clients.
+// Events with ID 0 are direct replies and are never stored in the history.
+type Event struct {
+	ID     int64        `json:"id"`
+	Type   string       `json:"type"`
+	QuizID *int64       `json:"quiz_id,omitempty"` // nil means every client receives the event
+	Target *EventTarget `json:"target,omitempty"`  // set for events addressed to specific participants
+	Data   interface{}  `json:"data"`
+}
+
+// EventTarget addresses an event to the participant connections of one participant or IP address.
+// Targeted events ignore quiz subscriptions and are never sent to projector or admin clients.
+type EventTarget struct {
+	ParticipantID int64  `json:"participant_id,omitempty"`
+	RemoteIP      string `json:"remote_ip,omitempty"`
+	// Disconnect closes the connection once the event has been delivered
+	Disconnect bool `json:"disconnect,omitempty"`
+}
+
+// closesConnection reports whether the connection must be closed after delivering the event
+func (ev *Event) closesConnection() bool {
+	return ev.Target != nil && ev.Target.Disconnect
+}
+
+// Client represents a subscriber attached to the hub
+type Client struct {
+	ID            string
+	Transport     string
+	Role          string
+	RemoteIP      string
+	SessionID     int64
+	ParticipantID int64 // 0 unless the participant connected with their token
+	ConnectedAt   time.Time
+
+	send      chan *Event
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.RWMutex
+	quizID        *int64
+	lastHeartbeat time.Time
+}
+
+// newClient creates a participant client for the given transport
+func newClient(transport, remoteIP string) *Client {
+	now := time.Now()
+	return &Client{
+		ID:            uuid.NewString(),
+		Transport:     transport,
+		Role:          RoleParticipant,
+		RemoteIP:      remoteIP,
+		ConnectedAt:   now,
+		send:          make(chan *Event, clientSendBuffer),
+		done:          make(chan struct{}),
+		lastHeartbeat: now,
+	}
+}
+
+// Subscribe restricts quiz-scoped events to the given quiz
+func (c *Client) Subscribe(quizID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quizID = &quizID
+}
+
+// Unsubscribe clears the quiz subscription
+func (c *Client) Unsubscribe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quizID = nil
+}
+
+// QuizID returns the quiz the client is subscribed to, or nil
+func (c *Client) QuizID() *int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.quizID == nil {
+		return nil
+	}
+	id := *c.quizID
+	return &id
+}
+
+// Touch records a heartbeat from the client
+func (c *Client) Touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastHeartbeat = time.Now()
+}
+
+// LastHeartbeat returns the time of the last heartbeat
+func (c *Client) LastHeartbeat() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastHeartbeat
+}
+
+// QueueDepth returns the number of events waiting to be sent
+func (c *Client) QueueDepth() int {
+	return len(c.send)
+}
+
+// Done is closed when the client has been closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close detaches the client; its transport loop exits when Done is closed
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// wants reports whether the event matches the client's subscription filter
+func (c *Client) wants(ev *Event) bool {
+	if ev.Target != nil {
+		return c.isTarget(ev.Target)
+	}
+	if ev.QuizID == nil {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.quizID != nil && *c.quizID == *ev.QuizID
+}
+
+// isTarget reports whether the client is one of the connections addressed by target
+func (c *Client) isTarget(target *EventTarget) bool {
+	if c.Role != RoleParticipant {
+		return false
+	}
+	return (target.ParticipantID != 0 && c.ParticipantID == target.ParticipantID) ||
+		(target.RemoteIP != "" && c.RemoteIP == target.RemoteIP)
+}
+
+// enqueue queues an event without blocking. Clients that cannot keep up are closed.
+func (c *Client) enqueue(ev *Event) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- ev:
+		return true
+	default:
+		c.Close()
+		return false
+	}
+}
+
+// Reply queues a direct message for this client only
+func (c *Client) Reply(eventType string, data interface{}) {
+	c.enqueue(&Event{Type: eventType, Data: data})
+}
+
+// Hub fans out events to every registered client and keeps a short history for resume.
+// Events travel through the broker so that clients on every replica receive them.
+type Hub struct {
+	broker services.EventBroker
+
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	history []*Event
+	size    int
+}
+
+// NewHub creates a hub keeping up to historySize events and subscribes it to the broker
+func NewHub(historySize int, broker services.EventBroker) (*Hub, error) {
+	h := &Hub{
+		broker:  broker,
+		clients: make(map[*Client]struct{}),
+		history: make([]*Event, 0, historySize),
+		size:    historySize,
+	}
+
+	if err := broker.Subscribe(context.Background(), h.dispatch); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newMemoryHub creates a hub backed by an in-process broker
+func newMemoryHub() *Hub {
+	h, err := NewHub(EventHistorySize, services.NewMemoryBroker())
+	if err != nil {
+		// MemoryBroker.Subscribe never fails
+		panic(err)
+	}
+	return h
+}
+
+// hub is the process-wide hub shared by the WebSocket and SSE handlers
+var hub = newMemoryHub()
+
+// UseEventBroker replaces the process-wide hub with one backed by the given broker.
+// It must be called before the server starts accepting connections.
+func UseEventBroker(broker services.EventBroker) error {
+	h, err := NewHub(EventHistorySize, broker)
+	if err != nil {
+		return err
+	}
+	hub = h
+	return nil
+}
+
+// Register attaches a client to the hub
+func (h *Hub) Register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+}
+
+// Admit registers a client if the connection limits allow it. When they do not,
+// it returns the name of the exceeded limit.
+func (h *Hub) Admit(c *Client, limits ConnectionLimits) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if reason, ok := limits.admit(c, h.clients); !ok {
+		return reason, false
+	}
+	h.clients[c] = struct{}{}
+	return "", true
+}
+
+// EventsSince returns the stored events after lastID that match the client's filter.
+// ok is false when lastID is older than the retained history, or newer than any stored event,
+// e.g. because event IDs started again after a restart.
+func (h *Hub) EventsSince(c *Client, lastID int64) (missed []*Event, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ok = true
+	switch {
+	case len(h.history) == 0:
+		ok = lastID <= 0
+	case lastID < h.history[0].ID-1, lastID > h.history[len(h.history)-1].ID:
+		ok = false
+	}
+	for _, ev := range h.history {
+		if ev.ID > lastID && c.wants(ev) {
+			missed = append(missed, ev)
+		}
+	}
+	return missed, ok
+}
+
+// Unregister detaches a client from the hub and closes it
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+	c.Close()
+}
+
+// Publish assigns a cluster-wide ID to a new event and sends it through the broker.
+// It returns nil if the broker is unavailable.
+func (h *Hub) Publish(eventType string, quizID *int64, data interface{}) *Event {
+	return h.publish(&Event{Type: eventType, QuizID: quizID, Data: data})
+}
+
+// PublishTo sends an event to the participant connections matching target on every replica
+func (h *Hub) PublishTo(eventType string, target EventTarget, data interface{}) *Event {
+	return h.publish(&Event{Type: eventType, Target: &target, Data: data})
+}
+
+// publish assigns the event an ID and sends it through the broker
+func (h *Hub) publish(ev *Event) *Event {
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+
+	id, err := h.broker.NextSequence(ctx)
+	if err != nil {
+		log.Printf("Failed to publish %s event: %v", ev.Type, err)
+		return nil
+	}
+	ev.ID = id
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", ev.Type, err)
+		return nil
+	}
+
+	if err := h.broker.Publish(ctx, payload); err != nil {
+		log.Printf("Failed to publish %s event: %v", ev.Type, err)
+		return nil
+	}
+	return ev
+}
+
+// dispatch receives an event from the broker, stores it and delivers it to matching clients
+func (h *Hub) dispatch(payload []byte) {
+	var ev Event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		log.Printf("Failed to decode broker event: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.storeLocked(&ev)
+
+	for c := range h.clients {
+		if c.wants(&ev) {
+			c.enqueue(&ev)
+		}
+	}
+}
+
+// storeLocked inserts an event into the history ordered by ID.
+// Events from other replicas may arrive slightly out of order.
+func (h *Hub) storeLocked(ev *Event) {
+	i := len(h.history)
+	for i > 0 && h.history[i-1].ID > ev.ID {
+		i--
+	}
+
+	if len(h.history) == h.size {
+		if i == 0 {
+			// Older than everything retained
+			return
+		}
+		h.history = h.history[1:]
+		i--
+	}
+
+	h.history = append(h.history, nil)
+	copy(h.history[i+1:], h.history[i:])
+	h.history[i] = ev
+}
+
+// Clients returns a snapshot of the registered clients
+func (h *Hub) Clients() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// ClientCount returns the number of registered clients
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// SubscriptionCount returns the number of clients subscribed to a quiz
+func (h *Hub) SubscriptionCount(quizID int64) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for c := range h.clients {
+		if id := c.QuizID(); id != nil && *id == quizID {
+			count++
+		}
+	}
+	return count
+}
+
+// ConnectedParticipants returns the IDs of participants with at least one connection that
+// identified itself with a participant token
+func (h *Hub) ConnectedParticipants() map[int64]bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	connected := make(map[int64]bool)
+	for c := range h.clients {
+		if c.Role == RoleParticipant && c.ParticipantID != 0 {
+			connected[c.ParticipantID] = true
+		}
+	}
+	return connected
+}
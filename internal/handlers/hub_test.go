@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newRedisHub(t *testing.T, addr string) *Hub {
+	t.Helper()
+
+	broker, err := services.NewRedisBroker(addr, "", services.DefaultRedisEventChannel)
+	if err != nil {
+		t.Fatalf("Failed to create Redis broker: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = broker.Close()
+	})
+
+	h, err := NewHub(EventHistorySize, broker)
+	if err != nil {
+		t.Fatalf("Failed to create hub: %v", err)
+	}
+	return h
+}
+
+func TestHubDeliversAcrossReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	replicaA := newRedisHub(t, server.Addr())
+	replicaB := newRedisHub(t, server.Addr())
+
+	// A projector connected to replica B
+	projector := newClient(TransportWebSocket, "127.0.0.1")
+	projector.Subscribe(7)
+	replicaB.Register(projector)
+	defer replicaB.Unregister(projector)
+
+	// An answer submitted on replica A
+	quizID := int64(7)
+	sent := replicaA.Publish("answer_status", &quizID, AnswerStatusUpdate{QuizID: 7, AnsweredCount: 1})
+	if sent == nil {
+		t.Fatal("Publish returned nil")
+	}
+
+	select {
+	case ev := <-projector.send:
+		if ev.Type != "answer_status" || ev.ID != sent.ID {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for event on replica B")
+	}
+
+	// Both replicas keep the event for Last-Event-ID resume
+	other := newClient(TransportSSE, "127.0.0.1")
+	replicaA.Register(other)
+	defer replicaA.Unregister(other)
+	missed, ok := replicaA.EventsSince(other, 0)
+	if !ok {
+		t.Error("Expected complete history")
+	}
+	for _, ev := range missed {
+		if ev.QuizID != nil {
+			t.Error("Quiz-scoped events should not be replayed to unsubscribed clients")
+		}
+	}
+}
+
+func TestHubHistoryOrdering(t *testing.T) {
+	h, err := NewHub(3, services.NewMemoryBroker())
+	if err != nil {
+		t.Fatalf("Failed to create hub: %v", err)
+	}
+
+	for _, id := range []int64{1, 3, 2, 5, 4} {
+		h.storeLocked(&Event{ID: id, Type: "session_update"})
+	}
+
+	want := []int64{3, 4, 5}
+	if len(h.history) != len(want) {
+		t.Fatalf("Expected %d events, got %d", len(want), len(h.history))
+	}
+	for i, ev := range h.history {
+		if ev.ID != want[i] {
+			t.Errorf("history[%d] = %d, want %d", i, ev.ID, want[i])
+		}
+	}
+
+	client := newClient(TransportSSE, "127.0.0.1")
+	if _, ok := h.EventsSince(client, 1); ok {
+		t.Error("Expected incomplete history when resuming before the retained window")
+	}
+	if _, ok := h.EventsSince(client, 5); !ok {
+		t.Error("Expected complete history when resuming at the newest event")
+	}
+
+	// After a restart event IDs start again, so an ID from before the restart is a gap
+	if _, ok := h.EventsSince(client, 9); ok {
+		t.Error("Expected incomplete history when resuming after the newest event")
+	}
+	restarted, err := NewHub(3, services.NewMemoryBroker())
+	if err != nil {
+		t.Fatalf("Failed to create hub: %v", err)
+	}
+	if _, ok := restarted.EventsSince(client, 5); ok {
+		t.Error("Expected incomplete history when resuming on a hub without events")
+	}
+}
+
+func TestHubTargetedEvents(t *testing.T) {
+	h, err := NewHub(EventHistorySize, services.NewMemoryBroker())
+	if err != nil {
+		t.Fatalf("Failed to create hub: %v", err)
+	}
+
+	byID := newClient(TransportWebSocket, "10.0.0.1")
+	byID.ParticipantID = 42
+	byIP := newClient(TransportSSE, "10.0.0.2")
+	other := newClient(TransportWebSocket, "10.0.0.3")
+	projector := newClient(TransportWebSocket, "10.0.0.2")
+	projector.Role = RoleProjector
+
+	for _, c := range []*Client{byID, byIP, other, projector} {
+		h.Register(c)
+		defer h.Unregister(c)
+	}
+
+	sent := h.PublishTo("moderation_notice", EventTarget{ParticipantID: 42, RemoteIP: "10.0.0.2", Disconnect: true},
+		ModerationNotice{Action: ParticipantActionBanned})
+	if !sent.closesConnection() {
+		t.Error("Expected a disconnecting event")
+	}
+
+	for _, c := range []*Client{byID, byIP} {
+		select {
+		case ev := <-c.send:
+			if ev.ID != sent.ID {
+				t.Errorf("Unexpected event %+v", ev)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for targeted event on %s", c.RemoteIP)
+		}
+	}
+
+	for _, c := range []*Client{other, projector} {
+		select {
+		case ev := <-c.send:
+			t.Errorf("Client %s (%s) should not receive targeted event %+v", c.RemoteIP, c.Role, ev)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// Untargeted events do not close connections
+	if h.Publish("quiz_update", nil, nil).closesConnection() {
+		t.Error("Broadcast events must not close connections")
+	}
+}
+
+func TestHubConnectedParticipants(t *testing.T) {
+	h, err := NewHub(EventHistorySize, services.NewMemoryBroker())
+	if err != nil {
+		t.Fatalf("Failed to create hub: %v", err)
+	}
+
+	phone := newClient(TransportWebSocket, "10.0.0.1")
+	phone.ParticipantID = 7
+	laptop := newClient(TransportSSE, "10.0.0.2")
+	laptop.ParticipantID = 7
+	anonymous := newClient(TransportWebSocket, "10.0.0.3")
+	projector := newClient(TransportWebSocket, "10.0.0.4")
+	projector.Role = RoleProjector
+	projector.ParticipantID = 9
+
+	for _, c := range []*Client{phone, laptop, anonymous, projector} {
+		h.Register(c)
+	}
+
+	connected := h.ConnectedParticipants()
+	if len(connected) != 1 || !connected[7] {
+		t.Errorf("Expected only participant 7 to be connected, got %v", connected)
+	}
+
+	// The participant stays connected until their last connection closes
+	h.Unregister(phone)
+	if !h.ConnectedParticipants()[7] {
+		t.Error("Expected participant 7 to stay connected on the second device")
+	}
+	h.Unregister(laptop)
+	if h.ConnectedParticipants()[7] {
+		t.Error("Expected participant 7 to be disconnected")
+	}
+}
@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Lifelines a participant can use on a question, at most one per question
+const (
+	LifelineFiftyFifty = "fifty_fifty" // hides two wrong options
+	LifelineSkip       = "skip"        // passes the question with a neutral result
+	LifelineDouble     = "double"      // doubles the points of the next question asked
+)
+
+// answerPointsSQL scores an answer aliased a: a correct answer is worth one point,
+// or two with the double lifeline
+const answerPointsSQL = `CASE WHEN a.is_correct THEN CASE WHEN a.lifeline = 'double' THEN 2 ELSE 1 END ELSE 0 END`
+
+// participantStatsQuery counts the judged answers, correct answers and points of a participant.
+// Skipped questions are neutral, so they are not counted as answers.
+const participantStatsQuery = `SELECT COUNT(*), COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0),
+							   COALESCE(SUM(` + answerPointsSQL + `), 0)
+							   FROM answers a WHERE a.participant_id = $1 AND a.selected_option IS NOT NULL`
+
+var (
+	// errLifelineUsed is returned when a lifeline was already used on the question
+	errLifelineUsed = errors.New("lifeline already used on this question")
+	// errLifelineLimitReached is returned when the participant has no uses of the lifeline left
+	errLifelineLimitReached = errors.New("lifeline limit reached")
+	// errDoublePending is returned when a double is already waiting for the next question
+	errDoublePending = errors.New("a double is already waiting for the next question")
+)
+
+// answerPoints returns the points of an answer, as answerPointsSQL does
+func answerPoints(isCorrect bool, lifeline *string) int {
+	switch {
+	case !isCorrect:
+		return 0
+	case lifeline != nil && *lifeline == LifelineDouble:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// questionSkippedResponse writes the error for answering a question the participant skipped
+func questionSkippedResponse(c *gin.Context) {
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "QUESTION_SKIPPED",
+			Message: "This question was skipped with a lifeline",
+		},
+	})
+}
+
+// lifelineCount returns the field of counts that belongs to a lifeline, or nil for an unknown lifeline
+func lifelineCount(counts *models.LifelineCounts, lifeline string) *int {
+	switch lifeline {
+	case LifelineFiftyFifty:
+		return &counts.FiftyFifty
+	case LifelineSkip:
+		return &counts.Skip
+	case LifelineDouble:
+		return &counts.Double
+	}
+	return nil
+}
+
+// lifelineLimitValues returns the limits of a lifeline request, nil for each omitted lifeline
+func lifelineLimitValues(req *models.LifelineLimitsRequest) (fiftyFifty, skip, double *int) {
+	if req == nil {
+		return nil, nil, nil
+	}
+	return req.FiftyFifty, req.Skip, req.Double
+}
+
+// pickHiddenOptions picks two of the three wrong options at random for the 50/50 lifeline
+func pickHiddenOptions(correctAnswer string) []string {
+	var wrong []string
+	for _, option := range []string{"A", "B", "C", "D"} {
+		if option != correctAnswer {
+			wrong = append(wrong, option)
+		}
+	}
+	rand.Shuffle(len(wrong), func(i, j int) { wrong[i], wrong[j] = wrong[j], wrong[i] })
+
+	hidden := wrong[:2]
+	sort.Strings(hidden)
+	return hidden
+}
+
+// useLifeline records a participant using a lifeline on a quiz and applies it to their answer.
+// A skip replaces any answer with a skipped one. A double does not use up the quiz: it waits,
+// without a quiz, until applyPendingDoubles attaches it to the next question asked. It returns
+// the option of the answer a skip replaced, which is empty if there was none.
+func useLifeline(db *sql.DB, participantID, quizID int64, lifeline string, limit int) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after commit
+	}()
+
+	// Locking the participant serializes their lifelines, so concurrent requests cannot exceed the limit
+	var lockedID int64
+	if err := tx.QueryRow("SELECT id FROM participants WHERE id = $1 FOR UPDATE", participantID).Scan(&lockedID); err != nil {
+		return "", err
+	}
+
+	var used int
+	var usedOnQuiz, doublePending bool
+	usageQuery := `SELECT COUNT(*) FILTER (WHERE lifeline = $3), COUNT(*) FILTER (WHERE quiz_id = $2) > 0,
+					   COUNT(*) FILTER (WHERE quiz_id IS NULL) > 0
+				   FROM lifeline_uses WHERE participant_id = $1`
+	if err := tx.QueryRow(usageQuery, participantID, quizID, lifeline).Scan(&used, &usedOnQuiz, &doublePending); err != nil {
+		return "", err
+	}
+	switch {
+	case lifeline == LifelineDouble && doublePending:
+		return "", errDoublePending
+	case lifeline != LifelineDouble && usedOnQuiz:
+		return "", errLifelineUsed
+	case used >= limit:
+		return "", errLifelineLimitReached
+	}
+
+	var correctAnswer string
+	if err := tx.QueryRow("SELECT correct_answer FROM quizzes WHERE id = $1", quizID).Scan(&correctAnswer); err != nil {
+		return "", err
+	}
+
+	usedOn := &quizID
+	var hiddenOptions []string
+	switch lifeline {
+	case LifelineFiftyFifty:
+		hiddenOptions = pickHiddenOptions(correctAnswer)
+	case LifelineDouble:
+		usedOn = nil
+	}
+
+	insertQuery := `INSERT INTO lifeline_uses (participant_id, quiz_id, lifeline, hidden_options, created_at)
+					VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
+	if _, err := tx.Exec(insertQuery, participantID, usedOn, lifeline, pq.Array(hiddenOptions)); err != nil {
+		return "", err
+	}
+	if usedOn == nil {
+		return "", tx.Commit()
+	}
+
+	var previousOption sql.NullString
+	err = tx.QueryRow("SELECT selected_option FROM answers WHERE participant_id = $1 AND quiz_id = $2 FOR UPDATE",
+		participantID, quizID).Scan(&previousOption)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	// The lifeline is recorded on the answer; answers submitted later pick it up from lifeline_uses
+	answerQuery := "UPDATE answers SET lifeline = $3 WHERE participant_id = $1 AND quiz_id = $2"
+	if lifeline == LifelineSkip {
+		answerQuery = `INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct, lifeline, answered_at)
+					   VALUES ($1, $2, NULL, false, $3, CURRENT_TIMESTAMP)
+					   ON CONFLICT (participant_id, quiz_id) DO UPDATE
+					   SET selected_option = NULL, is_correct = false, lifeline = EXCLUDED.lifeline, answered_at = EXCLUDED.answered_at`
+	}
+	if _, err := tx.Exec(answerQuery, participantID, quizID, lifeline); err != nil {
+		return "", err
+	}
+
+	return previousOption.String, tx.Commit()
+}
+
+// loadLifelineStatus loads how many lifelines a participant used against the given limits
+func loadLifelineStatus(db *sql.DB, participantID int64, limits models.LifelineCounts) (*models.LifelineStatus, error) {
+	rows, err := db.Query("SELECT lifeline, COUNT(*) FROM lifeline_uses WHERE participant_id = $1 GROUP BY lifeline", participantID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	status := &models.LifelineStatus{ParticipantID: participantID, Limits: limits}
+	for rows.Next() {
+		var lifeline string
+		var count int
+		if err := rows.Scan(&lifeline, &count); err != nil {
+			return nil, err
+		}
+		if used := lifelineCount(&status.Used, lifeline); used != nil {
+			*used = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, lifeline := range []string{LifelineFiftyFifty, LifelineSkip, LifelineDouble} {
+		*lifelineCount(&status.Remaining, lifeline) = max(*lifelineCount(&limits, lifeline)-*lifelineCount(&status.Used, lifeline), 0)
+	}
+	return status, nil
+}
+
+// loadLifelineUse returns the lifeline a participant used on a quiz, or nil if they used none
+func loadLifelineUse(db *sql.DB, participantID, quizID int64) (*models.LifelineUse, error) {
+	return scanLifelineUse(db.QueryRow(`SELECT id, participant_id, quiz_id, lifeline, hidden_options, created_at
+										 FROM lifeline_uses WHERE participant_id = $1 AND quiz_id = $2`, participantID, quizID))
+}
+
+// loadCurrentLifelines sets the lifeline used on the current question, if there is one, and the
+// double kept for the next question
+func loadCurrentLifelines(db *sql.DB, status *models.LifelineStatus, currentQuizID *int64) error {
+	var err error
+	if currentQuizID != nil {
+		if status.Current, err = loadLifelineUse(db, status.ParticipantID, *currentQuizID); err != nil {
+			return err
+		}
+	}
+	status.Pending, err = loadPendingDouble(db, status.ParticipantID)
+	return err
+}
+
+// loadPendingDouble returns the double a participant is keeping for the next question, or nil
+func loadPendingDouble(db *sql.DB, participantID int64) (*models.LifelineUse, error) {
+	return scanLifelineUse(db.QueryRow(`SELECT id, participant_id, quiz_id, lifeline, hidden_options, created_at
+										 FROM lifeline_uses WHERE participant_id = $1 AND quiz_id IS NULL`, participantID))
+}
+
+// scanLifelineUse scans a lifeline use, returning nil if there is none
+func scanLifelineUse(row *sql.Row) (*models.LifelineUse, error) {
+	use := &models.LifelineUse{}
+	err := row.Scan(&use.ID, &use.ParticipantID, &use.QuizID, &use.Lifeline, pq.Array(&use.HiddenOptions), &use.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return use, nil
+}
+
+// applyPendingDoubles attaches the doubles that participants of a session are keeping to the
+// question being asked. Participants who already used a lifeline on it or answered it, because
+// it is asked again, keep their double for the question after.
+func applyPendingDoubles(db *sql.DB, sessionID, quizID int64) error {
+	_, err := db.Exec(`UPDATE lifeline_uses l SET quiz_id = $2
+					   FROM participants p
+					   WHERE l.participant_id = p.id AND l.quiz_id IS NULL AND COALESCE(p.session_id, 0) = $1
+					   AND NOT EXISTS (SELECT 1 FROM lifeline_uses u WHERE u.participant_id = l.participant_id AND u.quiz_id = $2)
+					   AND NOT EXISTS (SELECT 1 FROM answers a WHERE a.participant_id = l.participant_id AND a.quiz_id = $2)`,
+		sessionID, quizID)
+	return err
+}
+
+// UseLifeline uses a lifeline on the current question. The 50/50 lifeline returns the two
+// wrong options hidden for the participant, a skip records a neutral answer and a double
+// doubles the points of the participant's answer to the next question asked.
+func UseLifeline(c *gin.Context) {
+	var req models.LifelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	participantID := authenticatedParticipantID(c)
+	db := database.GetDB()
+
+	var isAcceptingAnswers bool
+	var currentQuizID *int64
+	var limits models.LifelineCounts
+	sessionQuery := `SELECT is_accepting_answers, current_quiz_id, lifeline_fifty_fifty, lifeline_skip, lifeline_double
+					 FROM quiz_sessions
+					 ORDER BY id DESC
+					 LIMIT 1`
+	err := db.QueryRow(sessionQuery).Scan(&isAcceptingAnswers, &currentQuizID, &limits.FiftyFifty, &limits.Skip, &limits.Double)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "SESSION_ERROR",
+				Message: "No active session found",
+			},
+		})
+		return
+	}
+
+	if !isAcceptingAnswers {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "ANSWERS_NOT_ACCEPTED",
+				Message: "Lifelines can only be used while answers are accepted",
+			},
+		})
+		return
+	}
+
+	if currentQuizID == nil || *currentQuizID != req.QuizID {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_QUIZ",
+				Message: "This quiz is not currently active",
+			},
+		})
+		return
+	}
+
+	if !checkParticipantCanAnswer(c, db, participantID) {
+		return
+	}
+
+	limit := *lifelineCount(&limits, req.Lifeline)
+	if limit == 0 {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "LIFELINE_DISABLED",
+				Message: "This lifeline is not available in this session",
+			},
+		})
+		return
+	}
+
+	previousOption, err := useLifeline(db, participantID, req.QuizID, req.Lifeline, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, errLifelineUsed):
+			c.JSON(http.StatusConflict, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "LIFELINE_ALREADY_USED",
+					Message: "A lifeline was already used on this question",
+				},
+			})
+		case errors.Is(err, errDoublePending):
+			c.JSON(http.StatusConflict, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "LIFELINE_ALREADY_USED",
+					Message: "A double is already waiting for the next question",
+				},
+			})
+		case errors.Is(err, errLifelineLimitReached):
+			c.JSON(http.StatusConflict, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "LIFELINE_LIMIT_REACHED",
+					Message: "No uses of this lifeline are left",
+				},
+			})
+		case err == sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "QUIZ_NOT_FOUND",
+					Message: "Quiz not found",
+				},
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to use lifeline",
+				},
+			})
+		}
+		return
+	}
+
+	if req.Lifeline == LifelineSkip {
+		// Coalesced answer_status broadcast; a skip counts as answered but not towards any option
+		getAnswerAggregator().RecordAnswer(req.QuizID, previousOption, "")
+	}
+
+	status, err := loadLifelineStatus(db, participantID, limits)
+	if err == nil {
+		err = loadCurrentLifelines(db, status, currentQuizID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query lifelines",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "ライフラインを使用しました",
+		Data:    status,
+	})
+}
+
+// GetParticipantLifelines returns the lifelines a participant has left in their session and
+// the lifeline used on the current question, so a reloaded client can hide the same options
+func GetParticipantLifelines(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Lifelines are only shown to the participant themselves
+	if id != authenticatedParticipantID(c) {
+		participantForbidden(c, "Cannot view another participant's lifelines")
+		return
+	}
+
+	db := database.GetDB()
+
+	var limits models.LifelineCounts
+	var currentQuizID *int64
+	query := `SELECT COALESCE(s.lifeline_fifty_fifty, 0), COALESCE(s.lifeline_skip, 0), COALESCE(s.lifeline_double, 0),
+			  s.current_quiz_id
+			  FROM participants p
+			  LEFT JOIN quiz_sessions s ON s.id = p.session_id
+			  WHERE p.id = $1`
+	err := db.QueryRow(query, id).Scan(&limits.FiftyFifty, &limits.Skip, &limits.Double, &currentQuizID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "PARTICIPANT_NOT_FOUND",
+					Message: "Participant not found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query participant",
+			},
+		})
+		return
+	}
+
+	status, err := loadLifelineStatus(db, id, limits)
+	if err == nil {
+		err = loadCurrentLifelines(db, status, currentQuizID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query lifelines",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPickHiddenOptions(t *testing.T) {
+	for _, correct := range []string{"A", "B", "C", "D"} {
+		for range 20 {
+			hidden := pickHiddenOptions(correct)
+			if len(hidden) != 2 || hidden[0] >= hidden[1] {
+				t.Fatalf("Expected two distinct sorted options, got %v", hidden)
+			}
+			if slices.Contains(hidden, correct) {
+				t.Fatalf("The correct answer %s must never be hidden, got %v", correct, hidden)
+			}
+		}
+	}
+}
+
+func TestAnswerPoints(t *testing.T) {
+	double, fiftyFifty := LifelineDouble, LifelineFiftyFifty
+	tests := []struct {
+		name      string
+		isCorrect bool
+		lifeline  *string
+		expected  int
+	}{
+		{"Correct", true, nil, 1},
+		{"Wrong", false, nil, 0},
+		{"Correct with double", true, &double, 2},
+		{"Wrong with double", false, &double, 0},
+		{"Correct with 50/50", true, &fiftyFifty, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if points := answerPoints(tt.isCorrect, tt.lifeline); points != tt.expected {
+				t.Errorf("Expected %d points, got %d", tt.expected, points)
+			}
+		})
+	}
+}
+
+func TestLifelines(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	var participantID int64
+	send := func(handler gin.HandlerFunc, params gin.Params, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		c.Request, _ = http.NewRequest("POST", "/lifelines", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = params
+		c.Set("participant_id", participantID)
+		handler(c)
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		var response models.APIResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Error == nil {
+			return ""
+		}
+		return response.Error.Code
+	}
+
+	var quizIDs [3]int64
+	for i := range quizIDs {
+		err := db.QueryRow(`INSERT INTO quizzes (question_text, option_a, option_b, option_c, option_d, correct_answer)
+							VALUES ('Lifeline Question?', 'A', 'B', 'C', 'D', 'A')
+							RETURNING id`).Scan(&quizIDs[i])
+		if err != nil {
+			t.Fatalf("Failed to create test quiz: %v", err)
+		}
+	}
+
+	// 各ライフライン1回ずつ使えるセッションを開始
+	one := 1
+	start := models.SessionStartRequest{
+		QuizID:    quizIDs[0],
+		Lifelines: &models.LifelineLimitsRequest{FiftyFifty: &one, Skip: &one, Double: &one},
+	}
+	if w := send(StartSession, nil, start); w.Code != http.StatusOK {
+		t.Fatalf("Start session failed: %d %s", w.Code, w.Body.String())
+	}
+	defer send(EndSession, nil, nil)
+
+	w := send(RegisterParticipant, nil, models.ParticipantRequest{Nickname: fmt.Sprintf("Lifeline%d", os.Getpid())})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+	}
+	var registered struct {
+		Data struct {
+			ParticipantID int64 `json:"participant_id"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &registered)
+	participantID = registered.Data.ParticipantID
+
+	useLifeline := func(quizID int64, lifeline string) (*httptest.ResponseRecorder, models.LifelineStatus) {
+		w := send(UseLifeline, nil, models.LifelineRequest{QuizID: quizID, Lifeline: lifeline})
+		var response struct {
+			Data models.LifelineStatus `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response.Data
+	}
+	answer := func(quizID int64, option string) *httptest.ResponseRecorder {
+		return send(SubmitAnswer, nil, models.AnswerRequest{QuizID: quizID, SelectedOption: option})
+	}
+
+	// 問題1: 50/50は正解以外の2つを隠し、同じ問題では1つしか使えない
+	w, status := useLifeline(quizIDs[0], LifelineFiftyFifty)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("50/50 failed: %d %s", w.Code, w.Body.String())
+	}
+	if status.Current == nil || len(status.Current.HiddenOptions) != 2 || slices.Contains(status.Current.HiddenOptions, "A") {
+		t.Errorf("Expected two wrong options to be hidden, got %+v", status.Current)
+	}
+	if status.Remaining.FiftyFifty != 0 || status.Remaining.Double != 1 {
+		t.Errorf("Unexpected remaining lifelines %+v", status.Remaining)
+	}
+	if w, _ := useLifeline(quizIDs[0], LifelineSkip); w.Code != http.StatusConflict || errorCode(w) != "LIFELINE_ALREADY_USED" {
+		t.Errorf("Expected one lifeline per question, got %d %s", w.Code, w.Body.String())
+	}
+	if w := answer(quizIDs[0], "A"); w.Code != http.StatusCreated {
+		t.Fatalf("Submit answer failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// ダブルは回答済みの問題1ではなく次の問題に使う
+	w, status = useLifeline(quizIDs[0], LifelineDouble)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Double failed: %d %s", w.Code, w.Body.String())
+	}
+	if status.Pending == nil || status.Pending.QuizID != nil || status.Current == nil || status.Current.Lifeline != LifelineFiftyFifty {
+		t.Errorf("Expected the double to wait for the next question, got %+v", status)
+	}
+	if w, _ := useLifeline(quizIDs[0], LifelineDouble); w.Code != http.StatusConflict || errorCode(w) != "LIFELINE_ALREADY_USED" {
+		t.Errorf("Expected one double waiting at a time, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 再読み込みしたクライアントにも同じ選択肢を隠す
+	w = send(GetParticipantLifelines, gin.Params{{Key: "id", Value: fmt.Sprint(participantID)}}, nil)
+	var lifelines struct {
+		Data models.LifelineStatus `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &lifelines)
+	if w.Code != http.StatusOK || lifelines.Data.Current == nil || !slices.Equal(lifelines.Data.Current.HiddenOptions, status.Current.HiddenOptions) {
+		t.Errorf("Expected the same hidden options, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 問題2: 出題されるとダブルが適用され、この問題では他のライフラインを使えない
+	if w := send(NextQuestion, nil, models.SessionNextRequest{QuizID: quizIDs[1]}); w.Code != http.StatusOK {
+		t.Fatalf("Next question failed: %d %s", w.Code, w.Body.String())
+	}
+	w = send(GetParticipantLifelines, gin.Params{{Key: "id", Value: fmt.Sprint(participantID)}}, nil)
+	lifelines.Data = models.LifelineStatus{}
+	_ = json.Unmarshal(w.Body.Bytes(), &lifelines)
+	if current := lifelines.Data.Current; current == nil || current.Lifeline != LifelineDouble || current.QuizID == nil || *current.QuizID != quizIDs[1] || lifelines.Data.Pending != nil {
+		t.Errorf("Expected the double to apply to the next question, got %s", w.Body.String())
+	}
+	if w, _ := useLifeline(quizIDs[1], LifelineSkip); w.Code != http.StatusConflict || errorCode(w) != "LIFELINE_ALREADY_USED" {
+		t.Errorf("Expected the doubled question to have no other lifeline, got %d %s", w.Code, w.Body.String())
+	}
+	if w := answer(quizIDs[1], "A"); w.Code != http.StatusCreated {
+		t.Fatalf("Submit answer failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// 問題3: 使い切ったライフラインと無効なライフラインは使えない。スキップした問題には回答できない
+	if w := send(NextQuestion, nil, models.SessionNextRequest{QuizID: quizIDs[2]}); w.Code != http.StatusOK {
+		t.Fatalf("Next question failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := useLifeline(quizIDs[2], LifelineFiftyFifty); w.Code != http.StatusConflict || errorCode(w) != "LIFELINE_LIMIT_REACHED" {
+		t.Errorf("Expected the limit to be enforced, got %d %s", w.Code, w.Body.String())
+	}
+	zero := 0
+	if w := send(UpdateLobbySettings, nil, models.LobbyRequest{Lifelines: &models.LifelineLimitsRequest{Double: &zero}}); w.Code != http.StatusOK {
+		t.Fatalf("Update settings failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := useLifeline(quizIDs[2], LifelineDouble); w.Code != http.StatusForbidden || errorCode(w) != "LIFELINE_DISABLED" {
+		t.Errorf("Expected a disabled lifeline to be refused, got %d %s", w.Code, w.Body.String())
+	}
+	if w := answer(quizIDs[2], "B"); w.Code != http.StatusCreated {
+		t.Fatalf("Submit answer failed: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := useLifeline(quizIDs[2], LifelineSkip); w.Code != http.StatusCreated {
+		t.Fatalf("Skip failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := answer(quizIDs[2], "A"); w.Code != http.StatusConflict || errorCode(w) != "QUESTION_SKIPPED" {
+		t.Errorf("Expected a skipped question to stay skipped, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 回答履歴: スキップは回答数に含めず、ダブルは2点
+	w = send(GetParticipantAnswers, gin.Params{{Key: "id", Value: fmt.Sprint(participantID)}}, nil)
+	var history struct {
+		Data models.ParticipantAnswersResponse `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &history)
+	if history.Data.TotalAnswers != 2 || history.Data.CorrectAnswers != 2 || history.Data.SkippedAnswers != 1 || history.Data.TotalScore != 3 {
+		t.Errorf("Unexpected answer history %+v", history.Data)
+	}
+	for _, a := range history.Data.Answers {
+		if a.Lifeline == nil {
+			t.Errorf("Expected every answer to record its lifeline, got %+v", a)
+		}
+	}
+
+	// 集計: スキップとライフラインの使用数
+	results, err := getQuizResultsData(db, quizIDs[2], nil)
+	if err != nil {
+		t.Fatalf("Failed to get results: %v", err)
+	}
+	if results.SkippedCount != 1 || results.TotalAnswers != 0 || results.LifelineUsage.Skip != 1 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+}
@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Session statuses
+const (
+	SessionStatusLobby  = "lobby"  // participants are joining; no question has been shown
+	SessionStatusActive = "active" // questions are being asked
+	SessionStatusEnded  = "ended"
+)
+
+// Participant approval statuses
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+)
+
+// lobbyRosterDelay coalesces roster broadcasts when many participants join at once
+const lobbyRosterDelay = 500 * time.Millisecond
+
+// sessionSettings holds the lobby settings of a session
+type sessionSettings struct {
+	status          string
+	maxParticipants *int
+	requireApproval bool
+	gameMode        string
+}
+
+// loadSessionSettings returns the lobby settings of a session.
+// Participants registered without a session have no limit and need no approval.
+func loadSessionSettings(db *sql.DB, sessionID int64) (sessionSettings, error) {
+	settings := sessionSettings{status: SessionStatusActive, gameMode: GameModeStandard}
+	if sessionID == 0 {
+		return settings, nil
+	}
+
+	query := `SELECT status, max_participants, require_approval, game_mode FROM quiz_sessions WHERE id = $1`
+	err := db.QueryRow(query, sessionID).Scan(&settings.status, &settings.maxParticipants, &settings.requireApproval, &settings.gameMode)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// sessionHasRoom locks the session and reports whether another participant fits.
+// Participants awaiting approval hold a place; kicked and rejected participants do not.
+func sessionHasRoom(tx *sql.Tx, sessionID int64, maxParticipants int) (bool, error) {
+	var lockedID int64
+	if err := tx.QueryRow("SELECT id FROM quiz_sessions WHERE id = $1 FOR UPDATE", sessionID).Scan(&lockedID); err != nil {
+		return false, err
+	}
+
+	var count int
+	query := `SELECT COUNT(*) FROM participants WHERE session_id = $1 AND kicked_at IS NULL`
+	if err := tx.QueryRow(query, sessionID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count < maxParticipants, nil
+}
+
+// sessionFullResponse writes the error for a session that has reached its participant limit
+func sessionFullResponse(c *gin.Context) {
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "SESSION_FULL",
+			Message: "This session has reached its participant limit",
+		},
+	})
+}
+
+// getLobbyRoster returns the participants who joined a session and how many of them are
+// connected right now. Pending participants are counted, and listed if includePending is set.
+func getLobbyRoster(db *sql.DB, sessionID int64, includePending bool) (*models.LobbyRoster, error) {
+	settings, err := loadSessionSettings(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	roster := &models.LobbyRoster{
+		SessionID:       sessionID,
+		Status:          settings.status,
+		MaxParticipants: settings.maxParticipants,
+		RequireApproval: settings.requireApproval,
+		Participants:    []models.LobbyParticipant{},
+		UpdatedAt:       time.Now(),
+	}
+	if includePending {
+		roster.Pending = []models.LobbyParticipant{}
+	}
+
+	query := `SELECT id, nickname, is_hidden, team_id, approval_status, created_at,
+					 COALESCE(last_seen_at >= CURRENT_TIMESTAMP - $2 * INTERVAL '1 second', FALSE)
+			  FROM participants
+			  WHERE COALESCE(session_id, 0) = $1 AND kicked_at IS NULL
+			  ORDER BY created_at, id`
+
+	rows, err := db.Query(query, sessionID, presenceSettings().Timeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	for rows.Next() {
+		var participant models.LobbyParticipant
+		var isHidden bool
+		var approvalStatus string
+		err := rows.Scan(
+			&participant.ParticipantID,
+			&participant.Nickname,
+			&isHidden,
+			&participant.TeamID,
+			&approvalStatus,
+			&participant.JoinedAt,
+			&participant.Connected,
+		)
+		if err != nil {
+			return nil, err
+		}
+		participant.Nickname = displayNickname(participant.Nickname, isHidden)
+
+		if approvalStatus == ApprovalStatusPending {
+			roster.PendingCount++
+			if includePending {
+				roster.Pending = append(roster.Pending, participant)
+			}
+			continue
+		}
+
+		roster.JoinedCount++
+		if participant.Connected {
+			roster.ConnectedCount++
+		}
+		roster.Participants = append(roster.Participants, participant)
+	}
+	return roster, rows.Err()
+}
+
+// respondLobbyRoster writes the roster of the session in the session_id query parameter
+func respondLobbyRoster(c *gin.Context, includePending bool) {
+	sessionID, ok := sessionIDQuery(c)
+	if !ok {
+		return
+	}
+
+	roster, err := getLobbyRoster(database.GetDB(), sessionID, includePending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query lobby roster",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    roster,
+	})
+}
+
+// GetLobbyRoster returns the approved participants of a session for the projector.
+// The session defaults to the current one.
+func GetLobbyRoster(c *gin.Context) {
+	respondLobbyRoster(c, false)
+}
+
+// GetAdminLobbyRoster returns the roster including participants awaiting approval (admin only)
+func GetAdminLobbyRoster(c *gin.Context) {
+	respondLobbyRoster(c, true)
+}
+
+// OpenLobby opens a new session in the lobby phase (admin only). Participants join and appear
+// on the roster until the first question is started with /session/start. Participants who
+// registered while no session was open join it.
+func OpenLobby(c *gin.Context) {
+	var req models.LobbyRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	db := database.GetDB()
+
+	var status string
+	err := db.QueryRow("SELECT status FROM quiz_sessions ORDER BY id DESC LIMIT 1").Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query session",
+			},
+		})
+		return
+	}
+	if status == SessionStatusLobby {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "LOBBY_ALREADY_OPEN",
+				Message: "The current session is already in the lobby",
+			},
+		})
+		return
+	}
+
+	var maxParticipants int
+	if req.MaxParticipants != nil {
+		maxParticipants = *req.MaxParticipants
+	}
+	requireApproval := req.RequireApproval != nil && *req.RequireApproval
+	gameMode := GameModeStandard
+	if req.GameMode != nil {
+		gameMode = *req.GameMode
+	}
+	var questionLimit int
+	if req.QuestionLimit != nil {
+		questionLimit = *req.QuestionLimit
+	}
+
+	fiftyFifty, skip, double := lifelineLimitValues(req.Lifelines)
+
+	query := `INSERT INTO quiz_sessions (is_accepting_answers, status, max_participants, require_approval, game_mode, question_limit,
+			                             lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at)
+			  VALUES (false, $1, NULLIF($2, 0), $3, $4, NULLIF($5, 0), COALESCE($6, 0), COALESCE($7, 0), COALESCE($8, 0),
+			          CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			  RETURNING id, current_quiz_id, is_accepting_answers, status, max_participants, require_approval,
+			            game_mode, question_limit, lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at`
+
+	var session models.QuizSession
+	err = createSession(db, func(tx *sql.Tx) (int64, error) {
+		err := tx.QueryRow(query, SessionStatusLobby, maxParticipants, requireApproval, gameMode, questionLimit,
+			fiftyFifty, skip, double).Scan(
+			&session.ID,
+			&session.CurrentQuizID,
+			&session.IsAcceptingAnswers,
+			&session.Status,
+			&session.MaxParticipants,
+			&session.RequireApproval,
+			&session.GameMode,
+			&session.QuestionLimit,
+			&session.Lifelines.FiftyFifty,
+			&session.Lifelines.Skip,
+			&session.Lifelines.Double,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+		)
+		return session.ID, err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to create session",
+			},
+		})
+		return
+	}
+
+	BroadcastSessionUpdate(map[string]interface{}{
+		"session_id":           session.ID,
+		"is_accepting_answers": false,
+		"status":               SessionStatusLobby,
+	})
+	BroadcastLobbyRoster()
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "参加受付を開始しました",
+		Data:    session,
+	})
+}
+
+// UpdateLobbySettings changes the participant limit, approval setting, game mode and lifeline limits
+// of the current session (admin only). Turning approval off lets in everyone who is waiting.
+func UpdateLobbySettings(c *gin.Context) {
+	var req models.LobbyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	db := database.GetDB()
+	if req.GameMode != nil && !checkGameModeChangeable(c, db) {
+		return
+	}
+
+	query := `UPDATE quiz_sessions
+			  SET max_participants = CASE WHEN $1::INT IS NULL THEN max_participants ELSE NULLIF($1, 0) END,
+			      require_approval = COALESCE($2, require_approval),
+			      game_mode = COALESCE($3, game_mode),
+			      question_limit = CASE WHEN $4::INT IS NULL THEN question_limit ELSE NULLIF($4, 0) END,
+			      lifeline_fifty_fifty = COALESCE($5, lifeline_fifty_fifty),
+			      lifeline_skip = COALESCE($6, lifeline_skip),
+			      lifeline_double = COALESCE($7, lifeline_double),
+			      updated_at = CURRENT_TIMESTAMP
+			  WHERE id = (SELECT id FROM quiz_sessions ORDER BY id DESC LIMIT 1)
+			  RETURNING id, current_quiz_id, is_accepting_answers, status, max_participants, require_approval,
+			            game_mode, question_limit, lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at`
+
+	fiftyFifty, skip, double := lifelineLimitValues(req.Lifelines)
+	var session models.QuizSession
+	err := db.QueryRow(query, req.MaxParticipants, req.RequireApproval, req.GameMode, req.QuestionLimit,
+		fiftyFifty, skip, double).Scan(
+		&session.ID,
+		&session.CurrentQuizID,
+		&session.IsAcceptingAnswers,
+		&session.Status,
+		&session.MaxParticipants,
+		&session.RequireApproval,
+		&session.GameMode,
+		&session.QuestionLimit,
+		&session.Lifelines.FiftyFifty,
+		&session.Lifelines.Skip,
+		&session.Lifelines.Double,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "NO_ACTIVE_SESSION",
+					Message: "No active session found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to update session",
+			},
+		})
+		return
+	}
+
+	if !session.RequireApproval {
+		approveQuery := `UPDATE participants SET approval_status = $1
+						 WHERE session_id = $2 AND approval_status = $3 AND kicked_at IS NULL`
+		if _, err := db.Exec(approveQuery, ApprovalStatusApproved, session.ID, ApprovalStatusPending); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to approve waiting participants",
+				},
+			})
+			return
+		}
+	}
+
+	BroadcastLobbyRoster()
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "参加設定を更新しました",
+		Data:    session,
+	})
+}
+
+// setApprovalStatus moves a pending participant to the given approval status.
+// It writes an error response and returns false if the participant is not waiting for approval.
+func setApprovalStatus(c *gin.Context, db *sql.DB, participant *models.Participant, status string) bool {
+	query := `UPDATE participants
+			  SET approval_status = $2,
+			      kicked_at = CASE WHEN $2 = 'rejected' THEN CURRENT_TIMESTAMP ELSE kicked_at END,
+			      is_hidden = is_hidden OR $2 = 'rejected'
+			  WHERE id = $1 AND approval_status = 'pending' AND kicked_at IS NULL
+			  RETURNING approval_status, kicked_at, is_hidden`
+
+	err := db.QueryRow(query, participant.ID, status).Scan(&participant.ApprovalStatus, &participant.KickedAt, &participant.IsHidden)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "PARTICIPANT_NOT_PENDING",
+					Message: "Participant is not waiting for approval",
+				},
+			})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to update participant",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// ApproveParticipant lets a participant who is waiting for approval into the session (admin only)
+func ApproveParticipant(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	participant, ok := loadParticipantOrRespond(c, db, id)
+	if !ok {
+		return
+	}
+	if !setApprovalStatus(c, db, &participant, ApprovalStatusApproved) {
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        ParticipantActionApproved,
+		ParticipantID: participant.ID,
+	})
+	BroadcastParticipantUpdate(participant, ParticipantActionApproved)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "参加を承認しました",
+		Data:    participant,
+	})
+}
+
+// RejectParticipant declines a participant who is waiting for approval (admin only).
+// Like a kick, their nickname is freed and their connections are closed.
+func RejectParticipant(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ParticipantKickRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	db := database.GetDB()
+	participant, ok := loadParticipantOrRespond(c, db, id)
+	if !ok {
+		return
+	}
+	if !setApprovalStatus(c, db, &participant, ApprovalStatusRejected) {
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        ParticipantActionRejected,
+		ParticipantID: participant.ID,
+		Reason:        req.Reason,
+	})
+	BroadcastModerationNotice(EventTarget{ParticipantID: participant.ID}, ParticipantActionRejected, req.Reason)
+	BroadcastLobbyRoster()
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "参加を見送りました",
+		Data:    participant,
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLobby(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+
+	send := func(method, path string, handler gin.HandlerFunc, params gin.Params, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		c.Request, _ = http.NewRequest(method, path, bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = params
+		handler(c)
+		return w
+	}
+	roster := func(handler gin.HandlerFunc) models.LobbyRoster {
+		w := send("GET", "/session/lobby", handler, nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Get lobby roster failed: %d %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data models.LobbyRoster `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode lobby roster: %v", err)
+		}
+		return response.Data
+	}
+
+	// 定員2名・承認制で参加受付を開始
+	maxParticipants, requireApproval := 2, true
+	w := send("POST", "/admin/session/lobby", OpenLobby, nil, models.LobbyRequest{MaxParticipants: &maxParticipants, RequireApproval: &requireApproval})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Open lobby failed: %d %s", w.Code, w.Body.String())
+	}
+	defer func() {
+		// 後続のテストが登録できるよう制限を外してセッションを終了
+		unlimited, noApproval := 0, false
+		send("PUT", "/admin/session/lobby", UpdateLobbySettings, nil, models.LobbyRequest{MaxParticipants: &unlimited, RequireApproval: &noApproval})
+		send("POST", "/admin/session/end", EndSession, nil, nil)
+	}()
+
+	if w := send("POST", "/admin/session/lobby", OpenLobby, nil, nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected a second lobby to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	register := func(nickname string) (int, int64, string) {
+		w := send("POST", "/participants/register", RegisterParticipant, nil, models.ParticipantRequest{Nickname: nickname})
+		var response struct {
+			Data struct {
+				ParticipantID  int64  `json:"participant_id"`
+				ApprovalStatus string `json:"approval_status"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data.ParticipantID, response.Data.ApprovalStatus
+	}
+
+	suffix := os.Getpid()
+	code, first, status := register(fmt.Sprintf("LobbyA%d", suffix))
+	if code != http.StatusCreated || status != ApprovalStatusPending {
+		t.Fatalf("Expected a pending participant, got %d %q", code, status)
+	}
+	_, second, _ := register(fmt.Sprintf("LobbyB%d", suffix))
+	if code, _, _ := register(fmt.Sprintf("LobbyC%d", suffix)); code != http.StatusConflict {
+		t.Errorf("Expected a full session to refuse registration, got %d", code)
+	}
+
+	// 承認待ちの参加者は投影画面に表示されない
+	if r := roster(GetLobbyRoster); r.Status != SessionStatusLobby || r.JoinedCount != 0 || r.PendingCount != 2 || len(r.Pending) != 0 {
+		t.Errorf("Unexpected public roster %+v", r)
+	}
+	if r := roster(GetAdminLobbyRoster); len(r.Pending) != 2 {
+		t.Errorf("Expected admins to see pending participants, got %+v", r)
+	}
+
+	// 承認待ちの参加者は回答できない
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/answers", nil)
+	if checkParticipantCanAnswer(c, database.GetDB(), first) || w.Code != http.StatusForbidden {
+		t.Errorf("Expected a pending participant to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	idParams := func(id int64) gin.Params {
+		return gin.Params{{Key: "id", Value: fmt.Sprintf("%d", id)}}
+	}
+	if w := send("POST", "/admin/participants/approve", ApproveParticipant, idParams(first), nil); w.Code != http.StatusOK {
+		t.Errorf("Approve participant failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := send("POST", "/admin/participants/approve", ApproveParticipant, idParams(first), nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected approving twice to fail, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send("POST", "/admin/participants/reject", RejectParticipant, idParams(second), map[string]string{"reason": "unknown"}); w.Code != http.StatusOK {
+		t.Errorf("Reject participant failed: %d %s", w.Code, w.Body.String())
+	}
+
+	r := roster(GetLobbyRoster)
+	if r.JoinedCount != 1 || r.PendingCount != 0 || len(r.Participants) != 1 || r.Participants[0].ParticipantID != first {
+		t.Errorf("Expected only the approved participant on the roster, got %+v", r)
+	}
+
+	// 見送った参加者の枠は空く。承認制を外すと待機中の参加者も承認される
+	if code, _, status := register(fmt.Sprintf("LobbyC%d", suffix)); code != http.StatusCreated || status != ApprovalStatusPending {
+		t.Errorf("Expected registration after a rejection, got %d %q", code, status)
+	}
+	noApproval := false
+	if w := send("PUT", "/admin/session/lobby", UpdateLobbySettings, nil, models.LobbyRequest{RequireApproval: &noApproval}); w.Code != http.StatusOK {
+		t.Errorf("Update lobby settings failed: %d %s", w.Code, w.Body.String())
+	}
+	if r := roster(GetLobbyRoster); r.JoinedCount != 2 || r.PendingCount != 0 || r.MaxParticipants == nil || *r.MaxParticipants != 2 {
+		t.Errorf("Unexpected roster after turning approval off %+v", r)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// loginLocked refuses a login with 429 if the username or the client's address is locked out.
+// Lockout check failures are logged and the login proceeds, since the password is still checked.
+func loginLocked(c *gin.Context, guard *services.LoginGuard, username string) bool {
+	wait, err := guard.Check(username, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to check login lockout: %v", err)
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	recordLoginEvent(c, guard, nil, username, false, services.LoginReasonLockedOut)
+	respondLoginLocked(c, wait)
+	return true
+}
+
+// respondLoginLocked writes the response for a locked out login with a Retry-After hint
+func respondLoginLocked(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "LOGIN_LOCKED",
+			Message: "Too many failed login attempts. Please try again later.",
+		},
+	})
+}
+
+// recordLoginFailure counts a failed login for the username and the client's address and records it
+func recordLoginFailure(c *gin.Context, guard *services.LoginGuard, username, reason string) {
+	if _, err := guard.RecordFailure(username, c.ClientIP()); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	recordLoginEvent(c, guard, nil, username, false, reason)
+}
+
+// recordLoginSuccess clears the failures of an administrator who signed in and records the login
+func recordLoginSuccess(c *gin.Context, guard *services.LoginGuard, admin *models.Administrator, reason string) {
+	if err := guard.RecordSuccess(admin.Username); err != nil {
+		log.Printf("Failed to clear login failures: %v", err)
+	}
+	recordLoginEvent(c, guard, &admin.ID, admin.Username, true, reason)
+}
+
+// recordLoginEvent adds a login attempt to the login audit. Failures are logged so that
+// an audit problem does not block logins.
+func recordLoginEvent(c *gin.Context, guard *services.LoginGuard, adminID *int64, username string, success bool, reason string) {
+	err := guard.RecordEvent(models.LoginEvent{
+		AdminID:   adminID,
+		Username:  username,
+		Success:   success,
+		Reason:    reason,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		log.Printf("Failed to record login event: %v", err)
+	}
+}
+
+// GetLoginEvents returns administrator login attempts, newest first (owner only).
+// Filter with admin_id, username, ip_address, success and the from/to time range (RFC 3339).
+func GetLoginEvents(c *gin.Context) {
+	page, limit, _ := getPaginationParams(c)
+
+	params := newQueryFilter(c)
+	filter := services.LoginEventFilter{
+		AdminID:   params.id("admin_id"),
+		Username:  c.Query("username"),
+		IPAddress: c.Query("ip_address"),
+		Success:   params.bool("success"),
+		From:      params.time("from"),
+		To:        params.time("to"),
+	}
+	if !params.ok() {
+		return
+	}
+
+	events, total, err := services.NewLoginGuard().ListEvents(filter, page, limit)
+	if err != nil {
+		log.Printf("Failed to query login events: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query login events",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.PaginatedResponse{
+			Data:  events,
+			Total: total,
+			Page:  page,
+			Limit: limit,
+		},
+	})
+}
+
+// UnlockAdminLogin clears the failed login attempts and lockout of an administrator (owner only)
+func UnlockAdminLogin(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	admin, err := services.NewAuthService().GetAdminByID(id)
+	if err != nil {
+		respondAdminError(c, err, "Failed to get administrator")
+		return
+	}
+	if err := services.NewLoginGuard().Unlock(admin.Username); err != nil {
+		respondAdminError(c, err, "Failed to unlock login")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ログインのロックを解除しました",
+	})
+}
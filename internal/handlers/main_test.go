@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+func TestMain(m *testing.M) {
+	// サーバーの起動時と同じく、管理者トークンのサービスを設定する
+	UseJWTService(services.NewJWTService())
+	os.Exit(m.Run())
+}
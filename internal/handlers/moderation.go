@@ -0,0 +1,1063 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// hiddenNicknameLabel replaces the nickname of hidden participants in results and rankings
+const hiddenNicknameLabel = "非表示の参加者"
+
+// nicknameSuggestionCount is the number of alternatives offered when a nickname is taken
+const nicknameSuggestionCount = 3
+
+// Participant update actions broadcast as participant_update
+const (
+	ParticipantActionRenamed = "renamed"
+	ParticipantActionHidden  = "hidden"
+	ParticipantActionShown   = "shown"
+	ParticipantActionKicked  = "kicked"
+	ParticipantActionBanned  = "banned"
+	// ParticipantActionTeamChanged is sent when an admin moves a participant to another team
+	ParticipantActionTeamChanged = "team_changed"
+	// ParticipantActionApproved is sent when an admin lets a participant into a session that requires approval.
+	// Rejected participants only receive a moderation_notice, as their nickname was never shown.
+	ParticipantActionApproved = "approved"
+	ParticipantActionRejected = "rejected"
+)
+
+// nicknamePolicy is loaded once so the deny-list file is not read on every registration
+var nicknamePolicy = sync.OnceValues(services.NewNicknamePolicy)
+
+// displayNickname returns the nickname shown in results and rankings
+func displayNickname(nickname string, hidden bool) string {
+	if hidden {
+		return hiddenNicknameLabel
+	}
+	return nickname
+}
+
+// checkNickname applies the nickname policy and returns the display form and key.
+// It writes an error response and returns false if the nickname may not be used.
+func checkNickname(c *gin.Context, nickname string) (string, string, bool) {
+	policy, err := nicknamePolicy()
+	if err != nil {
+		log.Printf("Failed to load nickname policy: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "CONFIGURATION_ERROR",
+				Message: "Nickname policy is not available",
+			},
+		})
+		return "", "", false
+	}
+
+	display, key, err := policy.Normalize(nickname)
+	switch {
+	case errors.Is(err, services.ErrNicknameDenied):
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "NICKNAME_NOT_ALLOWED",
+				Message: "This nickname is not allowed",
+			},
+		})
+		return "", "", false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_NICKNAME",
+				Message: "Nickname must contain visible characters and be at most 50 characters",
+			},
+		})
+		return "", "", false
+	}
+
+	return display, key, true
+}
+
+// nicknameTaken reports whether another active participant in the session uses the nickname key
+func nicknameTaken(db *sql.DB, sessionID int64, key string, excludeID int64) (bool, error) {
+	query := `SELECT EXISTS (
+				  SELECT 1 FROM participants
+				  WHERE COALESCE(session_id, 0) = $1 AND nickname_key = $2
+				    AND kicked_at IS NULL AND id <> $3
+			  )`
+
+	var taken bool
+	err := db.QueryRow(query, sessionID, key, excludeID).Scan(&taken)
+	return taken, err
+}
+
+// nicknameSuggestions returns nicknames similar to display that are free in the session
+func nicknameSuggestions(db *sql.DB, sessionID int64, display, key string) []string {
+	// Keys are letters and digits only, so they are safe in a LIKE pattern
+	query := `SELECT nickname_key FROM participants
+			  WHERE COALESCE(session_id, 0) = $1 AND nickname_key LIKE $2 AND kicked_at IS NULL`
+
+	taken := make(map[string]bool)
+	rows, err := db.Query(query, sessionID, key+"%")
+	if err == nil {
+		defer func() {
+			_ = rows.Close() // Ignore close error in defer
+		}()
+		for rows.Next() {
+			var existing string
+			if err := rows.Scan(&existing); err == nil {
+				taken[existing] = true
+			}
+		}
+	}
+
+	policy, err := nicknamePolicy()
+	if err != nil {
+		return []string{}
+	}
+	return policy.Suggest(display, func(candidate string) bool { return taken[candidate] }, nicknameSuggestionCount)
+}
+
+// nicknameTakenResponse writes the conflict response for a nickname already used in the session
+func nicknameTakenResponse(c *gin.Context, suggestions []string) {
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Data: map[string]interface{}{
+			"suggestions": suggestions,
+		},
+		Error: &models.APIError{
+			Code:    "NICKNAME_TAKEN",
+			Message: "This nickname is already used in this session",
+		},
+	})
+}
+
+// participantIDParam parses the participant ID path parameter, writing an error response if it is invalid
+func participantIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid participant ID",
+			},
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// sessionIDQuery returns the session_id query parameter, defaulting to the current session.
+// It writes an error response and returns false if the parameter is invalid.
+func sessionIDQuery(c *gin.Context) (int64, bool) {
+	sessionIDStr := c.Query("session_id")
+	if sessionIDStr == "" {
+		return currentSessionID(), true
+	}
+
+	id, err := strconv.ParseInt(sessionIDStr, 10, 64)
+	if err != nil || id < 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid session ID",
+			},
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// loadParticipant returns a participant with their moderation state
+func loadParticipant(db *sql.DB, id int64) (models.Participant, error) {
+	var participant models.Participant
+	query := `SELECT id, nickname, session_id, is_hidden, kicked_at, answers_excluded, team_id, approval_status, eliminated_at, created_at
+			  FROM participants WHERE id = $1`
+
+	err := db.QueryRow(query, id).Scan(
+		&participant.ID,
+		&participant.Nickname,
+		&participant.SessionID,
+		&participant.IsHidden,
+		&participant.KickedAt,
+		&participant.AnswersExcluded,
+		&participant.TeamID,
+		&participant.ApprovalStatus,
+		&participant.EliminatedAt,
+		&participant.CreatedAt,
+	)
+	return participant, err
+}
+
+// loadParticipantOrRespond loads a participant, writing an error response if they cannot be loaded
+func loadParticipantOrRespond(c *gin.Context, db *sql.DB, id int64) (models.Participant, bool) {
+	participant, err := loadParticipant(db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "PARTICIPANT_NOT_FOUND",
+					Message: "Participant not found",
+				},
+			})
+			return participant, false
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query participant",
+			},
+		})
+		return participant, false
+	}
+	return participant, true
+}
+
+// Error codes for participants refused by moderation
+const (
+	codeParticipantKicked     = "PARTICIPANT_KICKED"
+	codeParticipantBanned     = "PARTICIPANT_BANNED"
+	codeParticipantRejected   = "PARTICIPANT_REJECTED"
+	codeParticipantPending    = "PARTICIPANT_PENDING_APPROVAL"
+	codeParticipantEliminated = "PARTICIPANT_ELIMINATED"
+)
+
+// participantRestriction returns the error code that blocks a participant or IP address
+// in the current session, or "" if neither is blocked. Pass participantID 0 to check the IP only.
+func participantRestriction(db *sql.DB, participantID int64, ip string) (string, error) {
+	banQuery := `SELECT EXISTS (
+					 SELECT 1 FROM participant_bans
+					 WHERE COALESCE(session_id, 0) = $1 AND lifted_at IS NULL
+					   AND (participant_id = $2 OR ip_address = $3)
+				 )`
+
+	var banned bool
+	if err := db.QueryRow(banQuery, currentSessionID(), participantID, ip).Scan(&banned); err != nil {
+		return "", err
+	}
+	if banned {
+		return codeParticipantBanned, nil
+	}
+
+	if participantID == 0 {
+		return "", nil
+	}
+
+	var kicked, eliminated bool
+	var approvalStatus string
+	query := "SELECT kicked_at IS NOT NULL, eliminated_at IS NOT NULL, approval_status FROM participants WHERE id = $1"
+	err := db.QueryRow(query, participantID).Scan(&kicked, &eliminated, &approvalStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	switch {
+	case approvalStatus == ApprovalStatusRejected:
+		return codeParticipantRejected, nil
+	case kicked:
+		return codeParticipantKicked, nil
+	case approvalStatus == ApprovalStatusPending:
+		return codeParticipantPending, nil
+	case eliminated:
+		return codeParticipantEliminated, nil
+	}
+	return "", nil
+}
+
+// checkParticipantAccess refuses kicked or rejected participants and banned participants or
+// IP addresses. Participants awaiting approval or eliminated from an elimination game may
+// rejoin and connect to watch but not answer.
+// It writes an error response and returns false if the request must not proceed.
+func checkParticipantAccess(c *gin.Context, db *sql.DB, participantID int64) bool {
+	return checkParticipant(c, db, participantID, true)
+}
+
+// checkParticipantCanAnswer is checkParticipantAccess for answers, which also requires approval
+// and, in an elimination game, that the participant is still in
+func checkParticipantCanAnswer(c *gin.Context, db *sql.DB, participantID int64) bool {
+	return checkParticipant(c, db, participantID, false)
+}
+
+// checkParticipant writes an error response and returns false if the participant is restricted
+func checkParticipant(c *gin.Context, db *sql.DB, participantID int64, allowSpectators bool) bool {
+	if db == nil {
+		// Nothing to enforce without a database
+		return true
+	}
+
+	code, err := participantRestriction(db, participantID, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to check participant",
+			},
+		})
+		return false
+	}
+
+	switch code {
+	case codeParticipantBanned:
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    codeParticipantBanned,
+				Message: "You have been banned from this session",
+			},
+		})
+		return false
+	case codeParticipantKicked:
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    codeParticipantKicked,
+				Message: "You have been removed from this session",
+			},
+		})
+		return false
+	case codeParticipantRejected:
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    codeParticipantRejected,
+				Message: "Your request to join this session was declined",
+			},
+		})
+		return false
+	case codeParticipantPending:
+		if allowSpectators {
+			return true
+		}
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    codeParticipantPending,
+				Message: "Waiting for an admin to approve you",
+			},
+		})
+		return false
+	case codeParticipantEliminated:
+		if allowSpectators {
+			return true
+		}
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    codeParticipantEliminated,
+				Message: "You have been eliminated and can only watch",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// adminIDFromContext returns the admin ID set by middleware.JWTAuth, or nil
+func adminIDFromContext(c *gin.Context) *int64 {
+	value, exists := c.Get("admin_id")
+	if !exists {
+		return nil
+	}
+	id, ok := value.(int64)
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// moderationAction describes an admin action for the moderation audit log
+type moderationAction struct {
+	Action        string
+	ParticipantID int64
+	IPAddress     string
+	Reason        string
+	Details       map[string]interface{}
+}
+
+// recordModerationAction writes an entry to the moderation audit log.
+// The action has already been applied, so a failure is logged rather than returned.
+func recordModerationAction(c *gin.Context, db *sql.DB, action moderationAction) {
+	var details *string
+	if action.Details != nil {
+		if encoded, err := json.Marshal(action.Details); err == nil {
+			value := string(encoded)
+			details = &value
+		}
+	}
+
+	query := `INSERT INTO moderation_audit_log (session_id, admin_id, action, participant_id, ip_address, reason, details)
+			  VALUES (NULLIF($1, 0), $2, $3, NULLIF($4, 0), NULLIF($5, ''), $6, $7)`
+
+	_, err := db.Exec(query, currentSessionID(), adminIDFromContext(c), action.Action, action.ParticipantID, action.IPAddress, action.Reason, details)
+	if err != nil {
+		log.Printf("Failed to record moderation action %s: %v", action.Action, err)
+	}
+}
+
+// ListParticipants lists the participants of a session with their moderation state (admin only).
+// The session defaults to the current one; session_id=0 lists participants registered without a session.
+func ListParticipants(c *gin.Context) {
+	page, limit, _ := getPaginationParams(c)
+
+	sessionID, ok := sessionIDQuery(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM participants WHERE COALESCE(session_id, 0) = $1`
+	if err := db.QueryRow(countQuery, sessionID).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to count participants",
+			},
+		})
+		return
+	}
+
+	query := `SELECT id, nickname, session_id, is_hidden, kicked_at, answers_excluded, team_id, approval_status, eliminated_at, created_at
+			  FROM participants
+			  WHERE COALESCE(session_id, 0) = $1
+			  ORDER BY id
+			  LIMIT $2 OFFSET $3`
+
+	rows, err := db.Query(query, sessionID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query participants",
+			},
+		})
+		return
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	participants := []models.Participant{}
+	for rows.Next() {
+		var participant models.Participant
+		err := rows.Scan(
+			&participant.ID,
+			&participant.Nickname,
+			&participant.SessionID,
+			&participant.IsHidden,
+			&participant.KickedAt,
+			&participant.AnswersExcluded,
+			&participant.TeamID,
+			&participant.ApprovalStatus,
+			&participant.EliminatedAt,
+			&participant.CreatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "SCAN_ERROR",
+					Message: "Failed to scan participant data",
+				},
+			})
+			return
+		}
+		participants = append(participants, participant)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.PaginatedResponse{
+			Data:  participants,
+			Total: total,
+			Page:  page,
+			Limit: limit,
+		},
+	})
+}
+
+// RenameParticipant changes a participant's nickname (admin only).
+// The new nickname goes through the same policy and uniqueness checks as registration.
+func RenameParticipant(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ParticipantRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	display, key, ok := checkNickname(c, req.Nickname)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	participant, ok := loadParticipantOrRespond(c, db, id)
+	if !ok {
+		return
+	}
+
+	var sessionID int64
+	if participant.SessionID != nil {
+		sessionID = *participant.SessionID
+	}
+
+	taken, err := nicknameTaken(db, sessionID, key, participant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to check nickname",
+			},
+		})
+		return
+	}
+	if taken {
+		nicknameTakenResponse(c, nicknameSuggestions(db, sessionID, display, key))
+		return
+	}
+
+	_, err = db.Exec("UPDATE participants SET nickname = $1, nickname_key = $2 WHERE id = $3", display, key, participant.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			nicknameTakenResponse(c, nicknameSuggestions(db, sessionID, display, key))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to rename participant",
+			},
+		})
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        ParticipantActionRenamed,
+		ParticipantID: participant.ID,
+		Details:       map[string]interface{}{"from": participant.Nickname, "to": display},
+	})
+
+	participant.Nickname = display
+	BroadcastParticipantUpdate(participant, ParticipantActionRenamed)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ニックネームを変更しました",
+		Data:    participant,
+	})
+}
+
+// SetParticipantVisibility hides or shows a participant's nickname in results and rankings (admin only)
+func SetParticipantVisibility(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ParticipantVisibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	db := database.GetDB()
+	participant, ok := loadParticipantOrRespond(c, db, id)
+	if !ok {
+		return
+	}
+
+	if _, err := db.Exec("UPDATE participants SET is_hidden = $1 WHERE id = $2", *req.Hidden, participant.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to update participant",
+			},
+		})
+		return
+	}
+
+	participant.IsHidden = *req.Hidden
+	action := ParticipantActionShown
+	message := "ニックネームを表示しました"
+	if participant.IsHidden {
+		action = ParticipantActionHidden
+		message = "ニックネームを非表示にしました"
+	}
+	recordModerationAction(c, db, moderationAction{Action: action, ParticipantID: participant.ID})
+	BroadcastParticipantUpdate(participant, action)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    participant,
+	})
+}
+
+// bindOptionalJSON binds a JSON body that may be omitted.
+// It writes an error response and returns false if a body is present but invalid.
+func bindOptionalJSON(c *gin.Context, req interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// removeParticipant marks a participant as kicked and hides their nickname.
+// With excludeAnswers their answers are also left out of results and rankings.
+func removeParticipant(db *sql.DB, participant *models.Participant, excludeAnswers bool) error {
+	query := `UPDATE participants
+			  SET kicked_at = COALESCE(kicked_at, CURRENT_TIMESTAMP),
+			      is_hidden = TRUE,
+			      answers_excluded = answers_excluded OR $2
+			  WHERE id = $1
+			  RETURNING kicked_at, answers_excluded`
+
+	var kickedAt time.Time
+	if err := db.QueryRow(query, participant.ID, excludeAnswers).Scan(&kickedAt, &participant.AnswersExcluded); err != nil {
+		return err
+	}
+	participant.IsHidden = true
+	participant.KickedAt = &kickedAt
+	return nil
+}
+
+// refreshResults recounts the current question after answers were excluded and broadcasts the new
+// results and team ranking. Individual rankings are computed on request and need no refresh.
+func refreshResults(db *sql.DB) {
+	BroadcastTeamRanking()
+
+	var quizID sql.NullInt64
+	if err := db.QueryRow("SELECT current_quiz_id FROM quiz_sessions ORDER BY id DESC LIMIT 1").Scan(&quizID); err != nil || !quizID.Valid {
+		return
+	}
+
+	getAnswerAggregator().Reload(quizID.Int64)
+	BroadcastResultUpdate(quizID.Int64)
+}
+
+// KickParticipant removes a participant from the session (admin only).
+// Their connections receive a moderation_notice and are closed, their nickname is hidden
+// and freed for others, and they can no longer answer or rejoin.
+func KickParticipant(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ParticipantKickRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	db := database.GetDB()
+	participant, ok := loadParticipantOrRespond(c, db, id)
+	if !ok {
+		return
+	}
+
+	if participant.KickedAt != nil {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "PARTICIPANT_ALREADY_KICKED",
+				Message: "Participant has already been removed",
+			},
+		})
+		return
+	}
+
+	if err := removeParticipant(db, &participant, req.ExcludeAnswers); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to remove participant",
+			},
+		})
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        ParticipantActionKicked,
+		ParticipantID: participant.ID,
+		Reason:        req.Reason,
+		Details:       map[string]interface{}{"exclude_answers": req.ExcludeAnswers},
+	})
+	BroadcastParticipantUpdate(participant, ParticipantActionKicked)
+	BroadcastModerationNotice(EventTarget{ParticipantID: participant.ID}, ParticipantActionKicked, req.Reason)
+	if req.ExcludeAnswers {
+		refreshResults(db)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "参加者を退場させました",
+		Data:    participant,
+	})
+}
+
+// BanParticipant bans a participant, an IP address or both for the rest of the current session (admin only).
+// A banned participant is also kicked. Connections from a banned IP address are closed, and it
+// can no longer register, rejoin, connect or answer until the session ends or the ban is lifted.
+func BanParticipant(c *gin.Context) {
+	var req models.ParticipantBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	if req.ParticipantID == nil && req.IPAddress == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Either participant_id or ip_address is required",
+			},
+		})
+		return
+	}
+
+	db := database.GetDB()
+
+	var participant models.Participant
+	if req.ParticipantID != nil {
+		var ok bool
+		participant, ok = loadParticipantOrRespond(c, db, *req.ParticipantID)
+		if !ok {
+			return
+		}
+		if err := removeParticipant(db, &participant, req.ExcludeAnswers); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to remove participant",
+				},
+			})
+			return
+		}
+	}
+
+	query := `INSERT INTO participant_bans (session_id, participant_id, ip_address, reason, banned_by)
+			  VALUES (NULLIF($1, 0), $2, NULLIF($3, ''), $4, $5)
+			  RETURNING id, session_id, participant_id, ip_address, reason, banned_by, created_at`
+
+	var ban models.ParticipantBan
+	err := db.QueryRow(query, currentSessionID(), req.ParticipantID, req.IPAddress, req.Reason, adminIDFromContext(c)).Scan(
+		&ban.ID,
+		&ban.SessionID,
+		&ban.ParticipantID,
+		&ban.IPAddress,
+		&ban.Reason,
+		&ban.BannedBy,
+		&ban.CreatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to ban participant",
+			},
+		})
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        ParticipantActionBanned,
+		ParticipantID: participant.ID,
+		IPAddress:     req.IPAddress,
+		Reason:        req.Reason,
+		Details:       map[string]interface{}{"ban_id": ban.ID, "exclude_answers": req.ExcludeAnswers},
+	})
+	if participant.ID != 0 {
+		BroadcastParticipantUpdate(participant, ParticipantActionBanned)
+	}
+	BroadcastModerationNotice(EventTarget{ParticipantID: participant.ID, RemoteIP: req.IPAddress}, ParticipantActionBanned, req.Reason)
+	if participant.ID != 0 && req.ExcludeAnswers {
+		refreshResults(db)
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "入場禁止にしました",
+		Data:    ban,
+	})
+}
+
+// ListBans lists the bans of a session, including lifted ones (admin only).
+// The session defaults to the current one.
+func ListBans(c *gin.Context) {
+	sessionID, ok := sessionIDQuery(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	query := `SELECT id, session_id, participant_id, ip_address, reason, banned_by, created_at, lifted_at
+			  FROM participant_bans
+			  WHERE COALESCE(session_id, 0) = $1
+			  ORDER BY created_at DESC`
+
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query bans",
+			},
+		})
+		return
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	bans := []models.ParticipantBan{}
+	for rows.Next() {
+		var ban models.ParticipantBan
+		err := rows.Scan(
+			&ban.ID,
+			&ban.SessionID,
+			&ban.ParticipantID,
+			&ban.IPAddress,
+			&ban.Reason,
+			&ban.BannedBy,
+			&ban.CreatedAt,
+			&ban.LiftedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "SCAN_ERROR",
+					Message: "Failed to scan ban data",
+				},
+			})
+			return
+		}
+		bans = append(bans, ban)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    bans,
+	})
+}
+
+// LiftBan lifts a ban (admin only). A participant who was kicked by the ban stays kicked.
+func LiftBan(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid ban ID",
+			},
+		})
+		return
+	}
+
+	db := database.GetDB()
+	query := `UPDATE participant_bans SET lifted_at = CURRENT_TIMESTAMP
+			  WHERE id = $1 AND lifted_at IS NULL
+			  RETURNING COALESCE(participant_id, 0), COALESCE(ip_address, '')`
+
+	var participantID int64
+	var ipAddress string
+	if err := db.QueryRow(query, id).Scan(&participantID, &ipAddress); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "BAN_NOT_FOUND",
+					Message: "Ban not found or already lifted",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to lift ban",
+			},
+		})
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        "unbanned",
+		ParticipantID: participantID,
+		IPAddress:     ipAddress,
+		Details:       map[string]interface{}{"ban_id": id},
+	})
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "入場禁止を解除しました",
+	})
+}
+
+// GetModerationAuditLog returns moderation actions, newest first (admin only).
+// Filter with participant_id, action and session_id.
+func GetModerationAuditLog(c *gin.Context) {
+	page, limit, _ := getPaginationParams(c)
+
+	var participantID, sessionID int64
+	for param, target := range map[string]*int64{"participant_id": &participantID, "session_id": &sessionID} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id < 1 {
+				c.JSON(http.StatusBadRequest, models.APIResponse{
+					Success: false,
+					Error: &models.APIError{
+						Code:    "INVALID_ID",
+						Message: "Invalid " + param,
+					},
+				})
+				return
+			}
+			*target = id
+		}
+	}
+	action := c.Query("action")
+
+	db := database.GetDB()
+
+	// Zero and empty filters match every entry
+	filter := `WHERE ($1 = 0 OR participant_id = $1)
+			     AND ($2 = '' OR action = $2)
+			     AND ($3 = 0 OR session_id = $3)`
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM moderation_audit_log "+filter, participantID, action, sessionID).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to count audit log entries",
+			},
+		})
+		return
+	}
+
+	query := `SELECT id, session_id, admin_id, action, participant_id, ip_address, reason, details, created_at
+			  FROM moderation_audit_log ` + filter + `
+			  ORDER BY created_at DESC, id DESC
+			  LIMIT $4 OFFSET $5`
+
+	rows, err := db.Query(query, participantID, action, sessionID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query audit log",
+			},
+		})
+		return
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	entries := []models.ModerationAuditEntry{}
+	for rows.Next() {
+		var entry models.ModerationAuditEntry
+		var details []byte
+		err := rows.Scan(
+			&entry.ID,
+			&entry.SessionID,
+			&entry.AdminID,
+			&entry.Action,
+			&entry.ParticipantID,
+			&entry.IPAddress,
+			&entry.Reason,
+			&details,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "SCAN_ERROR",
+					Message: "Failed to scan audit log data",
+				},
+			})
+			return
+		}
+		entry.Details = details
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.PaginatedResponse{
+			Data:  entries,
+			Total: total,
+			Page:  page,
+			Limit: limit,
+		},
+	})
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDisplayNickname(t *testing.T) {
+	if got := displayNickname("Taro", false); got != "Taro" {
+		t.Errorf("Expected visible nickname, got %q", got)
+	}
+	if got := displayNickname("Taro", true); got != hiddenNicknameLabel {
+		t.Errorf("Expected hidden nickname to be masked, got %q", got)
+	}
+}
+
+func TestParticipantModeration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+
+	// 同じセッションに参加者を2人登録
+	register := func(nickname string) (int64, string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(models.ParticipantRequest{Nickname: nickname})
+		c.Request, _ = http.NewRequest("POST", "/participants/register", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		RegisterParticipant(c)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Data struct {
+				ParticipantID int64  `json:"participant_id"`
+				Token         string `json:"token"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode register response: %v", err)
+		}
+		return response.Data.ParticipantID, response.Data.Token
+	}
+
+	suffix := os.Getpid()
+	participantID, token := register(fmt.Sprintf("ModUser%d", suffix))
+	register(fmt.Sprintf("ModOther%d", suffix))
+
+	idParam := gin.Params{{Key: "id", Value: fmt.Sprintf("%d", participantID)}}
+
+	tests := []struct {
+		name           string
+		method         string
+		handler        gin.HandlerFunc
+		requestBody    interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "Rename to a nickname taken in the session",
+			method:         "PUT",
+			handler:        RenameParticipant,
+			requestBody:    models.ParticipantRenameRequest{Nickname: fmt.Sprintf("modother%d", suffix)},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Rename to a denied nickname",
+			method:         "PUT",
+			handler:        RenameParticipant,
+			requestBody:    models.ParticipantRenameRequest{Nickname: "Administrator"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Rename participant",
+			method:         "PUT",
+			handler:        RenameParticipant,
+			requestBody:    models.ParticipantRenameRequest{Nickname: fmt.Sprintf("Renamed%d", suffix)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Visibility without hidden flag",
+			method:         "PUT",
+			handler:        SetParticipantVisibility,
+			requestBody:    map[string]interface{}{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Hide participant",
+			method:         "PUT",
+			handler:        SetParticipantVisibility,
+			requestBody:    map[string]interface{}{"hidden": true},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Kick participant",
+			method:         "POST",
+			handler:        KickParticipant,
+			requestBody:    nil,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Kick participant twice",
+			method:         "POST",
+			handler:        KickParticipant,
+			requestBody:    nil,
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			body, err := json.Marshal(tt.requestBody)
+			if err != nil {
+				t.Fatalf("Failed to marshal request body: %v", err)
+			}
+
+			c.Request, _ = http.NewRequest(tt.method, "/admin/participants/"+idParam[0].Value, bytes.NewBuffer(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = idParam
+
+			tt.handler(c)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d. Response body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// 退場させた参加者は再接続できない
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(models.ParticipantRejoinRequest{Token: token})
+	c.Request, _ = http.NewRequest("POST", "/participants/rejoin", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	RejoinParticipant(c)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected kicked participant to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 退場させた参加者のニックネームは再び使える
+	register(fmt.Sprintf("Renamed%d", suffix))
+}
+
+func TestParticipantBans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+
+	// ban 対象ごとに別の IP アドレスを使う
+	ip := fmt.Sprintf("192.0.2.%d", os.Getpid()%250+1)
+	send := func(method, path string, handler gin.HandlerFunc, params gin.Params, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		c.Request, _ = http.NewRequest(method, path, bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.RemoteAddr = ip + ":12345"
+		c.Params = params
+		handler(c)
+		return w
+	}
+
+	w := send("POST", "/participants/register", RegisterParticipant, nil,
+		models.ParticipantRequest{Nickname: fmt.Sprintf("BanUser%d", os.Getpid())})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+	}
+	var registered struct {
+		Data struct {
+			ParticipantID int64 `json:"participant_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &registered); err != nil {
+		t.Fatalf("Failed to decode register response: %v", err)
+	}
+	participantID := registered.Data.ParticipantID
+
+	// 参加者と IP アドレスを入場禁止にする
+	w = send("POST", "/admin/bans", BanParticipant, nil, map[string]interface{}{})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected ban without target to fail, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = send("POST", "/admin/bans", BanParticipant, nil, models.ParticipantBanRequest{
+		ParticipantID:  &participantID,
+		IPAddress:      ip,
+		Reason:         "spam",
+		ExcludeAnswers: true,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Ban participant failed: %d %s", w.Code, w.Body.String())
+	}
+	var banned struct {
+		Data models.ParticipantBan `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &banned); err != nil {
+		t.Fatalf("Failed to decode ban response: %v", err)
+	}
+
+	participant, err := loadParticipant(database.GetDB(), participantID)
+	if err != nil {
+		t.Fatalf("Failed to load participant: %v", err)
+	}
+	if participant.KickedAt == nil || !participant.AnswersExcluded {
+		t.Errorf("Expected banned participant to be kicked with answers excluded, got %+v", participant)
+	}
+
+	// 同じ IP アドレスからは登録できない
+	w = send("POST", "/participants/register", RegisterParticipant, nil,
+		models.ParticipantRequest{Nickname: fmt.Sprintf("BanAgain%d", os.Getpid())})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected registration from a banned IP to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = send("GET", "/admin/bans", ListBans, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("List bans failed: %d %s", w.Code, w.Body.String())
+	}
+
+	banParams := gin.Params{{Key: "id", Value: fmt.Sprintf("%d", banned.Data.ID)}}
+	if w = send("DELETE", "/admin/bans/"+banParams[0].Value, LiftBan, banParams, nil); w.Code != http.StatusOK {
+		t.Errorf("Lift ban failed: %d %s", w.Code, w.Body.String())
+	}
+	if w = send("DELETE", "/admin/bans/"+banParams[0].Value, LiftBan, banParams, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected lifting a lifted ban to fail, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 解除後は同じ IP アドレスから登録できる
+	w = send("POST", "/participants/register", RegisterParticipant, nil,
+		models.ParticipantRequest{Nickname: fmt.Sprintf("BanAgain%d", os.Getpid())})
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected registration after lifting the ban, got %d %s", w.Code, w.Body.String())
+	}
+
+	// 操作は監査ログに残る
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", fmt.Sprintf("/admin/moderation/audit-log?participant_id=%d", participantID), nil)
+	GetModerationAuditLog(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Get audit log failed: %d %s", w.Code, w.Body.String())
+	}
+
+	var audit struct {
+		Data struct {
+			Data []models.ModerationAuditEntry `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &audit); err != nil {
+		t.Fatalf("Failed to decode audit log: %v", err)
+	}
+	actions := map[string]bool{}
+	for _, entry := range audit.Data.Data {
+		actions[entry.Action] = true
+	}
+	if !actions[ParticipantActionBanned] || !actions["unbanned"] {
+		t.Errorf("Expected ban and unban in the audit log, got %+v", audit.Data.Data)
+	}
+}
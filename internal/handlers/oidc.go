@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// OIDCLogin starts a login through the OpenID Connect provider. The client keeps the returned
+// browser secret and sends the browser to the authorization URL; the provider redirects back to
+// OIDC_REDIRECT_URL with a code and state, which the client posts to OIDCCallback with the secret.
+func OIDCLogin(c *gin.Context) {
+	authURL, browserSecret, expiresAt, err := services.NewOIDCService(newSessionService()).AuthorizationURL()
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: models.OIDCAuthorizationResponse{
+			AuthorizationURL: authURL,
+			BrowserSecret:    browserSecret,
+			ExpiresAt:        expiresAt,
+		},
+	})
+}
+
+// OIDCCallback completes a login through the OpenID Connect provider. It issues the same tokens
+// as AdminLogin, or a two-factor challenge when the administrator has or needs a second factor.
+func OIDCCallback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	oidcService := services.NewOIDCService(newSessionService())
+	identity, err := oidcService.Exchange(req.Code, req.State, req.BrowserSecret)
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	guard := services.NewLoginGuard()
+	admin, err := oidcService.ResolveAdmin(identity)
+	if err != nil {
+		reason := services.LoginReasonOIDCRejected
+		if errors.Is(err, services.ErrAdminDisabled) {
+			reason = services.LoginReasonAdminDisabled
+		}
+		recordLoginEvent(c, guard, nil, identity.Username, false, reason)
+		respondOIDCError(c, err)
+		return
+	}
+
+	if continueWithTwoFactor(c, admin) {
+		return
+	}
+
+	response, err := newSessionService().StartSession(admin)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate authentication tokens",
+			},
+		})
+		return
+	}
+
+	recordLoginSuccess(c, guard, admin, services.LoginReasonOIDC)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ログインに成功しました",
+		Data:    response,
+	})
+}
+
+// respondOIDCError writes the error response for a failed OpenID Connect login
+func respondOIDCError(c *gin.Context, err error) {
+	status, code, message := http.StatusInternalServerError, "OIDC_ERROR", "Failed to sign in"
+	switch {
+	case errors.Is(err, services.ErrOIDCNotConfigured):
+		status, code, message = http.StatusNotFound, "OIDC_NOT_CONFIGURED", "Single sign-on is not configured"
+	case errors.Is(err, services.ErrOIDCInvalidState):
+		status, code, message = http.StatusBadRequest, "INVALID_OIDC_STATE", "The login has expired or was already used; sign in again"
+	case errors.Is(err, services.ErrOIDCAuthentication):
+		status, code, message = http.StatusUnauthorized, "OIDC_AUTHENTICATION_FAILED", "The identity provider did not authenticate the login"
+	case errors.Is(err, services.ErrOIDCProvider):
+		status, code, message = http.StatusBadGateway, "OIDC_PROVIDER_ERROR", "The identity provider is unavailable"
+	case errors.Is(err, services.ErrOIDCNoAccount):
+		status, code, message = http.StatusForbidden, "OIDC_NO_ACCOUNT", "No administrator account is linked to this identity"
+	case errors.Is(err, services.ErrOIDCNotAuthorized):
+		status, code, message = http.StatusForbidden, "OIDC_NOT_AUTHORIZED", "This identity is not allowed to administer quizzes"
+	case errors.Is(err, services.ErrAdminDisabled):
+		status, code, message = http.StatusForbidden, "ADMIN_DISABLED", "This administrator account has been disabled"
+	case errors.Is(err, services.ErrAdminExists):
+		status, code, message = http.StatusConflict, "ADMIN_EXISTS", "An administrator with the same username or email already exists"
+	}
+	if status >= http.StatusInternalServerError || status == http.StatusUnauthorized {
+		log.Printf("OpenID Connect login failed: %v", err)
+	}
+
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Tattsum/quiz/internal/database"
 	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
 // RegisterParticipant registers a new participant
@@ -25,16 +31,152 @@ func RegisterParticipant(c *gin.Context) {
 		return
 	}
 
+	nickname, nicknameKey, ok := checkNickname(c, req.Nickname)
+	if !ok {
+		return
+	}
+
 	db := database.GetDB()
+	tokenService := services.NewParticipantTokenService()
+
+	// Participants banned by IP address cannot register again under another nickname
+	if !checkParticipantAccess(c, db, 0) {
+		return
+	}
+
+	// Nicknames are unique per session; participants registered while no session is open share
+	// session 0 until the next session adopts them
+	sessionID := openSessionID()
+	taken, err := nicknameTaken(db, sessionID, nicknameKey, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to check nickname",
+			},
+		})
+		return
+	}
+	if taken {
+		nicknameTakenResponse(c, nicknameSuggestions(db, sessionID, nickname, nicknameKey))
+		return
+	}
+
+	// In team mode every participant belongs to a team of the session
+	teamID, err := registrationTeam(db, sessionID, req.TeamID)
+	if err != nil {
+		if errors.Is(err, errTeamNotFound) {
+			teamNotFoundResponse(c, http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to assign team",
+			},
+		})
+		return
+	}
+
+	// The recovery PIN lets the participant rejoin from a reloaded or new device
+	recoveryPIN, recoveryPINHash, err := newRecoveryPIN(tokenService)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate recovery PIN",
+			},
+		})
+		return
+	}
+
+	settings, err := loadSessionSettings(db, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query session",
+			},
+		})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to start transaction",
+			},
+		})
+		return
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after commit
+	}()
+
+	// The session row stays locked until commit so concurrent registrations cannot exceed the limit
+	if settings.maxParticipants != nil {
+		hasRoom, err := sessionHasRoom(tx, sessionID, *settings.maxParticipants)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to check participant limit",
+				},
+			})
+			return
+		}
+		if !hasRoom {
+			sessionFullResponse(c)
+			return
+		}
+	}
+
+	approvalStatus := ApprovalStatusApproved
+	if settings.requireApproval {
+		approvalStatus = ApprovalStatusPending
+	}
+
+	// Once an elimination game has judged a question, latecomers can only watch
+	var spectator bool
+	if settings.gameMode == GameModeElimination {
+		spectator, err = eliminationStarted(db, sessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to query session",
+				},
+			})
+			return
+		}
+	}
 
 	// Insert new participant
-	query := `INSERT INTO participants (nickname, created_at)
-			  VALUES ($1, CURRENT_TIMESTAMP)
-			  RETURNING id, created_at`
+	query := `INSERT INTO participants (nickname, nickname_key, session_id, recovery_pin_hash, team_id, approval_status, eliminated_at, created_at)
+			  VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, CASE WHEN $7 THEN CURRENT_TIMESTAMP END, CURRENT_TIMESTAMP)
+			  RETURNING id, eliminated_at, created_at`
 
 	var participant models.Participant
-	err := db.QueryRow(query, req.Nickname).Scan(&participant.ID, &participant.CreatedAt)
+	err = tx.QueryRow(query, nickname, nicknameKey, sessionID, recoveryPINHash, teamID, approvalStatus, spectator).
+		Scan(&participant.ID, &participant.EliminatedAt, &participant.CreatedAt)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		// Another participant registered the same nickname since the check above
+		if isUniqueViolation(err) {
+			nicknameTakenResponse(c, nicknameSuggestions(db, sessionID, nickname, nicknameKey))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
@@ -45,15 +187,284 @@ func RegisterParticipant(c *gin.Context) {
 		return
 	}
 
-	participant.Nickname = req.Nickname
+	participant.Nickname = nickname
+	participant.ApprovalStatus = approvalStatus
+	BroadcastLobbyRoster()
+
+	// Issue the token that identifies this participant on answer and history endpoints
+	token, expiresAt, err := tokenService.GenerateToken(&participant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate participant token",
+			},
+		})
+		return
+	}
+
+	message := "参加者として登録されました"
+	switch {
+	case approvalStatus == ApprovalStatusPending:
+		message = "参加者として登録されました。管理者の承認をお待ちください"
+	case spectator:
+		message = "サバイバル形式の途中のため、観戦者として登録されました"
+	}
 
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
-		Message: "参加者として登録されました",
+		Message: message,
 		Data: map[string]interface{}{
-			"participant_id": participant.ID,
-			"nickname":       participant.Nickname,
-			"created_at":     participant.CreatedAt,
+			"participant_id":   participant.ID,
+			"nickname":         participant.Nickname,
+			"team_id":          teamID,
+			"approval_status":  approvalStatus,
+			"eliminated":       spectator,
+			"created_at":       participant.CreatedAt,
+			"token":            token,
+			"token_expires_at": expiresAt,
+			"recovery_pin":     recoveryPIN,
+		},
+	})
+}
+
+// newRecoveryPIN generates a recovery PIN and its hash for storage
+func newRecoveryPIN(tokenService *services.ParticipantTokenService) (string, string, error) {
+	pin, err := tokenService.GenerateRecoveryPIN()
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := tokenService.HashRecoveryPIN(pin)
+	if err != nil {
+		return "", "", err
+	}
+	return pin, hash, nil
+}
+
+// RejoinParticipant lets a participant resume on a reloaded or new device with their
+// token or their nickname and recovery PIN. The participant keeps their ID, nickname
+// and answers, and receives a fresh token.
+func RejoinParticipant(c *gin.Context) {
+	var req models.ParticipantRejoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	if req.Token == "" && (req.Nickname == "" || req.RecoveryPIN == "") {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Either token or nickname and recovery_pin are required",
+			},
+		})
+		return
+	}
+
+	db := database.GetDB()
+	tokenService := services.NewParticipantTokenService()
+
+	var participant models.Participant
+	var err error
+	if req.Token != "" {
+		participant, err = findParticipantByToken(db, tokenService, req.Token)
+	} else {
+		var wait time.Duration
+		participant, wait, err = findParticipantByRecoveryPIN(db, services.NewLoginGuard(), tokenService, req.Nickname, req.RecoveryPIN)
+		if errors.Is(err, errRecoveryPINLocked) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "RECOVERY_PIN_LOCKED",
+					Message: "Too many wrong recovery PINs. Please try again later.",
+				},
+			})
+			return
+		}
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "INVALID_CREDENTIALS",
+					Message: "Participant could not be recovered",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query participant",
+			},
+		})
+		return
+	}
+
+	if !checkParticipantAccess(c, db, participant.ID) {
+		return
+	}
+
+	token, expiresAt, err := tokenService.GenerateToken(&participant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate participant token",
+			},
+		})
+		return
+	}
+
+	// Score so far, so the client can restore its state
+	var totalAnswers, correctAnswers, totalScore int
+	if err := db.QueryRow(participantStatsQuery, participant.ID).Scan(&totalAnswers, &correctAnswers, &totalScore); err != nil {
+		totalAnswers = 0
+		correctAnswers = 0
+		totalScore = 0
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "参加者として再接続しました",
+		Data: map[string]interface{}{
+			"participant_id":   participant.ID,
+			"nickname":         participant.Nickname,
+			"created_at":       participant.CreatedAt,
+			"token":            token,
+			"token_expires_at": expiresAt,
+			"total_answers":    totalAnswers,
+			"correct_answers":  correctAnswers,
+			"total_score":      totalScore,
+		},
+	})
+}
+
+// findParticipantByToken returns the participant identified by a valid participant token.
+// It returns sql.ErrNoRows if the token is invalid or the participant no longer exists.
+func findParticipantByToken(db *sql.DB, tokenService *services.ParticipantTokenService, token string) (models.Participant, error) {
+	var participant models.Participant
+
+	claims, err := tokenService.ValidateToken(token)
+	if err != nil {
+		return participant, sql.ErrNoRows
+	}
+
+	return loadParticipant(db, claims.ParticipantID)
+}
+
+// errRecoveryPINLocked is returned when the participant's recovery PIN is locked after too many wrong PINs
+var errRecoveryPINLocked = errors.New("recovery PIN locked")
+
+// maxRecoveryPINCandidates caps the participants whose PIN is checked for one nickname. Nicknames
+// are unique within a session, so only kicked participants can share one.
+const maxRecoveryPINCandidates = 3
+
+// findParticipantByRecoveryPIN returns the participant of the current or open session with the given
+// nickname whose recovery PIN matches. Nicknames are compared by key, so the participant need not
+// type it exactly as registered. Wrong PINs are counted per participant, and a participant with too
+// many is locked out: errRecoveryPINLocked is returned with the time until the PIN can be tried again.
+// It returns sql.ErrNoRows if no participant matches.
+func findParticipantByRecoveryPIN(db *sql.DB, guard *services.LoginGuard, tokenService *services.ParticipantTokenService,
+	nickname, pin string) (participant models.Participant, wait time.Duration, err error) {
+	query := `SELECT id, nickname, session_id, is_hidden, kicked_at, created_at, COALESCE(recovery_pin_hash, '')
+			  FROM participants
+			  WHERE (nickname_key = $1 OR (nickname_key IS NULL AND nickname = $2)) AND COALESCE(session_id, 0) IN ($3, $4)
+			  ORDER BY id DESC
+			  LIMIT $5`
+
+	// Participants of an ended session can still rejoin to see their results
+	rows, err := db.Query(query, services.NicknameKey(nickname), nickname, openSessionID(), currentSessionID(), maxRecoveryPINCandidates)
+	if err != nil {
+		return models.Participant{}, 0, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	type candidate struct {
+		participant     models.Participant
+		recoveryPINHash string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		err := rows.Scan(
+			&c.participant.ID,
+			&c.participant.Nickname,
+			&c.participant.SessionID,
+			&c.participant.IsHidden,
+			&c.participant.KickedAt,
+			&c.participant.CreatedAt,
+			&c.recoveryPINHash,
+		)
+		if err != nil {
+			return models.Participant{}, 0, err
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Participant{}, 0, err
+	}
+
+	checked := 0
+	for _, c := range candidates {
+		// Lockout check failures are logged and the PIN is checked, as for administrator logins
+		locked, err := guard.CheckRecoveryPIN(c.participant.ID)
+		if err != nil {
+			log.Printf("Failed to check recovery PIN lockout: %v", err)
+		}
+		if locked > 0 {
+			wait = max(wait, locked)
+			continue
+		}
+
+		checked++
+		if tokenService.CheckRecoveryPIN(c.recoveryPINHash, pin) {
+			if err := guard.ClearRecoveryPINFailures(c.participant.ID); err != nil {
+				log.Printf("Failed to clear recovery PIN failures: %v", err)
+			}
+			return c.participant, 0, nil
+		}
+		lockout, err := guard.RecordRecoveryPINFailure(c.participant.ID)
+		if err != nil {
+			log.Printf("Failed to record recovery PIN failure: %v", err)
+		}
+		wait = max(wait, lockout)
+	}
+	if checked == 0 && wait > 0 {
+		return models.Participant{}, wait, errRecoveryPINLocked
+	}
+	return models.Participant{}, 0, sql.ErrNoRows
+}
+
+// authenticatedParticipantID returns the participant ID set by middleware.ParticipantAuth
+func authenticatedParticipantID(c *gin.Context) int64 {
+	value, _ := c.Get("participant_id")
+	participantID, _ := value.(int64)
+	return participantID
+}
+
+// participantForbidden writes the response for a participant accessing another participant's data
+func participantForbidden(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "PARTICIPANT_MISMATCH",
+			Message: message,
 		},
 	})
 }
@@ -106,15 +517,13 @@ func GetParticipant(c *gin.Context) {
 	}
 
 	// Get participant statistics
-	var totalAnswers, correctAnswers int
-	statsQuery := `SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_correct THEN 1 ELSE 0 END), 0)
-				   FROM answers WHERE participant_id = $1`
-
-	err = db.QueryRow(statsQuery, id).Scan(&totalAnswers, &correctAnswers)
+	var totalAnswers, correctAnswers, totalScore int
+	err = db.QueryRow(participantStatsQuery, id).Scan(&totalAnswers, &correctAnswers, &totalScore)
 	if err != nil {
 		// If error getting stats, just return basic info
 		totalAnswers = 0
 		correctAnswers = 0
+		totalScore = 0
 	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
@@ -125,6 +534,7 @@ func GetParticipant(c *gin.Context) {
 			"created_at":      participant.CreatedAt,
 			"total_answers":   totalAnswers,
 			"correct_answers": correctAnswers,
+			"total_score":     totalScore,
 		},
 	})
 }
@@ -144,11 +554,13 @@ func GetParticipantAnswers(c *gin.Context) {
 		return
 	}
 
-	db := database.GetDB()
+	// Answer history is only available to the participant themselves
+	if id != authenticatedParticipantID(c) {
+		participantForbidden(c, "Cannot view another participant's answers")
+		return
+	}
 
-	// Check if participant exists
-	var participantID int64
-	err = db.QueryRow("SELECT id FROM participants WHERE id = $1", id).Scan(&participantID)
+	response, err := getParticipantAnswersData(database.GetDB(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.APIResponse{
@@ -164,30 +576,38 @@ func GetParticipantAnswers(c *gin.Context) {
 			Success: false,
 			Error: &models.APIError{
 				Code:    "DATABASE_ERROR",
-				Message: "Failed to check participant",
+				Message: "Failed to query answers",
 			},
 		})
 		return
 	}
 
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// getParticipantAnswersData loads a participant's answer history, newest first, with their statistics.
+// It returns sql.ErrNoRows if the participant does not exist.
+func getParticipantAnswersData(db *sql.DB, id int64) (*models.ParticipantAnswersResponse, error) {
+	// Check if participant exists
+	var participantID int64
+	if err := db.QueryRow("SELECT id FROM participants WHERE id = $1", id).Scan(&participantID); err != nil {
+		return nil, err
+	}
+
 	// Get participant answers with quiz details
-	answersQuery := `SELECT a.id, a.quiz_id, q.question_text, a.selected_option, 
-					 q.correct_answer, a.is_correct, a.answered_at
+	answersQuery := `SELECT a.id, a.quiz_id, q.question_text, COALESCE(a.selected_option, ''),
+					 q.correct_answer, a.is_correct, a.lifeline, a.answered_at
 					 FROM answers a
 					 JOIN quizzes q ON a.quiz_id = q.id
 					 WHERE a.participant_id = $1
-					 ORDER BY a.answered_at DESC`
+					 ORDER BY a.answered_at DESC, a.id DESC`
 
 	rows, err := db.Query(answersQuery, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error: &models.APIError{
-				Code:    "DATABASE_ERROR",
-				Message: "Failed to query answers",
-			},
-		})
-		return
+		return nil, err
 	}
 	defer func() {
 		_ = rows.Close() // Ignore close error in defer
@@ -203,28 +623,31 @@ func GetParticipantAnswers(c *gin.Context) {
 			&answer.SelectedOption,
 			&answer.CorrectAnswer,
 			&answer.IsCorrect,
+			&answer.Lifeline,
 			&answer.AnsweredAt,
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.APIResponse{
-				Success: false,
-				Error: &models.APIError{
-					Code:    "SCAN_ERROR",
-					Message: "Failed to scan answer data",
-				},
-			})
-			return
+			return nil, err
 		}
+		answer.Points = answerPoints(answer.IsCorrect, answer.Lifeline)
 		answers = append(answers, answer)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	// Calculate statistics
-	totalAnswers := len(answers)
-	correctAnswers := 0
+	// Calculate statistics; skipped questions are neutral
+	var totalAnswers, correctAnswers, skippedAnswers, totalScore int
 	for _, answer := range answers {
+		if answer.Lifeline != nil && *answer.Lifeline == LifelineSkip {
+			skippedAnswers++
+			continue
+		}
+		totalAnswers++
 		if answer.IsCorrect {
 			correctAnswers++
 		}
+		totalScore += answer.Points
 	}
 
 	var accuracyRate float64
@@ -232,18 +655,15 @@ func GetParticipantAnswers(c *gin.Context) {
 		accuracyRate = float64(correctAnswers) / float64(totalAnswers)
 	}
 
-	response := models.ParticipantAnswersResponse{
+	return &models.ParticipantAnswersResponse{
 		ParticipantID:  id,
 		Answers:        answers,
 		TotalAnswers:   totalAnswers,
 		CorrectAnswers: correctAnswers,
+		SkippedAnswers: skippedAnswers,
 		AccuracyRate:   accuracyRate,
-	}
-
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Data:    response,
-	})
+		TotalScore:     totalScore,
+	}, nil
 }
 
 // SubmitAnswer handles answer submission
@@ -263,6 +683,13 @@ func SubmitAnswer(c *gin.Context) {
 		return
 	}
 
+	// The participant is identified by the token, never by the request body
+	participantID := authenticatedParticipantID(c)
+	if req.ParticipantID != 0 && req.ParticipantID != participantID {
+		participantForbidden(c, "Cannot answer as another participant")
+		return
+	}
+
 	db := database.GetDB()
 
 	// Check if session is accepting answers
@@ -308,8 +735,7 @@ func SubmitAnswer(c *gin.Context) {
 	}
 
 	// Check if participant exists
-	var participantID int64
-	err = db.QueryRow("SELECT id FROM participants WHERE id = $1", req.ParticipantID).Scan(&participantID)
+	err = db.QueryRow("SELECT id FROM participants WHERE id = $1", participantID).Scan(&participantID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.APIResponse{
@@ -331,6 +757,11 @@ func SubmitAnswer(c *gin.Context) {
 		return
 	}
 
+	// Kicked, banned and unapproved participants cannot answer
+	if !checkParticipantCanAnswer(c, db, participantID) {
+		return
+	}
+
 	// Get quiz correct answer
 	var correctAnswer string
 	err = db.QueryRow("SELECT correct_answer FROM quizzes WHERE id = $1", req.QuizID).Scan(&correctAnswer)
@@ -359,19 +790,23 @@ func SubmitAnswer(c *gin.Context) {
 
 	// Check if answer already exists (for update)
 	var existingAnswerID int64
-	checkQuery := `SELECT id FROM answers WHERE participant_id = $1 AND quiz_id = $2`
-	err = db.QueryRow(checkQuery, req.ParticipantID, req.QuizID).Scan(&existingAnswerID)
+	var previousOption string
+	checkQuery := `SELECT id, COALESCE(selected_option, '') FROM answers WHERE participant_id = $1 AND quiz_id = $2`
+	err = db.QueryRow(checkQuery, participantID, req.QuizID).Scan(&existingAnswerID, &previousOption)
 
-	if err == nil {
+	if err == nil && previousOption == "" {
+		questionSkippedResponse(c)
+		return
+	} else if err == nil {
 		// Update existing answer
 		updateQuery := `UPDATE answers 
 						SET selected_option = $1, is_correct = $2, answered_at = CURRENT_TIMESTAMP
 						WHERE id = $3
-						RETURNING id, answered_at`
+						RETURNING id, lifeline, answered_at`
 
 		var answer models.Answer
 		err = db.QueryRow(updateQuery, req.SelectedOption, isCorrect, existingAnswerID).Scan(
-			&answer.ID, &answer.AnsweredAt)
+			&answer.ID, &answer.Lifeline, &answer.AnsweredAt)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.APIResponse{
 				Success: false,
@@ -383,38 +818,13 @@ func SubmitAnswer(c *gin.Context) {
 			return
 		}
 
-		answer.ParticipantID = req.ParticipantID
+		answer.ParticipantID = participantID
 		answer.QuizID = req.QuizID
 		answer.SelectedOption = req.SelectedOption
 		answer.IsCorrect = isCorrect
 
-		// Broadcast answer status update
-		db := database.GetDB()
-		var totalParticipants, answeredCount int
-		answerCounts := make(map[string]int)
-
-		// Get total participants
-		_ = db.QueryRow("SELECT COUNT(*) FROM participants").Scan(&totalParticipants)
-
-		// Get answered count for this quiz
-		_ = db.QueryRow("SELECT COUNT(*) FROM answers WHERE quiz_id = $1", req.QuizID).Scan(&answeredCount)
-
-		// Get answer distribution
-		rows, err := db.Query("SELECT selected_option, COUNT(*) FROM answers WHERE quiz_id = $1 GROUP BY selected_option", req.QuizID)
-		if err == nil {
-			defer func() {
-				_ = rows.Close() // Ignore close error in defer
-			}()
-			for rows.Next() {
-				var option string
-				var count int
-				_ = rows.Scan(&option, &count)
-				answerCounts[option] = count
-			}
-		}
-
-		// Broadcast the current answer status
-		BroadcastAnswerStatus(req.QuizID, req.QuizID, totalParticipants, answeredCount, answerCounts)
+		// Coalesced answer_status broadcast
+		getAnswerAggregator().RecordAnswer(req.QuizID, previousOption, req.SelectedOption)
 
 		c.JSON(http.StatusOK, models.APIResponse{
 			Success: true,
@@ -422,14 +832,16 @@ func SubmitAnswer(c *gin.Context) {
 			Data:    answer,
 		})
 	} else if err == sql.ErrNoRows {
-		// Insert new answer
-		insertQuery := `INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct, answered_at)
-						VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
-						RETURNING id, answered_at`
+		// Insert new answer with the lifeline used on the question before answering, if any
+		insertQuery := `INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct, lifeline, answered_at)
+						VALUES ($1, $2, $3, $4,
+								(SELECT lifeline FROM lifeline_uses WHERE participant_id = $1 AND quiz_id = $2),
+								CURRENT_TIMESTAMP)
+						RETURNING id, lifeline, answered_at`
 
 		var answer models.Answer
-		err = db.QueryRow(insertQuery, req.ParticipantID, req.QuizID, req.SelectedOption, isCorrect).Scan(
-			&answer.ID, &answer.AnsweredAt)
+		err = db.QueryRow(insertQuery, participantID, req.QuizID, req.SelectedOption, isCorrect).Scan(
+			&answer.ID, &answer.Lifeline, &answer.AnsweredAt)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.APIResponse{
 				Success: false,
@@ -441,38 +853,13 @@ func SubmitAnswer(c *gin.Context) {
 			return
 		}
 
-		answer.ParticipantID = req.ParticipantID
+		answer.ParticipantID = participantID
 		answer.QuizID = req.QuizID
 		answer.SelectedOption = req.SelectedOption
 		answer.IsCorrect = isCorrect
 
-		// Broadcast answer status update
-		db := database.GetDB()
-		var totalParticipants, answeredCount int
-		answerCounts := make(map[string]int)
-
-		// Get total participants
-		_ = db.QueryRow("SELECT COUNT(*) FROM participants").Scan(&totalParticipants)
-
-		// Get answered count for this quiz
-		_ = db.QueryRow("SELECT COUNT(*) FROM answers WHERE quiz_id = $1", req.QuizID).Scan(&answeredCount)
-
-		// Get answer distribution
-		rows, err := db.Query("SELECT selected_option, COUNT(*) FROM answers WHERE quiz_id = $1 GROUP BY selected_option", req.QuizID)
-		if err == nil {
-			defer func() {
-				_ = rows.Close() // Ignore close error in defer
-			}()
-			for rows.Next() {
-				var option string
-				var count int
-				_ = rows.Scan(&option, &count)
-				answerCounts[option] = count
-			}
-		}
-
-		// Broadcast the current answer status
-		BroadcastAnswerStatus(req.QuizID, req.QuizID, totalParticipants, answeredCount, answerCounts)
+		// Coalesced answer_status broadcast
+		getAnswerAggregator().RecordAnswer(req.QuizID, "", req.SelectedOption)
 
 		c.JSON(http.StatusCreated, models.APIResponse{
 			Success: true,
@@ -537,14 +924,14 @@ func UpdateAnswer(c *gin.Context) {
 	}
 
 	// Get existing answer and quiz info
-	var quizID int64
-	var correctAnswer string
-	existingQuery := `SELECT a.quiz_id, q.correct_answer 
+	var quizID, ownerID int64
+	var correctAnswer, previousOption string
+	existingQuery := `SELECT a.quiz_id, a.participant_id, q.correct_answer, COALESCE(a.selected_option, '')
 					  FROM answers a 
 					  JOIN quizzes q ON a.quiz_id = q.id 
 					  WHERE a.id = $1`
 
-	err = db.QueryRow(existingQuery, answerID).Scan(&quizID, &correctAnswer)
+	err = db.QueryRow(existingQuery, answerID).Scan(&quizID, &ownerID, &correctAnswer, &previousOption)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.APIResponse{
@@ -566,17 +953,31 @@ func UpdateAnswer(c *gin.Context) {
 		return
 	}
 
+	if ownerID != authenticatedParticipantID(c) {
+		participantForbidden(c, "Cannot change another participant's answer")
+		return
+	}
+
+	if !checkParticipantCanAnswer(c, db, ownerID) {
+		return
+	}
+
+	if previousOption == "" {
+		questionSkippedResponse(c)
+		return
+	}
+
 	isCorrect := req.SelectedOption == correctAnswer
 
 	// Update answer
 	updateQuery := `UPDATE answers 
 					SET selected_option = $1, is_correct = $2, answered_at = CURRENT_TIMESTAMP
 					WHERE id = $3
-					RETURNING participant_id, quiz_id, answered_at`
+					RETURNING participant_id, quiz_id, lifeline, answered_at`
 
 	var answer models.Answer
 	err = db.QueryRow(updateQuery, req.SelectedOption, isCorrect, answerID).Scan(
-		&answer.ParticipantID, &answer.QuizID, &answer.AnsweredAt)
+		&answer.ParticipantID, &answer.QuizID, &answer.Lifeline, &answer.AnsweredAt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -592,9 +993,183 @@ func UpdateAnswer(c *gin.Context) {
 	answer.SelectedOption = req.SelectedOption
 	answer.IsCorrect = isCorrect
 
+	// Coalesced answer_status broadcast
+	getAnswerAggregator().RecordAnswer(answer.QuizID, previousOption, req.SelectedOption)
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "回答が変更されました",
 		Data:    answer,
 	})
 }
+
+// mergeConflictRule describes how MergeParticipants resolves two answers to the same quiz
+const mergeConflictRule = "earliest_answer"
+
+// MergeParticipants merges duplicate participants into a target participant.
+// Answers of the duplicates are moved to the target and the duplicates are deleted.
+// When both answered the same quiz, the earliest submitted answer is kept, so a second
+// registration cannot be used to retry a question.
+func MergeParticipants(c *gin.Context) {
+	var req models.ParticipantMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	for _, sourceID := range req.SourceIDs {
+		if sourceID == req.TargetID {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "VALIDATION_ERROR",
+					Message: "A participant cannot be merged into itself",
+				},
+			})
+			return
+		}
+	}
+
+	db := database.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to start transaction",
+			},
+		})
+		return
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after commit
+	}()
+
+	response, err := mergeParticipants(tx, req.TargetID, req.SourceIDs)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "PARTICIPANT_NOT_FOUND",
+					Message: "Participant not found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to merge participants",
+			},
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to merge participants",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "参加者を統合しました",
+		Data:    response,
+	})
+}
+
+// mergeParticipants moves the answers of sourceIDs to targetID inside tx.
+// It returns sql.ErrNoRows if any of the participants does not exist.
+func mergeParticipants(tx *sql.Tx, targetID int64, sourceIDs []int64) (*models.ParticipantMergeResponse, error) {
+	response := &models.ParticipantMergeResponse{
+		TargetID:           targetID,
+		MergedIDs:          []int64{},
+		ConflictResolution: mergeConflictRule,
+	}
+
+	// Lock the participants so concurrent merges cannot interleave. Rows are locked in ID order,
+	// so that merges of overlapping participants wait for each other instead of deadlocking.
+	ids := map[int64]struct{}{targetID: {}}
+	for _, id := range sourceIDs {
+		ids[id] = struct{}{}
+	}
+	allIDs := make([]int64, 0, len(ids))
+	for id := range ids {
+		allIDs = append(allIDs, id)
+	}
+	rows, err := tx.Query("SELECT id FROM participants WHERE id = ANY($1) ORDER BY id FOR UPDATE", pq.Array(allIDs))
+	if err != nil {
+		return nil, err
+	}
+	locked := 0
+	for rows.Next() {
+		locked++
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if locked != len(allIDs) {
+		return nil, sql.ErrNoRows
+	}
+
+	for _, sourceID := range sourceIDs {
+		// Conflicting answers: the later one loses (the target wins ties)
+		result, err := tx.Exec(`DELETE FROM answers s USING answers t
+								WHERE s.participant_id = $1 AND t.participant_id = $2
+								AND s.quiz_id = t.quiz_id AND s.answered_at >= t.answered_at`, sourceID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		discarded, _ := result.RowsAffected()
+
+		result, err = tx.Exec(`DELETE FROM answers t USING answers s
+							   WHERE t.participant_id = $1 AND s.participant_id = $2
+							   AND t.quiz_id = s.quiz_id AND s.answered_at < t.answered_at`, targetID, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		replaced, _ := result.RowsAffected()
+
+		result, err = tx.Exec("UPDATE answers SET participant_id = $1 WHERE participant_id = $2", targetID, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		moved, _ := result.RowsAffected()
+
+		// Lifelines used by a duplicate count against the target, one per quiz and one kept double
+		_, err = tx.Exec(`UPDATE lifeline_uses l SET participant_id = $1
+						  WHERE l.participant_id = $2
+						  AND NOT EXISTS (SELECT 1 FROM lifeline_uses t
+										  WHERE t.participant_id = $1 AND t.quiz_id IS NOT DISTINCT FROM l.quiz_id)`, targetID, sourceID)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec("DELETE FROM participants WHERE id = $1", sourceID); err != nil {
+			return nil, err
+		}
+
+		response.MergedIDs = append(response.MergedIDs, sourceID)
+		response.MovedAnswers += moved
+		response.DiscardedAnswers += discarded + replaced
+	}
+
+	return response, nil
+}
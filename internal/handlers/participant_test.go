@@ -28,6 +28,9 @@ func TestRegisterParticipant(t *testing.T) {
 		t.Fatalf("Database connection failed in test environment: %v", err)
 	}
 
+	// ニックネームはセッション内で一意なので、実行ごとに異なる名前を使う
+	nickname := fmt.Sprintf("TestUser%d", os.Getpid())
+
 	tests := []struct {
 		name           string
 		requestBody    interface{}
@@ -36,10 +39,31 @@ func TestRegisterParticipant(t *testing.T) {
 		{
 			name: "Register participant with valid nickname",
 			requestBody: models.ParticipantRequest{
-				Nickname: "TestUser",
+				Nickname: nickname,
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name: "Register participant with a lookalike of a taken nickname",
+			requestBody: models.ParticipantRequest{
+				Nickname: " ｔｅｓｔ\u200bUSER" + nickname[len("TestUser"):],
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "Register participant with invisible nickname",
+			requestBody: models.ParticipantRequest{
+				Nickname: "\u200b\u3164",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Register participant with denied nickname",
+			requestBody: models.ParticipantRequest{
+				Nickname: "Admin",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name: "Register participant with empty nickname",
 			requestBody: models.ParticipantRequest{
@@ -185,24 +209,34 @@ func TestGetParticipantAnswers(t *testing.T) {
 	}
 
 	tests := []struct {
-		name           string
-		participantID  string
-		expectedStatus int
+		name              string
+		participantID     string
+		authParticipantID int64
+		expectedStatus    int
 	}{
 		{
-			name:           "Get answers for valid participant ID",
-			participantID:  "1",
-			expectedStatus: http.StatusOK,
+			name:              "Get answers for valid participant ID",
+			participantID:     "1",
+			authParticipantID: 1,
+			expectedStatus:    http.StatusOK,
 		},
 		{
-			name:           "Get answers for invalid participant ID",
-			participantID:  "invalid",
-			expectedStatus: http.StatusBadRequest,
+			name:              "Get answers for invalid participant ID",
+			participantID:     "invalid",
+			authParticipantID: 1,
+			expectedStatus:    http.StatusBadRequest,
 		},
 		{
-			name:           "Get answers for non-existent participant ID",
-			participantID:  "999999",
-			expectedStatus: http.StatusNotFound,
+			name:              "Get answers for non-existent participant ID",
+			participantID:     "999999",
+			authParticipantID: 999999,
+			expectedStatus:    http.StatusNotFound,
+		},
+		{
+			name:              "Get answers of another participant",
+			participantID:     "1",
+			authParticipantID: 2,
+			expectedStatus:    http.StatusForbidden,
 		},
 	}
 
@@ -214,6 +248,7 @@ func TestGetParticipantAnswers(t *testing.T) {
 			c.Params = gin.Params{
 				{Key: "id", Value: tt.participantID},
 			}
+			c.Set("participant_id", tt.authParticipantID)
 
 			GetParticipantAnswers(c)
 
@@ -311,12 +346,21 @@ func TestSubmitAnswer(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name: "Submit answer with missing participant ID",
+			name: "Submit answer without participant ID uses the token",
 			requestBody: map[string]interface{}{
 				"quiz_id":         1,
-				"selected_option": "A",
+				"selected_option": "B",
 			},
-			expectedStatus: http.StatusBadRequest,
+			expectedStatus: http.StatusOK, // 既存の回答を変更
+		},
+		{
+			name: "Submit answer as another participant",
+			requestBody: models.AnswerRequest{
+				ParticipantID:  2,
+				QuizID:         1,
+				SelectedOption: "A",
+			},
+			expectedStatus: http.StatusForbidden,
 		},
 		{
 			name:           "Submit answer with malformed JSON",
@@ -344,6 +388,7 @@ func TestSubmitAnswer(t *testing.T) {
 			req, _ := http.NewRequest("POST", "/answers", bytes.NewBuffer(body))
 			req.Header.Set("Content-Type", "application/json")
 			c.Request = req
+			c.Set("participant_id", int64(1))
 
 			SubmitAnswer(c)
 
@@ -416,11 +461,21 @@ func TestUpdateAnswer(t *testing.T) {
 	}
 
 	tests := []struct {
-		name           string
-		answerID       string
-		requestBody    interface{}
-		expectedStatus int
+		name              string
+		answerID          string
+		requestBody       interface{}
+		authParticipantID int64
+		expectedStatus    int
 	}{
+		{
+			name:     "Update answer of another participant",
+			answerID: fmt.Sprintf("%d", answerID),
+			requestBody: models.AnswerUpdateRequest{
+				SelectedOption: "C",
+			},
+			authParticipantID: 2,
+			expectedStatus:    http.StatusForbidden,
+		},
 		{
 			name:     "Update answer with valid data",
 			answerID: fmt.Sprintf("%d", answerID),
@@ -473,6 +528,12 @@ func TestUpdateAnswer(t *testing.T) {
 			req.Header.Set("Content-Type", "application/json")
 			c.Request = req
 
+			authParticipantID := tt.authParticipantID
+			if authParticipantID == 0 {
+				authParticipantID = 1
+			}
+			c.Set("participant_id", authParticipantID)
+
 			UpdateAnswer(c)
 
 			if w.Code != tt.expectedStatus {
@@ -481,3 +542,313 @@ func TestUpdateAnswer(t *testing.T) {
 		})
 	}
 }
+
+func TestRejoinParticipant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+
+	// 参加者を登録してトークンと復帰PINを取得
+	nickname := fmt.Sprintf("RejoinUser%d", os.Getpid())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(models.ParticipantRequest{Nickname: nickname})
+	c.Request, _ = http.NewRequest("POST", "/participants/register", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	RegisterParticipant(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+	}
+
+	var registered struct {
+		Data struct {
+			ParticipantID int64  `json:"participant_id"`
+			Token         string `json:"token"`
+			RecoveryPIN   string `json:"recovery_pin"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &registered); err != nil {
+		t.Fatalf("Failed to parse register response: %v", err)
+	}
+
+	wrongPIN := "000000"
+	if registered.Data.RecoveryPIN == wrongPIN {
+		wrongPIN = "111111"
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    models.ParticipantRejoinRequest
+		expectedStatus int
+	}{
+		{
+			name:           "Rejoin with token",
+			requestBody:    models.ParticipantRejoinRequest{Token: registered.Data.Token},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Rejoin with nickname and recovery PIN",
+			requestBody:    models.ParticipantRejoinRequest{Nickname: nickname, RecoveryPIN: registered.Data.RecoveryPIN},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Rejoin with wrong recovery PIN",
+			requestBody:    models.ParticipantRejoinRequest{Nickname: nickname, RecoveryPIN: wrongPIN},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Rejoin with invalid token",
+			requestBody:    models.ParticipantRejoinRequest{Token: "invalid"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Rejoin without credentials",
+			requestBody:    models.ParticipantRejoinRequest{Nickname: nickname},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			body, err := json.Marshal(tt.requestBody)
+			if err != nil {
+				t.Fatalf("Failed to marshal request body: %v", err)
+			}
+
+			req, _ := http.NewRequest("POST", "/participants/rejoin", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			c.Request = req
+
+			RejoinParticipant(c)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d. Response body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if w.Code == http.StatusOK {
+				var response struct {
+					Data struct {
+						ParticipantID int64 `json:"participant_id"`
+					} `json:"data"`
+				}
+				_ = json.Unmarshal(w.Body.Bytes(), &response)
+				if response.Data.ParticipantID != registered.Data.ParticipantID {
+					t.Errorf("Expected participant %d, got %d", registered.Data.ParticipantID, response.Data.ParticipantID)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeParticipants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+
+	db := database.GetDB()
+
+	// クイズを2問作成
+	var quizIDs [2]int64
+	for i := range quizIDs {
+		err = db.QueryRow(`
+			INSERT INTO quizzes (question_text, option_a, option_b, option_c, option_d, correct_answer)
+			VALUES ('Merge Question?', 'A', 'B', 'C', 'D', 'A')
+			RETURNING id
+		`).Scan(&quizIDs[i])
+		if err != nil {
+			t.Fatalf("Failed to create test quiz: %v", err)
+		}
+	}
+
+	// 同一人物の二重登録
+	var targetID, sourceID int64
+	for _, id := range []*int64{&targetID, &sourceID} {
+		if err := db.QueryRow(`INSERT INTO participants (nickname) VALUES ('MergeUser') RETURNING id`).Scan(id); err != nil {
+			t.Fatalf("Failed to create test participant: %v", err)
+		}
+	}
+
+	// 問題1: 両方が回答（先に回答した複製側が残る）、問題2: 複製側のみ回答
+	answers := []struct {
+		participantID int64
+		quizID        int64
+		option        string
+		isCorrect     bool
+		answeredAt    string
+	}{
+		{targetID, quizIDs[0], "B", false, "2024-01-01 10:05:00"},
+		{sourceID, quizIDs[0], "A", true, "2024-01-01 10:01:00"},
+		{sourceID, quizIDs[1], "C", false, "2024-01-01 10:10:00"},
+	}
+	for _, a := range answers {
+		_, err := db.Exec(`INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct, answered_at)
+						   VALUES ($1, $2, $3, $4, $5)`, a.participantID, a.quizID, a.option, a.isCorrect, a.answeredAt)
+		if err != nil {
+			t.Fatalf("Failed to create test answer: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "Merge into itself",
+			requestBody:    models.ParticipantMergeRequest{TargetID: targetID, SourceIDs: []int64{targetID}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Merge non-existent participant",
+			requestBody:    models.ParticipantMergeRequest{TargetID: targetID, SourceIDs: []int64{999999999}},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Merge duplicate participant",
+			requestBody:    models.ParticipantMergeRequest{TargetID: targetID, SourceIDs: []int64{sourceID}},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			body, err := json.Marshal(tt.requestBody)
+			if err != nil {
+				t.Fatalf("Failed to marshal request body: %v", err)
+			}
+
+			req, _ := http.NewRequest("POST", "/admin/participants/merge", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			c.Request = req
+
+			MergeParticipants(c)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d. Response body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// 統合後: 回答2件、問題1は先に送信された正解が残る
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM answers WHERE participant_id = $1`, targetID).Scan(&count); err != nil {
+		t.Fatalf("Failed to count merged answers: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 answers after merge, got %d", count)
+	}
+
+	var selected string
+	err = db.QueryRow(`SELECT selected_option FROM answers WHERE participant_id = $1 AND quiz_id = $2`, targetID, quizIDs[0]).Scan(&selected)
+	if err != nil {
+		t.Fatalf("Failed to get merged answer: %v", err)
+	}
+	if selected != "A" {
+		t.Errorf("Expected the earliest answer A to be kept, got %s", selected)
+	}
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM participants WHERE id = $1`, sourceID).Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected the duplicate participant to be deleted, count=%d err=%v", count, err)
+	}
+}
+
+func TestRegisterBeforeSessionStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	send := func(handler gin.HandlerFunc, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(requestBody)
+		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler(c)
+		return w
+	}
+
+	// 前のセッションが終了した状態で参加登録する
+	if _, err := db.Exec("INSERT INTO quiz_sessions (is_accepting_answers, status) VALUES (false, $1)", SessionStatusEnded); err != nil {
+		t.Fatalf("Failed to end previous session: %v", err)
+	}
+	w := send(RegisterParticipant, models.ParticipantRequest{Nickname: fmt.Sprintf("EarlyBird%d", os.Getpid())})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+	}
+	var registered struct {
+		Data struct {
+			ParticipantID int64 `json:"participant_id"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &registered)
+	defer func() {
+		_, _ = db.Exec("DELETE FROM participants WHERE id = $1", registered.Data.ParticipantID)
+	}()
+
+	var sessionID *int64
+	if err := db.QueryRow("SELECT session_id FROM participants WHERE id = $1", registered.Data.ParticipantID).Scan(&sessionID); err != nil || sessionID != nil {
+		t.Fatalf("Expected no session before the start, got %v (%v)", sessionID, err)
+	}
+
+	// 開始したセッションに登録済みの参加者が入る
+	var quizID int64
+	err = db.QueryRow(`INSERT INTO quizzes (question_text, option_a, option_b, option_c, option_d, correct_answer)
+					   VALUES ('Early Question?', 'A', 'B', 'C', 'D', 'A')
+					   RETURNING id`).Scan(&quizID)
+	if err != nil {
+		t.Fatalf("Failed to create test quiz: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM quizzes WHERE id = $1", quizID)
+	}()
+	w = send(StartSession, models.SessionStartRequest{QuizID: quizID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Start session failed: %d %s", w.Code, w.Body.String())
+	}
+	defer send(EndSession, nil)
+	var started struct {
+		Data struct {
+			SessionID int64 `json:"session_id"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &started)
+
+	if err := db.QueryRow("SELECT session_id FROM participants WHERE id = $1", registered.Data.ParticipantID).Scan(&sessionID); err != nil ||
+		sessionID == nil || *sessionID != started.Data.SessionID {
+		t.Errorf("Expected the participant to join session %d, got %v (%v)", started.Data.SessionID, sessionID, err)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultPresenceHeartbeatInterval is how often each replica marks its connected participants as present
+	DefaultPresenceHeartbeatInterval = 20 * time.Second
+	// DefaultPresenceTimeout is how long a participant counts as connected after their last heartbeat
+	DefaultPresenceTimeout = 90 * time.Second
+)
+
+// PresenceSettings configures how participant presence is tracked
+type PresenceSettings struct {
+	HeartbeatInterval time.Duration
+	Timeout           time.Duration
+}
+
+// LoadPresenceSettings reads the presence settings from PRESENCE_HEARTBEAT_SECONDS and
+// PRESENCE_TIMEOUT_SECONDS. The timeout covers at least two heartbeats so that a single
+// late heartbeat does not show a participant as disconnected.
+func LoadPresenceSettings() PresenceSettings {
+	settings := PresenceSettings{
+		HeartbeatInterval: durationFromEnv("PRESENCE_HEARTBEAT_SECONDS", time.Second, DefaultPresenceHeartbeatInterval),
+		Timeout:           durationFromEnv("PRESENCE_TIMEOUT_SECONDS", time.Second, DefaultPresenceTimeout),
+	}
+	if settings.Timeout < 2*settings.HeartbeatInterval {
+		settings.Timeout = 2 * settings.HeartbeatInterval
+	}
+	return settings
+}
+
+// presenceSettings is the presence configuration, loaded once
+var presenceSettings = sync.OnceValue(LoadPresenceSettings)
+
+// ParticipantCounts holds how many participants of a session may answer and how many of
+// them are connected right now
+type ParticipantCounts struct {
+	Registered int
+	Connected  int
+}
+
+// loadParticipantCounts counts the participants of a session. Kicked, rejected, pending and
+// eliminated participants and those whose answers are excluded are not counted.
+// A participant is connected if any replica saw a heartbeat within the presence timeout.
+func loadParticipantCounts(db *sql.DB, sessionID int64) (ParticipantCounts, error) {
+	query := `SELECT COUNT(*),
+					 COUNT(*) FILTER (WHERE last_seen_at >= CURRENT_TIMESTAMP - $2 * INTERVAL '1 second')
+			  FROM participants
+			  WHERE COALESCE(session_id, 0) = $1 AND kicked_at IS NULL AND eliminated_at IS NULL
+			  AND NOT answers_excluded AND approval_status = $3`
+
+	var counts ParticipantCounts
+	err := db.QueryRow(query, sessionID, presenceSettings().Timeout.Seconds(), ApprovalStatusApproved).
+		Scan(&counts.Registered, &counts.Connected)
+	return counts, err
+}
+
+// answerRate returns the percentage of connected participants who answered. Participants
+// who answered and then disconnected would push it over 100, so it is capped there.
+func answerRate(answeredCount, connectedCount int) float64 {
+	return calculatePercentage(min(answeredCount, connectedCount), connectedCount)
+}
+
+// markPresent records a heartbeat for the given participants
+func markPresent(db *sql.DB, participantIDs []int64) error {
+	_, err := db.Exec("UPDATE participants SET last_seen_at = CURRENT_TIMESTAMP WHERE id = ANY($1)", pq.Array(participantIDs))
+	return err
+}
+
+// presenceChanged records that an identified participant connected or disconnected, then
+// refreshes the lobby roster and the answer rates
+func presenceChanged(client *Client) {
+	if client.Role != RoleParticipant || client.ParticipantID == 0 {
+		return
+	}
+
+	if db := database.GetDB(); db != nil {
+		var err error
+		if hub.ConnectedParticipants()[client.ParticipantID] {
+			err = markPresent(db, []int64{client.ParticipantID})
+		} else {
+			err = markDisconnected(db, client.ParticipantID, presenceSettings())
+		}
+		if err != nil {
+			log.Printf("Failed to record presence of participant %d: %v", client.ParticipantID, err)
+		}
+	}
+
+	BroadcastLobbyRoster()
+	getAnswerAggregator().RefreshPresence()
+}
+
+// markDisconnected records that a participant's last connection to this replica closed. The
+// participant may still be connected to another replica, so the last heartbeat is only moved
+// back to expire after two heartbeat intervals, in which any other replica marks them again.
+func markDisconnected(db *sql.DB, participantID int64, settings PresenceSettings) error {
+	grace := settings.Timeout - 2*settings.HeartbeatInterval
+	_, err := db.Exec(`UPDATE participants
+					   SET last_seen_at = LEAST(last_seen_at, CURRENT_TIMESTAMP - $2 * INTERVAL '1 second')
+					   WHERE id = $1 AND last_seen_at IS NOT NULL`, participantID, grace.Seconds())
+	return err
+}
+
+// RecordPresenceHeartbeats marks the participants connected to this replica as present
+// every heartbeat interval until the process exits
+func RecordPresenceHeartbeats() {
+	settings := presenceSettings()
+	ticker := time.NewTicker(settings.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		recordPresenceHeartbeat(settings.Timeout)
+	}
+}
+
+// recordPresenceHeartbeat marks the identified participants whose connections sent a
+// heartbeat within the timeout as present. Stale connections are left to expire.
+func recordPresenceHeartbeat(timeout time.Duration) {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-timeout)
+	seen := make(map[int64]bool)
+	var participantIDs []int64
+	for _, client := range hub.Clients() {
+		if client.Role != RoleParticipant || client.ParticipantID == 0 || seen[client.ParticipantID] {
+			continue
+		}
+		if client.LastHeartbeat().Before(cutoff) {
+			continue
+		}
+		seen[client.ParticipantID] = true
+		participantIDs = append(participantIDs, client.ParticipantID)
+	}
+
+	if len(participantIDs) > 0 {
+		if err := markPresent(db, participantIDs); err != nil {
+			log.Printf("Failed to record presence heartbeat: %v", err)
+			return
+		}
+	}
+
+	// Participants on other replicas may have timed out, so refresh even if nobody is connected here
+	getAnswerAggregator().RefreshPresence()
+	BroadcastLobbyRoster()
+}
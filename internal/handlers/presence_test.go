@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func TestLoadPresenceSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		heartbeat string
+		timeout   string
+		want      PresenceSettings
+	}{
+		{
+			name: "defaults",
+			want: PresenceSettings{HeartbeatInterval: DefaultPresenceHeartbeatInterval, Timeout: DefaultPresenceTimeout},
+		},
+		{
+			name:      "custom",
+			heartbeat: "10",
+			timeout:   "45",
+			want:      PresenceSettings{HeartbeatInterval: 10 * time.Second, Timeout: 45 * time.Second},
+		},
+		{
+			name:      "timeout raised to two heartbeats",
+			heartbeat: "30",
+			timeout:   "40",
+			want:      PresenceSettings{HeartbeatInterval: 30 * time.Second, Timeout: 60 * time.Second},
+		},
+		{
+			name:      "invalid values fall back to defaults",
+			heartbeat: "-1",
+			timeout:   "soon",
+			want:      PresenceSettings{HeartbeatInterval: DefaultPresenceHeartbeatInterval, Timeout: DefaultPresenceTimeout},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PRESENCE_HEARTBEAT_SECONDS", tt.heartbeat)
+			t.Setenv("PRESENCE_TIMEOUT_SECONDS", tt.timeout)
+
+			if got := LoadPresenceSettings(); got != tt.want {
+				t.Errorf("LoadPresenceSettings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnswerRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		answered  int
+		connected int
+		want      float64
+	}{
+		{"nobody connected", 0, 0, 0},
+		{"half answered", 5, 10, 50},
+		{"everyone answered", 8, 8, 100},
+		{"answered then disconnected", 12, 10, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answerRate(tt.answered, tt.connected); got != tt.want {
+				t.Errorf("answerRate(%d, %d) = %v, want %v", tt.answered, tt.connected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParticipantPresence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+	sessionID := openSessionID()
+
+	// 参加受付中のセッションに参加者を登録
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(models.ParticipantRequest{Nickname: fmt.Sprintf("Presence%d", os.Getpid())})
+	c.Request, _ = http.NewRequest("POST", "/participants/register", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	RegisterParticipant(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data struct {
+			ParticipantID int64 `json:"participant_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode register response: %v", err)
+	}
+
+	// 登録しただけでは接続中に数えない
+	before, err := loadParticipantCounts(db, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to count participants: %v", err)
+	}
+
+	client := newClient(TransportWebSocket, "192.0.2.10")
+	client.ParticipantID = response.Data.ParticipantID
+	hub.Register(client)
+	presenceChanged(client)
+
+	connected, err := loadParticipantCounts(db, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to count participants: %v", err)
+	}
+	if connected.Registered != before.Registered || connected.Connected != before.Connected+1 {
+		t.Errorf("Expected one more connected participant, got %+v then %+v", before, connected)
+	}
+
+	// 最後の接続が切れても、他のレプリカに接続している可能性があるためすぐには外さない
+	hub.Unregister(client)
+	presenceChanged(client)
+
+	disconnected, err := loadParticipantCounts(db, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to count participants: %v", err)
+	}
+	if disconnected != connected {
+		t.Errorf("Expected counts %+v right after disconnecting, got %+v", connected, disconnected)
+	}
+
+	// ハートビート2回分で期限切れになる
+	settings := presenceSettings()
+	var expiresIn float64
+	err = db.QueryRow("SELECT EXTRACT(EPOCH FROM last_seen_at + $2 * INTERVAL '1 second' - CURRENT_TIMESTAMP) FROM participants WHERE id = $1",
+		client.ParticipantID, settings.Timeout.Seconds()).Scan(&expiresIn)
+	if err != nil {
+		t.Fatalf("Failed to get last seen time: %v", err)
+	}
+	if limit := (2 * settings.HeartbeatInterval).Seconds(); expiresIn <= 0 || expiresIn > limit {
+		t.Errorf("Expected the participant to expire within %.0f seconds, got %.1f", limit, expiresIn)
+	}
+
+	// 期限切れになると接続中から外れる
+	if _, err := db.Exec("UPDATE participants SET last_seen_at = last_seen_at - $2 * INTERVAL '1 second' WHERE id = $1",
+		client.ParticipantID, (2 * settings.HeartbeatInterval).Seconds()); err != nil {
+		t.Fatalf("Failed to age last seen time: %v", err)
+	}
+	after, err := loadParticipantCounts(db, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to count participants: %v", err)
+	}
+	if after != before {
+		t.Errorf("Expected counts %+v after the presence expired, got %+v", before, after)
+	}
+}
+
+func TestSessionCountsParticipantsRegisteredBeforeStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	send := func(handler gin.HandlerFunc, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(requestBody)
+		c.Request, _ = http.NewRequest("POST", "/", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler(c)
+		return w
+	}
+
+	// 前のセッションが終了した後、開始前に2人が登録する
+	if _, err := db.Exec("INSERT INTO quiz_sessions (is_accepting_answers, status) VALUES (false, $1)", SessionStatusEnded); err != nil {
+		t.Fatalf("Failed to end previous session: %v", err)
+	}
+	var participants [2]int64
+	for i := range participants {
+		w := send(RegisterParticipant, models.ParticipantRequest{Nickname: fmt.Sprintf("Waiting%c%d", 'A'+i, os.Getpid())})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Register participant failed: %d %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data struct {
+				ParticipantID int64 `json:"participant_id"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		participants[i] = response.Data.ParticipantID
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM participants WHERE id = ANY($1)", pq.Array(participants[:]))
+	}()
+
+	var quizID int64
+	err = db.QueryRow(`INSERT INTO quizzes (question_text, option_a, option_b, option_c, option_d, correct_answer)
+					   VALUES ('Waiting Question?', 'A', 'B', 'C', 'D', 'A')
+					   RETURNING id`).Scan(&quizID)
+	if err != nil {
+		t.Fatalf("Failed to create test quiz: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM quizzes WHERE id = $1", quizID)
+	}()
+	if w := send(StartSession, models.SessionStartRequest{QuizID: quizID}); w.Code != http.StatusOK {
+		t.Fatalf("Start session failed: %d %s", w.Code, w.Body.String())
+	}
+	defer send(EndSession, nil)
+
+	// 2人とも接続し、1人が回答する
+	if err := markPresent(db, participants[:]); err != nil {
+		t.Fatalf("Failed to mark participants present: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct) VALUES ($1, $2, 'A', true)`,
+		participants[0], quizID); err != nil {
+		t.Fatalf("Failed to create test answer: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/session/status", nil)
+	GetSessionStatus(c)
+	var status struct {
+		Data models.SessionStatusResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode session status: %v", err)
+	}
+	if status.Data.TotalParticipants != 2 || status.Data.ConnectedParticipants != 2 || status.Data.AnswersCount != 1 || status.Data.AnswerRate != 50 {
+		t.Errorf("Expected both waiting participants to be counted, got %+v", status.Data)
+	}
+
+	tally, err := loadAnswerTally(quizID)
+	if err != nil {
+		t.Fatalf("Failed to load answer tally: %v", err)
+	}
+	if tally.TotalParticipants != 2 || tally.ConnectedParticipants != 2 || tally.AnswerCounts["A"] != 1 {
+		t.Errorf("Expected the answer status to count both waiting participants, got %+v", tally)
+	}
+}
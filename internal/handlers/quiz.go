@@ -111,6 +111,8 @@ func CreateQuiz(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, services.AuditActionQuizCreate, services.AuditTargetQuiz, &quiz.ID, nil, quiz)
+
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
 		Message: "問題が作成されました",
@@ -147,6 +149,8 @@ func UpdateQuiz(c *gin.Context) {
 	}
 
 	quizService := services.NewQuizService()
+	// A missing quiz is reported by UpdateQuiz
+	before, _ := quizService.GetQuizByID(id)
 	quiz, err := quizService.UpdateQuiz(id, req)
 	if err != nil {
 		if err.Error() == quizNotFoundError {
@@ -169,6 +173,8 @@ func UpdateQuiz(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, services.AuditActionQuizUpdate, services.AuditTargetQuiz, &quiz.ID, before, quiz)
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "問題が更新されました",
@@ -192,6 +198,8 @@ func DeleteQuiz(c *gin.Context) {
 	}
 
 	quizService := services.NewQuizService()
+	// A missing quiz is reported by DeleteQuiz
+	before, _ := quizService.GetQuizByID(id)
 	err = quizService.DeleteQuiz(id)
 	if err != nil {
 		if err.Error() == quizNotFoundError {
@@ -214,6 +222,8 @@ func DeleteQuiz(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, services.AuditActionQuizDelete, services.AuditTargetQuiz, &id, before, nil)
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "問題が削除されました",
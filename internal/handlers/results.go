@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -119,11 +120,13 @@ func getQuizResultsData(db *sql.DB, quizID int64, isAcceptingAnswers *bool) (*mo
 		return nil, err
 	}
 
-	// Get answer counts by option
-	resultsQuery := `SELECT selected_option, COUNT(*) 
-					 FROM answers 
-					 WHERE quiz_id = $1 
-					 GROUP BY selected_option`
+	// Get answer counts by option, leaving out participants excluded by an admin.
+	// Skipped questions have no option and are counted separately.
+	resultsQuery := `SELECT a.selected_option, COUNT(*)
+					 FROM answers a
+					 JOIN participants p ON a.participant_id = p.id
+					 WHERE a.quiz_id = $1 AND NOT p.answers_excluded
+					 GROUP BY a.selected_option`
 
 	rows, err := db.Query(resultsQuery, quizID)
 	if err != nil {
@@ -134,18 +137,27 @@ func getQuizResultsData(db *sql.DB, quizID int64, isAcceptingAnswers *bool) (*mo
 	}()
 
 	optionCounts := make(map[string]int)
-	totalAnswers := 0
+	totalAnswers, skippedCount := 0, 0
 
 	for rows.Next() {
-		var option string
+		var option sql.NullString
 		var count int
 		if err := rows.Scan(&option, &count); err != nil {
 			return nil, err
 		}
-		optionCounts[option] = count
+		if !option.Valid {
+			skippedCount = count
+			continue
+		}
+		optionCounts[option.String] = count
 		totalAnswers += count
 	}
 
+	lifelineUsage, err := loadLifelineUsage(db, quizID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Calculate results for each option
 	results := make(map[string]models.OptionResult)
 	for _, option := range []string{"A", "B", "C", "D"} {
@@ -169,6 +181,8 @@ func getQuizResultsData(db *sql.DB, quizID int64, isAcceptingAnswers *bool) (*mo
 		CorrectAnswer:      correctAnswer,
 		CorrectCount:       correctCount,
 		CorrectPercentage:  correctPercentage,
+		SkippedCount:       skippedCount,
+		LifelineUsage:      lifelineUsage,
 		IsAcceptingAnswers: isAcceptingAnswers,
 		UpdatedAt:          time.Now(),
 	}
@@ -176,6 +190,36 @@ func getQuizResultsData(db *sql.DB, quizID int64, isAcceptingAnswers *bool) (*mo
 	return response, nil
 }
 
+// loadLifelineUsage counts the lifelines used on a quiz, leaving out participants excluded by an admin
+func loadLifelineUsage(db *sql.DB, quizID int64) (models.LifelineCounts, error) {
+	var usage models.LifelineCounts
+	query := `SELECT l.lifeline, COUNT(*)
+			  FROM lifeline_uses l
+			  JOIN participants p ON l.participant_id = p.id
+			  WHERE l.quiz_id = $1 AND NOT p.answers_excluded
+			  GROUP BY l.lifeline`
+
+	rows, err := db.Query(query, quizID)
+	if err != nil {
+		return usage, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	for rows.Next() {
+		var lifeline string
+		var count int
+		if err := rows.Scan(&lifeline, &count); err != nil {
+			return usage, err
+		}
+		if used := lifelineCount(&usage, lifeline); used != nil {
+			*used = count
+		}
+	}
+	return usage, rows.Err()
+}
+
 // GetOverallRanking returns overall participant ranking
 func GetOverallRanking(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "100")
@@ -195,7 +239,7 @@ func GetOverallRanking(c *gin.Context) {
 
 	// Get total participants count
 	var totalParticipants int
-	err = db.QueryRow("SELECT COUNT(*) FROM participants").Scan(&totalParticipants)
+	err = db.QueryRow("SELECT COUNT(*) FROM participants WHERE NOT answers_excluded").Scan(&totalParticipants)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -207,8 +251,8 @@ func GetOverallRanking(c *gin.Context) {
 		return
 	}
 
-	// Get ranking data
-	rankingQuery := `SELECT p.id, p.nickname,
+	// Get ranking data; skipped questions are neutral and left out
+	rankingQuery := `SELECT p.id, p.nickname, p.is_hidden, COALESCE(t.name, '') as team_name,
 					 COUNT(a.id) as total_answers,
 					 COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_answers,
 					 CASE 
@@ -216,10 +260,12 @@ func GetOverallRanking(c *gin.Context) {
 							CAST(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END) AS FLOAT) / COUNT(a.id)
 						ELSE 0 
 					 END as accuracy_rate,
-					 COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as total_score
+					 COALESCE(SUM(` + answerPointsSQL + `), 0) as total_score
 					 FROM participants p
-					 LEFT JOIN answers a ON p.id = a.participant_id
-					 GROUP BY p.id, p.nickname
+					 LEFT JOIN teams t ON t.id = p.team_id
+					 LEFT JOIN answers a ON p.id = a.participant_id AND a.selected_option IS NOT NULL
+					 WHERE NOT p.answers_excluded
+					 GROUP BY p.id, p.nickname, p.is_hidden, t.name
 					 ORDER BY total_score DESC, accuracy_rate DESC, total_answers DESC
 					 LIMIT $1 OFFSET $2`
 
@@ -243,9 +289,12 @@ func GetOverallRanking(c *gin.Context) {
 
 	for rows.Next() {
 		var entry models.RankingEntry
+		var isHidden bool
 		err := rows.Scan(
 			&entry.ParticipantID,
 			&entry.Nickname,
+			&isHidden,
+			&entry.TeamName,
 			&entry.TotalAnswers,
 			&entry.CorrectAnswers,
 			&entry.AccuracyRate,
@@ -261,6 +310,7 @@ func GetOverallRanking(c *gin.Context) {
 			})
 			return
 		}
+		entry.Nickname = displayNickname(entry.Nickname, isHidden)
 		entry.Rank = rank
 		ranking = append(ranking, entry)
 		rank++
@@ -278,6 +328,173 @@ func GetOverallRanking(c *gin.Context) {
 	})
 }
 
+// GetTeamRanking returns the team ranking of a session.
+// The aggregation and best_n query parameters override TEAM_SCORE_AGGREGATION and TEAM_SCORE_BEST_N.
+func GetTeamRanking(c *gin.Context) {
+	sessionID, ok := sessionIDQuery(c)
+	if !ok {
+		return
+	}
+
+	scoring := teamScoring()
+	if aggregation := c.Query("aggregation"); aggregation != "" {
+		scoring.Aggregation = aggregation
+	}
+	if bestNStr := c.Query("best_n"); bestNStr != "" {
+		bestN, err := strconv.Atoi(bestNStr)
+		if err != nil || bestN < 1 {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "VALIDATION_ERROR",
+					Message: "best_n must be a positive integer",
+				},
+			})
+			return
+		}
+		scoring.BestN = bestN
+	}
+	if !scoring.valid() {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "aggregation must be one of sum, average or best",
+			},
+		})
+		return
+	}
+
+	response, err := getTeamRankingData(database.GetDB(), sessionID, scoring)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query team ranking",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// teamScores holds the scores of a team's members
+type teamScores struct {
+	id      int64
+	name    string
+	scores  []int // points per member
+	correct int   // correct answers of all members
+}
+
+// getTeamRankingData loads the member scores of a session's teams and ranks the teams
+func getTeamRankingData(db *sql.DB, sessionID int64, scoring TeamScoring) (*models.TeamRankingResponse, error) {
+	// Members whose answers were excluded by an admin do not count towards their team
+	query := `SELECT t.id, t.name, p.id,
+			  COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_answers,
+			  COALESCE(SUM(` + answerPointsSQL + `), 0) as points
+			  FROM teams t
+			  LEFT JOIN participants p ON p.team_id = t.id AND NOT p.answers_excluded
+			  LEFT JOIN answers a ON a.participant_id = p.id
+			  WHERE COALESCE(t.session_id, 0) = $1
+			  GROUP BY t.id, t.name, p.id
+			  ORDER BY t.id`
+
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	var teams []teamScores
+	for rows.Next() {
+		var teamID int64
+		var name string
+		var participantID sql.NullInt64
+		var correct, points int
+		if err := rows.Scan(&teamID, &name, &participantID, &correct, &points); err != nil {
+			return nil, err
+		}
+
+		if len(teams) == 0 || teams[len(teams)-1].id != teamID {
+			teams = append(teams, teamScores{id: teamID, name: name})
+		}
+		if participantID.Valid {
+			team := &teams[len(teams)-1]
+			team.scores = append(team.scores, points)
+			team.correct += correct
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	response := &models.TeamRankingResponse{
+		SessionID:   sessionID,
+		Aggregation: scoring.Aggregation,
+		Ranking:     rankTeams(teams, scoring),
+		UpdatedAt:   time.Now(),
+	}
+	if scoring.Aggregation == TeamAggregationBest {
+		response.BestN = scoring.BestN
+	}
+	return response, nil
+}
+
+// rankTeams scores each team with the given aggregation and ranks them by score.
+// Teams with the same score share a rank. With the best aggregation, teams with fewer than
+// N members count every member.
+func rankTeams(teams []teamScores, scoring TeamScoring) []models.TeamRankingEntry {
+	ranking := make([]models.TeamRankingEntry, 0, len(teams))
+	for _, team := range teams {
+		scores := append([]int{}, team.scores...)
+		sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+
+		entry := models.TeamRankingEntry{
+			TeamID:         team.id,
+			Name:           team.name,
+			MemberCount:    len(scores),
+			CountedMembers: len(scores),
+			CorrectAnswers: team.correct,
+		}
+		if scoring.Aggregation == TeamAggregationBest && len(scores) > scoring.BestN {
+			entry.CountedMembers = scoring.BestN
+		}
+
+		total := 0
+		for _, score := range scores[:entry.CountedMembers] {
+			total += score
+		}
+
+		entry.Score = float64(total)
+		if scoring.Aggregation == TeamAggregationAverage && len(scores) > 0 {
+			entry.Score = float64(total) / float64(len(scores))
+		}
+		ranking = append(ranking, entry)
+	}
+
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].Score != ranking[j].Score {
+			return ranking[i].Score > ranking[j].Score
+		}
+		return ranking[i].CorrectAnswers > ranking[j].CorrectAnswers
+	})
+	for i := range ranking {
+		if i > 0 && ranking[i].Score == ranking[i-1].Score {
+			ranking[i].Rank = ranking[i-1].Rank
+		} else {
+			ranking[i].Rank = i + 1
+		}
+	}
+	return ranking
+}
+
 // GetQuizRanking returns ranking for a specific quiz (correct answers)
 func GetQuizRanking(c *gin.Context) {
 	idStr := c.Param("id")
@@ -321,10 +538,10 @@ func GetQuizRanking(c *gin.Context) {
 	}
 
 	// Get correct participants
-	correctParticipantsQuery := `SELECT p.id, p.nickname, a.selected_option, a.answered_at
+	correctParticipantsQuery := `SELECT p.id, p.nickname, p.is_hidden, a.selected_option, a.lifeline, a.answered_at
 								 FROM answers a
 								 JOIN participants p ON a.participant_id = p.id
-								 WHERE a.quiz_id = $1 AND a.is_correct = true
+								 WHERE a.quiz_id = $1 AND a.is_correct = true AND NOT p.answers_excluded
 								 ORDER BY a.answered_at ASC`
 
 	rows, err := db.Query(correctParticipantsQuery, quizID)
@@ -345,10 +562,13 @@ func GetQuizRanking(c *gin.Context) {
 	var correctParticipants []models.CorrectParticipant
 	for rows.Next() {
 		var participant models.CorrectParticipant
+		var isHidden bool
 		err := rows.Scan(
 			&participant.ParticipantID,
 			&participant.Nickname,
+			&isHidden,
 			&participant.SelectedOption,
+			&participant.Lifeline,
 			&participant.AnsweredAt,
 		)
 		if err != nil {
@@ -361,15 +581,19 @@ func GetQuizRanking(c *gin.Context) {
 			})
 			return
 		}
+		participant.Nickname = displayNickname(participant.Nickname, isHidden)
+		participant.Points = answerPoints(true, participant.Lifeline)
 		correctParticipants = append(correctParticipants, participant)
 	}
 
-	// Get total answer counts
+	// Get total answer counts, leaving out skipped questions
 	var totalCorrect, totalAnswers int
-	countQuery := `SELECT 
-					COUNT(CASE WHEN is_correct THEN 1 END) as correct_count,
+	countQuery := `SELECT
+					COUNT(CASE WHEN a.is_correct THEN 1 END) as correct_count,
 					COUNT(*) as total_count
-					FROM answers WHERE quiz_id = $1`
+					FROM answers a
+					JOIN participants p ON a.participant_id = p.id
+					WHERE a.quiz_id = $1 AND NOT p.answers_excluded AND a.selected_option IS NOT NULL`
 
 	err = db.QueryRow(countQuery, quizID).Scan(&totalCorrect, &totalAnswers)
 	if err != nil {
@@ -409,11 +633,7 @@ func GetParticipantRanking(c *gin.Context) {
 		return
 	}
 
-	db := database.GetDB()
-
-	// Check if participant exists and get basic info
-	var nickname string
-	err = db.QueryRow("SELECT nickname FROM participants WHERE id = $1", participantID).Scan(&nickname)
+	response, err := getParticipantRankingData(database.GetDB(), participantID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.APIResponse{
@@ -435,15 +655,30 @@ func GetParticipantRanking(c *gin.Context) {
 		return
 	}
 
-	// Get participant stats
-	var totalAnswers, correctAnswers int
-	statsQuery := `SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_correct THEN 1 ELSE 0 END), 0)
-				   FROM answers WHERE participant_id = $1`
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    response,
+	})
+}
 
-	err = db.QueryRow(statsQuery, participantID).Scan(&totalAnswers, &correctAnswers)
+// getParticipantRankingData calculates a participant's overall rank and percentile.
+// It returns sql.ErrNoRows if the participant does not exist.
+func getParticipantRankingData(db *sql.DB, participantID int64) (*models.ParticipantRankingResponse, error) {
+	// Check if participant exists and get basic info
+	var nickname string
+	var isHidden bool
+	err := db.QueryRow("SELECT nickname, is_hidden FROM participants WHERE id = $1", participantID).Scan(&nickname, &isHidden)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get participant stats
+	var totalAnswers, correctAnswers, totalScore int
+	err = db.QueryRow(participantStatsQuery, participantID).Scan(&totalAnswers, &correctAnswers, &totalScore)
 	if err != nil {
 		totalAnswers = 0
 		correctAnswers = 0
+		totalScore = 0
 	}
 
 	var accuracyRate float64
@@ -455,7 +690,7 @@ func GetParticipantRanking(c *gin.Context) {
 	rankQuery := `SELECT COUNT(*) + 1 as rank
 				  FROM (
 					  SELECT p.id,
-						     COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as score,
+						     COALESCE(SUM(` + answerPointsSQL + `), 0) as score,
 						     CASE 
 							    WHEN COUNT(a.id) > 0 THEN 
 								    CAST(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END) AS FLOAT) / COUNT(a.id)
@@ -463,7 +698,8 @@ func GetParticipantRanking(c *gin.Context) {
 						     END as acc_rate,
 						     COUNT(a.id) as total_ans
 					  FROM participants p
-					  LEFT JOIN answers a ON p.id = a.participant_id
+					  LEFT JOIN answers a ON p.id = a.participant_id AND a.selected_option IS NOT NULL
+					  WHERE NOT p.answers_excluded
 					  GROUP BY p.id
 				  ) sub
 				  WHERE (sub.score > $1) 
@@ -471,35 +707,31 @@ func GetParticipantRanking(c *gin.Context) {
 				     OR (sub.score = $1 AND sub.acc_rate = $2 AND sub.total_ans > $3)`
 
 	var currentRank int
-	err = db.QueryRow(rankQuery, correctAnswers, accuracyRate, totalAnswers).Scan(&currentRank)
+	err = db.QueryRow(rankQuery, totalScore, accuracyRate, totalAnswers).Scan(&currentRank)
 	if err != nil {
 		currentRank = 1
 	}
 
 	// Get total participants
 	var totalParticipants int
-	err = db.QueryRow("SELECT COUNT(*) FROM participants").Scan(&totalParticipants)
-	if err != nil {
+	err = db.QueryRow("SELECT COUNT(*) FROM participants WHERE NOT answers_excluded").Scan(&totalParticipants)
+	if err != nil || totalParticipants < 1 {
+		// The participant may be the only one and excluded
 		totalParticipants = 1
 	}
 
 	// Calculate percentile
 	percentile := float64(totalParticipants-currentRank+1) / float64(totalParticipants) * 100
 
-	response := models.ParticipantRankingResponse{
+	return &models.ParticipantRankingResponse{
 		ParticipantID:     participantID,
-		Nickname:          nickname,
+		Nickname:          displayNickname(nickname, isHidden),
 		CurrentRank:       currentRank,
 		TotalParticipants: totalParticipants,
 		TotalAnswers:      totalAnswers,
 		CorrectAnswers:    correctAnswers,
 		AccuracyRate:      accuracyRate,
-		TotalScore:        correctAnswers,
+		TotalScore:        totalScore,
 		Percentile:        percentile,
-	}
-
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Data:    response,
-	})
+	}, nil
 }
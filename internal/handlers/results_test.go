@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestRankTeams(t *testing.T) {
+	teams := []teamScores{
+		{id: 1, name: "Red", scores: []int{5, 1, 0, 0}, correct: 6},
+		{id: 2, name: "Blue", scores: []int{3, 3}, correct: 6},
+		{id: 3, name: "Green", scores: []int{4, 2, 2}, correct: 8},
+		{id: 4, name: "Empty"},
+	}
+
+	tests := []struct {
+		name     string
+		scoring  TeamScoring
+		expected []int64   // team IDs in rank order
+		scores   []float64 // scores in rank order
+		ranks    []int
+	}{
+		{
+			name:     "Sum",
+			scoring:  TeamScoring{Aggregation: TeamAggregationSum},
+			expected: []int64{3, 1, 2, 4},
+			scores:   []float64{8, 6, 6, 0},
+			ranks:    []int{1, 2, 2, 4},
+		},
+		{
+			name:     "Average",
+			scoring:  TeamScoring{Aggregation: TeamAggregationAverage},
+			expected: []int64{2, 3, 1, 4},
+			scores:   []float64{3, 8.0 / 3, 1.5, 0},
+			ranks:    []int{1, 2, 3, 4},
+		},
+		{
+			name:     "Best two",
+			scoring:  TeamScoring{Aggregation: TeamAggregationBest, BestN: 2},
+			expected: []int64{3, 1, 2, 4}, // ties are ordered by total correct answers
+			scores:   []float64{6, 6, 6, 0},
+			ranks:    []int{1, 1, 1, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranking := rankTeams(teams, tt.scoring)
+			if len(ranking) != len(tt.expected) {
+				t.Fatalf("Expected %d teams, got %d", len(tt.expected), len(ranking))
+			}
+			for i, entry := range ranking {
+				if entry.TeamID != tt.expected[i] || entry.Score != tt.scores[i] || entry.Rank != tt.ranks[i] {
+					t.Errorf("ranking[%d] = team %d score %v rank %d, want team %d score %v rank %d",
+						i, entry.TeamID, entry.Score, entry.Rank, tt.expected[i], tt.scores[i], tt.ranks[i])
+				}
+			}
+		})
+	}
+
+	// Only the best members are counted, but every correct answer is reported
+	ranking := rankTeams(teams[:1], TeamScoring{Aggregation: TeamAggregationBest, BestN: 2})
+	if ranking[0].CountedMembers != 2 || ranking[0].MemberCount != 4 || ranking[0].CorrectAnswers != 6 {
+		t.Errorf("Unexpected best-N entry %+v", ranking[0])
+	}
+}
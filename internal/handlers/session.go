@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 
 	"github.com/Tattsum/quiz/internal/database"
 	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,7 +17,8 @@ func GetSessionStatus(c *gin.Context) {
 
 	// Get current session
 	var session models.QuizSession
-	sessionQuery := `SELECT id, current_quiz_id, is_accepting_answers, created_at, updated_at 
+	sessionQuery := `SELECT id, current_quiz_id, is_accepting_answers, status, game_mode,
+					 lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at
 					 FROM quiz_sessions 
 					 ORDER BY id DESC 
 					 LIMIT 1`
@@ -24,6 +27,11 @@ func GetSessionStatus(c *gin.Context) {
 		&session.ID,
 		&session.CurrentQuizID,
 		&session.IsAcceptingAnswers,
+		&session.Status,
+		&session.GameMode,
+		&session.Lifelines.FiftyFifty,
+		&session.Lifelines.Skip,
+		&session.Lifelines.Double,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 	)
@@ -53,6 +61,9 @@ func GetSessionStatus(c *gin.Context) {
 
 	var response models.SessionStatusResponse
 	response.SessionID = session.ID
+	response.Status = session.Status
+	response.GameMode = session.GameMode
+	response.Lifelines = session.Lifelines
 	response.IsAcceptingAnswers = session.IsAcceptingAnswers
 
 	// Get current quiz if available
@@ -78,20 +89,25 @@ func GetSessionStatus(c *gin.Context) {
 			response.CurrentQuiz = &currentQuiz
 		}
 
-		// Get answers count for current quiz
+		// Get answers count for current quiz from this session's participants
 		var answersCount int
-		err = db.QueryRow("SELECT COUNT(*) FROM answers WHERE quiz_id = $1", *session.CurrentQuizID).Scan(&answersCount)
+		answersQuery := `SELECT COUNT(*)
+						 FROM answers a
+						 JOIN participants p ON a.participant_id = p.id
+						 WHERE a.quiz_id = $1 AND p.session_id = $2 AND NOT p.answers_excluded`
+		err = db.QueryRow(answersQuery, *session.CurrentQuizID, session.ID).Scan(&answersCount)
 		if err == nil {
 			response.AnswersCount = answersCount
 		}
 	}
 
-	// Get total participants
-	var totalParticipants int
-	err = db.QueryRow("SELECT COUNT(*) FROM participants").Scan(&totalParticipants)
+	// Get registered and connected participants
+	counts, err := loadParticipantCounts(db, session.ID)
 	if err == nil {
-		response.TotalParticipants = totalParticipants
+		response.TotalParticipants = counts.Registered
+		response.ConnectedParticipants = counts.Connected
 	}
+	response.AnswerRate = answerRate(response.AnswersCount, response.ConnectedParticipants)
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -153,13 +169,39 @@ func StartSession(c *gin.Context) {
 		return
 	}
 
-	// Create new session
-	sessionQuery := `INSERT INTO quiz_sessions (current_quiz_id, is_accepting_answers, created_at, updated_at)
-					 VALUES ($1, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-					 RETURNING id, created_at, updated_at`
-
+	before := sessionAuditState(db)
+
+	// A session opened as a lobby starts with its first question; otherwise a new session is created
+	sessionQuery := `UPDATE quiz_sessions
+					 SET current_quiz_id = $1, is_accepting_answers = true, status = $2,
+					     game_mode = COALESCE($4, game_mode),
+					     question_limit = CASE WHEN $5::INT IS NULL THEN question_limit ELSE NULLIF($5, 0) END,
+					     lifeline_fifty_fifty = COALESCE($6, lifeline_fifty_fifty),
+					     lifeline_skip = COALESCE($7, lifeline_skip),
+					     lifeline_double = COALESCE($8, lifeline_double),
+					     updated_at = CURRENT_TIMESTAMP
+					 WHERE id = (SELECT id FROM quiz_sessions ORDER BY id DESC LIMIT 1) AND status = $3
+					 RETURNING id, game_mode, lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at`
+
+	fiftyFifty, skip, double := lifelineLimitValues(req.Lifelines)
 	var sessionID int64
-	err = db.QueryRow(sessionQuery, req.QuizID).Scan(&sessionID, &quiz.CreatedAt, &quiz.UpdatedAt)
+	var gameMode string
+	var lifelines models.LifelineCounts
+	err = db.QueryRow(sessionQuery, req.QuizID, SessionStatusActive, SessionStatusLobby, req.GameMode, req.QuestionLimit,
+		fiftyFifty, skip, double).
+		Scan(&sessionID, &gameMode, &lifelines.FiftyFifty, &lifelines.Skip, &lifelines.Double, &quiz.CreatedAt, &quiz.UpdatedAt)
+	if err == sql.ErrNoRows {
+		sessionQuery = `INSERT INTO quiz_sessions (current_quiz_id, is_accepting_answers, status, game_mode, question_limit,
+						                           lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at)
+						VALUES ($1, true, $2, COALESCE($3, 'standard'), NULLIF($4, 0), COALESCE($5, 0), COALESCE($6, 0), COALESCE($7, 0),
+						        CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+						RETURNING id, game_mode, lifeline_fifty_fifty, lifeline_skip, lifeline_double, created_at, updated_at`
+		err = createSession(db, func(tx *sql.Tx) (int64, error) {
+			err := tx.QueryRow(sessionQuery, req.QuizID, SessionStatusActive, req.GameMode, req.QuestionLimit, fiftyFifty, skip, double).
+				Scan(&sessionID, &gameMode, &lifelines.FiftyFifty, &lifelines.Skip, &lifelines.Double, &quiz.CreatedAt, &quiz.UpdatedAt)
+			return sessionID, err
+		})
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -171,6 +213,12 @@ func StartSession(c *gin.Context) {
 		return
 	}
 
+	// A new session has no state before it started; a lobby session had one
+	if target := sessionAuditTarget(before); target == nil || *target != sessionID {
+		before = nil
+	}
+	recordAudit(c, services.AuditActionSessionStart, services.AuditTargetSession, &sessionID, before, sessionAuditState(db))
+
 	currentQuiz := convertQuizToPublic(quiz)
 
 	// Broadcast session start and first question
@@ -179,6 +227,8 @@ func StartSession(c *gin.Context) {
 		"session_id":           sessionID,
 		"quiz":                 currentQuiz,
 		"is_accepting_answers": true,
+		"game_mode":            gameMode,
+		"lifelines":            lifelines,
 		"status":               "started",
 	})
 
@@ -189,6 +239,8 @@ func StartSession(c *gin.Context) {
 			"session_id":           sessionID,
 			"quiz":                 currentQuiz,
 			"is_accepting_answers": true,
+			"game_mode":            gameMode,
+			"lifelines":            lifelines,
 		},
 	})
 }
@@ -247,9 +299,20 @@ func NextQuestion(c *gin.Context) {
 		return
 	}
 
+	// In an elimination game the previous question is judged before moving on, in case answers
+	// were never closed; the game may end here
+	closeEliminationRound(db)
+	if !checkEliminationGameRunning(c, db) {
+		return
+	}
+
+	before := sessionAuditState(db)
+
 	// Get current session and update it
 	sessionQuery := `UPDATE quiz_sessions 
-					 SET current_quiz_id = $1, is_accepting_answers = true, updated_at = CURRENT_TIMESTAMP
+					 SET current_quiz_id = $1, is_accepting_answers = true,
+					     status = CASE WHEN status = 'lobby' THEN 'active' ELSE status END,
+					     updated_at = CURRENT_TIMESTAMP
 					 WHERE id = (SELECT id FROM quiz_sessions ORDER BY id DESC LIMIT 1)
 					 RETURNING id`
 
@@ -266,6 +329,12 @@ func NextQuestion(c *gin.Context) {
 		return
 	}
 
+	if err := applyPendingDoubles(db, sessionID, req.QuizID); err != nil {
+		log.Printf("Failed to apply pending doubles to quiz %d: %v", req.QuizID, err)
+	}
+
+	recordAudit(c, services.AuditActionSessionNextQuestion, services.AuditTargetSession, &sessionID, before, sessionAuditState(db))
+
 	currentQuiz := convertQuizToPublic(quiz)
 
 	// Broadcast question switch (assuming question numbers for now)
@@ -304,6 +373,7 @@ func ToggleAnswers(c *gin.Context) {
 	}
 
 	db := database.GetDB()
+	before := sessionAuditState(db)
 
 	// Update current session
 	sessionQuery := `UPDATE quiz_sessions 
@@ -322,6 +392,9 @@ func ToggleAnswers(c *gin.Context) {
 		return
 	}
 
+	after := sessionAuditState(db)
+	recordAudit(c, services.AuditActionSessionToggle, services.AuditTargetSession, sessionAuditTarget(after), before, after)
+
 	message := "回答受付を開始しました"
 	if !req.IsAcceptingAnswers {
 		message = "回答受付を停止しました"
@@ -331,6 +404,8 @@ func ToggleAnswers(c *gin.Context) {
 		if currentQuizID != nil {
 			BroadcastVotingEnd(*currentQuizID, *currentQuizID)
 		}
+		BroadcastTeamRanking()
+		closeEliminationRound(db)
 	}
 
 	// Broadcast session update
@@ -348,17 +423,72 @@ func ToggleAnswers(c *gin.Context) {
 	})
 }
 
-// EndSession ends the current quiz session
-func EndSession(c *gin.Context) {
-	db := database.GetDB()
+// createSession runs insert, which inserts a session and returns its ID, and moves the
+// participants and teams waiting for a session into it
+func createSession(db *sql.DB, insert func(tx *sql.Tx) (int64, error)) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after commit
+	}()
 
-	// Update current session to stop accepting answers
+	sessionID, err := insert(tx)
+	if err != nil {
+		return err
+	}
+	if err := adoptWaitingParticipants(tx, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adoptWaitingParticipants moves the participants and teams registered while no session was
+// open into the new session sessionID. They have no session and were created after the
+// previous session, during which registrations joined that session instead.
+func adoptWaitingParticipants(tx *sql.Tx, sessionID int64) error {
+	for _, table := range []string{"teams", "participants"} {
+		query := `UPDATE ` + table + ` SET session_id = $1
+				  WHERE session_id IS NULL
+				    AND created_at >= COALESCE((SELECT MAX(created_at) FROM quiz_sessions WHERE id < $1), '-infinity'::TIMESTAMP)`
+		if _, err := tx.Exec(query, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endCurrentSession stops answers and marks the current session as ended
+func endCurrentSession(db *sql.DB) error {
 	sessionQuery := `UPDATE quiz_sessions 
-					 SET is_accepting_answers = false, current_quiz_id = NULL, updated_at = CURRENT_TIMESTAMP
+					 SET is_accepting_answers = false, current_quiz_id = NULL, status = 'ended', updated_at = CURRENT_TIMESTAMP
 					 WHERE id = (SELECT id FROM quiz_sessions ORDER BY id DESC LIMIT 1)`
 
 	_, err := db.Exec(sessionQuery)
-	if err != nil {
+	return err
+}
+
+// broadcastSessionEnded broadcasts the end of the session with any extra fields
+func broadcastSessionEnded(extra map[string]interface{}) {
+	update := map[string]interface{}{
+		"is_accepting_answers": false,
+		"current_quiz":         nil,
+		"status":               "ended",
+	}
+	for key, value := range extra {
+		update[key] = value
+	}
+	BroadcastSessionUpdate(update)
+}
+
+// EndSession ends the current quiz session
+func EndSession(c *gin.Context) {
+	db := database.GetDB()
+	before := sessionAuditState(db)
+
+	// Update current session to stop accepting answers
+	if err := endCurrentSession(db); err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Error: &models.APIError{
@@ -369,12 +499,12 @@ func EndSession(c *gin.Context) {
 		return
 	}
 
+	after := sessionAuditState(db)
+	recordAudit(c, services.AuditActionSessionEnd, services.AuditTargetSession, sessionAuditTarget(after), before, after)
+
 	// Broadcast session end
-	BroadcastSessionUpdate(map[string]interface{}{
-		"is_accepting_answers": false,
-		"current_quiz":         nil,
-		"status":               "ended",
-	})
+	broadcastSessionEnded(nil)
+	BroadcastTeamRanking()
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
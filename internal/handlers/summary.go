@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Result summary formats
+const (
+	SummaryFormatJSON = "json"
+	SummaryFormatPNG  = "png" // result card to share
+	SummaryFormatPDF  = "pdf" // certificate to print
+)
+
+// defaultEventName is shown on result cards and certificates when EVENT_NAME is not set
+const defaultEventName = "Quiz Event"
+
+// eventName returns the event name shown on result summaries
+var eventName = sync.OnceValue(func() string {
+	if name := os.Getenv("EVENT_NAME"); name != "" {
+		return name
+	}
+	return defaultEventName
+})
+
+// resultRenderer draws result cards and certificates, created once with the configured fonts
+var resultRenderer = sync.OnceValues(services.NewResultRenderer)
+
+// getResultSummaryData builds a participant's personal results from their answer history
+// and their ranking. It returns sql.ErrNoRows if the participant does not exist.
+func getResultSummaryData(db *sql.DB, participantID int64) (*models.ResultSummary, error) {
+	ranking, err := getParticipantRankingData(db, participantID)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := getParticipantAnswersData(db, participantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionID int64
+	if err := db.QueryRow("SELECT COALESCE(session_id, 0) FROM participants WHERE id = $1", participantID).Scan(&sessionID); err != nil {
+		return nil, err
+	}
+	settings, err := loadSessionSettings(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The answer history is newest first; the summary lists questions in the order they were asked
+	questions := slices.Clone(answers.Answers)
+	slices.Reverse(questions)
+	if questions == nil {
+		questions = []models.ParticipantAnswer{}
+	}
+
+	return &models.ResultSummary{
+		EventName:         eventName(),
+		ParticipantID:     participantID,
+		Nickname:          ranking.Nickname,
+		Rank:              ranking.CurrentRank,
+		TotalParticipants: ranking.TotalParticipants,
+		Percentile:        ranking.Percentile,
+		TotalAnswers:      answers.TotalAnswers,
+		CorrectAnswers:    answers.CorrectAnswers,
+		SkippedAnswers:    answers.SkippedAnswers,
+		AccuracyRate:      answers.AccuracyRate,
+		TotalScore:        answers.TotalScore,
+		Questions:         questions,
+		Final:             settings.status == SessionStatusEnded,
+		GeneratedAt:       time.Now(),
+	}, nil
+}
+
+// GetParticipantSummary returns a participant's personal results as JSON, a PNG result card
+// or a PDF certificate, selected with the format query parameter
+func GetParticipantSummary(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid participant ID",
+			},
+		})
+		return
+	}
+
+	// Results are only available to the participant themselves
+	if id != authenticatedParticipantID(c) {
+		participantForbidden(c, "Cannot view another participant's results")
+		return
+	}
+
+	format := c.DefaultQuery("format", SummaryFormatJSON)
+	if format != SummaryFormatJSON && format != SummaryFormatPNG && format != SummaryFormatPDF {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_FORMAT",
+				Message: "format must be json, png or pdf",
+			},
+		})
+		return
+	}
+
+	summary, err := getResultSummaryData(database.GetDB(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "PARTICIPANT_NOT_FOUND",
+					Message: "Participant not found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to get results",
+			},
+		})
+		return
+	}
+
+	if format == SummaryFormatJSON {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Data:    summary,
+		})
+		return
+	}
+
+	data, contentType, err := renderResultSummary(summary, format)
+	if errors.Is(err, services.ErrMissingGlyphs) {
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "FONT_NOT_AVAILABLE",
+				Message: "The configured font cannot draw the event name or nickname",
+			},
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to render results of participant %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "RENDER_ERROR",
+				Message: "Failed to render results",
+			},
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="quiz-result-%d.%s"`, id, format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// renderResultSummary draws the summary as a PNG result card or a PDF certificate
+func renderResultSummary(summary *models.ResultSummary, format string) ([]byte, string, error) {
+	renderer, err := resultRenderer()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if format == SummaryFormatPNG {
+		img, err := renderer.RenderCard(summary)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), services.ContentTypePNG, nil
+	}
+
+	img, err := renderer.RenderCertificate(summary)
+	if err != nil {
+		return nil, "", err
+	}
+	title := fmt.Sprintf("%s - %s", summary.EventName, summary.Nickname)
+	if err := services.EncodePDF(&buf, img, services.A4LandscapeWidth, services.A4LandscapeHeight, title); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "application/pdf", nil
+}
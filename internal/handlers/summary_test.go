@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetParticipantSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+	db := database.GetDB()
+
+	var participantID int64
+	err = db.QueryRow("INSERT INTO participants (nickname) VALUES ($1) RETURNING id", fmt.Sprintf("Summary%d", os.Getpid())).Scan(&participantID)
+	if err != nil {
+		t.Fatalf("Failed to create test participant: %v", err)
+	}
+
+	// 3問に回答: ダブルで正解、不正解、スキップ
+	optionA, optionB, double, skip := "A", "B", LifelineDouble, LifelineSkip
+	answers := []struct {
+		option   *string
+		correct  bool
+		lifeline *string
+	}{
+		{&optionA, true, &double},
+		{&optionB, false, nil},
+		{nil, false, &skip},
+	}
+	for _, a := range answers {
+		var quizID int64
+		err := db.QueryRow(`INSERT INTO quizzes (question_text, option_a, option_b, option_c, option_d, correct_answer)
+							VALUES ('Summary Question?', 'A', 'B', 'C', 'D', 'A')
+							RETURNING id`).Scan(&quizID)
+		if err != nil {
+			t.Fatalf("Failed to create test quiz: %v", err)
+		}
+		_, err = db.Exec(`INSERT INTO answers (participant_id, quiz_id, selected_option, is_correct, lifeline) VALUES ($1, $2, $3, $4, $5)`,
+			participantID, quizID, a.option, a.correct, a.lifeline)
+		if err != nil {
+			t.Fatalf("Failed to create test answer: %v", err)
+		}
+	}
+
+	request := func(id int64, format string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/participants/summary?format="+format, nil)
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+		c.Set("participant_id", participantID)
+		GetParticipantSummary(c)
+		return w
+	}
+
+	// JSON: 回答順に並び、スキップは回答数に含めない
+	w := request(participantID, SummaryFormatJSON)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.ResultSummary `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode summary: %v", err)
+	}
+	summary := response.Data
+	if summary.TotalAnswers != 2 || summary.CorrectAnswers != 1 || summary.SkippedAnswers != 1 || summary.TotalScore != 2 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if len(summary.Questions) != 3 || !summary.Questions[0].IsCorrect || summary.Questions[0].Points != 2 {
+		t.Errorf("Expected questions in the order they were answered, got %+v", summary.Questions)
+	}
+	if summary.Rank < 1 || summary.Rank > summary.TotalParticipants || summary.EventName == "" {
+		t.Errorf("Unexpected ranking %+v", summary)
+	}
+
+	// PNGの結果カードとPDFの参加証
+	w = request(participantID, SummaryFormatPNG)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("Expected a PNG card, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if _, err := png.Decode(w.Body); err != nil {
+		t.Errorf("Card is not a valid PNG: %v", err)
+	}
+	w = request(participantID, SummaryFormatPDF)
+	if w.Code != http.StatusOK || !bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")) {
+		t.Errorf("Expected a PDF certificate, got %d", w.Code)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, fmt.Sprintf("quiz-result-%d.pdf", participantID)) {
+		t.Errorf("Expected a download file name, got %q", disposition)
+	}
+
+	// 他の参加者の結果と未対応の形式は取得できない
+	if w := request(participantID+1, SummaryFormatJSON); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for another participant, got %d", w.Code)
+	}
+	if w := request(participantID, "gif"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", w.Code)
+	}
+}
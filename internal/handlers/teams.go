@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Team score aggregations
+const (
+	TeamAggregationSum     = "sum"     // total of all member scores
+	TeamAggregationAverage = "average" // mean member score, so team size does not matter
+	TeamAggregationBest    = "best"    // total of the best N member scores
+
+	// DefaultTeamBestN is the number of members counted by the best aggregation
+	DefaultTeamBestN = 3
+)
+
+// errTeamNotFound is returned when a team does not exist in the session
+var errTeamNotFound = errors.New("team not found")
+
+// TeamScoring configures how member scores add up to a team score
+type TeamScoring struct {
+	Aggregation string
+	BestN       int
+}
+
+// LoadTeamScoring reads the team scoring from TEAM_SCORE_AGGREGATION and TEAM_SCORE_BEST_N.
+// Unknown aggregations fall back to sum.
+func LoadTeamScoring() TeamScoring {
+	scoring := TeamScoring{
+		Aggregation: strings.ToLower(os.Getenv("TEAM_SCORE_AGGREGATION")),
+		BestN:       intFromEnv("TEAM_SCORE_BEST_N", DefaultTeamBestN),
+	}
+	if !scoring.valid() {
+		scoring.Aggregation = TeamAggregationSum
+	}
+	if scoring.BestN < 1 {
+		scoring.BestN = DefaultTeamBestN
+	}
+	return scoring
+}
+
+// teamScoring is the default team scoring, loaded once
+var teamScoring = sync.OnceValue(LoadTeamScoring)
+
+// valid reports whether the aggregation is known
+func (s TeamScoring) valid() bool {
+	switch s.Aggregation {
+	case TeamAggregationSum, TeamAggregationAverage, TeamAggregationBest:
+		return true
+	}
+	return false
+}
+
+// teamInSession returns errTeamNotFound unless the team belongs to the session
+func teamInSession(db *sql.DB, teamID, sessionID int64) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM teams WHERE id = $1 AND COALESCE(session_id, 0) = $2)`
+	if err := db.QueryRow(query, teamID, sessionID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errTeamNotFound
+	}
+	return nil
+}
+
+// registrationTeam returns the team of a participant registering in the session.
+// A chosen team must belong to the session; otherwise the participant joins the team with
+// the fewest members. It returns nil if the session has no teams.
+func registrationTeam(db *sql.DB, sessionID int64, teamID *int64) (*int64, error) {
+	if teamID != nil {
+		if err := teamInSession(db, *teamID, sessionID); err != nil {
+			return nil, err
+		}
+		return teamID, nil
+	}
+
+	query := `SELECT t.id
+			  FROM teams t
+			  LEFT JOIN participants p ON p.team_id = t.id AND p.kicked_at IS NULL
+			  WHERE COALESCE(t.session_id, 0) = $1
+			  GROUP BY t.id
+			  ORDER BY COUNT(p.id), t.id
+			  LIMIT 1`
+
+	var assigned int64
+	if err := db.QueryRow(query, sessionID).Scan(&assigned); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &assigned, nil
+}
+
+// teamNotFoundResponse writes the error for a team that does not exist in the session
+func teamNotFoundResponse(c *gin.Context, status int) {
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "TEAM_NOT_FOUND",
+			Message: "Team not found in this session",
+		},
+	})
+}
+
+// teamNameTakenResponse writes the error for a duplicate team name
+func teamNameTakenResponse(c *gin.Context) {
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Error: &models.APIError{
+			Code:    "TEAM_NAME_TAKEN",
+			Message: "A team with this name already exists in the session",
+		},
+	})
+}
+
+// bindTeamRequest binds and trims a team request.
+// It writes an error response and returns false if the request is invalid.
+func bindTeamRequest(c *gin.Context) (string, bool) {
+	var req models.TeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return "", false
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Team name is required",
+			},
+		})
+		return "", false
+	}
+	return name, true
+}
+
+// teamIDParam parses the team ID path parameter.
+// It writes an error response and returns false if the ID is invalid.
+func teamIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_ID",
+				Message: "Invalid team ID",
+			},
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// ListTeams lists the teams of a session with their member counts, for choosing a team at
+// registration. The session defaults to the current one.
+func ListTeams(c *gin.Context) {
+	sessionID, ok := sessionIDQuery(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	query := `SELECT t.id, t.session_id, t.name, COUNT(p.id), t.created_at
+			  FROM teams t
+			  LEFT JOIN participants p ON p.team_id = t.id AND p.kicked_at IS NULL
+			  WHERE COALESCE(t.session_id, 0) = $1
+			  GROUP BY t.id, t.session_id, t.name, t.created_at
+			  ORDER BY t.id`
+
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to query teams",
+			},
+		})
+		return
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	teams := []models.Team{}
+	for rows.Next() {
+		var team models.Team
+		if err := rows.Scan(&team.ID, &team.SessionID, &team.Name, &team.MemberCount, &team.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "SCAN_ERROR",
+					Message: "Failed to scan team data",
+				},
+			})
+			return
+		}
+		teams = append(teams, team)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    teams,
+	})
+}
+
+// CreateTeam creates a team in the open session, or for the next session if none is open (admin only)
+func CreateTeam(c *gin.Context) {
+	name, ok := bindTeamRequest(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	query := `INSERT INTO teams (session_id, name, created_at)
+			  VALUES (NULLIF($1, 0), $2, CURRENT_TIMESTAMP)
+			  RETURNING id, session_id, name, created_at`
+
+	var team models.Team
+	err := db.QueryRow(query, openSessionID(), name).Scan(&team.ID, &team.SessionID, &team.Name, &team.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			teamNameTakenResponse(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to create team",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "チームを作成しました",
+		Data:    team,
+	})
+}
+
+// UpdateTeam renames a team (admin only)
+func UpdateTeam(c *gin.Context) {
+	id, ok := teamIDParam(c)
+	if !ok {
+		return
+	}
+	name, ok := bindTeamRequest(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	query := `UPDATE teams SET name = $1 WHERE id = $2
+			  RETURNING id, session_id, name, created_at`
+
+	var team models.Team
+	err := db.QueryRow(query, name, id).Scan(&team.ID, &team.SessionID, &team.Name, &team.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			teamNotFoundResponse(c, http.StatusNotFound)
+			return
+		}
+		if isUniqueViolation(err) {
+			teamNameTakenResponse(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to update team",
+			},
+		})
+		return
+	}
+
+	BroadcastTeamRanking()
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "チームを更新しました",
+		Data:    team,
+	})
+}
+
+// DeleteTeam deletes a team (admin only). Its members stay in the session without a team.
+func DeleteTeam(c *gin.Context) {
+	id, ok := teamIDParam(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	result, err := db.Exec("DELETE FROM teams WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to delete team",
+			},
+		})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		teamNotFoundResponse(c, http.StatusNotFound)
+		return
+	}
+
+	BroadcastTeamRanking()
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "チームを削除しました",
+	})
+}
+
+// AssignParticipantTeam moves a participant to another team of their session, or removes them
+// from their team with a null team_id (admin only)
+func AssignParticipantTeam(c *gin.Context) {
+	id, ok := participantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ParticipantTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	db := database.GetDB()
+	participant, ok := loadParticipantOrRespond(c, db, id)
+	if !ok {
+		return
+	}
+
+	if req.TeamID != nil {
+		var sessionID int64
+		if participant.SessionID != nil {
+			sessionID = *participant.SessionID
+		}
+		if err := teamInSession(db, *req.TeamID, sessionID); err != nil {
+			if errors.Is(err, errTeamNotFound) {
+				teamNotFoundResponse(c, http.StatusBadRequest)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to check team",
+				},
+			})
+			return
+		}
+	}
+
+	if _, err := db.Exec("UPDATE participants SET team_id = $1 WHERE id = $2", req.TeamID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to update participant",
+			},
+		})
+		return
+	}
+
+	recordModerationAction(c, db, moderationAction{
+		Action:        ParticipantActionTeamChanged,
+		ParticipantID: participant.ID,
+		Details:       map[string]interface{}{"from": participant.TeamID, "to": req.TeamID},
+	})
+
+	participant.TeamID = req.TeamID
+	BroadcastParticipantUpdate(participant, ParticipantActionTeamChanged)
+	BroadcastTeamRanking()
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "チームを変更しました",
+		Data:    participant,
+	})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadTeamScoring(t *testing.T) {
+	t.Setenv("TEAM_SCORE_AGGREGATION", "Best")
+	t.Setenv("TEAM_SCORE_BEST_N", "5")
+	if scoring := LoadTeamScoring(); scoring.Aggregation != TeamAggregationBest || scoring.BestN != 5 {
+		t.Errorf("Unexpected team scoring %+v", scoring)
+	}
+
+	t.Setenv("TEAM_SCORE_AGGREGATION", "median")
+	t.Setenv("TEAM_SCORE_BEST_N", "0")
+	if scoring := LoadTeamScoring(); scoring.Aggregation != TeamAggregationSum || scoring.BestN != DefaultTeamBestN {
+		t.Errorf("Expected defaults for invalid settings, got %+v", scoring)
+	}
+}
+
+func TestTeamMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// テスト環境用のデータベース設定
+	setupTestEnv()
+
+	// データベース接続を初期化
+	_, err := database.Initialize()
+	if err != nil && os.Getenv("TEST_ENV") != testEnvValue {
+		t.Skipf("Database connection failed (not in test environment): %v", err)
+	} else if err != nil {
+		t.Fatalf("Database connection failed in test environment: %v", err)
+	}
+
+	send := func(method, path string, handler gin.HandlerFunc, params gin.Params, requestBody interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		var body []byte
+		if requestBody != nil {
+			body, _ = json.Marshal(requestBody)
+		}
+		c.Request, _ = http.NewRequest(method, path, bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = params
+		handler(c)
+		return w
+	}
+
+	// 現在のセッションにチームを2つ作成
+	suffix := os.Getpid()
+	createTeam := func(name string) int64 {
+		w := send("POST", "/admin/teams", CreateTeam, nil, models.TeamRequest{Name: name})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Create team failed: %d %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data models.Team `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode team: %v", err)
+		}
+		return response.Data.ID
+	}
+	red := createTeam(fmt.Sprintf("Red%d", suffix))
+	blue := createTeam(fmt.Sprintf("Blue%d", suffix))
+	defer func() {
+		for _, id := range []int64{red, blue} {
+			send("DELETE", "/admin/teams", DeleteTeam, gin.Params{{Key: "id", Value: fmt.Sprintf("%d", id)}}, nil)
+		}
+	}()
+
+	if w := send("POST", "/admin/teams", CreateTeam, nil, models.TeamRequest{Name: fmt.Sprintf("Red%d", suffix)}); w.Code != http.StatusConflict {
+		t.Errorf("Expected duplicate team name to fail, got %d %s", w.Code, w.Body.String())
+	}
+
+	register := func(nickname string, teamID *int64) (int, *int64) {
+		w := send("POST", "/participants/register", RegisterParticipant, nil, models.ParticipantRequest{Nickname: nickname, TeamID: teamID})
+		var response struct {
+			Data struct {
+				TeamID *int64 `json:"team_id"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data.TeamID
+	}
+
+	// 選んだチームに所属する
+	if code, teamID := register(fmt.Sprintf("TeamA%d", suffix), &red); code != http.StatusCreated || teamID == nil || *teamID != red {
+		t.Errorf("Expected participant in the chosen team, got %d %v", code, teamID)
+	}
+
+	// 選ばなかった参加者は人数の少ないチームに割り当てる
+	if code, teamID := register(fmt.Sprintf("TeamB%d", suffix), nil); code != http.StatusCreated || teamID == nil || *teamID != blue {
+		t.Errorf("Expected participant in the smallest team, got %d %v", code, teamID)
+	}
+
+	// 存在しないチームは選べない
+	missing := int64(-1)
+	if code, _ := register(fmt.Sprintf("TeamC%d", suffix), &missing); code != http.StatusBadRequest {
+		t.Errorf("Expected unknown team to be refused, got %d", code)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Default aggregation", "", http.StatusOK},
+		{"Average", "?aggregation=average", http.StatusOK},
+		{"Best N", "?aggregation=best&best_n=2", http.StatusOK},
+		{"Unknown aggregation", "?aggregation=median", http.StatusBadRequest},
+		{"Invalid best N", "?aggregation=best&best_n=0", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send("GET", "/ranking/teams"+tt.query, GetTeamRanking, nil, nil)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d. Response body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Data models.TeamRankingResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode team ranking: %v", err)
+			}
+			found := 0
+			for _, entry := range response.Data.Ranking {
+				if entry.TeamID == red || entry.TeamID == blue {
+					found++
+				}
+			}
+			if found != 2 {
+				t.Errorf("Expected both teams in the ranking, got %+v", response.Data.Ranking)
+			}
+		})
+	}
+}
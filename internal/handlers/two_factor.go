@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// respondTwoFactorChallenge answers a login whose password was correct with a challenge token
+// for the second step. With setup, the administrator must set up two-factor authentication.
+func respondTwoFactorChallenge(c *gin.Context, admin *models.Administrator, setup bool) {
+	token, expiresAt, err := jwtService.GenerateTwoFactorChallenge(admin, setup)
+	if err != nil {
+		log.Printf("Failed to generate two-factor challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate authentication tokens",
+			},
+		})
+		return
+	}
+
+	message := "認証アプリのコードを入力してください"
+	if setup {
+		message = "二段階認証の設定が必要です"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data: models.TwoFactorChallengeResponse{
+			TwoFactorRequired:      !setup,
+			TwoFactorSetupRequired: setup,
+			ChallengeToken:         token,
+			ExpiresAt:              expiresAt,
+		},
+	})
+}
+
+// continueWithTwoFactor answers a login with a challenge token if the administrator has
+// two-factor authentication or must set it up, and reports whether the login was answered
+func continueWithTwoFactor(c *gin.Context, admin *models.Administrator) bool {
+	required := false
+	if !admin.TwoFactorEnabled {
+		settings, err := services.NewTwoFactorService().SecuritySettings()
+		if err != nil {
+			log.Printf("Failed to get security settings: %v", err)
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "DATABASE_ERROR",
+					Message: "Failed to sign in",
+				},
+			})
+			return true
+		}
+		required = settings.RequireTwoFactor
+	}
+	if admin.TwoFactorEnabled || required {
+		respondTwoFactorChallenge(c, admin, !admin.TwoFactorEnabled)
+		return true
+	}
+	return false
+}
+
+// twoFactorChallenge validates the challenge token of the second login step and returns the
+// administrator, writing an error response if the login cannot continue
+func twoFactorChallenge(c *gin.Context, challengeToken string) (*models.JWTClaims, *models.Administrator, bool) {
+	claims, err := jwtService.ValidateTwoFactorChallenge(challengeToken)
+	if err != nil {
+		code, message := "INVALID_CHALLENGE", "Invalid challenge token; sign in again"
+		if errors.Is(err, services.ErrExpiredToken) {
+			code, message = "CHALLENGE_EXPIRED", "The challenge has expired; sign in again"
+		}
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    code,
+				Message: message,
+			},
+		})
+		return nil, nil, false
+	}
+
+	admin, err := services.NewAuthService().GetAdminByID(claims.AdminID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to get administrator")
+		return nil, nil, false
+	}
+	if admin.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "ADMIN_DISABLED",
+				Message: "This administrator account has been disabled",
+			},
+		})
+		return nil, nil, false
+	}
+	return claims, admin, true
+}
+
+// BeginTwoFactorSetup generates a TOTP secret during a login that requires setting up
+// two-factor authentication. The login is completed with a code of the secret.
+func BeginTwoFactorSetup(c *gin.Context) {
+	var req models.TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	claims, _, ok := twoFactorChallenge(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	if claims.Type != services.TwoFactorSetupType {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "INVALID_TOKEN_TYPE",
+				Message: "Two-factor authentication is already set up",
+			},
+		})
+		return
+	}
+
+	enrollment, err := services.NewTwoFactorService().BeginEnrollment(claims.AdminID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to start two-factor setup")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "認証アプリにQRコードを登録してください",
+		Data:    enrollment,
+	})
+}
+
+// AdminLoginTwoFactor completes a login with a one-time code or a recovery code. During a
+// setup login the code enables two-factor authentication and recovery codes are returned.
+func AdminLoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	claims, admin, ok := twoFactorChallenge(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	// Wrong codes count as failed logins, so that codes cannot be guessed either
+	guard := services.NewLoginGuard()
+	if loginLocked(c, guard, admin.Username) {
+		return
+	}
+
+	twoFactor := services.NewTwoFactorService()
+	var recoveryCodes []string
+	var err error
+	if claims.Type == services.TwoFactorSetupType {
+		recoveryCodes, err = twoFactor.ConfirmEnrollment(admin.ID, req.Code)
+		admin.TwoFactorEnabled = err == nil
+	} else {
+		err = twoFactor.Verify(admin.ID, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			recordLoginFailure(c, guard, admin.Username, services.LoginReasonInvalidTwoFactorCode)
+			c.JSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Error: &models.APIError{
+					Code:    "INVALID_TWO_FACTOR_CODE",
+					Message: "The authentication code is invalid or was already used",
+				},
+			})
+			return
+		}
+		respondAdminError(c, err, "Failed to verify two-factor authentication")
+		return
+	}
+
+	response, err := newSessionService().StartSession(admin)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "TOKEN_GENERATION_ERROR",
+				Message: "Failed to generate authentication tokens",
+			},
+		})
+		return
+	}
+
+	recordLoginSuccess(c, guard, admin, services.LoginReasonTwoFactor)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ログインに成功しました",
+		Data: models.TwoFactorLoginResponse{
+			LoginResponse: *response,
+			RecoveryCodes: recoveryCodes,
+		},
+	})
+}
+
+// requireAdminID returns the signed-in administrator's ID, writing an error response if there is none
+func requireAdminID(c *gin.Context) (int64, bool) {
+	id := adminIDFromContext(c)
+	if id == nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "UNAUTHORIZED",
+				Message: "Authentication required",
+			},
+		})
+		return 0, false
+	}
+	return *id, true
+}
+
+// GetTwoFactorStatus returns the two-factor state of the signed-in administrator
+func GetTwoFactorStatus(c *gin.Context) {
+	id, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	status, err := services.NewTwoFactorService().Status(id)
+	if err != nil {
+		respondAdminError(c, err, "Failed to get two-factor status")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// EnrollTwoFactor generates a TOTP secret for the signed-in administrator. Two-factor
+// authentication is enabled once ConfirmTwoFactor receives a code of the secret.
+func EnrollTwoFactor(c *gin.Context) {
+	id, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := services.NewTwoFactorService().BeginEnrollment(id)
+	if err != nil {
+		respondAdminError(c, err, "Failed to start two-factor setup")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "認証アプリにQRコードを登録してください",
+		Data:    enrollment,
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a code of the enrolled secret and
+// returns the recovery codes, which are shown only once
+func ConfirmTwoFactor(c *gin.Context) {
+	id, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	codes, err := services.NewTwoFactorService().ConfirmEnrollment(id, req.Code)
+	if err != nil {
+		respondAdminError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "二段階認証を有効にしました。リカバリーコードを保管してください",
+		Data:    models.RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the signed-in administrator after
+// checking a one-time code
+func RegenerateRecoveryCodes(c *gin.Context) {
+	id, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	codes, err := services.NewTwoFactorService().RegenerateRecoveryCodes(id, req.Code)
+	if err != nil {
+		respondAdminError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "リカバリーコードを再発行しました",
+		Data:    models.RecoveryCodesResponse{RecoveryCodes: codes},
+	})
+}
+
+// DisableTwoFactor turns off two-factor authentication of the signed-in administrator after
+// checking their password and a code. It is refused while owners require two-factor authentication.
+func DisableTwoFactor(c *gin.Context) {
+	id, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	if err := services.NewAuthService().VerifyPassword(id, req.Password); err != nil {
+		respondAdminError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+	if err := services.NewTwoFactorService().Disable(id, req.Code); err != nil {
+		respondAdminError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "二段階認証を無効にしました",
+	})
+}
+
+// ResetAdminTwoFactor turns off two-factor authentication of another administrator who lost
+// their device (owner only)
+func ResetAdminTwoFactor(c *gin.Context) {
+	id, ok := adminIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := services.NewTwoFactorService().Reset(id); err != nil {
+		respondAdminError(c, err, "Failed to reset two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "二段階認証をリセットしました",
+	})
+}
+
+// GetSecuritySettings returns the security policies (owner only)
+func GetSecuritySettings(c *gin.Context) {
+	settings, err := services.NewTwoFactorService().SecuritySettings()
+	if err != nil {
+		respondAdminError(c, err, "Failed to get security settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    settings,
+	})
+}
+
+// UpdateSecuritySettings sets whether every administrator must use two-factor authentication
+// (owner only). Administrators without it are asked to set it up at their next login.
+func UpdateSecuritySettings(c *gin.Context) {
+	id, ok := requireAdminID(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateSecuritySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error: &models.APIError{
+				Code:    "VALIDATION_ERROR",
+				Message: "Invalid request data",
+				Details: parseValidationErrors(err),
+			},
+		})
+		return
+	}
+
+	settings, err := services.NewTwoFactorService().UpdateSecuritySettings(*req.RequireTwoFactor, id)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update security settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "セキュリティ設定を更新しました",
+		Data:    settings,
+	})
+}
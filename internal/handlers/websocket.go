@@ -1,10 +1,10 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Tattsum/quiz/internal/database"
@@ -13,31 +13,20 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-const (
-	// MaxConnections is the maximum number of concurrent WebSocket connections allowed
-	MaxConnections = 150 // 最大接続数 - Increased for performance testing
-)
-
 var (
 	upgrader = websocket.Upgrader{
+		// permessage-deflate is negotiated only when the client offers it
+		EnableCompression: true,
+		Subprotocols:      subprotocols(),
 		CheckOrigin: func(_ /*r*/ *http.Request) bool {
 			// In production, implement proper origin checking
 			return true
 		},
 	}
 
-	// Store active WebSocket connections
-	connections      = make(map[*websocket.Conn]*ClientConnection)
-	connectionsMutex = sync.RWMutex{}
+	errDatabaseNotInitialized = errors.New("database connection not initialized")
 )
 
-// ClientConnection represents a WebSocket client connection
-type ClientConnection struct {
-	Conn          *websocket.Conn
-	QuizID        *int64
-	LastHeartbeat time.Time
-}
-
 // WebSocketMessage represents a WebSocket message
 type WebSocketMessage struct {
 	Type string      `json:"type"`
@@ -67,33 +56,55 @@ type VotingEndNotification struct {
 
 // AnswerStatusUpdate represents current answer status
 type AnswerStatusUpdate struct {
-	QuizID            int64          `json:"quiz_id"`
-	QuestionID        int64          `json:"question_id"`
-	TotalParticipants int            `json:"total_participants"`
-	AnsweredCount     int            `json:"answered_count"`
-	AnswerCounts      map[string]int `json:"answer_counts"`
-	UpdatedAt         time.Time      `json:"updated_at"`
+	QuizID                int64          `json:"quiz_id"`
+	QuestionID            int64          `json:"question_id"`
+	TotalParticipants     int            `json:"total_participants"`
+	ConnectedParticipants int            `json:"connected_participants"`
+	AnsweredCount         int            `json:"answered_count"`
+	AnswerRate            float64        `json:"answer_rate"`
+	AnswerCounts          map[string]int `json:"answer_counts"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+}
+
+// ParticipantUpdateNotification represents an admin moderation action on a participant
+type ParticipantUpdateNotification struct {
+	ParticipantID int64     `json:"participant_id"`
+	Nickname      string    `json:"nickname"`
+	Action        string    `json:"action"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ModerationNotice tells a participant that an admin has removed or banned them
+type ModerationNotice struct {
+	Action   string    `json:"action"`
+	Reason   string    `json:"reason,omitempty"`
+	IssuedAt time.Time `json:"issued_at"`
+}
+
+// EliminationNotice tells a participant that they are out of an elimination game
+type EliminationNotice struct {
+	SessionID    int64     `json:"session_id"`
+	QuizID       int64     `json:"quiz_id"`
+	Reason       string    `json:"reason"`
+	Survivors    int       `json:"survivors"`
+	EliminatedAt time.Time `json:"eliminated_at"`
 }
 
 // WebSocketResults handles WebSocket connections for real-time results
-//
-//nolint:gocyclo
 func WebSocketResults(c *gin.Context) {
-	// Check connection limit
-	connectionsMutex.RLock()
-	currentConnections := len(connections)
-	connectionsMutex.RUnlock()
-
-	if currentConnections >= MaxConnections {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":           "Maximum connections reached",
-			"max_connections": MaxConnections,
-		})
+	client, ok := newClientFromRequest(c, TransportWebSocket)
+	if !ok {
+		return
+	}
+
+	// Check connection limits and register
+	if !admitClient(c, client) {
 		return
 	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		hub.Unregister(client)
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
@@ -102,47 +113,27 @@ func WebSocketResults(c *gin.Context) {
 			log.Printf("Failed to close WebSocket connection: %v", err)
 		}
 	}()
+	conn.EnableWriteCompression(compressionEnabled())
+	codec := codecForSubprotocol(conn.Subprotocol())
+	log.Printf("New WebSocket connection established (%s, %s). Total connections: %d/%d", client.Role, codec.Subprotocol(), hub.ClientCount(), connectionLimits().MaxTotal)
 
-	// Register connection
-	client := &ClientConnection{
-		Conn:          conn,
-		LastHeartbeat: time.Now(),
-	}
-
-	connectionsMutex.Lock()
-	connections[conn] = client
-	log.Printf("New WebSocket connection established. Total connections: %d/%d", len(connections), MaxConnections)
-	connectionsMutex.Unlock()
+	presenceChanged(client)
 
 	// Remove connection when done
 	defer func() {
-		connectionsMutex.Lock()
-		delete(connections, conn)
-		log.Printf("WebSocket connection closed. Total connections: %d/%d", len(connections), MaxConnections)
-		connectionsMutex.Unlock()
+		hub.Unregister(client)
+		presenceChanged(client)
+		log.Printf("WebSocket connection closed. Total connections: %d/%d", hub.ClientCount(), connectionLimits().MaxTotal)
 	}()
 
 	// Set up ping/pong for connection health check
 	conn.SetPongHandler(func(string) error {
-		client.LastHeartbeat = time.Now()
+		client.Touch()
 		return nil
 	})
 
-	// Start heartbeat goroutine
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-
-		//nolint:gosimple
-		for {
-			select {
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					return
-				}
-			}
-		}
-	}()
+	// All writes happen on a single goroutine
+	go writePump(conn, codec, client)
 
 	// Handle incoming messages
 	for {
@@ -154,32 +145,75 @@ func WebSocketResults(c *gin.Context) {
 			break
 		}
 
+		// Clients may always fall back to JSON text frames
+		decoder := codec
 		if messageType == websocket.TextMessage {
+			decoder = jsonCodec{}
+		}
+		if messageType == websocket.TextMessage || messageType == codec.FrameType() {
 			var msg SubscribeMessage
-			if err := json.Unmarshal(data, &msg); err != nil {
+			if err := decoder.Unmarshal(data, &msg); err != nil {
 				log.Printf("Failed to unmarshal message: %v", err)
 				continue
 			}
 
-			switch msg.Type {
-			case "subscribe":
-				client.QuizID = &msg.QuizID
+			handleClientMessage(client, msg)
+		}
+	}
+}
 
-				// Send current results immediately
-				results, err := getCurrentQuizResults(msg.QuizID)
-				if err == nil {
-					sendMessage(conn, "result_update", results)
-				}
+// handleClientMessage applies a subscribe/unsubscribe/heartbeat message to a client
+func handleClientMessage(client *Client, msg SubscribeMessage) {
+	switch msg.Type {
+	case "subscribe":
+		client.Subscribe(msg.QuizID)
+
+		// Send current results immediately
+		results, err := getCurrentQuizResults(msg.QuizID)
+		if err == nil {
+			client.Reply("result_update", results)
+		}
+
+	case "unsubscribe":
+		client.Unsubscribe()
+
+	case "heartbeat":
+		client.Touch()
+		client.Reply("heartbeat_ack", map[string]interface{}{
+			"timestamp": time.Now(),
+		})
+	}
+}
 
-			case "unsubscribe":
-				client.QuizID = nil
+// writePump delivers queued events and periodic pings to a WebSocket connection
+func writePump(conn *websocket.Conn, codec MessageCodec, client *Client) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 
-			case "heartbeat":
-				client.LastHeartbeat = time.Now()
-				sendMessage(conn, "heartbeat_ack", map[string]interface{}{
-					"timestamp": time.Now(),
-				})
+	for {
+		select {
+		case ev := <-client.send:
+			if err := sendMessage(conn, codec, ev.Type, ev.Data); err != nil {
+				client.Close()
+				_ = conn.Close()
+				return
+			}
+			if ev.closesConnection() {
+				closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ev.Type)
+				_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+				client.Close()
+				_ = conn.Close()
+				return
 			}
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				client.Close()
+				return
+			}
+		case <-client.Done():
+			// Unblock the read loop when the hub drops the client
+			_ = conn.Close()
+			return
 		}
 	}
 }
@@ -192,28 +226,32 @@ func BroadcastResultUpdate(quizID int64) {
 		return
 	}
 
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
+	hub.Publish("result_update", &quizID, results)
+}
 
-	for conn, client := range connections {
-		if client.QuizID != nil && *client.QuizID == quizID {
-			go func(c *websocket.Conn) {
-				sendMessage(c, "result_update", results)
-			}(conn)
-		}
+// BroadcastTeamRanking broadcasts the team ranking of the current session.
+// Nothing is sent for sessions without teams.
+func BroadcastTeamRanking() {
+	db := database.GetDB()
+	if db == nil {
+		return
 	}
+
+	ranking, err := getTeamRankingData(db, currentSessionID(), teamScoring())
+	if err != nil {
+		log.Printf("Failed to get team ranking for broadcast: %v", err)
+		return
+	}
+	if len(ranking.Ranking) == 0 {
+		return
+	}
+
+	hub.Publish("team_ranking", nil, ranking)
 }
 
 // BroadcastSessionUpdate broadcasts session status updates to all clients
 func BroadcastSessionUpdate(sessionData interface{}) {
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-
-	for conn := range connections {
-		go func(c *websocket.Conn) {
-			sendMessage(c, "session_update", sessionData)
-		}(conn)
-	}
+	hub.Publish("session_update", nil, sessionData)
 }
 
 // BroadcastQuestionSwitch broadcasts question switch notifications
@@ -225,16 +263,7 @@ func BroadcastQuestionSwitch(quizID int64, questionNumber, totalQuestions int) {
 		SwitchedAt:     time.Now(),
 	}
 
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-
-	for conn, client := range connections {
-		if client.QuizID != nil && *client.QuizID == quizID {
-			go func(c *websocket.Conn) {
-				sendMessage(c, "question_switch", notification)
-			}(conn)
-		}
-	}
+	hub.Publish("question_switch", &quizID, notification)
 
 	log.Printf("Broadcasted question switch for quiz %d to %d subscribers", quizID, GetSubscriptionCount(quizID))
 }
@@ -247,62 +276,128 @@ func BroadcastVotingEnd(quizID, questionID int64) {
 		EndedAt:    time.Now(),
 	}
 
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-
-	for conn, client := range connections {
-		if client.QuizID != nil && *client.QuizID == quizID {
-			go func(c *websocket.Conn) {
-				sendMessage(c, "voting_end", notification)
-			}(conn)
-		}
-	}
+	hub.Publish("voting_end", &quizID, notification)
 
 	log.Printf("Broadcasted voting end for quiz %d, question %d to %d subscribers", quizID, questionID, GetSubscriptionCount(quizID))
 }
 
-// BroadcastAnswerStatus broadcasts current answer status
-func BroadcastAnswerStatus(quizID, questionID int64, totalParticipants, answeredCount int, answerCounts map[string]int) {
+// BroadcastAnswerStatus broadcasts current answer status. The answer rate is based on the
+// connected participants rather than everyone who registered.
+func BroadcastAnswerStatus(quizID, questionID int64, totalParticipants, connectedParticipants, answeredCount int, answerCounts map[string]int) {
 	status := AnswerStatusUpdate{
-		QuizID:            quizID,
-		QuestionID:        questionID,
-		TotalParticipants: totalParticipants,
-		AnsweredCount:     answeredCount,
-		AnswerCounts:      answerCounts,
-		UpdatedAt:         time.Now(),
+		QuizID:                quizID,
+		QuestionID:            questionID,
+		TotalParticipants:     totalParticipants,
+		ConnectedParticipants: connectedParticipants,
+		AnsweredCount:         answeredCount,
+		AnswerRate:            answerRate(answeredCount, connectedParticipants),
+		AnswerCounts:          answerCounts,
+		UpdatedAt:             time.Now(),
 	}
 
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
+	hub.Publish("answer_status", &quizID, status)
+}
 
-	for conn, client := range connections {
-		if client.QuizID != nil && *client.QuizID == quizID {
-			go func(c *websocket.Conn) {
-				sendMessage(c, "answer_status", status)
-			}(conn)
-		}
+// BroadcastParticipantUpdate broadcasts an admin moderation action so displays can update the nickname
+func BroadcastParticipantUpdate(participant models.Participant, action string) {
+	notification := ParticipantUpdateNotification{
+		ParticipantID: participant.ID,
+		Nickname:      displayNickname(participant.Nickname, participant.IsHidden),
+		Action:        action,
+		UpdatedAt:     time.Now(),
+	}
+
+	hub.Publish("participant_update", nil, notification)
+	BroadcastLobbyRoster()
+}
+
+// lobbyRosterScheduled is set while a lobby roster broadcast is waiting to be sent
+var lobbyRosterScheduled atomic.Bool
+
+// BroadcastLobbyRoster broadcasts the roster of the current session while it is in the lobby.
+// Changes within lobbyRosterDelay are sent as a single lobby_roster message.
+func BroadcastLobbyRoster() {
+	if !lobbyRosterScheduled.CompareAndSwap(false, true) {
+		return
+	}
+	time.AfterFunc(lobbyRosterDelay, func() {
+		lobbyRosterScheduled.Store(false)
+		publishLobbyRoster()
+	})
+}
+
+// publishLobbyRoster publishes the current session's roster if the session is in the lobby
+func publishLobbyRoster() {
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+
+	roster, err := getLobbyRoster(db, currentSessionID(), false)
+	if err != nil {
+		log.Printf("Failed to get lobby roster for broadcast: %v", err)
+		return
+	}
+	if roster.Status != SessionStatusLobby {
+		return
+	}
+
+	hub.Publish("lobby_roster", nil, roster)
+}
+
+// BroadcastModerationNotice sends a moderation_notice to the targeted participant connections
+// on every replica and then closes them
+func BroadcastModerationNotice(target EventTarget, action, reason string) {
+	target.Disconnect = true
+	notice := ModerationNotice{
+		Action:   action,
+		Reason:   reason,
+		IssuedAt: time.Now(),
 	}
+
+	hub.PublishTo("moderation_notice", target, notice)
 }
 
-// sendMessage sends a message to a WebSocket connection
-func sendMessage(conn *websocket.Conn, messageType string, data interface{}) {
-	message := WebSocketMessage{
+// BroadcastEliminationNotice sends an elimination notice to the connections of one participant.
+// The connections stay open so that the participant can keep watching.
+func BroadcastEliminationNotice(participantID int64, notice EliminationNotice) {
+	hub.PublishTo("elimination_notice", EventTarget{ParticipantID: participantID}, notice)
+}
+
+// BroadcastSurvivorUpdate broadcasts the survivors of an elimination game after a question is judged
+func BroadcastSurvivorUpdate(status *models.SurvivorStatus) {
+	hub.Publish("survivor_update", nil, status)
+}
+
+// sendMessage encodes a message with the connection's codec and sends it
+func sendMessage(conn *websocket.Conn, codec MessageCodec, messageType string, data interface{}) error {
+	payload, err := codec.Marshal(WebSocketMessage{
 		Type: messageType,
 		Data: data,
+	})
+	if err != nil {
+		// Drop the message but keep the connection
+		log.Printf("Failed to encode %s message: %v", messageType, err)
+		return nil
 	}
 
-	if err := conn.WriteJSON(message); err != nil {
+	if err := conn.WriteMessage(codec.FrameType(), payload); err != nil {
 		log.Printf("Failed to send WebSocket message: %v", err)
+		return err
 	}
+	return nil
 }
 
 // getCurrentQuizResults gets current results for a quiz
 func getCurrentQuizResults(quizID int64) (*models.QuizResultsResponse, error) {
 	db := database.GetDB()
+	if db == nil {
+		return nil, errDatabaseNotInitialized
+	}
 	return getQuizResultsData(db, quizID, nil)
 }
 
-// CleanupConnections removes stale WebSocket connections
+// CleanupConnections removes stale WebSocket and SSE connections
 func CleanupConnections() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
@@ -311,39 +406,25 @@ func CleanupConnections() {
 	for {
 		select {
 		case <-ticker.C:
-			connectionsMutex.Lock()
 			cutoff := time.Now().Add(-2 * time.Minute)
 
-			for conn, client := range connections {
-				if client.LastHeartbeat.Before(cutoff) {
-					_ = conn.Close()
-					delete(connections, conn)
+			for _, client := range hub.Clients() {
+				if client.LastHeartbeat().Before(cutoff) {
+					hub.Unregister(client)
 				}
 			}
-			connectionsMutex.Unlock()
 		}
 	}
 }
 
-// GetConnectionCount returns the current number of active WebSocket connections
+// GetConnectionCount returns the current number of active WebSocket and SSE connections
 func GetConnectionCount() int {
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-	return len(connections)
+	return hub.ClientCount()
 }
 
 // GetSubscriptionCount returns the number of connections subscribed to a specific quiz
 func GetSubscriptionCount(quizID int64) int {
-	connectionsMutex.RLock()
-	defer connectionsMutex.RUnlock()
-
-	count := 0
-	for _, client := range connections {
-		if client.QuizID != nil && *client.QuizID == quizID {
-			count++
-		}
-	}
-	return count
+	return hub.SubscriptionCount(quizID)
 }
 
 // init initializes the WebSocket cleanup goroutine
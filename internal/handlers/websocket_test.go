@@ -342,7 +342,7 @@ func TestBroadcastFunctions(t *testing.T) {
 					"C": 2,
 					"D": 1,
 				}
-				BroadcastAnswerStatus(1, 1, 11, 11, answerCounts)
+				BroadcastAnswerStatus(1, 1, 15, 11, 11, answerCounts)
 			},
 		},
 	}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+// APIKeyHeader is the header that carries an API key. Keys are also accepted as bearer tokens.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyFromRequest returns the API key of a request, or "" if it carries an access token
+func apiKeyFromRequest(c *gin.Context, jwtService *services.JWTService) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if token := jwtService.ExtractTokenFromHeader(c.GetHeader("Authorization")); services.IsAPIKey(token) {
+		return token
+	}
+	return ""
+}
+
+// authenticateAPIKey authenticates a request with an API key. The request acts for the
+// administrator who created the key, and RequirePermission also checks the key's permissions.
+func authenticateAPIKey(c *gin.Context, key string) {
+	apiKey, admin, err := services.NewAPIKeyService().Authenticate(key, c.ClientIP())
+	if err != nil {
+		status, errorCode, errorMessage := http.StatusUnauthorized, "", ""
+		switch {
+		case errors.Is(err, services.ErrInvalidAPIKey), errors.Is(err, services.ErrAdminNotFound):
+			errorCode = "INVALID_API_KEY"
+			errorMessage = "Invalid API key"
+		case errors.Is(err, services.ErrAPIKeyExpired):
+			errorCode = "API_KEY_EXPIRED"
+			errorMessage = "API key has expired"
+		case errors.Is(err, services.ErrAdminDisabled):
+			status = http.StatusForbidden
+			errorCode = "ADMIN_DISABLED"
+			errorMessage = "The administrator of this API key has been disabled"
+		default:
+			log.Printf("Failed to authenticate API key: %v", err)
+			status = http.StatusServiceUnavailable
+			errorCode = "API_KEY_CHECK_FAILED"
+			errorMessage = "Could not verify the API key; please try again"
+		}
+
+		c.JSON(status, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    errorCode,
+				"message": errorMessage,
+			},
+		})
+		c.Abort()
+		return
+	}
+
+	// Set the key's administrator in context; there are no token claims
+	c.Set("admin_id", admin.ID)
+	c.Set("username", admin.Username)
+	c.Set("admin_role", admin.Role)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("api_key_permissions", apiKey.Permissions)
+	c.Next()
+}
+
+// RequireInteractiveLogin middleware refuses requests authenticated with an API key. It
+// guards the administrator's own account (password, two-factor authentication, logout),
+// which only a signed-in administrator may change.
+func RequireInteractiveLogin() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "API_KEY_NOT_ALLOWED",
+					"message": "This action requires signing in; API keys cannot be used",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
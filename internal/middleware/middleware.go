@@ -2,6 +2,9 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -14,14 +17,14 @@ import (
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 
+	"github.com/Tattsum/quiz/internal/models"
 	"github.com/Tattsum/quiz/internal/services"
 )
 
 var (
-	tokenBlacklist = make(map[string]bool)
-	blacklistMutex sync.RWMutex
-	rateLimiters   = make(map[string]*rate.Limiter)
-	limiterMutex   sync.Mutex
+	revocationStore services.RevocationStore = services.NewMemoryRevocationStore()
+	rateLimiters                             = make(map[string]*rate.Limiter)
+	limiterMutex    sync.Mutex
 )
 
 // CORS middleware using gin-contrib/cors
@@ -39,7 +42,8 @@ func CORS() gin.HandlerFunc {
 	}
 
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Last-Event-ID", RequestIDHeader}
+	config.ExposeHeaders = []string{RequestIDHeader, "Content-Disposition"}
 	config.AllowCredentials = true
 	config.MaxAge = 12 * time.Hour
 
@@ -49,7 +53,7 @@ func CORS() gin.HandlerFunc {
 // Logger middleware
 func Logger() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
+		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\" %s\n",
 			param.ClientIP,
 			param.TimeStamp.Format(time.RFC1123),
 			param.Method,
@@ -59,10 +63,54 @@ func Logger() gin.HandlerFunc {
 			param.Latency,
 			param.Request.UserAgent(),
 			param.ErrorMessage,
+			param.Keys["request_id"],
 		)
 	})
 }
 
+// RequestIDHeader carries the ID of a request. The ID is logged, recorded in the audit log
+// and returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits request IDs given by clients or proxies
+const maxRequestIDLength = 64
+
+// RequestID middleware sets the ID of each request in context as "request_id". A valid ID
+// from the client or a proxy is kept so that a request can be traced across services;
+// otherwise a random ID is generated.
+func RequestID() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	})
+}
+
+// validRequestID reports whether id is a non-empty request ID of letters, digits, '-', '_' and '.'
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // crypto/rand.Read never fails on supported platforms
+	return hex.EncodeToString(b)
+}
+
 // RateLimit middleware using token bucket algorithm
 func RateLimit() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -75,8 +123,8 @@ func RateLimit() gin.HandlerFunc {
 		case strings.HasPrefix(c.Request.URL.Path, "/api/admin"):
 			// Admin endpoints: 500 requests per minute (increased for performance testing)
 			limiter = getLimiter(clientIP+":admin", rate.Every(time.Minute/500), 500)
-		case strings.HasPrefix(c.Request.URL.Path, "/api/auth"):
-			// Auth endpoints: 20 requests per minute (increased for performance testing)
+		case strings.HasPrefix(c.Request.URL.Path, "/api/auth"), c.Request.URL.Path == "/api/participants/rejoin":
+			// Auth and participant recovery endpoints: 20 requests per minute (increased for performance testing)
 			limiter = getLimiter(clientIP+":auth", rate.Every(time.Minute/20), 20)
 		case strings.HasPrefix(c.Request.URL.Path, "/api/answers"):
 			// Answer endpoints: 300 requests per minute (increased for performance testing)
@@ -130,9 +178,15 @@ func getLimiter(key string, r rate.Limit, b int) *rate.Limiter {
 	return limiter
 }
 
-// JWTAuth middleware for admin authentication
+// JWTAuth middleware for admin authentication. API keys are accepted in place of an
+// access token, in the X-API-Key header or as a bearer token.
 func JWTAuth(jwtService *services.JWTService) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
+		if key := apiKeyFromRequest(c, jwtService); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -159,10 +213,47 @@ func JWTAuth(jwtService *services.JWTService) gin.HandlerFunc {
 			return
 		}
 
-		// Check if token is blacklisted
-		blacklistMutex.RLock()
-		if tokenBlacklist[tokenString] {
-			blacklistMutex.RUnlock()
+		// Validate token using JWT service
+		claims, err := jwtService.ValidateAccessToken(tokenString)
+		if err != nil {
+			var errorCode, errorMessage string
+			switch {
+			case errors.Is(err, services.ErrExpiredToken):
+				errorCode = "TOKEN_EXPIRED"
+				errorMessage = "Token has expired"
+			case errors.Is(err, services.ErrInvalidTokenType):
+				errorCode = "INVALID_TOKEN_TYPE"
+				errorMessage = "Invalid token type"
+			default:
+				errorCode = "INVALID_TOKEN"
+				errorMessage = "Invalid token"
+			}
+
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    errorCode,
+					"message": errorMessage,
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		// Check if token has been revoked (by logout)
+		revoked, err := IsTokenRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "REVOCATION_CHECK_FAILED",
+					"message": "Could not verify the token; please try again",
+				},
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"error": gin.H{
@@ -173,10 +264,48 @@ func JWTAuth(jwtService *services.JWTService) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		blacklistMutex.RUnlock()
 
-		// Validate token using JWT service
-		claims, err := jwtService.ValidateAccessToken(tokenString)
+		// Set user information in context
+		c.Set("admin_id", claims.AdminID)
+		c.Set("username", claims.Username)
+		c.Set("admin_role", claims.Role)
+		c.Set("token", tokenString)
+		c.Set("token_claims", claims)
+		c.Next()
+	})
+}
+
+// ParticipantAuth middleware for participant authentication.
+// The authenticated participant ID is stored in the context as "participant_id".
+func ParticipantAuth(tokenService *services.ParticipantTokenService) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "MISSING_TOKEN",
+					"message": "Authorization header is required",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if tokenString == authHeader || tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_TOKEN_FORMAT",
+					"message": "Invalid authorization header format",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		claims, err := tokenService.ValidateToken(tokenString)
 		if err != nil {
 			var errorCode, errorMessage string
 			switch {
@@ -202,26 +331,47 @@ func JWTAuth(jwtService *services.JWTService) gin.HandlerFunc {
 			return
 		}
 
-		// Set user information in context
-		c.Set("admin_id", claims.AdminID)
-		c.Set("username", claims.Username)
-		c.Set("token", tokenString)
+		// Set participant information in context
+		c.Set("participant_id", claims.ParticipantID)
+		c.Set("nickname", claims.Nickname)
 		c.Next()
 	})
 }
 
-// LogoutUser adds a token to the blacklist (logout functionality)
-func LogoutUser(c *gin.Context) {
-	if token, exists := c.Get("token"); exists {
-		if tokenString, ok := token.(string); ok {
-			BlacklistToken(tokenString)
-		}
+// UseRevocationStore replaces the store of revoked admin tokens. The default in-memory
+// store is lost on restart and not shared between replicas. It must be called before the
+// server starts handling requests.
+func UseRevocationStore(store services.RevocationStore) {
+	revocationStore = store
+}
+
+// TokenRevocationStore returns the store of revoked admin tokens
+func TokenRevocationStore() services.RevocationStore {
+	return revocationStore
+}
+
+// LogoutUser revokes the access token of the current request (logout functionality)
+func LogoutUser(c *gin.Context) error {
+	claims, ok := c.Get("token_claims")
+	if !ok {
+		return services.ErrInvalidToken
+	}
+	return RevokeToken(c.Request.Context(), claims.(*models.JWTClaims))
+}
+
+// RevokeToken revokes a token by its ID until it expires. Tokens issued without an ID
+// cannot be revoked and simply expire.
+func RevokeToken(ctx context.Context, claims *models.JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
 	}
+	return revocationStore.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
 }
 
-// BlacklistToken adds a token to the blacklist
-func BlacklistToken(tokenString string) {
-	blacklistMutex.Lock()
-	defer blacklistMutex.Unlock()
-	tokenBlacklist[tokenString] = true
+// IsTokenRevoked reports whether a token has been revoked
+func IsTokenRevoked(ctx context.Context, claims *models.JWTClaims) (bool, error) {
+	if claims.ID == "" {
+		return false, nil
+	}
+	return revocationStore.IsRevoked(ctx, claims.ID)
 }
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/Tattsum/quiz/internal/services"
+)
+
+func TestJWTAuth_RevokedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	UseRevocationStore(services.NewMemoryRevocationStore())
+
+	jwtService := services.NewJWTService()
+	admin := &models.Administrator{ID: 1, Username: "admin", Role: models.AdminRoleOwner}
+	first, _, err := jwtService.GenerateTokenPairWithIDs(admin)
+	if err != nil {
+		t.Fatalf("GenerateTokenPairWithIDs() failed: %v", err)
+	}
+	second, _, err := jwtService.GenerateTokenPairWithIDs(admin)
+	if err != nil {
+		t.Fatalf("GenerateTokenPairWithIDs() failed: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(JWTAuth(jwtService))
+	router.GET("/verify", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/logout", func(c *gin.Context) {
+		if err := LogoutUser(c); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("GET", "/verify", first.AccessToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 before logout, got %d", w.Code)
+	}
+	if w := request("POST", "/logout", first.AccessToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d", w.Code)
+	}
+
+	w := request("GET", "/verify", first.AccessToken)
+	var response struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusUnauthorized || response.Error.Code != "TOKEN_REVOKED" {
+		t.Errorf("Expected a logged out token to be revoked, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Only the logged out token is revoked, not other sessions of the same administrator
+	if w := request("GET", "/verify", second.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("Expected another token to stay valid, got %d", w.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("request_id"))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"generated", "", false},
+		{"from client", "trace-123_abc.1", true},
+		{"invalid characters", "abc\r\nX-Injected: 1", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" || id != w.Body.String() {
+				t.Fatalf("Expected the request ID in the header and context, got %q and %q", id, w.Body.String())
+			}
+			if (id == tt.header) != tt.keep {
+				t.Errorf("Request ID = %q for header %q, keep = %v", id, tt.header, tt.keep)
+			}
+		})
+	}
+}
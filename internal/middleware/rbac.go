@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+// Permission is an action on the admin API that is granted to some administrator roles
+type Permission string
+
+// Admin API permissions
+const (
+	PermissionRead                 Permission = "read"                  // quizzes, results, rankings, participants and monitoring
+	PermissionEditQuizzes          Permission = "edit_quizzes"          // create, update and delete quizzes and upload images
+	PermissionRunSession           Permission = "run_session"           // open the lobby, ask questions and end sessions
+	PermissionModerateParticipants Permission = "moderate_participants" // approve, rename, kick, ban and assign teams
+	PermissionManageAdmins         Permission = "manage_admins"         // create, invite, update, disable and delete administrators
+)
+
+// rolePermissions lists the permissions of each administrator role
+var rolePermissions = map[string][]Permission{
+	models.AdminRoleOwner:  {PermissionRead, PermissionEditQuizzes, PermissionRunSession, PermissionModerateParticipants, PermissionManageAdmins},
+	models.AdminRoleAuthor: {PermissionRead, PermissionEditQuizzes},
+	models.AdminRoleHost:   {PermissionRead, PermissionRunSession, PermissionModerateParticipants},
+	models.AdminRoleViewer: {PermissionRead},
+}
+
+// RoleHasPermission reports whether an administrator role grants a permission.
+// Unknown roles, including tokens issued before roles existed, have no permissions.
+func RoleHasPermission(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// RequirePermission middleware allows the request only if the administrator's role grants
+// the permission and, for API keys, the key does too. It must run after JWTAuth, which sets
+// the role and the key's permissions in the context.
+func RequirePermission(permission Permission) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		role := c.GetString("admin_role")
+		if keyPermissions := c.GetStringSlice("api_key_permissions"); c.GetInt64("api_key_id") != 0 &&
+			!slices.Contains(keyPermissions, string(permission)) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INSUFFICIENT_PERMISSION",
+					"message": "The API key does not allow this action",
+					"details": gin.H{
+						"permission": permission,
+					},
+				},
+			})
+			c.Abort()
+			return
+		}
+		if !RoleHasPermission(role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INSUFFICIENT_PERMISSION",
+					"message": "Your role does not allow this action",
+					"details": gin.H{
+						"role":       role,
+						"permission": permission,
+					},
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
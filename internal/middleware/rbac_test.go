@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+func TestRoleHasPermission(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission Permission
+		expected   bool
+	}{
+		{models.AdminRoleOwner, PermissionManageAdmins, true},
+		{models.AdminRoleOwner, PermissionEditQuizzes, true},
+		{models.AdminRoleAuthor, PermissionEditQuizzes, true},
+		{models.AdminRoleAuthor, PermissionRunSession, false},
+		{models.AdminRoleHost, PermissionRunSession, true},
+		{models.AdminRoleHost, PermissionModerateParticipants, true},
+		{models.AdminRoleHost, PermissionEditQuizzes, false},
+		{models.AdminRoleViewer, PermissionRead, true},
+		{models.AdminRoleViewer, PermissionModerateParticipants, false},
+		{models.AdminRoleViewer, PermissionManageAdmins, false},
+		{"", PermissionRead, false},
+		{"superuser", PermissionRead, false},
+	}
+
+	for _, tt := range tests {
+		if got := RoleHasPermission(tt.role, tt.permission); got != tt.expected {
+			t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.expected)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		role           string
+		keyPermissions []string // nil for an access token
+		expected       int
+	}{
+		{"Allowed role", models.AdminRoleAuthor, nil, http.StatusOK},
+		{"Denied role", models.AdminRoleViewer, nil, http.StatusForbidden},
+		{"Token without role", "", nil, http.StatusForbidden},
+		{"API key with the permission", models.AdminRoleOwner, []string{"read", "edit_quizzes"}, http.StatusOK},
+		{"API key without the permission", models.AdminRoleOwner, []string{"read", "run_session"}, http.StatusForbidden},
+		{"API key beyond the role", models.AdminRoleViewer, []string{"edit_quizzes"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/quizzes", func(c *gin.Context) {
+				c.Set("admin_role", tt.role)
+				if tt.keyPermissions != nil {
+					c.Set("api_key_id", int64(1))
+					c.Set("api_key_permissions", tt.keyPermissions)
+				}
+			}, RequirePermission(PermissionEditQuizzes), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/quizzes", nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireInteractiveLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, apiKey := range []bool{false, true} {
+		router := gin.New()
+		router.POST("/me/password", func(c *gin.Context) {
+			if apiKey {
+				c.Set("api_key_id", int64(1))
+			}
+		}, RequireInteractiveLogin(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/me/password", nil)
+		router.ServeHTTP(w, req)
+
+		expected := http.StatusOK
+		if apiKey {
+			expected = http.StatusForbidden
+		}
+		if w.Code != expected {
+			t.Errorf("With API key %v: expected status %d, got %d", apiKey, expected, w.Code)
+		}
+	}
+}
@@ -2,26 +2,59 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Administrator roles
+const (
+	AdminRoleOwner  = "owner"  // every permission, including managing administrators
+	AdminRoleAuthor = "author" // writes and edits quizzes
+	AdminRoleHost   = "host"   // runs sessions and moderates participants
+	AdminRoleViewer = "viewer" // read-only
+)
+
 // Administrator represents the administrators table
 type Administrator struct {
-	ID           int64     `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	Email        string    `json:"email" db:"email"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID               int64      `json:"id" db:"id"`
+	Username         string     `json:"username" db:"username"`
+	PasswordHash     string     `json:"-" db:"password_hash"`
+	Email            string     `json:"email" db:"email"`
+	Role             string     `json:"role" db:"role"`
+	DisabledAt       *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	InvitedBy        *int64     `json:"invited_by,omitempty" db:"invited_by"`
+	InviteExpiresAt  *time.Time `json:"invite_expires_at,omitempty" db:"invite_expires_at"` // set until the invitation is accepted
+	TwoFactorEnabled bool       `json:"two_factor_enabled" db:"-"`                          // totp_enabled_at IS NOT NULL
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // Participant represents the participants table
 type Participant struct {
-	ID        int64     `json:"id" db:"id"`
-	Nickname  string    `json:"nickname" db:"nickname"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int64      `json:"id" db:"id"`
+	Nickname  string     `json:"nickname" db:"nickname"`
+	SessionID *int64     `json:"session_id,omitempty" db:"session_id"`
+	IsHidden  bool       `json:"is_hidden" db:"is_hidden"`
+	KickedAt  *time.Time `json:"kicked_at,omitempty" db:"kicked_at"`
+	// AnswersExcluded leaves the participant's answers out of results and rankings
+	AnswersExcluded bool   `json:"answers_excluded" db:"answers_excluded"`
+	TeamID          *int64 `json:"team_id,omitempty" db:"team_id"`
+	// ApprovalStatus is pending until an admin approves the participant in sessions that require approval
+	ApprovalStatus string `json:"approval_status" db:"approval_status"`
+	// EliminatedAt is set when the participant is knocked out of an elimination game
+	EliminatedAt *time.Time `json:"eliminated_at,omitempty" db:"eliminated_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Team represents the teams table
+type Team struct {
+	ID          int64     `json:"id" db:"id"`
+	SessionID   *int64    `json:"session_id,omitempty" db:"session_id"`
+	Name        string    `json:"name" db:"name"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
 
 // Quiz represents the quizzes table
@@ -51,30 +84,59 @@ type QuizPublic struct {
 	VideoURL     *string `json:"video_url"`
 }
 
-// Answer represents the answers table
+// Answer represents the answers table.
+// A skipped question has an empty SelectedOption and the skip lifeline.
 type Answer struct {
 	ID             int64     `json:"id" db:"id"`
 	ParticipantID  int64     `json:"participant_id" db:"participant_id"`
 	QuizID         int64     `json:"quiz_id" db:"quiz_id"`
 	SelectedOption string    `json:"selected_option" db:"selected_option"`
 	IsCorrect      bool      `json:"is_correct" db:"is_correct"`
+	Lifeline       *string   `json:"lifeline,omitempty" db:"lifeline"`
 	AnsweredAt     time.Time `json:"answered_at" db:"answered_at"`
 }
 
+// LifelineCounts holds a number per lifeline: the limits of a session, or how many times
+// lifelines were used
+type LifelineCounts struct {
+	FiftyFifty int `json:"fifty_fifty"`
+	Skip       int `json:"skip"`
+	Double     int `json:"double"`
+}
+
+// LifelineUse represents the lifeline_uses table
+type LifelineUse struct {
+	ID            int64 `json:"id" db:"id"`
+	ParticipantID int64 `json:"participant_id" db:"participant_id"`
+	// QuizID is nil while a double waits for the next question
+	QuizID   *int64 `json:"quiz_id" db:"quiz_id"`
+	Lifeline string `json:"lifeline" db:"lifeline"`
+	// HiddenOptions are the wrong options hidden by the 50/50 lifeline
+	HiddenOptions []string  `json:"hidden_options,omitempty" db:"hidden_options"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
 // QuizSession represents the quiz_sessions table
 type QuizSession struct {
-	ID                 int64     `json:"id" db:"id"`
-	CurrentQuizID      *int64    `json:"current_quiz_id" db:"current_quiz_id"`
-	IsAcceptingAnswers bool      `json:"is_accepting_answers" db:"is_accepting_answers"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+	ID                 int64  `json:"id" db:"id"`
+	CurrentQuizID      *int64 `json:"current_quiz_id" db:"current_quiz_id"`
+	IsAcceptingAnswers bool   `json:"is_accepting_answers" db:"is_accepting_answers"`
+	Status             string `json:"status" db:"status"`
+	MaxParticipants    *int   `json:"max_participants" db:"max_participants"`
+	RequireApproval    bool   `json:"require_approval" db:"require_approval"`
+	GameMode           string `json:"game_mode" db:"game_mode"`
+	QuestionLimit      *int   `json:"question_limit" db:"question_limit"`
+	// Lifelines limits how many times each participant may use each lifeline; 0 disables it
+	Lifelines LifelineCounts `json:"lifelines"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
 }
 
 // Request/Response DTOs
 
 // LoginRequest represents admin login request
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
+	Username string `json:"username" binding:"required,max=100"`
 	Password string `json:"password" binding:"required"`
 }
 
@@ -86,6 +148,90 @@ type LoginResponse struct {
 	Admin        Administrator `json:"admin"`
 }
 
+// TwoFactorChallengeResponse is returned by login instead of tokens when the administrator
+// must enter a one-time code (or first set up two-factor authentication)
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired      bool      `json:"two_factor_required"`
+	TwoFactorSetupRequired bool      `json:"two_factor_setup_required"`
+	ChallengeToken         string    `json:"challenge_token"`
+	ExpiresAt              time.Time `json:"expires_at"`
+}
+
+// TwoFactorLoginRequest completes a login with a one-time or recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required,max=32"`
+}
+
+// TwoFactorChallengeRequest starts two-factor setup during login
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// TwoFactorLoginResponse is the login response after the second step. Recovery codes are
+// only included when two-factor authentication was set up during the login.
+type TwoFactorLoginResponse struct {
+	LoginResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorStatus is the two-factor authentication state of an administrator
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	Required               bool       `json:"required"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorEnrollment is a pending TOTP secret to register in an authenticator app
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, shown as a QR code
+}
+
+// TwoFactorCodeRequest carries a one-time code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+// DisableTwoFactorRequest disables two-factor authentication of the own account
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+// RecoveryCodesResponse holds newly generated recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SecuritySettings are the security policies set by owners
+type SecuritySettings struct {
+	RequireTwoFactor bool       `json:"require_two_factor"`
+	UpdatedBy        *int64     `json:"updated_by,omitempty"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty"`
+}
+
+// UpdateSecuritySettingsRequest updates the security policies
+type UpdateSecuritySettingsRequest struct {
+	RequireTwoFactor *bool `json:"require_two_factor" binding:"required"`
+}
+
+// OIDCAuthorizationResponse starts a login through the OpenID Connect provider
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	BrowserSecret    string    `json:"browser_secret"` // kept by the browser and posted with the callback
+	ExpiresAt        time.Time `json:"expires_at"`     // the login must be completed before this time
+}
+
+// OIDCCallbackRequest completes a login with the code and state the provider redirected back with
+// and the browser secret returned when the login was started
+type OIDCCallbackRequest struct {
+	Code          string `json:"code" binding:"required"`
+	State         string `json:"state" binding:"required"`
+	BrowserSecret string `json:"browser_secret" binding:"required"`
+}
+
 // RefreshTokenRequest represents refresh token request
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
@@ -102,7 +248,108 @@ type RefreshTokenResponse struct {
 type JWTClaims struct {
 	AdminID  int64  `json:"admin_id"`
 	Username string `json:"username"`
-	Type     string `json:"type"` // "access" or "refresh"
+	Role     string `json:"role"`
+	Type     string `json:"type"` // "access", "refresh", "2fa" or "2fa_setup"
+	jwt.RegisteredClaims
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP or EC curve
+	X   string `json:"x,omitempty"`   // OKP public key or EC x coordinate
+	Y   string `json:"y,omitempty"`   // EC y coordinate
+}
+
+// JWKSet is a JSON Web Key Set, served for verifying admin access tokens
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// InviteAdminRequest represents a request to invite an administrator
+type InviteAdminRequest struct {
+	Username string `json:"username" binding:"required,min=1,max=50"`
+	Email    string `json:"email" binding:"required,email,max=100"`
+	Role     string `json:"role" binding:"required,oneof=owner author host viewer"`
+}
+
+// InviteAdminResponse represents a created invitation. The token is shown only once.
+type InviteAdminResponse struct {
+	Admin       Administrator `json:"admin"`
+	InviteToken string        `json:"invite_token"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+}
+
+// AcceptInvitationRequest represents a request to accept an invitation by setting a password
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// AdminRoleRequest represents a request to change an administrator's role
+type AdminRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner author host viewer"`
+}
+
+// CreateAdminRequest represents a request to create an administrator with a password
+type CreateAdminRequest struct {
+	Username string `json:"username" binding:"required,min=1,max=50"`
+	Email    string `json:"email" binding:"required,email,max=100"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Role     string `json:"role" binding:"required,oneof=owner author host viewer"`
+}
+
+// UpdateAdminRequest represents a request to update an administrator. Omitted fields are unchanged.
+type UpdateAdminRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=1,max=50"`
+	Email    *string `json:"email" binding:"omitempty,email,max=100"`
+	Password *string `json:"password" binding:"omitempty,min=8,max=72"`
+}
+
+// ChangePasswordRequest represents a request to change one's own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// APIKey represents the api_keys table. The key itself is stored only as a hash.
+type APIKey struct {
+	ID          int64      `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Prefix      string     `json:"prefix" db:"key_prefix"`       // start of the key, to recognize it
+	Permissions []string   `json:"permissions" db:"permissions"` // admin API permissions granted to the key
+	CreatedBy   int64      `json:"created_by" db:"created_by"`   // the key acts for this administrator
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	LastUsedIP  *string    `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateAPIKeyRequest represents a request to create an API key. Administrator management
+// cannot be granted to keys.
+type CreateAPIKeyRequest struct {
+	Name        string     `json:"name" binding:"required,min=1,max=100"`
+	Permissions []string   `json:"permissions" binding:"required,min=1,dive,oneof=read edit_quizzes run_session moderate_participants"`
+	ExpiresAt   *time.Time `json:"expires_at"` // defaults to API_KEY_DEFAULT_EXPIRY_DAYS from now
+}
+
+// CreateAPIKeyResponse represents a created API key. The key is shown only once.
+type CreateAPIKeyResponse struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key"`
+}
+
+// ParticipantClaims represents participant token claims
+type ParticipantClaims struct {
+	ParticipantID int64  `json:"participant_id"`
+	Nickname      string `json:"nickname"`
+	Type          string `json:"type"` // "participant"
 	jwt.RegisteredClaims
 }
 
@@ -121,11 +368,127 @@ type QuizRequest struct {
 // ParticipantRequest represents participant registration request
 type ParticipantRequest struct {
 	Nickname string `json:"nickname" binding:"required,max=50"`
+	// TeamID picks a team in team mode; participants without one are assigned to the smallest team
+	TeamID *int64 `json:"team_id"`
+}
+
+// ParticipantRejoinRequest represents a participant rejoining from a reloaded or new device.
+// Either the participant token or the nickname and recovery PIN must be given.
+type ParticipantRejoinRequest struct {
+	Token       string `json:"token"`
+	Nickname    string `json:"nickname" binding:"max=50"`
+	RecoveryPIN string `json:"recovery_pin" binding:"omitempty,numeric,len=6"`
+}
+
+// ParticipantMergeRequest represents an admin request to merge duplicate participants
+type ParticipantMergeRequest struct {
+	TargetID  int64   `json:"target_id" binding:"required"`
+	SourceIDs []int64 `json:"source_ids" binding:"required,min=1,unique,dive,required"`
+}
+
+// ParticipantRenameRequest represents an admin request to rename a participant
+type ParticipantRenameRequest struct {
+	Nickname string `json:"nickname" binding:"required,max=50"`
+}
+
+// ParticipantVisibilityRequest represents an admin request to hide or show a participant's nickname
+type ParticipantVisibilityRequest struct {
+	Hidden *bool `json:"hidden" binding:"required"`
+}
+
+// ParticipantKickRequest represents an admin request to remove a participant from the session.
+// The body is optional.
+type ParticipantKickRequest struct {
+	Reason         string `json:"reason" binding:"max=255"`
+	ExcludeAnswers bool   `json:"exclude_answers"`
+}
+
+// ParticipantBanRequest represents an admin request to ban a participant or an IP address
+// for the rest of the session. At least one of participant_id and ip_address is required.
+type ParticipantBanRequest struct {
+	ParticipantID  *int64 `json:"participant_id"`
+	IPAddress      string `json:"ip_address" binding:"omitempty,ip"`
+	Reason         string `json:"reason" binding:"max=255"`
+	ExcludeAnswers bool   `json:"exclude_answers"`
+}
+
+// ParticipantTeamRequest represents an admin request to move a participant to another team.
+// A null team_id removes the participant from their team.
+type ParticipantTeamRequest struct {
+	TeamID *int64 `json:"team_id"`
+}
+
+// TeamRequest represents team creation/update request
+type TeamRequest struct {
+	Name string `json:"name" binding:"required,max=50"`
+}
+
+// ParticipantBan represents the participant_bans table
+type ParticipantBan struct {
+	ID            int64      `json:"id" db:"id"`
+	SessionID     *int64     `json:"session_id,omitempty" db:"session_id"`
+	ParticipantID *int64     `json:"participant_id,omitempty" db:"participant_id"`
+	IPAddress     *string    `json:"ip_address,omitempty" db:"ip_address"`
+	Reason        string     `json:"reason" db:"reason"`
+	BannedBy      *int64     `json:"banned_by,omitempty" db:"banned_by"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LiftedAt      *time.Time `json:"lifted_at,omitempty" db:"lifted_at"`
+}
+
+// ModerationAuditEntry represents the moderation_audit_log table
+type ModerationAuditEntry struct {
+	ID            int64           `json:"id" db:"id"`
+	SessionID     *int64          `json:"session_id,omitempty" db:"session_id"`
+	AdminID       *int64          `json:"admin_id,omitempty" db:"admin_id"`
+	Action        string          `json:"action" db:"action"`
+	ParticipantID *int64          `json:"participant_id,omitempty" db:"participant_id"`
+	IPAddress     *string         `json:"ip_address,omitempty" db:"ip_address"`
+	Reason        string          `json:"reason" db:"reason"`
+	Details       json.RawMessage `json:"details,omitempty" db:"details"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+// LoginEvent represents the login_events table: one administrator login attempt
+type LoginEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	AdminID   *int64    `json:"admin_id,omitempty" db:"admin_id"` // set when the username belongs to an administrator
+	Username  string    `json:"username" db:"username"`
+	Success   bool      `json:"success" db:"success"`
+	Reason    string    `json:"reason" db:"reason"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuditLog represents the audit_logs table: one administrator action with the target's state
+// before and after it
+type AuditLog struct {
+	ID         int64           `json:"id" db:"id"`
+	AdminID    *int64          `json:"admin_id,omitempty" db:"admin_id"`     // cleared when the administrator is deleted
+	Username   string          `json:"username" db:"username"`               // kept after the administrator is deleted
+	APIKeyID   *int64          `json:"api_key_id,omitempty" db:"api_key_id"` // set when the action was made with an API key
+	Action     string          `json:"action" db:"action"`
+	TargetType string          `json:"target_type" db:"target_type"`
+	TargetID   *int64          `json:"target_id,omitempty" db:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty" db:"before_data"`
+	After      json.RawMessage `json:"after,omitempty" db:"after_data"`
+	RequestID  string          `json:"request_id" db:"request_id"`
+	IPAddress  string          `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// ParticipantMergeResponse represents the result of merging duplicate participants
+type ParticipantMergeResponse struct {
+	TargetID           int64   `json:"target_id"`
+	MergedIDs          []int64 `json:"merged_ids"`
+	MovedAnswers       int64   `json:"moved_answers"`
+	DiscardedAnswers   int64   `json:"discarded_answers"`
+	ConflictResolution string  `json:"conflict_resolution"`
 }
 
 // AnswerRequest represents answer submission request
 type AnswerRequest struct {
-	ParticipantID  int64  `json:"participant_id" binding:"required"`
+	ParticipantID  int64  `json:"participant_id"` // optional; must match the participant token
 	QuizID         int64  `json:"quiz_id" binding:"required"`
 	SelectedOption string `json:"selected_option" binding:"required,oneof=A B C D"`
 }
@@ -135,9 +498,27 @@ type AnswerUpdateRequest struct {
 	SelectedOption string `json:"selected_option" binding:"required,oneof=A B C D"`
 }
 
+// LifelineRequest represents a participant using a lifeline on the current question
+type LifelineRequest struct {
+	QuizID   int64  `json:"quiz_id" binding:"required"`
+	Lifeline string `json:"lifeline" binding:"required,oneof=fifty_fifty skip double"`
+}
+
+// LifelineLimitsRequest sets the lifeline limits of a session. Omitted lifelines keep their
+// limit when updating; 0 disables a lifeline.
+type LifelineLimitsRequest struct {
+	FiftyFifty *int `json:"fifty_fifty" binding:"omitempty,min=0,max=100"`
+	Skip       *int `json:"skip" binding:"omitempty,min=0,max=100"`
+	Double     *int `json:"double" binding:"omitempty,min=0,max=100"`
+}
+
 // SessionStartRequest represents session start request
 type SessionStartRequest struct {
 	QuizID int64 `json:"quiz_id" binding:"required"`
+	// GameMode and QuestionLimit override the settings of a session opened as a lobby
+	GameMode      *string                `json:"game_mode" binding:"omitempty,oneof=standard elimination"`
+	QuestionLimit *int                   `json:"question_limit" binding:"omitempty,min=0"`
+	Lifelines     *LifelineLimitsRequest `json:"lifelines"`
 }
 
 // SessionNextRequest represents next question request
@@ -145,31 +526,105 @@ type SessionNextRequest struct {
 	QuizID int64 `json:"quiz_id" binding:"required"`
 }
 
+// LobbyRequest represents the lobby settings of a session. Omitted fields keep their value
+// when updating; max_participants and question_limit 0 remove the limit.
+type LobbyRequest struct {
+	MaxParticipants *int                   `json:"max_participants" binding:"omitempty,min=0"`
+	RequireApproval *bool                  `json:"require_approval"`
+	GameMode        *string                `json:"game_mode" binding:"omitempty,oneof=standard elimination"`
+	QuestionLimit   *int                   `json:"question_limit" binding:"omitempty,min=0"`
+	Lifelines       *LifelineLimitsRequest `json:"lifelines"`
+}
+
 // ToggleAnswersRequest represents toggle answers request
 type ToggleAnswersRequest struct {
 	IsAcceptingAnswers bool `json:"is_accepting_answers"`
 }
 
-// SessionStatusResponse represents session status response
+// SessionStatusResponse represents session status response.
+// TotalParticipants counts the participants registered in the session and
+// ConnectedParticipants those connected right now; AnswerRate is based on the latter.
 type SessionStatusResponse struct {
-	SessionID          int64       `json:"session_id"`
-	CurrentQuiz        *QuizPublic `json:"current_quiz"`
-	IsAcceptingAnswers bool        `json:"is_accepting_answers"`
-	TotalParticipants  int         `json:"total_participants"`
-	AnswersCount       int         `json:"answers_count"`
+	SessionID             int64          `json:"session_id"`
+	Status                string         `json:"status"`
+	GameMode              string         `json:"game_mode"`
+	CurrentQuiz           *QuizPublic    `json:"current_quiz"`
+	Lifelines             LifelineCounts `json:"lifelines"`
+	IsAcceptingAnswers    bool           `json:"is_accepting_answers"`
+	TotalParticipants     int            `json:"total_participants"`
+	ConnectedParticipants int            `json:"connected_participants"`
+	AnswersCount          int            `json:"answers_count"`
+	AnswerRate            float64        `json:"answer_rate"`
+}
+
+// LobbyParticipant represents a participant on the lobby roster
+type LobbyParticipant struct {
+	ParticipantID int64     `json:"participant_id"`
+	Nickname      string    `json:"nickname"`
+	TeamID        *int64    `json:"team_id,omitempty"`
+	Connected     bool      `json:"connected"`
+	JoinedAt      time.Time `json:"joined_at"`
+}
+
+// LobbyRoster represents the participants who joined a session.
+// Pending participants are only listed for admins.
+type LobbyRoster struct {
+	SessionID       int64              `json:"session_id"`
+	Status          string             `json:"status"`
+	MaxParticipants *int               `json:"max_participants"`
+	RequireApproval bool               `json:"require_approval"`
+	JoinedCount     int                `json:"joined_count"`
+	ConnectedCount  int                `json:"connected_count"`
+	PendingCount    int                `json:"pending_count"`
+	Participants    []LobbyParticipant `json:"participants"`
+	Pending         []LobbyParticipant `json:"pending,omitempty"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+}
+
+// Survivor represents a participant still in an elimination game
+type Survivor struct {
+	ParticipantID int64  `json:"participant_id"`
+	Nickname      string `json:"nickname"`
+	TeamID        *int64 `json:"team_id,omitempty"`
+}
+
+// EliminationRoundSummary represents the outcome of judging one question of an elimination game
+type EliminationRoundSummary struct {
+	QuizID          int64     `json:"quiz_id"`
+	SurvivorsBefore int       `json:"survivors_before"`
+	EliminatedCount int       `json:"eliminated_count"`
+	Voided          bool      `json:"voided"`
+	JudgedAt        time.Time `json:"judged_at"`
+}
+
+// SurvivorStatus represents the state of an elimination game
+type SurvivorStatus struct {
+	SessionID       int64                    `json:"session_id"`
+	GameMode        string                   `json:"game_mode"`
+	RoundsPlayed    int                      `json:"rounds_played"`
+	QuestionLimit   *int                     `json:"question_limit"`
+	SurvivorCount   int                      `json:"survivor_count"`
+	EliminatedCount int                      `json:"eliminated_count"`
+	LastRound       *EliminationRoundSummary `json:"last_round,omitempty"`
+	Survivors       []Survivor               `json:"survivors"`
+	Finished        bool                     `json:"finished"`
+	UpdatedAt       time.Time                `json:"updated_at"`
 }
 
 // QuizResultsResponse represents quiz results response
 type QuizResultsResponse struct {
-	QuizID             int64                   `json:"quiz_id"`
-	QuestionText       string                  `json:"question_text"`
-	TotalAnswers       int                     `json:"total_answers"`
-	Results            map[string]OptionResult `json:"results"`
-	CorrectAnswer      string                  `json:"correct_answer"`
-	CorrectCount       int                     `json:"correct_count"`
-	CorrectPercentage  float64                 `json:"correct_percentage"`
-	IsAcceptingAnswers *bool                   `json:"is_accepting_answers,omitempty"`
-	UpdatedAt          time.Time               `json:"updated_at"`
+	QuizID            int64                   `json:"quiz_id"`
+	QuestionText      string                  `json:"question_text"`
+	TotalAnswers      int                     `json:"total_answers"`
+	Results           map[string]OptionResult `json:"results"`
+	CorrectAnswer     string                  `json:"correct_answer"`
+	CorrectCount      int                     `json:"correct_count"`
+	CorrectPercentage float64                 `json:"correct_percentage"`
+	// SkippedCount counts the participants who skipped the question; they are not in TotalAnswers
+	SkippedCount       int            `json:"skipped_count"`
+	LifelineUsage      LifelineCounts `json:"lifeline_usage"`
+	IsAcceptingAnswers *bool          `json:"is_accepting_answers,omitempty"`
+	UpdatedAt          time.Time      `json:"updated_at"`
 }
 
 // OptionResult represents result for each option
@@ -187,6 +642,7 @@ type RankingEntry struct {
 	CorrectAnswers int     `json:"correct_answers"`
 	AccuracyRate   float64 `json:"accuracy_rate"`
 	TotalScore     int     `json:"total_score"`
+	TeamName       string  `json:"team_name,omitempty"`
 }
 
 // OverallRankingResponse represents overall ranking response
@@ -196,6 +652,26 @@ type OverallRankingResponse struct {
 	UpdatedAt         time.Time      `json:"updated_at"`
 }
 
+// TeamRankingEntry represents a team ranking entry
+type TeamRankingEntry struct {
+	Rank           int     `json:"rank"`
+	TeamID         int64   `json:"team_id"`
+	Name           string  `json:"name"`
+	MemberCount    int     `json:"member_count"`
+	CountedMembers int     `json:"counted_members"`
+	CorrectAnswers int     `json:"correct_answers"`
+	Score          float64 `json:"score"`
+}
+
+// TeamRankingResponse represents team ranking response
+type TeamRankingResponse struct {
+	SessionID   int64              `json:"session_id"`
+	Aggregation string             `json:"aggregation"`
+	BestN       int                `json:"best_n,omitempty"`
+	Ranking     []TeamRankingEntry `json:"ranking"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
 // QuizRankingResponse represents quiz-specific ranking response
 type QuizRankingResponse struct {
 	QuizID              int64                `json:"quiz_id"`
@@ -211,6 +687,8 @@ type CorrectParticipant struct {
 	ParticipantID  int64     `json:"participant_id"`
 	Nickname       string    `json:"nickname"`
 	SelectedOption string    `json:"selected_option"`
+	Lifeline       *string   `json:"lifeline,omitempty"`
+	Points         int       `json:"points"`
 	AnsweredAt     time.Time `json:"answered_at"`
 }
 
@@ -227,13 +705,16 @@ type ParticipantRankingResponse struct {
 	Percentile        float64 `json:"percentile"`
 }
 
-// ParticipantAnswersResponse represents participant answers history response
+// ParticipantAnswersResponse represents participant answers history response.
+// Skipped questions are listed but not counted as answers.
 type ParticipantAnswersResponse struct {
 	ParticipantID  int64               `json:"participant_id"`
 	Answers        []ParticipantAnswer `json:"answers"`
 	TotalAnswers   int                 `json:"total_answers"`
 	CorrectAnswers int                 `json:"correct_answers"`
+	SkippedAnswers int                 `json:"skipped_answers"`
 	AccuracyRate   float64             `json:"accuracy_rate"`
+	TotalScore     int                 `json:"total_score"`
 }
 
 // ParticipantAnswer represents a single answer in participant's history
@@ -244,9 +725,42 @@ type ParticipantAnswer struct {
 	SelectedOption string    `json:"selected_option"`
 	CorrectAnswer  string    `json:"correct_answer"`
 	IsCorrect      bool      `json:"is_correct"`
+	Lifeline       *string   `json:"lifeline,omitempty"`
+	Points         int       `json:"points"`
 	AnsweredAt     time.Time `json:"answered_at"`
 }
 
+// ResultSummary represents a participant's personal results at the end of an event.
+// Questions are listed in the order they were answered.
+type ResultSummary struct {
+	EventName         string              `json:"event_name"`
+	ParticipantID     int64               `json:"participant_id"`
+	Nickname          string              `json:"nickname"`
+	Rank              int                 `json:"rank"`
+	TotalParticipants int                 `json:"total_participants"`
+	Percentile        float64             `json:"percentile"`
+	TotalAnswers      int                 `json:"total_answers"`
+	CorrectAnswers    int                 `json:"correct_answers"`
+	SkippedAnswers    int                 `json:"skipped_answers"`
+	AccuracyRate      float64             `json:"accuracy_rate"`
+	TotalScore        int                 `json:"total_score"`
+	Questions         []ParticipantAnswer `json:"questions"`
+	Final             bool                `json:"final"`
+	GeneratedAt       time.Time           `json:"generated_at"`
+}
+
+// LifelineStatus represents the lifelines of a participant in their session
+type LifelineStatus struct {
+	ParticipantID int64          `json:"participant_id"`
+	Limits        LifelineCounts `json:"limits"`
+	Used          LifelineCounts `json:"used"`
+	Remaining     LifelineCounts `json:"remaining"`
+	// Current is the lifeline used on the current question, if any
+	Current *LifelineUse `json:"current,omitempty"`
+	// Pending is the double kept for the next question, if any
+	Pending *LifelineUse `json:"pending,omitempty"`
+}
+
 // APIResponse represents standard API response format
 type APIResponse struct {
 	Success bool        `json:"success"`
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when an API key is unknown or has been revoked
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyExpired is returned when an API key has expired
+	ErrAPIKeyExpired = errors.New("API key has expired")
+	// ErrAPIKeyNotFound is returned when an API key to manage does not exist
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+const (
+	// APIKeyPrefix starts every API key, so that keys can be told apart from access tokens
+	// and found by secret scanners
+	APIKeyPrefix = "qk_"
+	// DefaultAPIKeyExpiry is how long an API key is valid when no expiry is given
+	DefaultAPIKeyExpiry = 90 * 24 * time.Hour
+	// apiKeyDisplayLength is how much of a key is stored in the clear to recognize it
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+	// apiKeyUsageInterval limits how often the last use of a key is written
+	apiKeyUsageInterval = time.Minute
+)
+
+// apiKeyColumns are the api_keys columns scanned by scanAPIKey
+const apiKeyColumns = `id, name, key_prefix, permissions, created_by, expires_at, last_used_at, last_used_ip, revoked_at, created_at`
+
+// APIKeyService manages API keys for scripts and integrations. A key acts for the
+// administrator who created it: it is limited to its permissions and to what the
+// administrator's current role allows, and stops working when the administrator is disabled.
+// Keys are stored as SHA-256 hashes; the key itself is shown only when it is created.
+type APIKeyService struct {
+	db            *sql.DB
+	defaultExpiry time.Duration
+}
+
+// NewAPIKeyService creates a new API key service.
+// API_KEY_DEFAULT_EXPIRY_DAYS sets the expiry of keys created without one.
+func NewAPIKeyService() *APIKeyService {
+	defaultExpiry := DefaultAPIKeyExpiry
+	if days, err := strconv.Atoi(os.Getenv("API_KEY_DEFAULT_EXPIRY_DAYS")); err == nil && days > 0 {
+		defaultExpiry = time.Duration(days) * 24 * time.Hour
+	}
+
+	return &APIKeyService{
+		db:            database.GetDB(),
+		defaultExpiry: defaultExpiry,
+	}
+}
+
+// scanAPIKey scans a row of apiKeyColumns
+func scanAPIKey(row interface{ Scan(...any) error }, key *models.APIKey) error {
+	return row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.CreatedBy,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than an access token
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateAPIKey creates an API key with permissions for an administrator. Without expiresAt the
+// key expires after the default expiry. The returned key cannot be shown again.
+func (s *APIKeyService) CreateAPIKey(createdBy int64, name string, permissions []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	if s.db == nil {
+		return nil, "", errors.New("database connection not initialized")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	if expiresAt == nil {
+		expiry := time.Now().Add(s.defaultExpiry)
+		expiresAt = &expiry
+	}
+
+	query := `INSERT INTO api_keys (name, key_prefix, key_hash, permissions, created_by, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING ` + apiKeyColumns
+
+	var apiKey models.APIKey
+	err := scanAPIKey(s.db.QueryRow(query, name, key[:apiKeyDisplayLength], hashAPIKey(key), pq.Array(permissions), createdBy, expiresAt.UTC()), &apiKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return &apiKey, key, nil
+}
+
+// ListAPIKeys returns every API key, including revoked and expired keys, newest first
+func (s *APIKeyService) ListAPIKeys() ([]models.APIKey, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	rows, err := s.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an API key immediately. Revoked keys are kept for the record.
+func (s *APIKeyService) RevokeAPIKey(id int64) (*models.APIKey, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+			  WHERE id = $1
+			  RETURNING ` + apiKeyColumns
+
+	var key models.APIKey
+	if err := scanAPIKey(s.db.QueryRow(query, id), &key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return &key, nil
+}
+
+// Authenticate returns an API key and the administrator it acts for, recording its use from ip.
+// It returns ErrInvalidAPIKey for unknown or revoked keys, ErrAPIKeyExpired for expired keys
+// and ErrAdminDisabled when the administrator has been disabled.
+func (s *APIKeyService) Authenticate(key, ip string) (*models.APIKey, *models.Administrator, error) {
+	if s.db == nil {
+		return nil, nil, errors.New("database connection not initialized")
+	}
+	if !IsAPIKey(key) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hashAPIKey(key)), &apiKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if apiKey.ExpiresAt != nil && !time.Now().Before(*apiKey.ExpiresAt) {
+		return nil, nil, ErrAPIKeyExpired
+	}
+
+	admin, err := (&AuthService{db: s.db}).GetAdminByID(apiKey.CreatedBy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if admin.DisabledAt != nil {
+		return nil, nil, ErrAdminDisabled
+	}
+
+	// Busy keys are recorded at most once per interval instead of on every request
+	_, err = s.db.Exec(`UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $2
+					   WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - $3 * INTERVAL '1 second')`,
+		apiKey.ID, ip, int(apiKeyUsageInterval/time.Second))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return &apiKey, admin, nil
+}
+
+// hashAPIKey hashes an API key for storage. Keys are random, so a fast hash is enough and
+// lets a key be looked up directly.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+func TestIsAPIKey(t *testing.T) {
+	if !IsAPIKey(APIKeyPrefix + "abc") {
+		t.Error("Expected a key with the prefix to be an API key")
+	}
+	if IsAPIKey("eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.sig") {
+		t.Error("Expected an access token not to be an API key")
+	}
+}
+
+func TestAPIKeyService(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	suffix := os.Getpid()
+	admin, err := NewAuthService().CreateAdminWithRole(fmt.Sprintf("apikey%d", suffix), "apikeypassword",
+		fmt.Sprintf("apikey%d@example.com", suffix), models.AdminRoleHost)
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", admin.ID)
+	}()
+
+	service := NewAPIKeyService()
+
+	// 作成したキーはハッシュだけが保存され、既定の有効期限が設定される
+	apiKey, key, err := service.CreateAPIKey(admin.ID, "CI", []string{"read", "run_session"}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey() failed: %v", err)
+	}
+	if !IsAPIKey(key) || !strings.HasPrefix(key, apiKey.Prefix) || len(apiKey.Permissions) != 2 || apiKey.CreatedBy != admin.ID {
+		t.Errorf("Unexpected API key %+v (%s)", apiKey, key)
+	}
+	if apiKey.ExpiresAt == nil || apiKey.ExpiresAt.Before(time.Now().Add(DefaultAPIKeyExpiry-time.Hour)) {
+		t.Errorf("Expected the default expiry, got %v", apiKey.ExpiresAt)
+	}
+	var stored string
+	if err := db.QueryRow("SELECT key_hash FROM api_keys WHERE id = $1", apiKey.ID).Scan(&stored); err != nil || stored == key {
+		t.Errorf("Expected the key to be stored as a hash, got %q (%v)", stored, err)
+	}
+
+	// 認証すると作成した管理者として使え、最終使用日時が記録される
+	authenticated, keyAdmin, err := service.Authenticate(key, "192.0.2.10")
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if authenticated.ID != apiKey.ID || keyAdmin.ID != admin.ID || keyAdmin.Role != models.AdminRoleHost {
+		t.Errorf("Authenticate() = %+v, %+v", authenticated, keyAdmin)
+	}
+	keys, err := service.ListAPIKeys()
+	if err != nil {
+		t.Fatalf("ListAPIKeys() failed: %v", err)
+	}
+	for _, listed := range keys {
+		if listed.ID == apiKey.ID && (listed.LastUsedAt == nil || listed.LastUsedIP == nil || *listed.LastUsedIP != "192.0.2.10") {
+			t.Errorf("Expected the last use to be recorded, got %+v", listed)
+		}
+	}
+
+	if _, _, err := service.Authenticate(key+"x", ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() with a wrong key error = %v, want ErrInvalidAPIKey", err)
+	}
+
+	// 期限切れのキーは使えない
+	expired, expiredKey, err := service.CreateAPIKey(admin.ID, "expired", []string{"read"}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey() failed: %v", err)
+	}
+	if _, err := db.Exec("UPDATE api_keys SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1", expired.ID); err != nil {
+		t.Fatalf("Failed to expire key: %v", err)
+	}
+	if _, _, err := service.Authenticate(expiredKey, ""); !errors.Is(err, ErrAPIKeyExpired) {
+		t.Errorf("Authenticate() with an expired key error = %v, want ErrAPIKeyExpired", err)
+	}
+
+	// 管理者を無効化するとキーも使えない
+	if _, err := NewAuthService().SetAdminDisabled(admin.ID, true); err != nil {
+		t.Fatalf("Failed to disable admin: %v", err)
+	}
+	if _, _, err := service.Authenticate(key, ""); !errors.Is(err, ErrAdminDisabled) {
+		t.Errorf("Authenticate() for a disabled admin error = %v, want ErrAdminDisabled", err)
+	}
+	if _, err := NewAuthService().SetAdminDisabled(admin.ID, false); err != nil {
+		t.Fatalf("Failed to enable admin: %v", err)
+	}
+
+	// 無効にしたキーは使えない
+	revoked, err := service.RevokeAPIKey(apiKey.ID)
+	if err != nil || revoked.RevokedAt == nil {
+		t.Fatalf("RevokeAPIKey() = %+v, %v", revoked, err)
+	}
+	if _, _, err := service.Authenticate(key, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() with a revoked key error = %v, want ErrInvalidAPIKey", err)
+	}
+	if _, err := service.RevokeAPIKey(-1); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey() for an unknown key error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
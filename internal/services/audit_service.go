@@ -0,0 +1,161 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+// Audited administrator actions
+const (
+	AuditActionQuizCreate          = "quiz.create"
+	AuditActionQuizUpdate          = "quiz.update"
+	AuditActionQuizDelete          = "quiz.delete"
+	AuditActionSessionStart        = "session.start"
+	AuditActionSessionNextQuestion = "session.next_question"
+	AuditActionSessionToggle       = "session.toggle_answers"
+	AuditActionSessionEnd          = "session.end"
+)
+
+// Targets of audited actions
+const (
+	AuditTargetQuiz    = "quiz"
+	AuditTargetSession = "session"
+)
+
+// auditLogColumns are the audit_logs columns scanned by scanAuditLog
+const auditLogColumns = `id, admin_id, username, api_key_id, action, target_type, target_id,
+						 before_data, after_data, request_id, ip_address, created_at`
+
+// AuditService records administrator actions and queries the audit log
+type AuditService struct {
+	db *sql.DB
+}
+
+// AuditLogFilter selects audit log entries. Zero values match every entry.
+type AuditLogFilter struct {
+	AdminID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService() *AuditService {
+	return &AuditService{
+		db: database.GetDB(),
+	}
+}
+
+// Record adds an administrator action to the audit log. Before and After are stored as given
+// and may be empty, e.g. there is nothing before a quiz is created.
+func (s *AuditService) Record(entry models.AuditLog) error {
+	if s.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	_, err := s.db.Exec(`INSERT INTO audit_logs (admin_id, username, api_key_id, action, target_type, target_id,
+											   before_data, after_data, request_id, ip_address)
+						 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.AdminID, entry.Username, entry.APIKeyID, entry.Action, entry.TargetType, entry.TargetID,
+		jsonValue(entry.Before), jsonValue(entry.After), entry.RequestID, entry.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+	return nil
+}
+
+// ListLogs returns audit log entries matching filter, newest first, and the number of matching entries
+func (s *AuditService) ListLogs(filter AuditLogFilter, page, limit int) ([]models.AuditLog, int, error) {
+	if s.db == nil {
+		return nil, 0, errors.New("database connection not initialized")
+	}
+
+	where, args := filter.where()
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_logs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+
+	pageLimit, pageArgs := pageClause(args, page, limit)
+	logs := []models.AuditLog{}
+	err := s.eachLog(`SELECT `+auditLogColumns+`
+					  FROM audit_logs `+where+`
+					  ORDER BY created_at DESC, id DESC `+pageLimit, pageArgs, func(entry models.AuditLog) error {
+		logs = append(logs, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// ExportLogs calls fn with every audit log entry matching filter, oldest first, without loading
+// the whole log into memory. It stops at the first error returned by fn.
+func (s *AuditService) ExportLogs(filter AuditLogFilter, fn func(models.AuditLog) error) error {
+	if s.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	where, args := filter.where()
+	return s.eachLog(`SELECT `+auditLogColumns+`
+					  FROM audit_logs `+where+`
+					  ORDER BY created_at, id`, args, fn)
+}
+
+// where returns the WHERE clause and arguments of the filter
+func (f AuditLogFilter) where() (string, []any) {
+	var filter queryFilter
+	filter.id("admin_id", f.AdminID)
+	filter.text("action", f.Action)
+	filter.text("target_type", f.TargetType)
+	filter.id("target_id", f.TargetID)
+	filter.text("request_id", f.RequestID)
+	filter.timeRange("created_at", f.From, f.To)
+	return filter.where()
+}
+
+// eachLog runs an audit log query and calls fn with every entry
+func (s *AuditService) eachLog(query string, args []any, fn func(models.AuditLog) error) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	for rows.Next() {
+		var entry models.AuditLog
+		var before, after []byte
+		err := rows.Scan(&entry.ID, &entry.AdminID, &entry.Username, &entry.APIKeyID, &entry.Action,
+			&entry.TargetType, &entry.TargetID, &before, &after, &entry.RequestID, &entry.IPAddress, &entry.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		entry.Before = before
+		entry.After = after
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// jsonValue returns a JSON document as a query argument, or nil for SQL NULL
+func jsonValue(data []byte) *string {
+	if len(data) == 0 {
+		return nil
+	}
+	value := string(data)
+	return &value
+}
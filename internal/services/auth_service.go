@@ -2,28 +2,90 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/Tattsum/quiz/internal/database"
 	"github.com/Tattsum/quiz/internal/models"
 )
 
+var (
+	// ErrInvalidCredentials is returned when a username or password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAdminNotFound is returned when an administrator does not exist
+	ErrAdminNotFound = errors.New("admin not found")
+	// ErrAdminDisabled is returned when a disabled administrator tries to sign in
+	ErrAdminDisabled = errors.New("admin is disabled")
+	// ErrAdminExists is returned when a username or email is already in use
+	ErrAdminExists = errors.New("username or email is already in use")
+	// ErrInvitationInvalid is returned when an invitation token is unknown, used or expired
+	ErrInvitationInvalid = errors.New("invitation is invalid or has expired")
+	// ErrLastOwner is returned when a change would leave no active owner
+	ErrLastOwner = errors.New("at least one active owner is required")
+	// ErrInvalidPassword is returned when a new password is too short or too long
+	ErrInvalidPassword = fmt.Errorf("password must be %d to %d bytes", MinPasswordLength, MaxPasswordBytes)
+	// ErrAdminsExist is returned when bootstrapping after the first administrator was created
+	ErrAdminsExist = errors.New("administrators already exist")
+)
+
+const (
+	// DefaultInviteExpiry is how long an administrator invitation can be accepted
+	DefaultInviteExpiry = 72 * time.Hour
+	// MinPasswordLength is the minimum length of an administrator password
+	MinPasswordLength = 8
+	// MaxPasswordBytes is the longest password bcrypt accepts
+	MaxPasswordBytes = 72
+)
+
+// adminColumns are the administrators columns scanned by scanAdmin
+const adminColumns = `id, username, email, role, disabled_at, invited_by, invite_expires_at, totp_enabled_at IS NOT NULL, created_at, updated_at`
+
 // AuthService provides authentication related business logic
 type AuthService struct {
-	db *sql.DB
+	db           *sql.DB
+	inviteExpiry time.Duration
 }
 
-// NewAuthService creates a new AuthService instance
+// NewAuthService creates a new AuthService instance.
+// ADMIN_INVITE_EXPIRY_HOURS sets how long invitations can be accepted.
 func NewAuthService() *AuthService {
+	inviteExpiry := DefaultInviteExpiry
+	if hours, err := strconv.Atoi(os.Getenv("ADMIN_INVITE_EXPIRY_HOURS")); err == nil && hours > 0 {
+		inviteExpiry = time.Duration(hours) * time.Hour
+	}
+
 	return &AuthService{
-		db: database.GetDB(),
+		db:           database.GetDB(),
+		inviteExpiry: inviteExpiry,
 	}
 }
 
+// scanAdmin scans a row of adminColumns
+func scanAdmin(row interface{ Scan(...any) error }, admin *models.Administrator) error {
+	return row.Scan(
+		&admin.ID,
+		&admin.Username,
+		&admin.Email,
+		&admin.Role,
+		&admin.DisabledAt,
+		&admin.InvitedBy,
+		&admin.InviteExpiresAt,
+		&admin.TwoFactorEnabled,
+		&admin.CreatedAt,
+		&admin.UpdatedAt,
+	)
+}
+
 // AuthenticateAdmin authenticates an admin user and returns admin details
 func (s *AuthService) AuthenticateAdmin(username, password string) (*models.Administrator, error) {
 	if username == "" || password == "" {
@@ -40,7 +102,12 @@ func (s *AuthService) AuthenticateAdmin(username, password string) (*models.Admi
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
+	}
+
+	// Checked after the password so that the account state is not revealed to others
+	if admin.DisabledAt != nil {
+		return nil, ErrAdminDisabled
 	}
 
 	// Clear password hash for security
@@ -59,19 +126,12 @@ func (s *AuthService) GetAdminByID(id int64) (*models.Administrator, error) {
 	}
 
 	var admin models.Administrator
-	query := `SELECT id, username, email, created_at, updated_at 
-			  FROM administrators WHERE id = $1`
+	query := `SELECT ` + adminColumns + ` FROM administrators WHERE id = $1`
 
-	err := s.db.QueryRow(query, id).Scan(
-		&admin.ID,
-		&admin.Username,
-		&admin.Email,
-		&admin.CreatedAt,
-		&admin.UpdatedAt,
-	)
+	err := scanAdmin(s.db.QueryRow(query, id), &admin)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("admin not found")
+			return nil, ErrAdminNotFound
 		}
 		return nil, fmt.Errorf("failed to get admin: %w", err)
 	}
@@ -85,7 +145,7 @@ func (s *AuthService) getAdminByUsername(username string) (*models.Administrator
 	}
 
 	var admin models.Administrator
-	query := `SELECT id, username, password_hash, email, created_at, updated_at 
+	query := `SELECT id, username, password_hash, email, role, disabled_at, totp_enabled_at IS NOT NULL, created_at, updated_at
 			  FROM administrators WHERE username = $1`
 
 	err := s.db.QueryRow(query, username).Scan(
@@ -93,12 +153,15 @@ func (s *AuthService) getAdminByUsername(username string) (*models.Administrator
 		&admin.Username,
 		&admin.PasswordHash,
 		&admin.Email,
+		&admin.Role,
+		&admin.DisabledAt,
+		&admin.TwoFactorEnabled,
 		&admin.CreatedAt,
 		&admin.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("invalid credentials")
+			return nil, ErrInvalidCredentials
 		}
 		return nil, fmt.Errorf("failed to get admin: %w", err)
 	}
@@ -112,32 +175,357 @@ func (s *AuthService) HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
-// CreateAdmin creates a new administrator (for initial setup or testing)
+// ValidatePassword checks the length of a new password
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordBytes {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// CreateAdmin creates a new owner (for initial setup or testing)
 func (s *AuthService) CreateAdmin(username, password, email string) (*models.Administrator, error) {
+	return s.CreateAdminWithRole(username, password, email, models.AdminRoleOwner)
+}
+
+// CreateAdminWithRole creates a new administrator with a role and a password chosen for them
+func (s *AuthService) CreateAdminWithRole(username, password, email, role string) (*models.Administrator, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+	return s.createAdmin(s.db, username, password, email, role)
+}
+
+// BootstrapAdmin creates the first owner. It fails with ErrAdminsExist once any
+// administrator exists, so it is safe to run on every deployment.
+func (s *AuthService) BootstrapAdmin(username, password, email string) (*models.Administrator, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	// Block concurrent inserts so that two bootstraps cannot both see an empty table
+	if _, err := tx.Exec("LOCK TABLE administrators IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, fmt.Errorf("failed to lock administrators: %w", err)
+	}
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM administrators)").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to count administrators: %w", err)
+	}
+	if exists {
+		return nil, ErrAdminsExist
+	}
+
+	admin, err := s.createAdmin(tx, username, password, email, models.AdminRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return admin, nil
+}
+
+// createAdmin inserts an administrator with a password
+func (s *AuthService) createAdmin(db interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, username, password, email, role string) (*models.Administrator, error) {
 	if username == "" || password == "" || email == "" {
 		return nil, errors.New("username, password, and email are required")
 	}
+	if err := ValidatePassword(password); err != nil {
+		return nil, err
+	}
 
 	hashedPassword, err := s.HashPassword(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	query := `INSERT INTO administrators (username, password_hash, email, created_at, updated_at) 
-			  VALUES ($1, $2, $3, NOW(), NOW()) 
-			  RETURNING id, username, email, created_at, updated_at`
+	query := `INSERT INTO administrators (username, password_hash, email, role, created_at, updated_at) 
+			  VALUES ($1, $2, $3, $4, NOW(), NOW()) 
+			  RETURNING ` + adminColumns
 
 	var admin models.Administrator
-	err = s.db.QueryRow(query, username, hashedPassword, email).Scan(
-		&admin.ID,
-		&admin.Username,
-		&admin.Email,
-		&admin.CreatedAt,
-		&admin.UpdatedAt,
-	)
+	err = scanAdmin(db.QueryRow(query, username, hashedPassword, email, role), &admin)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAdminExists
+		}
 		return nil, fmt.Errorf("failed to create admin: %w", err)
 	}
 
 	return &admin, nil
 }
+
+// InviteAdmin creates an administrator who signs in after accepting the invitation with a
+// password of their own. The returned token is stored only as a hash, so it cannot be shown again.
+func (s *AuthService) InviteAdmin(invitedBy int64, username, email, role string) (*models.Administrator, string, error) {
+	if s.db == nil {
+		return nil, "", errors.New("database connection not initialized")
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	// An empty password hash never matches, so the account cannot sign in until it is accepted
+	query := `INSERT INTO administrators (username, password_hash, email, role, invited_by, invite_token_hash, invite_expires_at, created_at, updated_at)
+			  VALUES ($1, '', $2, $3, $4, $5, $6, NOW(), NOW())
+			  RETURNING ` + adminColumns
+
+	var admin models.Administrator
+	expiresAt := time.Now().Add(s.inviteExpiry)
+	err := scanAdmin(s.db.QueryRow(query, username, email, role, invitedBy, hashInvitationToken(token), expiresAt), &admin)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, "", ErrAdminExists
+		}
+		return nil, "", fmt.Errorf("failed to invite admin: %w", err)
+	}
+
+	return &admin, token, nil
+}
+
+// AcceptInvitation sets the password of an invited administrator and returns them
+func (s *AuthService) AcceptInvitation(token, password string) (*models.Administrator, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	if err := ValidatePassword(password); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	query := `UPDATE administrators
+			  SET password_hash = $1, invite_token_hash = NULL, invite_expires_at = NULL, updated_at = NOW()
+			  WHERE invite_token_hash = $2 AND invite_expires_at > NOW() AND disabled_at IS NULL
+			  RETURNING ` + adminColumns
+
+	var admin models.Administrator
+	err = scanAdmin(s.db.QueryRow(query, hashedPassword, hashInvitationToken(token)), &admin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	return &admin, nil
+}
+
+// ListAdmins returns every administrator, including disabled ones and pending invitations
+func (s *AuthService) ListAdmins() ([]models.Administrator, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	rows, err := s.db.Query(`SELECT ` + adminColumns + ` FROM administrators ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admins: %w", err)
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	admins := []models.Administrator{}
+	for rows.Next() {
+		var admin models.Administrator
+		if err := scanAdmin(rows, &admin); err != nil {
+			return nil, fmt.Errorf("failed to scan admin: %w", err)
+		}
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+// SetAdminRole changes an administrator's role. The last active owner cannot be demoted.
+func (s *AuthService) SetAdminRole(id int64, role string) (*models.Administrator, error) {
+	return s.updateAdmin(id, role != models.AdminRoleOwner, `UPDATE administrators SET role = $2, updated_at = NOW() WHERE id = $1 RETURNING `+adminColumns, role)
+}
+
+// SetAdminDisabled disables or re-enables an administrator. The last active owner cannot be disabled.
+func (s *AuthService) SetAdminDisabled(id int64, disabled bool) (*models.Administrator, error) {
+	query := `UPDATE administrators
+			  SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW()
+			  WHERE id = $1
+			  RETURNING ` + adminColumns
+	return s.updateAdmin(id, disabled, query, disabled)
+}
+
+// UpdateAdmin changes the username, email or password of an administrator.
+// Nil fields are left unchanged. Setting a password cancels a pending invitation.
+func (s *AuthService) UpdateAdmin(id int64, username, email, password *string) (*models.Administrator, error) {
+	var hashedPassword *string
+	if password != nil {
+		if err := ValidatePassword(*password); err != nil {
+			return nil, err
+		}
+		hash, err := s.HashPassword(*password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		hashedPassword = &hash
+	}
+
+	query := `UPDATE administrators
+			  SET username = COALESCE($2, username), email = COALESCE($3, email),
+				  password_hash = COALESCE($4, password_hash),
+				  invite_token_hash = CASE WHEN $4 IS NULL THEN invite_token_hash END,
+				  invite_expires_at = CASE WHEN $4 IS NULL THEN invite_expires_at END,
+				  updated_at = NOW()
+			  WHERE id = $1
+			  RETURNING ` + adminColumns
+	admin, err := s.updateAdmin(id, false, query, username, email, hashedPassword)
+	if isUniqueViolation(err) {
+		return nil, ErrAdminExists
+	}
+	return admin, err
+}
+
+// DeleteAdmin deletes an administrator. The last active owner cannot be deleted.
+// Records of their moderation actions are kept without the administrator.
+func (s *AuthService) DeleteAdmin(id int64) error {
+	_, err := s.updateAdmin(id, true, `DELETE FROM administrators WHERE id = $1 RETURNING `+adminColumns)
+	return err
+}
+
+// ChangePassword sets a new password after checking the current one.
+// It returns ErrInvalidCredentials if the current password is wrong.
+func (s *AuthService) ChangePassword(id int64, currentPassword, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+	if s.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	var passwordHash string
+	err := s.db.QueryRow("SELECT password_hash FROM administrators WHERE id = $1", id).Scan(&passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAdminNotFound
+		}
+		return fmt.Errorf("failed to get admin: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	hashedPassword, err := s.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	// Only replace the hash that was checked, in case the password changed meanwhile
+	result, err := s.db.Exec("UPDATE administrators SET password_hash = $1, updated_at = NOW() WHERE id = $2 AND password_hash = $3",
+		hashedPassword, id, passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// VerifyPassword checks the password of an administrator, returning ErrInvalidCredentials
+// if it is wrong
+func (s *AuthService) VerifyPassword(id int64, password string) error {
+	if s.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	var passwordHash string
+	err := s.db.QueryRow("SELECT password_hash FROM administrators WHERE id = $1", id).Scan(&passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAdminNotFound
+		}
+		return fmt.Errorf("failed to get admin: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// updateAdmin runs a statement that modifies one administrator and returns its row. If
+// removesOwner is set, it fails with ErrLastOwner when the administrator is the only active
+// owner. Active owners are locked so that two owners cannot demote each other at the same time.
+func (s *AuthService) updateAdmin(id int64, removesOwner bool, query string, args ...any) (*models.Administrator, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	if removesOwner {
+		rows, err := tx.Query(`SELECT id FROM administrators
+							   WHERE role = $1 AND disabled_at IS NULL AND invite_token_hash IS NULL
+							   FOR UPDATE`, models.AdminRoleOwner)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock owners: %w", err)
+		}
+		var owners []int64
+		for rows.Next() {
+			var ownerID int64
+			if err := rows.Scan(&ownerID); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("failed to scan owner: %w", err)
+			}
+			owners = append(owners, ownerID)
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to lock owners: %w", err)
+		}
+		if len(owners) == 1 && owners[0] == id {
+			return nil, ErrLastOwner
+		}
+	}
+
+	var admin models.Administrator
+	if err := scanAdmin(tx.QueryRow(query, append([]any{id}, args...)...), &admin); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAdminNotFound
+		}
+		return nil, fmt.Errorf("failed to update admin: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &admin, nil
+}
+
+// hashInvitationToken hashes an invitation token for storage. The token is random, so a
+// fast hash is enough and lets the token be looked up directly.
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
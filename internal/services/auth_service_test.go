@@ -1,6 +1,8 @@
 package services
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -113,3 +115,40 @@ func TestAuthService_GetAdminByID(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"too short", "1234567", true},
+		{"minimum length", "12345678", false},
+		{"maximum bcrypt length", strings.Repeat("a", MaxPasswordBytes), false},
+		{"longer than bcrypt accepts", strings.Repeat("a", MaxPasswordBytes+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPassword) {
+				t.Errorf("ValidatePassword() error = %v, want ErrInvalidPassword", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	service := &AuthService{db: nil}
+
+	// A short new password is refused before the current password is checked
+	if err := service.ChangePassword(1, "current", "short"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("ChangePassword() error = %v, want ErrInvalidPassword", err)
+	}
+	if err := service.ChangePassword(1, "current", "longenough"); err == nil {
+		t.Error("ChangePassword() should fail without a database connection")
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// EventBroker distributes real-time events between API replicas.
+// Every subscriber, including the publishing replica, receives each payload.
+type EventBroker interface {
+	// NextSequence returns a cluster-wide, monotonically increasing event ID
+	NextSequence(ctx context.Context) (int64, error)
+	// Publish delivers payload to all subscribers
+	Publish(ctx context.Context, payload []byte) error
+	// Subscribe registers a handler for payloads published by any replica
+	Subscribe(ctx context.Context, handler func(payload []byte)) error
+	// Close releases the broker's resources
+	Close() error
+}
+
+// MemoryBroker implements EventBroker within a single process
+type MemoryBroker struct {
+	sequence atomic.Int64
+
+	mu       sync.RWMutex
+	handlers []func(payload []byte)
+}
+
+// NewMemoryBroker creates a new MemoryBroker instance
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// NextSequence returns the next event ID for this process
+func (b *MemoryBroker) NextSequence(_ context.Context) (int64, error) {
+	return b.sequence.Add(1), nil
+}
+
+// Publish delivers payload to every handler synchronously
+func (b *MemoryBroker) Publish(_ context.Context, payload []byte) error {
+	b.mu.RLock()
+	handlers := make([]func(payload []byte), len(b.handlers))
+	copy(handlers, b.handlers)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for published payloads
+func (b *MemoryBroker) Subscribe(_ context.Context, handler func(payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+// Close removes all handlers
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = nil
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMemoryBroker_PublishSubscribe(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx := context.Background()
+
+	var received []string
+	if err := broker.Subscribe(ctx, func(payload []byte) {
+		received = append(received, string(payload))
+	}); err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	if err := broker.Publish(ctx, []byte("hello")); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+
+	if len(received) != 1 || received[0] != "hello" {
+		t.Errorf("expected [hello], got %v", received)
+	}
+
+	first, _ := broker.NextSequence(ctx)
+	second, _ := broker.NextSequence(ctx)
+	if second <= first {
+		t.Errorf("expected increasing sequence, got %d then %d", first, second)
+	}
+
+	if err := broker.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	if err := broker.Publish(ctx, []byte("after close")); err != nil {
+		t.Errorf("Publish() after close failed: %v", err)
+	}
+	if len(received) != 1 {
+		t.Errorf("expected no delivery after close, got %v", received)
+	}
+}
+
+func TestRedisBroker_CrossReplicaDelivery(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	replicaA, err := NewRedisBroker(server.Addr(), "", DefaultRedisEventChannel)
+	if err != nil {
+		t.Fatalf("failed to create broker A: %v", err)
+	}
+	defer replicaA.Close()
+
+	replicaB, err := NewRedisBroker(server.Addr(), "", DefaultRedisEventChannel)
+	if err != nil {
+		t.Fatalf("failed to create broker B: %v", err)
+	}
+	defer replicaB.Close()
+
+	ctx := context.Background()
+	received := make(chan string, 1)
+	if err := replicaB.Subscribe(ctx, func(payload []byte) {
+		received <- string(payload)
+	}); err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	if err := replicaA.Publish(ctx, []byte("answer")); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload != "answer" {
+			t.Errorf("expected answer, got %s", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for cross-replica delivery")
+	}
+
+	// Sequence numbers are shared between replicas
+	a, err := replicaA.NextSequence(ctx)
+	if err != nil {
+		t.Fatalf("NextSequence() failed: %v", err)
+	}
+	b, err := replicaB.NextSequence(ctx)
+	if err != nil {
+		t.Fatalf("NextSequence() failed: %v", err)
+	}
+	if b != a+1 {
+		t.Errorf("expected shared sequence, got %d then %d", a, b)
+	}
+}
+
+func TestNewRedisBroker_Unreachable(t *testing.T) {
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+
+	if _, err := NewRedisBroker(addr, "", DefaultRedisEventChannel); err == nil {
+		t.Error("expected error for unreachable redis server")
+	}
+}
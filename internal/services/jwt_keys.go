@@ -0,0 +1,272 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing tokens
+const minRSAKeyBits = 2048
+
+// KeySet holds the keys that sign and verify one kind of token. Tokens are signed with the
+// current key and carry its ID in the kid header. Previous keys still verify the tokens they
+// signed, so that keys can be rotated without signing everyone out.
+type KeySet struct {
+	current *signingKey
+	keys    map[string]*signingKey
+}
+
+// signingKey is one key of a KeySet
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   any // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	verifyKey any // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// NewHMACKeySet creates a key set signing with HS256 and the current secret. Previous secrets
+// only verify. Key IDs are derived from the secrets, so no IDs need to be configured.
+func NewHMACKeySet(current string, previous ...string) *KeySet {
+	newKey := func(secret string) *signingKey {
+		sum := sha256.Sum256([]byte("kid:" + secret))
+		return &signingKey{
+			id:        "hs-" + hex.EncodeToString(sum[:8]),
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(secret),
+			verifyKey: []byte(secret),
+		}
+	}
+
+	set := &KeySet{current: newKey(current), keys: make(map[string]*signingKey)}
+	set.keys[set.current.id] = set.current
+	for _, secret := range previous {
+		if secret != "" && secret != current {
+			key := newKey(secret)
+			set.keys[key.id] = key
+		}
+	}
+	return set
+}
+
+// NewAsymmetricKeySet creates a key set signing with an RSA (RS256) or Ed25519 (EdDSA)
+// private key. Previous public keys only verify. Key IDs are JWK thumbprints (RFC 7638).
+func NewAsymmetricKeySet(privateKey crypto.Signer, previous ...crypto.PublicKey) (*KeySet, error) {
+	current, err := newAsymmetricKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	current.signKey = privateKey
+
+	set := &KeySet{current: current, keys: map[string]*signingKey{current.id: current}}
+	for _, publicKey := range previous {
+		key, err := newAsymmetricKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := set.keys[key.id]; !exists {
+			set.keys[key.id] = key
+		}
+	}
+	return set, nil
+}
+
+// LoadAsymmetricKeySet loads the current private key and previous keys from PEM files.
+// Previous key files may hold either private or public keys.
+func LoadAsymmetricKeySet(privateKeyFile string, previousKeyFiles []string) (*KeySet, error) {
+	key, err := readPEMKey(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain a private key", privateKeyFile)
+	}
+
+	var previous []crypto.PublicKey
+	for _, file := range previousKeyFiles {
+		key, err := readPEMKey(file)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		previous = append(previous, key)
+	}
+	return NewAsymmetricKeySet(privateKey, previous...)
+}
+
+// Algorithm returns the signing algorithm of the current key
+func (k *KeySet) Algorithm() string {
+	return k.current.method.Alg()
+}
+
+// Sign signs claims with the current key and sets its kid header
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.current.method, claims)
+	token.Header["kid"] = k.current.id
+	return token.SignedString(k.current.signKey)
+}
+
+// Parse verifies a token with the key named by its kid header and parses its claims.
+// Tokens issued before key IDs were added have no kid and are verified with the current key.
+func (k *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	methods := make([]string, 0, len(k.keys))
+	for _, key := range k.keys {
+		methods = append(methods, key.method.Alg())
+	}
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key := k.current
+		if kid, _ := token.Header["kid"].(string); kid != "" {
+			var ok bool
+			if key, ok = k.keys[kid]; !ok {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods(methods))
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set. HMAC secrets are never
+// published, so an HMAC key set has no keys.
+func (k *KeySet) JWKS() models.JWKSet {
+	jwks := models.JWKSet{Keys: []models.JWK{}}
+	if jwk, ok := publicJWK(k.current); ok {
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	for _, key := range k.keys {
+		if key == k.current {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// newAsymmetricKey creates a verification key for a public key
+func newAsymmetricKey(publicKey crypto.PublicKey) (*signingKey, error) {
+	key := &signingKey{verifyKey: publicKey}
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T; use an RSA or Ed25519 key", publicKey)
+	}
+
+	jwk, _ := publicJWK(key)
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	key.id = thumbprint
+	return key, nil
+}
+
+// publicJWK returns the JWK of an asymmetric key's public part
+func publicJWK(key *signingKey) (models.JWK, bool) {
+	jwk := models.JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+	switch pub := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return models.JWK{}, false
+	}
+	return jwk, true
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of a JWK: the SHA-256 of its required
+// members in lexicographic order
+func jwkThumbprint(jwk models.JWK) (string, error) {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// readPEMKey reads the first PEM block of a file as a private or public key
+func readPEMKey(file string) (any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", file)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+}
+
+// splitList splits a comma-separated environment variable, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
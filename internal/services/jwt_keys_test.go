@@ -0,0 +1,271 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+// writeKeyFile writes a private key to a PKCS #8 PEM file
+func writeKeyFile(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return file
+}
+
+// tokenKeyID returns the kid header of a token without verifying it
+func tokenKeyID(t *testing.T, tokenString string) string {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &models.JWTClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestHMACKeySet_Rotation(t *testing.T) {
+	admin := &models.Administrator{ID: 1, Username: "admin", Role: models.AdminRoleOwner}
+	claims := func() *models.JWTClaims {
+		return &models.JWTClaims{AdminID: admin.ID, Type: "access"}
+	}
+
+	oldKeys := NewHMACKeySet("old-secret")
+	oldToken, err := oldKeys.Sign(claims())
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+	if tokenKeyID(t, oldToken) == "" {
+		t.Error("Expected a kid header")
+	}
+
+	// After rotation the new secret signs and the old one still verifies
+	rotated := NewHMACKeySet("new-secret", "old-secret")
+	newToken, err := rotated.Sign(claims())
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+	if tokenKeyID(t, newToken) == tokenKeyID(t, oldToken) {
+		t.Error("Expected the new secret to have a different kid")
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := rotated.Parse(token, &models.JWTClaims{}); err != nil {
+			t.Errorf("Parse() failed after rotation: %v", err)
+		}
+	}
+
+	// Once the old secret is retired its tokens are rejected
+	if _, err := NewHMACKeySet("new-secret").Parse(oldToken, &models.JWTClaims{}); err == nil {
+		t.Error("Expected a token of a retired secret to be rejected")
+	}
+
+	// Tokens issued before key IDs were added are verified with the current secret
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims()).SignedString([]byte("new-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign legacy token: %v", err)
+	}
+	if _, err := rotated.Parse(legacy, &models.JWTClaims{}); err != nil {
+		t.Errorf("Expected a token without kid to verify with the current secret: %v", err)
+	}
+}
+
+func TestJWTService_AsymmetricSigning(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		alg string
+		key crypto.Signer
+	}{
+		{SigningAlgRS256, rsaKey},
+		{SigningAlgEdDSA, edKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			t.Setenv("JWT_SIGNING_ALG", tt.alg)
+			t.Setenv("JWT_PRIVATE_KEY_FILE", writeKeyFile(t, tt.key))
+			t.Setenv("JWT_PREVIOUS_KEY_FILES", "")
+
+			service, err := LoadJWTService()
+			if err != nil {
+				t.Fatalf("LoadJWTService() failed: %v", err)
+			}
+			admin := &models.Administrator{ID: 7, Username: "admin", Role: models.AdminRoleHost}
+			pair, _, err := service.GenerateTokenPairWithIDs(admin)
+			if err != nil {
+				t.Fatalf("GenerateTokenPairWithIDs() failed: %v", err)
+			}
+
+			claims, err := service.ValidateAccessToken(pair.AccessToken)
+			if err != nil || claims.AdminID != admin.ID {
+				t.Fatalf("ValidateAccessToken() = %+v, %v", claims, err)
+			}
+			if _, err := service.ValidateRefreshToken(pair.RefreshToken); err != nil {
+				t.Errorf("ValidateRefreshToken() failed: %v", err)
+			}
+			if _, err := service.ValidateAccessToken(pair.RefreshToken); err == nil {
+				t.Error("Expected a refresh token to be rejected as an access token")
+			}
+
+			// The JWKS publishes the key under the token's kid, and verifies the token
+			jwks := service.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != tokenKeyID(t, pair.AccessToken) || jwks.Keys[0].Alg != tt.alg {
+				t.Fatalf("Unexpected JWKS %+v", jwks)
+			}
+			publicKey := jwkPublicKey(t, jwks.Keys[0])
+			if _, err := jwt.Parse(pair.AccessToken, func(*jwt.Token) (interface{}, error) { return publicKey, nil }); err != nil {
+				t.Errorf("Expected the JWKS key to verify the token: %v", err)
+			}
+
+			// Rotating keeps the old key for verification
+			var newKey crypto.Signer
+			if tt.alg == SigningAlgRS256 {
+				newKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+			} else {
+				_, newKey, _ = ed25519.GenerateKey(rand.Reader)
+			}
+			t.Setenv("JWT_PREVIOUS_KEY_FILES", os.Getenv("JWT_PRIVATE_KEY_FILE"))
+			t.Setenv("JWT_PRIVATE_KEY_FILE", writeKeyFile(t, newKey))
+			rotated, err := LoadJWTService()
+			if err != nil {
+				t.Fatalf("LoadJWTService() after rotation failed: %v", err)
+			}
+			if _, err := rotated.ValidateAccessToken(pair.AccessToken); err != nil {
+				t.Errorf("Expected a token of the previous key to stay valid: %v", err)
+			}
+			if jwks := rotated.JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].Kid == tokenKeyID(t, pair.AccessToken) {
+				t.Errorf("Expected the current key first and the previous key in the JWKS, got %+v", jwks)
+			}
+		})
+	}
+}
+
+// jwkPublicKey converts a JWK back to a public key
+func jwkPublicKey(t *testing.T, jwk models.JWK) crypto.PublicKey {
+	t.Helper()
+	decode := func(value string) []byte {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			t.Fatalf("Invalid base64url %q: %v", value, err)
+		}
+		return data
+	}
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("Unexpected key type %q", jwk.Kty)
+	return nil
+}
+
+func TestLoadJWTService_InvalidConfiguration(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		alg     string
+		keyFile string
+		wantErr string
+	}{
+		{"unknown algorithm", "none", "", "unsupported JWT_SIGNING_ALG"},
+		{"missing key file", SigningAlgRS256, "", "JWT_PRIVATE_KEY_FILE is required"},
+		{"algorithm does not match key", SigningAlgRS256, writeKeyFile(t, edKey), "holds a key for EdDSA"},
+		{"RSA key too small", SigningAlgRS256, writeKeyFile(t, smallRSA), "at least 2048 bits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SIGNING_ALG", tt.alg)
+			t.Setenv("JWT_PRIVATE_KEY_FILE", tt.keyFile)
+			if _, err := LoadJWTService(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadJWTService() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example of RFC 7638 section 3.1
+	jwk := models.JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		t.Fatalf("jwkThumbprint() failed: %v", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("jwkThumbprint() = %q", thumbprint)
+	}
+}
+
+func TestCheckProductionSecrets(t *testing.T) {
+	t.Setenv("JWT_SIGNING_ALG", "")
+	t.Setenv("JWT_ACCESS_SECRET", "")
+	t.Setenv("JWT_REFRESH_SECRET", defaultRefreshSecret)
+	t.Setenv("PARTICIPANT_TOKEN_SECRET", "participant-secret")
+
+	t.Setenv("GIN_MODE", "debug")
+	if err := CheckProductionSecrets(); err != nil {
+		t.Errorf("Expected default secrets to be allowed outside production, got %v", err)
+	}
+
+	t.Setenv("GIN_MODE", "release")
+	err := CheckProductionSecrets()
+	if err == nil || !strings.Contains(err.Error(), "JWT_ACCESS_SECRET") || !strings.Contains(err.Error(), "JWT_REFRESH_SECRET") ||
+		strings.Contains(err.Error(), "PARTICIPANT_TOKEN_SECRET") {
+		t.Errorf("Expected the unset and default secrets to be reported, got %v", err)
+	}
+
+	// Access tokens signed with a private key do not need JWT_ACCESS_SECRET
+	t.Setenv("JWT_SIGNING_ALG", SigningAlgEdDSA)
+	t.Setenv("JWT_REFRESH_SECRET", "refresh-secret")
+	if err := CheckProductionSecrets(); err != nil {
+		t.Errorf("Expected configured secrets to be accepted, got %v", err)
+	}
+
+	// A default secret must not be kept as a retired secret either
+	t.Setenv("JWT_REFRESH_PREVIOUS_SECRETS", "old-refresh-secret,"+defaultRefreshSecret)
+	err = CheckProductionSecrets()
+	if err == nil || !strings.Contains(err.Error(), "JWT_REFRESH_PREVIOUS_SECRETS") || strings.Contains(err.Error(), "JWT_ACCESS_PREVIOUS_SECRETS") {
+		t.Errorf("Expected the default retired secret to be reported, got %v", err)
+	}
+	t.Setenv("JWT_REFRESH_PREVIOUS_SECRETS", "old-refresh-secret")
+	if err := CheckProductionSecrets(); err != nil {
+		t.Errorf("Expected configured retired secrets to be accepted, got %v", err)
+	}
+}
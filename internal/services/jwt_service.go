@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Tattsum/quiz/internal/models"
@@ -22,24 +25,92 @@ var (
 	ErrInvalidTokenType = errors.New("invalid token type")
 )
 
+// Default secrets used when none are configured. CheckProductionSecrets refuses to start
+// the server in production mode with these.
+const (
+	defaultAccessSecret      = "default_access_secret_key_change_in_production"
+	defaultRefreshSecret     = "default_refresh_secret_key_change_in_production"
+	defaultParticipantSecret = "default_participant_secret_key_change_in_production"
+)
+
+// Signing algorithms of admin access tokens (JWT_SIGNING_ALG)
+const (
+	SigningAlgHS256 = "HS256"
+	SigningAlgRS256 = "RS256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+// Types of the short-lived tokens that carry a login from the password to the second step
+const (
+	// TwoFactorChallengeType tokens are exchanged for tokens with a one-time or recovery code
+	TwoFactorChallengeType = "2fa"
+	// TwoFactorSetupType tokens let an administrator who must use two-factor authentication
+	// set it up before signing in
+	TwoFactorSetupType = "2fa_setup"
+)
+
+// twoFactorChallengeExpiry is how long the second login step can be completed
+const twoFactorChallengeExpiry = 5 * time.Minute
+
 // JWTService provides JWT token generation and validation functionality
 type JWTService struct {
-	accessSecretKey   string
-	refreshSecretKey  string
+	accessKeys        *KeySet
+	refreshKeys       *KeySet
 	accessExpiryTime  time.Duration
 	refreshExpiryTime time.Duration
 }
 
-// NewJWTService creates a new JWT service instance with configuration from environment variables
+// asymmetricKeys caches the access token keys loaded from files, so that services created
+// per request do not read the key files again
+var asymmetricKeys struct {
+	mu     sync.Mutex
+	config string
+	keys   *KeySet
+}
+
+// NewJWTService creates a new JWT service instance with configuration from environment variables.
+// It panics if the configured key files cannot be loaded. The server builds its service once
+// at startup with LoadJWTService, which reports the error instead.
 func NewJWTService() *JWTService {
+	service, err := LoadJWTService()
+	if err != nil {
+		panic(err)
+	}
+	return service
+}
+
+// LoadJWTService creates a new JWT service from environment variables.
+//
+// Refresh tokens are signed with HS256 and JWT_REFRESH_SECRET. Access tokens are signed with
+// HS256 and JWT_ACCESS_SECRET, or with JWT_PRIVATE_KEY_FILE when JWT_SIGNING_ALG is RS256 or
+// EdDSA. Retired secrets (JWT_ACCESS_PREVIOUS_SECRETS, JWT_REFRESH_PREVIOUS_SECRETS) and key
+// files (JWT_PREVIOUS_KEY_FILES) still verify the tokens they signed.
+func LoadJWTService() (*JWTService, error) {
 	accessSecret := os.Getenv("JWT_ACCESS_SECRET")
 	if accessSecret == "" {
-		accessSecret = "default_access_secret_key_change_in_production"
+		accessSecret = defaultAccessSecret
 	}
 
 	refreshSecret := os.Getenv("JWT_REFRESH_SECRET")
 	if refreshSecret == "" {
-		refreshSecret = "default_refresh_secret_key_change_in_production"
+		refreshSecret = defaultRefreshSecret
+	}
+
+	var accessKeys *KeySet
+	switch alg := os.Getenv("JWT_SIGNING_ALG"); alg {
+	case "", SigningAlgHS256:
+		accessKeys = NewHMACKeySet(accessSecret, splitList(os.Getenv("JWT_ACCESS_PREVIOUS_SECRETS"))...)
+	case SigningAlgRS256, SigningAlgEdDSA:
+		keys, err := loadAsymmetricKeys(os.Getenv("JWT_PRIVATE_KEY_FILE"), splitList(os.Getenv("JWT_PREVIOUS_KEY_FILES")))
+		if err != nil {
+			return nil, err
+		}
+		if keys.Algorithm() != alg {
+			return nil, fmt.Errorf("JWT_SIGNING_ALG is %s but JWT_PRIVATE_KEY_FILE holds a key for %s", alg, keys.Algorithm())
+		}
+		accessKeys = keys
+	default:
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q; use HS256, RS256 or EdDSA", alg)
 	}
 
 	accessExpiryStr := os.Getenv("JWT_ACCESS_EXPIRY")
@@ -59,22 +130,115 @@ func NewJWTService() *JWTService {
 	}
 
 	return &JWTService{
-		accessSecretKey:   accessSecret,
-		refreshSecretKey:  refreshSecret,
+		accessKeys:        accessKeys,
+		refreshKeys:       NewHMACKeySet(refreshSecret, splitList(os.Getenv("JWT_REFRESH_PREVIOUS_SECRETS"))...),
 		accessExpiryTime:  accessExpiry,
 		refreshExpiryTime: refreshExpiry,
+	}, nil
+}
+
+// loadAsymmetricKeys loads the access token keys, reusing them while the configuration is unchanged
+func loadAsymmetricKeys(privateKeyFile string, previousKeyFiles []string) (*KeySet, error) {
+	if privateKeyFile == "" {
+		return nil, errors.New("JWT_PRIVATE_KEY_FILE is required for RS256 and EdDSA signing")
+	}
+
+	asymmetricKeys.mu.Lock()
+	defer asymmetricKeys.mu.Unlock()
+
+	config := privateKeyFile + "\n" + strings.Join(previousKeyFiles, "\n")
+	if asymmetricKeys.keys != nil && asymmetricKeys.config == config {
+		return asymmetricKeys.keys, nil
+	}
+	keys, err := LoadAsymmetricKeySet(privateKeyFile, previousKeyFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT signing keys: %w", err)
 	}
+	asymmetricKeys.config, asymmetricKeys.keys = config, keys
+	return keys, nil
+}
+
+// CheckProductionSecrets returns an error in production mode (GIN_MODE=release) if a token
+// secret is unset or left at its default, or a default is listed as a retired secret, since
+// anyone could then forge tokens
+func CheckProductionSecrets() error {
+	if os.Getenv("GIN_MODE") != "release" {
+		return nil
+	}
+
+	secrets := []struct{ env, defaultValue string }{
+		{"JWT_REFRESH_SECRET", defaultRefreshSecret},
+		{"PARTICIPANT_TOKEN_SECRET", defaultParticipantSecret},
+	}
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg == "" || alg == SigningAlgHS256 {
+		secrets = append(secrets, struct{ env, defaultValue string }{"JWT_ACCESS_SECRET", defaultAccessSecret})
+	}
+
+	var unset []string
+	for _, secret := range secrets {
+		if value := os.Getenv(secret.env); value == "" || value == secret.defaultValue {
+			unset = append(unset, secret.env)
+		}
+	}
+	if len(unset) > 0 {
+		return fmt.Errorf("refusing to start in production mode with default secrets; set %s", strings.Join(unset, ", "))
+	}
+
+	// A default secret kept as a retired secret would still verify forged tokens
+	previous := []struct{ env, defaultValue string }{
+		{"JWT_ACCESS_PREVIOUS_SECRETS", defaultAccessSecret},
+		{"JWT_REFRESH_PREVIOUS_SECRETS", defaultRefreshSecret},
+	}
+	var retired []string
+	for _, secrets := range previous {
+		for _, value := range splitList(os.Getenv(secrets.env)) {
+			if value == secrets.defaultValue {
+				retired = append(retired, secrets.env)
+				break
+			}
+		}
+	}
+	if len(retired) > 0 {
+		return fmt.Errorf("refusing to start in production mode with default secrets; remove them from %s", strings.Join(retired, ", "))
+	}
+	return nil
+}
+
+// JWKS returns the public keys that verify access tokens. It is empty with HS256 signing.
+func (j *JWTService) JWKS() models.JWKSet {
+	return j.accessKeys.JWKS()
 }
 
-// GenerateTokenPair generates access and refresh token pair for an administrator
-func (j *JWTService) GenerateTokenPair(admin *models.Administrator) (*models.LoginResponse, error) {
+// TokenPairIDs identifies the two tokens of a generated pair
+type TokenPairIDs struct {
+	AccessID         string
+	AccessExpiresAt  time.Time
+	RefreshID        string
+	RefreshExpiresAt time.Time
+}
+
+// GenerateTokenPairWithIDs generates a token pair and also returns the token IDs (jti)
+// and expiry times, for recording the pair server-side. Sign-ins and refreshes go through
+// SessionService, which records every pair in a refresh token family.
+func (j *JWTService) GenerateTokenPairWithIDs(admin *models.Administrator) (*models.LoginResponse, *TokenPairIDs, error) {
 	now := time.Now()
 	accessExpiresAt := now.Add(j.accessExpiryTime)
 	refreshExpiresAt := now.Add(j.refreshExpiryTime)
 
+	// Each token gets a unique ID (jti) so that it can be revoked individually
+	accessTokenID, err := j.GenerateSecureRandomString(16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate token id: %w", err)
+	}
+	refreshTokenID, err := j.GenerateSecureRandomString(16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate token id: %w", err)
+	}
+
 	accessClaims := &models.JWTClaims{
 		AdminID:  admin.ID,
 		Username: admin.Username,
+		Role:     admin.Role,
 		Type:     "access",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
@@ -82,12 +246,14 @@ func (j *JWTService) GenerateTokenPair(admin *models.Administrator) (*models.Log
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "quiz-app",
 			Subject:   fmt.Sprintf("admin:%d", admin.ID),
+			ID:        accessTokenID,
 		},
 	}
 
 	refreshClaims := &models.JWTClaims{
 		AdminID:  admin.ID,
 		Username: admin.Username,
+		Role:     admin.Role,
 		Type:     "refresh",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(refreshExpiresAt),
@@ -95,19 +261,18 @@ func (j *JWTService) GenerateTokenPair(admin *models.Administrator) (*models.Log
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "quiz-app",
 			Subject:   fmt.Sprintf("admin:%d", admin.ID),
+			ID:        refreshTokenID,
 		},
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(j.accessSecretKey))
+	accessTokenString, err := j.accessKeys.Sign(accessClaims)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign access token: %w", err)
+		return nil, nil, fmt.Errorf("failed to sign access token: %w", err)
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(j.refreshSecretKey))
+	refreshTokenString, err := j.refreshKeys.Sign(refreshClaims)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
+		return nil, nil, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
 
 	adminCopy := *admin
@@ -118,66 +283,85 @@ func (j *JWTService) GenerateTokenPair(admin *models.Administrator) (*models.Log
 		RefreshToken: refreshTokenString,
 		ExpiresAt:    accessExpiresAt,
 		Admin:        adminCopy,
+	}, &TokenPairIDs{
+		AccessID:         accessTokenID,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshID:        refreshTokenID,
+		RefreshExpiresAt: refreshExpiresAt,
 	}, nil
 }
 
 // ValidateAccessToken validates an access token and returns its claims
 func (j *JWTService) ValidateAccessToken(tokenString string) (*models.JWTClaims, error) {
-	return j.validateToken(tokenString, j.accessSecretKey, "access")
+	return j.validateToken(tokenString, j.accessKeys, "access")
 }
 
 // ValidateRefreshToken validates a refresh token and returns its claims
 func (j *JWTService) ValidateRefreshToken(tokenString string) (*models.JWTClaims, error) {
-	return j.validateToken(tokenString, j.refreshSecretKey, "refresh")
+	return j.validateToken(tokenString, j.refreshKeys, "refresh")
 }
 
-func (j *JWTService) validateToken(tokenString, secretKey, expectedType string) (*models.JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secretKey), nil
-	})
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
+// GenerateTwoFactorChallenge issues the token that completes a login after the password was
+// verified. With setup, the administrator must set up two-factor authentication first.
+// Challenges are signed with the refresh keys, which are never published or shared.
+func (j *JWTService) GenerateTwoFactorChallenge(admin *models.Administrator, setup bool) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(twoFactorChallengeExpiry)
+	tokenType := TwoFactorChallengeType
+	if setup {
+		tokenType = TwoFactorSetupType
 	}
 
-	claims, ok := token.Claims.(*models.JWTClaims)
-	if !ok || !token.Valid {
-		return nil, ErrInvalidToken
+	challengeID, err := j.GenerateSecureRandomString(16)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate token id: %w", err)
+	}
+	claims := &models.JWTClaims{
+		AdminID:  admin.ID,
+		Username: admin.Username,
+		Role:     admin.Role,
+		Type:     tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "quiz-app",
+			Subject:   fmt.Sprintf("admin:%d", admin.ID),
+			ID:        challengeID,
+		},
 	}
 
-	if claims.Type != expectedType {
-		return nil, ErrInvalidTokenType
+	token, err := j.refreshKeys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign challenge token: %w", err)
 	}
+	return token, expiresAt, nil
+}
 
-	return claims, nil
+// ValidateTwoFactorChallenge validates a challenge or setup token and returns its claims
+func (j *JWTService) ValidateTwoFactorChallenge(tokenString string) (*models.JWTClaims, error) {
+	return j.validateToken(tokenString, j.refreshKeys, TwoFactorChallengeType, TwoFactorSetupType)
 }
 
-// RefreshTokens generates new token pair using a valid refresh token
-func (j *JWTService) RefreshTokens(refreshTokenString string, admin *models.Administrator) (*models.RefreshTokenResponse, error) {
-	claims, err := j.ValidateRefreshToken(refreshTokenString)
+func (j *JWTService) validateToken(tokenString string, keys *KeySet, expectedTypes ...string) (*models.JWTClaims, error) {
+	token, err := keys.Parse(tokenString, &models.JWTClaims{})
 	if err != nil {
-		return nil, err
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
 	}
 
-	if claims.AdminID != admin.ID {
+	claims, ok := token.Claims.(*models.JWTClaims)
+	if !ok || !token.Valid {
 		return nil, ErrInvalidToken
 	}
 
-	response, err := j.GenerateTokenPair(admin)
-	if err != nil {
-		return nil, err
+	if !slices.Contains(expectedTypes, claims.Type) {
+		return nil, ErrInvalidTokenType
 	}
 
-	return &models.RefreshTokenResponse{
-		AccessToken:  response.AccessToken,
-		RefreshToken: response.RefreshToken,
-		ExpiresAt:    response.ExpiresAt,
-	}, nil
+	return claims, nil
 }
 
 // GenerateSecureRandomString generates a cryptographically secure random string
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -8,7 +9,7 @@ import (
 	"github.com/Tattsum/quiz/internal/models"
 )
 
-func TestJWTService_GenerateTokenPair(t *testing.T) {
+func TestJWTService_GenerateTokenPairWithIDs(t *testing.T) {
 	// Set test environment variables
 	os.Setenv("JWT_ACCESS_SECRET", "test_access_secret")
 	os.Setenv("JWT_REFRESH_SECRET", "test_refresh_secret")
@@ -23,7 +24,7 @@ func TestJWTService_GenerateTokenPair(t *testing.T) {
 		Email:    "test@example.com",
 	}
 
-	response, err := jwtService.GenerateTokenPair(admin)
+	response, _, err := jwtService.GenerateTokenPairWithIDs(admin)
 	if err != nil {
 		t.Fatalf("Failed to generate token pair: %v", err)
 	}
@@ -59,9 +60,10 @@ func TestJWTService_ValidateAccessToken(t *testing.T) {
 		ID:       1,
 		Username: "testadmin",
 		Email:    "test@example.com",
+		Role:     models.AdminRoleHost,
 	}
 
-	response, err := jwtService.GenerateTokenPair(admin)
+	response, _, err := jwtService.GenerateTokenPairWithIDs(admin)
 	if err != nil {
 		t.Fatalf("Failed to generate token pair: %v", err)
 	}
@@ -80,10 +82,23 @@ func TestJWTService_ValidateAccessToken(t *testing.T) {
 		t.Error("Username in claims should match")
 	}
 
+	if claims.Role != models.AdminRoleHost {
+		t.Errorf("Role in claims should be %q, got %q", models.AdminRoleHost, claims.Role)
+	}
+
 	if claims.Type != "access" {
 		t.Error("Token type should be 'access'")
 	}
 
+	// Each token has its own ID so that it can be revoked individually
+	refreshClaims, err := jwtService.ValidateRefreshToken(response.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to validate refresh token: %v", err)
+	}
+	if claims.ID == "" || refreshClaims.ID == "" || claims.ID == refreshClaims.ID {
+		t.Errorf("Expected distinct token IDs, got %q and %q", claims.ID, refreshClaims.ID)
+	}
+
 	// Test invalid token
 	_, err = jwtService.ValidateAccessToken("invalid_token")
 	if err == nil {
@@ -109,7 +124,7 @@ func TestJWTService_ValidateRefreshToken(t *testing.T) {
 		Email:    "test@example.com",
 	}
 
-	response, err := jwtService.GenerateTokenPair(admin)
+	response, _, err := jwtService.GenerateTokenPairWithIDs(admin)
 	if err != nil {
 		t.Fatalf("Failed to generate token pair: %v", err)
 	}
@@ -135,58 +150,49 @@ func TestJWTService_ValidateRefreshToken(t *testing.T) {
 	}
 }
 
-func TestJWTService_RefreshTokens(t *testing.T) {
+func TestJWTService_TwoFactorChallenge(t *testing.T) {
 	os.Setenv("JWT_ACCESS_SECRET", "test_access_secret")
 	os.Setenv("JWT_REFRESH_SECRET", "test_refresh_secret")
 
 	jwtService := NewJWTService()
+	admin := &models.Administrator{ID: 1, Username: "testadmin", Role: models.AdminRoleOwner}
 
-	admin := &models.Administrator{
-		ID:       1,
-		Username: "testadmin",
-		Email:    "test@example.com",
-	}
-
-	// Generate initial token pair
-	initialResponse, err := jwtService.GenerateTokenPair(admin)
-	if err != nil {
-		t.Fatalf("Failed to generate initial token pair: %v", err)
-	}
-
-	// Wait a moment to ensure new tokens have different issued time
-	time.Sleep(1 * time.Second)
-
-	// Refresh tokens
-	refreshResponse, err := jwtService.RefreshTokens(initialResponse.RefreshToken, admin)
-	if err != nil {
-		t.Fatalf("Failed to refresh tokens: %v", err)
-	}
-
-	if refreshResponse.AccessToken == "" {
-		t.Error("New access token should not be empty")
-	}
-
-	if refreshResponse.RefreshToken == "" {
-		t.Error("New refresh token should not be empty")
-	}
+	for _, setup := range []bool{false, true} {
+		token, expiresAt, err := jwtService.GenerateTwoFactorChallenge(admin, setup)
+		if err != nil {
+			t.Fatalf("GenerateTwoFactorChallenge() failed: %v", err)
+		}
+		if time.Until(expiresAt) > twoFactorChallengeExpiry {
+			t.Errorf("Expected the challenge to expire within %v, got %v", twoFactorChallengeExpiry, expiresAt)
+		}
 
-	if refreshResponse.AccessToken == initialResponse.AccessToken {
-		t.Error("New access token should be different from original")
-	}
+		claims, err := jwtService.ValidateTwoFactorChallenge(token)
+		if err != nil {
+			t.Fatalf("ValidateTwoFactorChallenge() failed: %v", err)
+		}
+		wantType := TwoFactorChallengeType
+		if setup {
+			wantType = TwoFactorSetupType
+		}
+		if claims.Type != wantType || claims.AdminID != admin.ID {
+			t.Errorf("Unexpected claims %+v", claims)
+		}
 
-	if refreshResponse.RefreshToken == initialResponse.RefreshToken {
-		t.Error("New refresh token should be different from original")
+		// A challenge grants no access until the second step is completed
+		if _, err := jwtService.ValidateAccessToken(token); err == nil {
+			t.Error("Expected a challenge token to be rejected as an access token")
+		}
+		if _, err := jwtService.ValidateRefreshToken(token); !errors.Is(err, ErrInvalidTokenType) {
+			t.Errorf("Expected a challenge token to be rejected as a refresh token, got %v", err)
+		}
 	}
 
-	// Validate new tokens
-	_, err = jwtService.ValidateAccessToken(refreshResponse.AccessToken)
+	response, _, err := jwtService.GenerateTokenPairWithIDs(admin)
 	if err != nil {
-		t.Error("New access token should be valid")
+		t.Fatalf("Failed to generate token pair: %v", err)
 	}
-
-	_, err = jwtService.ValidateRefreshToken(refreshResponse.RefreshToken)
-	if err != nil {
-		t.Error("New refresh token should be valid")
+	if _, err := jwtService.ValidateTwoFactorChallenge(response.RefreshToken); !errors.Is(err, ErrInvalidTokenType) {
+		t.Errorf("Expected a refresh token to be rejected as a challenge, got %v", err)
 	}
 }
 
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+// Defaults of the login lockout policy
+const (
+	// DefaultLoginMaxFailuresPerUser is how many failed attempts on one username are allowed before it is locked
+	DefaultLoginMaxFailuresPerUser = 5
+	// DefaultLoginMaxFailuresPerIP is how many failed attempts from one IP address are allowed before it is locked
+	DefaultLoginMaxFailuresPerIP = 20
+	// DefaultRecoveryPINMaxFailures is how many wrong recovery PINs for one participant are allowed before it is locked
+	DefaultRecoveryPINMaxFailures = 5
+	// DefaultLoginLockout is the first lockout; each further failure doubles it
+	DefaultLoginLockout = 30 * time.Second
+	// DefaultLoginMaxLockout caps the lockout
+	DefaultLoginMaxLockout = time.Hour
+	// loginFailureWindow is how long failures are remembered after the last failure or lockout
+	loginFailureWindow = 15 * time.Minute
+)
+
+// Scopes of login_throttle rows
+const (
+	loginScopeUser = "user"
+	loginScopeIP   = "ip"
+	loginScopePIN  = "pin" // participant recovery PIN; the key is the participant ID
+)
+
+// Reasons recorded in login_events
+const (
+	LoginReasonPassword             = "password"   // signed in with a password
+	LoginReasonTwoFactor            = "two_factor" // signed in with a password and a one-time or recovery code
+	LoginReasonOIDC                 = "oidc"       // signed in through the OpenID Connect provider
+	LoginReasonInvalidCredentials   = "invalid_credentials"
+	LoginReasonInvalidTwoFactorCode = "invalid_two_factor_code"
+	LoginReasonAdminDisabled        = "admin_disabled"
+	LoginReasonLockedOut            = "locked_out"
+	LoginReasonOIDCRejected         = "oidc_rejected" // the provider's identity is not allowed to sign in
+)
+
+// Lengths of the login_events text columns
+const (
+	maxLoginEventUsername  = 100
+	maxLoginEventUserAgent = 255
+)
+
+// LoginGuard protects administrator logins against password guessing. Failed attempts are
+// counted per username and per IP address; once a count reaches its limit, further attempts
+// are refused for a lockout that doubles with every additional failure. State is kept in the
+// database so that every replica enforces the same lockouts. Every attempt is recorded in
+// login_events.
+type LoginGuard struct {
+	db                 *sql.DB
+	maxFailuresPerUser int
+	maxFailuresPerIP   int
+	maxPINFailures     int
+	lockout            time.Duration
+	maxLockout         time.Duration
+	now                func() time.Time
+}
+
+// LoginEventFilter selects login events. Zero values match every event.
+type LoginEventFilter struct {
+	AdminID   int64
+	Username  string
+	IPAddress string
+	Success   *bool
+	From      *time.Time
+	To        *time.Time
+}
+
+// NewLoginGuard creates a new login guard.
+// LOGIN_MAX_FAILURES_PER_USER and LOGIN_MAX_FAILURES_PER_IP set the failures allowed before a
+// lockout, LOGIN_LOCKOUT_SECONDS the first lockout and LOGIN_MAX_LOCKOUT_MINUTES its cap.
+func NewLoginGuard() *LoginGuard {
+	positive := func(name string, fallback int) int {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+			return value
+		}
+		return fallback
+	}
+
+	return &LoginGuard{
+		db:                 database.GetDB(),
+		maxFailuresPerUser: positive("LOGIN_MAX_FAILURES_PER_USER", DefaultLoginMaxFailuresPerUser),
+		maxFailuresPerIP:   positive("LOGIN_MAX_FAILURES_PER_IP", DefaultLoginMaxFailuresPerIP),
+		maxPINFailures:     positive("RECOVERY_PIN_MAX_FAILURES", DefaultRecoveryPINMaxFailures),
+		lockout:            time.Duration(positive("LOGIN_LOCKOUT_SECONDS", int(DefaultLoginLockout/time.Second))) * time.Second,
+		maxLockout:         time.Duration(positive("LOGIN_MAX_LOCKOUT_MINUTES", int(DefaultLoginMaxLockout/time.Minute))) * time.Minute,
+		now:                time.Now,
+	}
+}
+
+// Check returns how long a login for username from ip must wait, or zero if it may proceed.
+// It is called before the password is checked, so that locked attempts cost no bcrypt work.
+func (g *LoginGuard) Check(username, ip string) (time.Duration, error) {
+	if g.db == nil {
+		return 0, errors.New("database connection not initialized")
+	}
+
+	now := g.now().UTC()
+	var lockedUntil sql.NullTime
+	err := g.db.QueryRow(`SELECT MAX(locked_until) FROM login_throttle
+						  WHERE ((scope = $1 AND key = $2) OR (scope = $3 AND key = $4)) AND locked_until > $5`,
+		loginScopeUser, username, loginScopeIP, ip, now).Scan(&lockedUntil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login lockout: %w", err)
+	}
+	if !lockedUntil.Valid {
+		return 0, nil
+	}
+	return lockedUntil.Time.Sub(now), nil
+}
+
+// throttleTarget is a login_throttle row that counts failures
+type throttleTarget struct {
+	scope       string
+	key         string
+	maxFailures int
+}
+
+// RecordFailure counts a failed attempt for username and ip and returns the resulting lockout,
+// or zero if neither is locked yet
+func (g *LoginGuard) RecordFailure(username, ip string) (time.Duration, error) {
+	return g.recordFailures(
+		throttleTarget{loginScopeUser, username, g.maxFailuresPerUser},
+		throttleTarget{loginScopeIP, ip, g.maxFailuresPerIP},
+	)
+}
+
+// recordFailures counts a failed attempt for every target and returns the longest resulting
+// lockout, or zero if none is locked yet
+func (g *LoginGuard) recordFailures(targets ...throttleTarget) (time.Duration, error) {
+	if g.db == nil {
+		return 0, errors.New("database connection not initialized")
+	}
+
+	tx, err := g.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	now := g.now().UTC()
+	forgetBefore := now.Add(-loginFailureWindow)
+
+	// Forget failures that are no longer relevant, so that the table stays small
+	_, err = tx.Exec(`DELETE FROM login_throttle
+					  WHERE GREATEST(last_failure_at, COALESCE(locked_until, last_failure_at)) < $1`, forgetBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old login failures: %w", err)
+	}
+
+	var lockout time.Duration
+	for _, target := range targets {
+		var failures int
+		err := tx.QueryRow(`INSERT INTO login_throttle (scope, key, failures, last_failure_at)
+							VALUES ($1, $2, 1, $3)
+							ON CONFLICT (scope, key) DO UPDATE
+							SET failures = login_throttle.failures + 1, last_failure_at = EXCLUDED.last_failure_at
+							RETURNING failures`, target.scope, target.key, now).Scan(&failures)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record login failure: %w", err)
+		}
+
+		duration := g.lockoutAfter(failures, target.maxFailures)
+		if duration == 0 {
+			continue
+		}
+		_, err = tx.Exec("UPDATE login_throttle SET locked_until = $3 WHERE scope = $1 AND key = $2",
+			target.scope, target.key, now.Add(duration))
+		if err != nil {
+			return 0, fmt.Errorf("failed to lock login: %w", err)
+		}
+		lockout = max(lockout, duration)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return lockout, nil
+}
+
+// RecordSuccess clears the failures of a username after a successful login. Failures of the
+// IP address are kept, so that an attacker cannot reset them with an account of their own.
+func (g *LoginGuard) RecordSuccess(username string) error {
+	return g.Unlock(username)
+}
+
+// Unlock clears the failures and lockout of a username
+func (g *LoginGuard) Unlock(username string) error {
+	if g.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	if _, err := g.db.Exec("DELETE FROM login_throttle WHERE scope = $1 AND key = $2", loginScopeUser, username); err != nil {
+		return fmt.Errorf("failed to unlock login: %w", err)
+	}
+	return nil
+}
+
+// RecordEvent records a login attempt. The administrator is looked up by username if
+// event.AdminID is not set.
+func (g *LoginGuard) RecordEvent(event models.LoginEvent) error {
+	if g.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	_, err := g.db.Exec(`INSERT INTO login_events (admin_id, username, success, reason, ip_address, user_agent)
+						 VALUES (COALESCE($1, (SELECT id FROM administrators WHERE username = $2)), $2, $3, $4, $5, $6)`,
+		event.AdminID, truncateText(event.Username, maxLoginEventUsername), event.Success, event.Reason,
+		event.IPAddress, truncateText(event.UserAgent, maxLoginEventUserAgent))
+	if err != nil {
+		return fmt.Errorf("failed to record login event: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns login events matching filter, newest first, and the number of matching events
+func (g *LoginGuard) ListEvents(filter LoginEventFilter, page, limit int) ([]models.LoginEvent, int, error) {
+	if g.db == nil {
+		return nil, 0, errors.New("database connection not initialized")
+	}
+
+	var conditions queryFilter
+	conditions.id("admin_id", filter.AdminID)
+	conditions.text("username", filter.Username)
+	conditions.text("ip_address", filter.IPAddress)
+	conditions.bool("success", filter.Success)
+	conditions.timeRange("created_at", filter.From, filter.To)
+	where, args := conditions.where()
+
+	var total int
+	if err := g.db.QueryRow("SELECT COUNT(*) FROM login_events "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count login events: %w", err)
+	}
+
+	pageLimit, pageArgs := pageClause(args, page, limit)
+	rows, err := g.db.Query(`SELECT id, admin_id, username, success, reason, ip_address, user_agent, created_at
+							 FROM login_events `+where+`
+							 ORDER BY created_at DESC, id DESC `+pageLimit, pageArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query login events: %w", err)
+	}
+	defer func() {
+		_ = rows.Close() // Ignore close error in defer
+	}()
+
+	events := []models.LoginEvent{}
+	for rows.Next() {
+		var event models.LoginEvent
+		err := rows.Scan(&event.ID, &event.AdminID, &event.Username, &event.Success, &event.Reason,
+			&event.IPAddress, &event.UserAgent, &event.CreatedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan login event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// CheckRecoveryPIN returns how long a participant's recovery PIN must wait before it is checked
+// again, or zero if it may be checked. It is called before the PIN is compared, so that locked
+// attempts cost no bcrypt work.
+func (g *LoginGuard) CheckRecoveryPIN(participantID int64) (time.Duration, error) {
+	if g.db == nil {
+		return 0, errors.New("database connection not initialized")
+	}
+
+	now := g.now().UTC()
+	var lockedUntil sql.NullTime
+	err := g.db.QueryRow(`SELECT locked_until FROM login_throttle
+						  WHERE scope = $1 AND key = $2 AND locked_until > $3`,
+		loginScopePIN, strconv.FormatInt(participantID, 10), now).Scan(&lockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to check recovery PIN lockout: %w", err)
+	}
+	if !lockedUntil.Valid {
+		return 0, nil
+	}
+	return lockedUntil.Time.Sub(now), nil
+}
+
+// RecordRecoveryPINFailure counts a wrong recovery PIN for a participant and returns the
+// resulting lockout, or zero if the participant is not locked yet. Failures are counted per
+// participant, so that guessing from many IP addresses is limited as well.
+func (g *LoginGuard) RecordRecoveryPINFailure(participantID int64) (time.Duration, error) {
+	return g.recordFailures(throttleTarget{loginScopePIN, strconv.FormatInt(participantID, 10), g.maxPINFailures})
+}
+
+// ClearRecoveryPINFailures clears the failures of a participant who recovered with their PIN
+func (g *LoginGuard) ClearRecoveryPINFailures(participantID int64) error {
+	if g.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	_, err := g.db.Exec("DELETE FROM login_throttle WHERE scope = $1 AND key = $2", loginScopePIN, strconv.FormatInt(participantID, 10))
+	if err != nil {
+		return fmt.Errorf("failed to clear recovery PIN failures: %w", err)
+	}
+	return nil
+}
+
+// lockoutAfter returns the lockout after a number of consecutive failures: none below
+// maxFailures, then the base lockout doubling with every further failure up to the cap
+func (g *LoginGuard) lockoutAfter(failures, maxFailures int) time.Duration {
+	if failures < maxFailures {
+		return 0
+	}
+	lockout := g.lockout
+	for i := maxFailures; i < failures && lockout < g.maxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, g.maxLockout)
+}
+
+// truncateText shortens s to at most n bytes without splitting a UTF-8 character
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+func TestLoginGuard_LockoutAfter(t *testing.T) {
+	guard := &LoginGuard{lockout: 30 * time.Second, maxLockout: 5 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{8, 4 * time.Minute},
+		{9, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := guard.lockoutAfter(tt.failures, 5); got != tt.want {
+			t.Errorf("lockoutAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestNewLoginGuard_Configuration(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES_PER_USER", "3")
+	t.Setenv("LOGIN_MAX_FAILURES_PER_IP", "invalid")
+	t.Setenv("LOGIN_LOCKOUT_SECONDS", "10")
+	t.Setenv("LOGIN_MAX_LOCKOUT_MINUTES", "-1")
+
+	guard := NewLoginGuard()
+	if guard.maxFailuresPerUser != 3 || guard.lockout != 10*time.Second {
+		t.Errorf("Expected the configured values, got %+v", guard)
+	}
+	if guard.maxFailuresPerIP != DefaultLoginMaxFailuresPerIP || guard.maxLockout != DefaultLoginMaxLockout {
+		t.Errorf("Expected invalid values to fall back to the defaults, got %+v", guard)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("agent", 10); got != "agent" {
+		t.Errorf("truncateText() = %q", got)
+	}
+	// "クイズ" is 9 bytes; cutting at 4 bytes must not split the second character
+	if got := truncateText("クイズ", 4); got != "ク" {
+		t.Errorf("truncateText() = %q, want %q", got, "ク")
+	}
+}
+
+func TestLoginGuard(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	suffix := os.Getpid()
+	username := fmt.Sprintf("guard%d", suffix)
+	ip := fmt.Sprintf("192.0.2.%d", suffix%250)
+	defer func() {
+		_, _ = db.Exec("DELETE FROM login_throttle WHERE key IN ($1, $2)", username, ip)
+		_, _ = db.Exec("DELETE FROM login_events WHERE username = $1", username)
+	}()
+
+	// 時刻を固定して、ロックの期限を制御する（データベースの精度に合わせて秒単位）
+	now := time.Now().Truncate(time.Second)
+	guard := &LoginGuard{db: db, maxFailuresPerUser: 3, maxFailuresPerIP: 10, lockout: time.Minute, maxLockout: time.Hour,
+		now: func() time.Time { return now }}
+
+	// 上限に達するまではロックしない
+	for i := 1; i < 3; i++ {
+		if lockout, err := guard.RecordFailure(username, ip); err != nil || lockout != 0 {
+			t.Fatalf("RecordFailure() #%d = %v, %v; want no lockout", i, lockout, err)
+		}
+	}
+	if wait, err := guard.Check(username, ip); err != nil || wait != 0 {
+		t.Fatalf("Check() = %v, %v; want no lockout", wait, err)
+	}
+
+	// 上限に達するとロックし、別のIPアドレスからでも同じユーザー名はロックされる
+	if lockout, err := guard.RecordFailure(username, ip); err != nil || lockout != time.Minute {
+		t.Fatalf("RecordFailure() = %v, %v; want a one minute lockout", lockout, err)
+	}
+	if wait, _ := guard.Check(username, "198.51.100.1"); wait != time.Minute {
+		t.Errorf("Check() from another address = %v, want 1m", wait)
+	}
+
+	// ロックが切れた後の失敗でロックは2倍になる
+	now = now.Add(time.Minute)
+	if wait, _ := guard.Check(username, ip); wait != 0 {
+		t.Errorf("Check() after the lockout = %v, want 0", wait)
+	}
+	if lockout, err := guard.RecordFailure(username, ip); err != nil || lockout != 2*time.Minute {
+		t.Errorf("RecordFailure() = %v, %v; want a two minute lockout", lockout, err)
+	}
+
+	// 成功するとユーザー名の失敗回数は消えるが、IPアドレスの失敗回数は残る
+	if err := guard.RecordSuccess(username); err != nil {
+		t.Fatalf("RecordSuccess() failed: %v", err)
+	}
+	var failures int
+	if err := db.QueryRow("SELECT failures FROM login_throttle WHERE scope = 'ip' AND key = $1", ip).Scan(&failures); err != nil || failures != 4 {
+		t.Errorf("Expected the address to keep its 4 failures, got %d (%v)", failures, err)
+	}
+
+	// しばらく失敗がなければ失敗回数は消える
+	now = now.Add(loginFailureWindow + 3*time.Minute)
+	if _, err := guard.RecordFailure(username, ip); err != nil {
+		t.Fatalf("RecordFailure() failed: %v", err)
+	}
+	if err := db.QueryRow("SELECT failures FROM login_throttle WHERE scope = 'ip' AND key = $1", ip).Scan(&failures); err != nil || failures != 1 {
+		t.Errorf("Expected old failures to be forgotten, got %d (%v)", failures, err)
+	}
+
+	// ログインの記録と絞り込み
+	for _, success := range []bool{false, true} {
+		err := guard.RecordEvent(models.LoginEvent{Username: username, Success: success, Reason: LoginReasonPassword, IPAddress: ip, UserAgent: "test"})
+		if err != nil {
+			t.Fatalf("RecordEvent() failed: %v", err)
+		}
+	}
+	success := true
+	events, total, err := guard.ListEvents(LoginEventFilter{Username: username, Success: &success}, 1, 20)
+	if err != nil {
+		t.Fatalf("ListEvents() failed: %v", err)
+	}
+	if total != 1 || len(events) != 1 || !events[0].Success || events[0].IPAddress != ip || events[0].AdminID != nil {
+		t.Errorf("Unexpected events %+v (total %d)", events, total)
+	}
+
+	// UTC以外のオフセットで指定した期間も同じ時刻として比較する
+	tokyo := time.FixedZone("JST", 9*60*60)
+	from, to := time.Now().Add(-time.Minute).In(tokyo), time.Now().Add(time.Minute).In(tokyo)
+	if _, total, err := guard.ListEvents(LoginEventFilter{Username: username, From: &from, To: &to}, 1, 20); err != nil || total != 2 {
+		t.Errorf("ListEvents() in the last minute with a +09:00 offset = %d events (%v), want 2", total, err)
+	}
+	if _, total, err := guard.ListEvents(LoginEventFilter{Username: username, To: &from}, 1, 20); err != nil || total != 0 {
+		t.Errorf("ListEvents() before the last minute with a +09:00 offset = %d events (%v), want 0", total, err)
+	}
+}
+
+func TestLoginGuard_RecoveryPIN(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	// 存在しない参加者IDでも失敗回数は数えられる
+	participantID := int64(-os.Getpid())
+	defer func() {
+		_, _ = db.Exec("DELETE FROM login_throttle WHERE scope = 'pin' AND key = $1", fmt.Sprint(participantID))
+	}()
+
+	now := time.Now().Truncate(time.Second)
+	guard := &LoginGuard{db: db, maxPINFailures: 2, lockout: time.Minute, maxLockout: time.Hour,
+		now: func() time.Time { return now }}
+
+	// 上限に達するとその参加者の復帰PINをロックする
+	if lockout, err := guard.RecordRecoveryPINFailure(participantID); err != nil || lockout != 0 {
+		t.Fatalf("RecordRecoveryPINFailure() = %v, %v; want no lockout", lockout, err)
+	}
+	if lockout, err := guard.RecordRecoveryPINFailure(participantID); err != nil || lockout != time.Minute {
+		t.Fatalf("RecordRecoveryPINFailure() = %v, %v; want a one minute lockout", lockout, err)
+	}
+	if wait, err := guard.CheckRecoveryPIN(participantID); err != nil || wait != time.Minute {
+		t.Errorf("CheckRecoveryPIN() = %v, %v; want 1m", wait, err)
+	}
+	if wait, _ := guard.CheckRecoveryPIN(participantID - 1); wait != 0 {
+		t.Errorf("CheckRecoveryPIN() for another participant = %v, want 0", wait)
+	}
+
+	// 復帰に成功すると失敗回数は消える
+	if err := guard.ClearRecoveryPINFailures(participantID); err != nil {
+		t.Fatalf("ClearRecoveryPINFailures() failed: %v", err)
+	}
+	if wait, _ := guard.CheckRecoveryPIN(participantID); wait != 0 {
+		t.Errorf("CheckRecoveryPIN() after clearing = %v, want 0", wait)
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// ErrNicknameEmpty is returned when a nickname has no visible characters
+	ErrNicknameEmpty = errors.New("nickname is empty")
+	// ErrNicknameTooLong is returned when a normalized nickname exceeds the maximum length
+	ErrNicknameTooLong = errors.New("nickname is too long")
+	// ErrNicknameDenied is returned when a nickname matches the deny-list
+	ErrNicknameDenied = errors.New("nickname is not allowed")
+)
+
+// MaxNicknameLength is the maximum number of characters in a normalized nickname
+const MaxNicknameLength = 50
+
+// defaultNicknameDenyList blocks nicknames that impersonate the organizers.
+// Add event-specific terms with NICKNAME_DENYLIST or NICKNAME_DENYLIST_FILE.
+// Terms match anywhere in a nickname; a leading "=" matches the whole nickname only.
+var defaultNicknameDenyList = []string{"=admin", "=administrator", "=staff", "管理者", "運営", "司会"}
+
+// confusables maps characters that look alike to a single representative.
+// It covers the Latin lookalikes seen in practice rather than the full Unicode table.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'l', 'ј': 'j', 'ѕ': 's',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	// Digits and symbols
+	'0': 'o', '1': 'l', '|': 'l', '!': 'l', '3': 'e', '5': 's', '$': 's', '@': 'a',
+	// Latin
+	'i': 'l',
+}
+
+// NicknamePolicy normalizes nicknames and decides whether they may be used.
+// Every nickname has a display form, shown to users, and a key used for uniqueness
+// and deny-list checks, in which confusable characters compare equal.
+type NicknamePolicy struct {
+	denyList []denyListEntry
+}
+
+// denyListEntry is a deny-list term in key form
+type denyListEntry struct {
+	key   string
+	exact bool
+}
+
+// NewNicknamePolicy creates a nickname policy with the deny-list from environment variables.
+// NICKNAME_DENYLIST is a comma-separated list; NICKNAME_DENYLIST_FILE has one term per line.
+func NewNicknamePolicy() (*NicknamePolicy, error) {
+	terms := append([]string{}, defaultNicknameDenyList...)
+
+	if list := os.Getenv("NICKNAME_DENYLIST"); list != "" {
+		terms = append(terms, strings.Split(list, ",")...)
+	}
+
+	if path := os.Getenv("NICKNAME_DENYLIST_FILE"); path != "" {
+		fileTerms, err := readDenyListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, fileTerms...)
+	}
+
+	return NewNicknamePolicyWithDenyList(terms), nil
+}
+
+// NewNicknamePolicyWithDenyList creates a nickname policy with an explicit deny-list
+func NewNicknamePolicyWithDenyList(terms []string) *NicknamePolicy {
+	policy := &NicknamePolicy{}
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		exact := strings.HasPrefix(term, "=")
+		if key := NicknameKey(strings.TrimPrefix(term, "=")); key != "" {
+			policy.denyList = append(policy.denyList, denyListEntry{key: key, exact: exact})
+		}
+	}
+	return policy
+}
+
+// readDenyListFile reads deny-list terms, ignoring blank lines and # comments
+func readDenyListFile(path string) ([]string, error) {
+	file, err := os.Open(path) // #nosec G304 -- path comes from server configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nickname deny-list: %w", err)
+	}
+	defer func() {
+		_ = file.Close() // Ignore close error in defer
+	}()
+
+	var terms []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read nickname deny-list: %w", err)
+	}
+	return terms, nil
+}
+
+// Normalize returns the display form and key of a nickname, or an error if it may not be used
+func (p *NicknamePolicy) Normalize(nickname string) (string, string, error) {
+	display := NormalizeNickname(nickname)
+	if display == "" {
+		return "", "", ErrNicknameEmpty
+	}
+	if len([]rune(display)) > MaxNicknameLength {
+		return "", "", ErrNicknameTooLong
+	}
+
+	key := NicknameKey(display)
+	if key == "" {
+		return "", "", ErrNicknameEmpty
+	}
+	for _, denied := range p.denyList {
+		if key == denied.key || (!denied.exact && strings.Contains(key, denied.key)) {
+			return "", "", ErrNicknameDenied
+		}
+	}
+
+	return display, key, nil
+}
+
+// Suggest returns up to n alternatives to a taken nickname. taken reports whether a key is in use.
+func (p *NicknamePolicy) Suggest(display string, taken func(key string) bool, n int) []string {
+	suggestions := []string{}
+	for i := 2; len(suggestions) < n && i < 100; i++ {
+		suffix := fmt.Sprintf("%d", i)
+
+		base := []rune(display)
+		if len(base)+len(suffix) > MaxNicknameLength {
+			base = base[:MaxNicknameLength-len(suffix)]
+		}
+
+		candidate, key, err := p.Normalize(string(base) + suffix)
+		if err != nil || taken(key) {
+			continue
+		}
+		suggestions = append(suggestions, candidate)
+	}
+	return suggestions
+}
+
+// NormalizeNickname applies NFKC normalization, removes invisible and control characters
+// and collapses whitespace
+func NormalizeNickname(nickname string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range norm.NFKC.String(nickname) {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs),
+			unicode.Is(unicode.Variation_Selector, r),
+			r == 'ᅟ', r == 'ᅠ', r == 'ㅤ', r == 'ﾠ': // Hangul fillers render blank
+			continue
+		}
+		if space {
+			b.WriteRune(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// NicknameKey returns the comparison key of a nickname. Case, accents, spacing,
+// punctuation and confusable characters are folded so lookalike nicknames share a key.
+// Only accents on Latin, Greek and Cyrillic letters are dropped; other marks such as the
+// kana voicing marks in だ and パ change the word, so they are kept.
+func NicknameKey(nickname string) string {
+	var b strings.Builder
+	keepMarks := false
+	for _, r := range norm.NFKD.String(NormalizeNickname(nickname)) {
+		if unicode.Is(unicode.Mn, r) {
+			if keepMarks {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		if r == 'I' {
+			r = 'l' // uppercase I and lowercase l are indistinguishable in many fonts
+		}
+		keepMarks = false
+		r = unicode.ToLower(r)
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+			keepMarks = !unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+		}
+	}
+	// Recompose the kept marks with their letters
+	return norm.NFC.String(strings.ReplaceAll(b.String(), "rn", "m"))
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNickname(t *testing.T) {
+	tests := []struct {
+		name     string
+		nickname string
+		expected string
+	}{
+		{"Plain nickname", "Taro", "Taro"},
+		{"Fullwidth characters", "Ｔａｒｏ", "Taro"},
+		{"Halfwidth katakana", "ﾀﾛｳ", "タロウ"},
+		{"Zero-width characters", "Ta\u200bro\u200d", "Taro"},
+		{"Surrounding and repeated spaces", "  Taro 　 Yamada  ", "Taro Yamada"},
+		{"Only invisible characters", "\u200b\u2060\u3164", ""},
+		{"Bidi override", "\u202eoraT", "oraT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeNickname(tt.nickname); got != tt.expected {
+				t.Errorf("NormalizeNickname(%q) = %q, want %q", tt.nickname, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNicknameKey_Confusables(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"Case", "taro", "TARO"},
+		{"Cyrillic lookalikes", "paypal", "раураl"},
+		{"Digits for letters", "Leet", "L33t"},
+		{"Uppercase I and lowercase l", "Ill", "lII"},
+		{"rn and m", "modern", "modem"},
+		{"Accents", "José", "Jose"},
+		{"Punctuation and spacing", "Taro Yamada", "taro_yamada"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if NicknameKey(tt.a) != NicknameKey(tt.b) {
+				t.Errorf("Expected %q and %q to share a key, got %q and %q", tt.a, tt.b, NicknameKey(tt.a), NicknameKey(tt.b))
+			}
+		})
+	}
+
+	if NicknameKey("Taro") == NicknameKey("Jiro") {
+		t.Error("Expected different nicknames to have different keys")
+	}
+}
+
+func TestNicknameKey_KanaVoicingMarks(t *testing.T) {
+	// Voiced and semi-voiced kana are different words, not accented letters
+	for _, pair := range [][2]string{
+		{"たなか", "だなか"},
+		{"ゆうき", "ゆうぎ"},
+		{"ハン", "バン"},
+		{"バン", "パン"},
+		{"ハン", "パン"},
+	} {
+		if NicknameKey(pair[0]) == NicknameKey(pair[1]) {
+			t.Errorf("Expected %q and %q to have different keys, got %q", pair[0], pair[1], NicknameKey(pair[0]))
+		}
+	}
+
+	// Half-width and decomposed kana are the same nickname
+	for _, pair := range [][2]string{
+		{"ﾀﾞﾅｶ", "ダナカ"},
+		{"た\u3099なか", "だなか"},
+		{"ハ\u309Aン", "パン"},
+	} {
+		if NicknameKey(pair[0]) != NicknameKey(pair[1]) {
+			t.Errorf("Expected %q and %q to share a key, got %q and %q", pair[0], pair[1], NicknameKey(pair[0]), NicknameKey(pair[1]))
+		}
+	}
+}
+
+func TestNicknamePolicy_Normalize(t *testing.T) {
+	policy := NewNicknamePolicyWithDenyList([]string{"=admin", "badword"})
+
+	tests := []struct {
+		name        string
+		nickname    string
+		expected    string
+		expectedErr error
+	}{
+		{"Valid nickname", " Taro ", "Taro", nil},
+		{"Empty nickname", "\u200b", "", ErrNicknameEmpty},
+		{"Punctuation only", "???", "", ErrNicknameEmpty},
+		{"Too long", strings.Repeat("a", MaxNicknameLength+1), "", ErrNicknameTooLong},
+		{"Exact deny-list match", "Admin", "", ErrNicknameDenied},
+		{"Disguised deny-list match", "Аdm1n", "", ErrNicknameDenied},
+		{"Exact term inside a word", "badminton", "badminton", nil},
+		{"Substring deny-list match", "xxBadWordxx", "", ErrNicknameDenied},
+		{"Deny-list term split by zero-width space", "bad\u200bword", "", ErrNicknameDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			display, _, err := policy.Normalize(tt.nickname)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if display != tt.expected {
+				t.Errorf("Expected display %q, got %q", tt.expected, display)
+			}
+		})
+	}
+}
+
+func TestNicknamePolicy_Suggest(t *testing.T) {
+	policy := NewNicknamePolicyWithDenyList(nil)
+
+	taken := map[string]bool{
+		NicknameKey("Taro"):  true,
+		NicknameKey("Taro2"): true,
+	}
+	suggestions := policy.Suggest("Taro", func(key string) bool { return taken[key] }, 3)
+
+	expected := []string{"Taro3", "Taro4", "Taro5"}
+	if strings.Join(suggestions, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected suggestions %v, got %v", expected, suggestions)
+	}
+
+	long := strings.Repeat("a", MaxNicknameLength)
+	for _, suggestion := range policy.Suggest(long, func(string) bool { return false }, 1) {
+		if len([]rune(suggestion)) > MaxNicknameLength {
+			t.Errorf("Suggestion %q exceeds the maximum length", suggestion)
+		}
+	}
+}
+
+func TestNewNicknamePolicy_FromEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	if err := os.WriteFile(path, []byte("# event terms\nspoiler\n\n=host\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write deny-list file: %v", err)
+	}
+
+	t.Setenv("NICKNAME_DENYLIST", "rival, =judge")
+	t.Setenv("NICKNAME_DENYLIST_FILE", path)
+
+	policy, err := NewNicknamePolicy()
+	if err != nil {
+		t.Fatalf("Failed to create nickname policy: %v", err)
+	}
+
+	for _, nickname := range []string{"Admin", "運営スタッフ", "MyRival", "judge", "spoilers", "Host"} {
+		if _, _, err := policy.Normalize(nickname); !errors.Is(err, ErrNicknameDenied) {
+			t.Errorf("Expected %q to be denied, got %v", nickname, err)
+		}
+	}
+	for _, nickname := range []string{"Judge Taro", "Ghost"} {
+		if _, _, err := policy.Normalize(nickname); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", nickname, err)
+		}
+	}
+
+	t.Setenv("NICKNAME_DENYLIST_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := NewNicknamePolicy(); err == nil {
+		t.Error("Expected an error for a missing deny-list file")
+	}
+}
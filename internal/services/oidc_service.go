@@ -0,0 +1,680 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+var (
+	// ErrOIDCNotConfigured is returned when OpenID Connect login is used without its configuration
+	ErrOIDCNotConfigured = errors.New("OpenID Connect login is not configured")
+	// ErrOIDCInvalidState is returned when a callback's state is unknown, used or expired
+	ErrOIDCInvalidState = errors.New("OpenID Connect login state is invalid or has expired")
+	// ErrOIDCAuthentication is returned when the provider rejects the code or its ID token is invalid
+	ErrOIDCAuthentication = errors.New("OpenID Connect authentication failed")
+	// ErrOIDCProvider is returned when the provider cannot be reached or answers unexpectedly
+	ErrOIDCProvider = errors.New("OpenID Connect provider is unavailable")
+	// ErrOIDCNoAccount is returned when no administrator is linked to an identity and none can be created
+	ErrOIDCNoAccount = errors.New("no administrator is linked to the identity")
+	// ErrOIDCNotAuthorized is returned when an identity is in no group mapped to an administrator role
+	ErrOIDCNotAuthorized = errors.New("identity is not in a group mapped to an administrator role")
+)
+
+const (
+	// DefaultOIDCScopes are the scopes requested from the provider
+	DefaultOIDCScopes = "openid profile email"
+	// DefaultOIDCUsernameClaim is the ID token claim used as the username of created administrators
+	DefaultOIDCUsernameClaim = "preferred_username"
+	// DefaultOIDCGroupsClaim is the ID token claim listing the groups of the identity
+	DefaultOIDCGroupsClaim = "groups"
+	// oidcStateExpiry is how long a login started at the provider can be completed
+	oidcStateExpiry = 10 * time.Minute
+	// oidcHTTPTimeout limits requests to the provider
+	oidcHTTPTimeout = 10 * time.Second
+	// oidcClockSkew is the clock difference tolerated when checking ID token times
+	oidcClockSkew = time.Minute
+	// maxAdminUsername is the length of administrators.username
+	maxAdminUsername = 50
+)
+
+// oidcRolePriority orders roles from the most to the least privileged, so that an identity in
+// several mapped groups gets the most privileged role
+var oidcRolePriority = []string{models.AdminRoleOwner, models.AdminRoleAuthor, models.AdminRoleHost, models.AdminRoleViewer}
+
+// OIDCService signs administrators in with an OpenID Connect provider using the authorization
+// code flow with PKCE. Identities are linked to administrators by issuer and subject; the first
+// login links an administrator with the same verified email or, if enabled, creates one.
+// Groups of the identity can be mapped to roles, which are then synchronized on every login.
+type OIDCService struct {
+	db            *sql.DB
+	client        *http.Client
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	scopes        string
+	usernameClaim string
+	groupsClaim   string
+	roleMapping   map[string]string
+	linkByEmail   bool
+	autoCreate    bool
+	sessions      *SessionService
+	now           func() time.Time
+}
+
+// OIDCIdentity is the identity asserted by a verified ID token
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Groups        []string
+}
+
+// oidcAuthRequest holds the secrets of one authorization request
+type oidcAuthRequest struct {
+	state         string
+	nonce         string
+	codeVerifier  string
+	browserSecret string // kept by the browser that started the login
+}
+
+// oidcProvider is the discovery document of a provider and its cached signing keys
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	mu   sync.Mutex
+	keys map[string]any // public keys by kid
+}
+
+// oidcProviders caches discovery documents by issuer, so that services created per request do
+// not fetch them again
+var oidcProviders struct {
+	mu       sync.Mutex
+	byIssuer map[string]*oidcProvider
+}
+
+// NewOIDCService creates a new OpenID Connect service.
+//
+// OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL enable the login; OIDC_CLIENT_SECRET is
+// sent if set. OIDC_SCOPES, OIDC_USERNAME_CLAIM and OIDC_GROUPS_CLAIM override the defaults.
+// OIDC_ROLE_MAPPING maps groups to roles ("quiz-owners=owner,quiz-hosts=host"); once set, only
+// identities in a mapped group may sign in. OIDC_LINK_BY_EMAIL=false stops linking existing
+// administrators by verified email, and OIDC_AUTO_CREATE=true creates administrators for
+// identities in a mapped group. The sessions of an administrator whose role the mapping changes
+// are revoked in sessions.
+func NewOIDCService(sessions *SessionService) *OIDCService {
+	withDefault := func(name, fallback string) string {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	return &OIDCService{
+		db:            database.GetDB(),
+		client:        &http.Client{Timeout: oidcHTTPTimeout},
+		issuer:        strings.TrimSuffix(strings.TrimSpace(os.Getenv("OIDC_ISSUER_URL")), "/"),
+		clientID:      strings.TrimSpace(os.Getenv("OIDC_CLIENT_ID")),
+		clientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		redirectURL:   strings.TrimSpace(os.Getenv("OIDC_REDIRECT_URL")),
+		scopes:        withDefault("OIDC_SCOPES", DefaultOIDCScopes),
+		usernameClaim: withDefault("OIDC_USERNAME_CLAIM", DefaultOIDCUsernameClaim),
+		groupsClaim:   withDefault("OIDC_GROUPS_CLAIM", DefaultOIDCGroupsClaim),
+		roleMapping:   parseOIDCRoleMapping(os.Getenv("OIDC_ROLE_MAPPING")),
+		linkByEmail:   os.Getenv("OIDC_LINK_BY_EMAIL") != "false",
+		autoCreate:    os.Getenv("OIDC_AUTO_CREATE") == "true",
+		sessions:      sessions,
+		now:           time.Now,
+	}
+}
+
+// Enabled reports whether OpenID Connect login is configured
+func (s *OIDCService) Enabled() bool {
+	return s.issuer != "" && s.clientID != "" && s.redirectURL != ""
+}
+
+// AuthorizationURL starts a login and returns the provider URL to send the browser to and a
+// browser secret. The provider redirects back to OIDC_REDIRECT_URL with the code and state to
+// pass to Exchange. The secret never leaves the browser that started the login, so a code and
+// state obtained by someone else cannot complete a login in another browser.
+func (s *OIDCService) AuthorizationURL() (authURL, browserSecret string, expiresAt time.Time, err error) {
+	if !s.Enabled() {
+		return "", "", time.Time{}, ErrOIDCNotConfigured
+	}
+	if s.db == nil {
+		return "", "", time.Time{}, errors.New("database connection not initialized")
+	}
+
+	provider, err := s.provider()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	request, err := newOIDCAuthRequest()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	now := s.now().UTC()
+	expiresAt = now.Add(oidcStateExpiry)
+	if _, err := s.db.Exec("DELETE FROM oidc_login_states WHERE expires_at < $1", now); err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to delete expired login states: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO oidc_login_states (state_hash, browser_secret_hash, code_verifier, nonce, expires_at)
+						VALUES ($1, $2, $3, $4, $5)`,
+		hashOIDCState(request.state), hashOIDCState(request.browserSecret), request.codeVerifier, request.nonce, expiresAt)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	authURL, err = s.authCodeURL(provider, request)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return authURL, request.browserSecret, expiresAt, nil
+}
+
+// Exchange completes a login: the state is consumed, the code is exchanged for tokens with the
+// PKCE verifier, and the ID token is verified. browserSecret must be the secret returned by
+// AuthorizationURL for the state. It returns the identity of the ID token.
+func (s *OIDCService) Exchange(code, state, browserSecret string) (*OIDCIdentity, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCNotConfigured
+	}
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	// A state can be used only once, and only by the browser that started the login
+	var (
+		codeVerifier string
+		nonce        string
+		expiresAt    time.Time
+	)
+	err := s.db.QueryRow(`DELETE FROM oidc_login_states WHERE state_hash = $1 AND browser_secret_hash = $2
+						  RETURNING code_verifier, nonce, expires_at`,
+		hashOIDCState(state), hashOIDCState(browserSecret)).Scan(&codeVerifier, &nonce, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOIDCInvalidState
+		}
+		return nil, fmt.Errorf("failed to get login state: %w", err)
+	}
+	if !s.now().Before(expiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	provider, err := s.provider()
+	if err != nil {
+		return nil, err
+	}
+	return s.exchangeCode(provider, code, codeVerifier, nonce)
+}
+
+// ResolveAdmin returns the administrator linked to an identity, linking or creating one on the
+// first login, and synchronizes the role mapped from the identity's groups. It returns
+// ErrAdminDisabled for disabled administrators.
+func (s *OIDCService) ResolveAdmin(identity *OIDCIdentity) (*models.Administrator, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	role := s.roleForGroups(identity.Groups)
+	if len(s.roleMapping) > 0 && role == "" {
+		return nil, ErrOIDCNotAuthorized
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	var adminID int64
+	err = tx.QueryRow("SELECT admin_id FROM admin_identities WHERE issuer = $1 AND subject = $2 FOR UPDATE",
+		identity.Issuer, identity.Subject).Scan(&adminID)
+	if err == sql.ErrNoRows {
+		adminID, err = s.linkAdmin(tx, identity, role)
+	}
+	if err != nil {
+		if errors.Is(err, ErrOIDCNoAccount) || errors.Is(err, ErrAdminExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get linked administrator: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE admin_identities SET email = $3, last_login_at = NOW() WHERE issuer = $1 AND subject = $2",
+		identity.Issuer, identity.Subject, identity.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update identity: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	authService := &AuthService{db: s.db}
+	admin, err := authService.GetAdminByID(adminID)
+	if err != nil {
+		return nil, err
+	}
+	if admin.DisabledAt != nil {
+		return nil, ErrAdminDisabled
+	}
+	if role != "" && admin.Role != role {
+		updated, err := authService.SetAdminRole(admin.ID, role)
+		switch {
+		case errors.Is(err, ErrLastOwner):
+			// The last owner keeps their role even if the provider no longer maps it
+			log.Printf("Kept the role of admin %d, the last active owner, instead of the mapped role %s", admin.ID, role)
+		case err != nil:
+			return nil, err
+		default:
+			// Access tokens carry the role, so tokens issued with the previous role must not
+			// outlive the change
+			if _, err := s.sessions.RevokeAllSessions(admin.ID, RevokeReasonRoleChanged, ""); err != nil {
+				log.Printf("Failed to revoke sessions of admin %d: %v", admin.ID, err)
+			}
+			admin = updated
+		}
+	}
+	return admin, nil
+}
+
+// linkAdmin links an identity on its first login to the administrator with its verified email,
+// or to a new administrator with role. New administrators have no password, so they can only
+// sign in through the provider until an owner sets one.
+func (s *OIDCService) linkAdmin(tx *sql.Tx, identity *OIDCIdentity, role string) (int64, error) {
+	var adminID int64
+	err := sql.ErrNoRows
+	if s.linkByEmail && identity.EmailVerified && identity.Email != "" {
+		err = tx.QueryRow("SELECT id FROM administrators WHERE LOWER(email) = LOWER($1)", identity.Email).Scan(&adminID)
+		if err == nil {
+			// Signing in through the provider accepts a pending invitation
+			_, err = tx.Exec(`UPDATE administrators SET invite_token_hash = NULL, invite_expires_at = NULL, updated_at = NOW()
+							  WHERE id = $1 AND invite_token_hash IS NOT NULL`, adminID)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err == sql.ErrNoRows {
+		if !s.autoCreate || role == "" || identity.Email == "" || identity.Username == "" {
+			return 0, ErrOIDCNoAccount
+		}
+		err = tx.QueryRow(`INSERT INTO administrators (username, password_hash, email, role, created_at, updated_at)
+						   VALUES ($1, '', $2, $3, NOW(), NOW())
+						   RETURNING id`, truncateText(identity.Username, maxAdminUsername), identity.Email, role).Scan(&adminID)
+		if isUniqueViolation(err) {
+			return 0, ErrAdminExists
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO admin_identities (admin_id, issuer, subject, email) VALUES ($1, $2, $3, $4)",
+		adminID, identity.Issuer, identity.Subject, identity.Email)
+	if err != nil {
+		return 0, err
+	}
+	return adminID, nil
+}
+
+// roleForGroups returns the most privileged role mapped from groups, or "" if none is mapped
+func (s *OIDCService) roleForGroups(groups []string) string {
+	mapped := make(map[string]bool)
+	for _, group := range groups {
+		if role, ok := s.roleMapping[group]; ok {
+			mapped[role] = true
+		}
+	}
+	for _, role := range oidcRolePriority {
+		if mapped[role] {
+			return role
+		}
+	}
+	return ""
+}
+
+// authCodeURL builds the authorization request URL with the PKCE challenge (S256)
+func (s *OIDCService) authCodeURL(provider *oidcProvider, request *oidcAuthRequest) (string, error) {
+	authURL, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint: %v", ErrOIDCProvider, err)
+	}
+
+	challenge := sha256.Sum256([]byte(request.codeVerifier))
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", s.clientID)
+	query.Set("redirect_uri", s.redirectURL)
+	query.Set("scope", s.scopes)
+	query.Set("state", request.state)
+	query.Set("nonce", request.nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// exchangeCode redeems an authorization code at the token endpoint and verifies the ID token
+func (s *OIDCService) exchangeCode(provider *oidcProvider, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.redirectURL},
+		"client_id":     {s.clientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid token endpoint: %v", ErrOIDCProvider, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore close error in defer
+	}()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: token endpoint returned %d", ErrOIDCProvider, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		// Usually invalid_grant: the code is wrong, used or does not match the verifier
+		return nil, fmt.Errorf("%w: %s %s", ErrOIDCAuthentication, token.Error, token.ErrorDescription)
+	case decodeErr != nil:
+		return nil, fmt.Errorf("%w: invalid token response: %v", ErrOIDCProvider, decodeErr)
+	case token.IDToken == "":
+		return nil, fmt.Errorf("%w: token response has no ID token", ErrOIDCProvider)
+	}
+	return s.verifyIDToken(provider, token.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature, issuer, audience, times and nonce of an ID token
+func (s *OIDCService) verifyIDToken(provider *oidcProvider, idToken, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.verificationKey(provider, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(s.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockSkew),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil {
+		if errors.Is(err, ErrOIDCProvider) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: invalid ID token: %v", ErrOIDCAuthentication, err)
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("%w: ID token nonce does not match", ErrOIDCAuthentication)
+	}
+	// A token for several audiences must be authorized for this client
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != s.clientID {
+			return nil, fmt.Errorf("%w: ID token is not authorized for this client", ErrOIDCAuthentication)
+		}
+	}
+
+	identity := &OIDCIdentity{Issuer: provider.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		// Some providers send the flag as a string
+		identity.EmailVerified = verified == "true"
+	}
+	identity.Username, _ = claims[s.usernameClaim].(string)
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	switch groups := claims[s.groupsClaim].(type) {
+	case []any:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	case string:
+		identity.Groups = splitList(groups)
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: ID token has no subject", ErrOIDCAuthentication)
+	}
+	return identity, nil
+}
+
+// provider returns the discovery document of the configured issuer, fetching it once
+func (s *OIDCService) provider() (*oidcProvider, error) {
+	oidcProviders.mu.Lock()
+	defer oidcProviders.mu.Unlock()
+	if provider, ok := oidcProviders.byIssuer[s.issuer]; ok {
+		return provider, nil
+	}
+
+	provider := &oidcProvider{}
+	if err := s.getJSON(s.issuer+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, err
+	}
+	// The document must be for the configured issuer (OpenID Connect Discovery 4.3)
+	if strings.TrimSuffix(provider.Issuer, "/") != s.issuer {
+		return nil, fmt.Errorf("%w: discovery document is for issuer %q", ErrOIDCProvider, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document is incomplete", ErrOIDCProvider)
+	}
+
+	if oidcProviders.byIssuer == nil {
+		oidcProviders.byIssuer = make(map[string]*oidcProvider)
+	}
+	oidcProviders.byIssuer[s.issuer] = provider
+	return provider, nil
+}
+
+// verificationKey returns the provider's public key with kid. The key set is fetched again
+// when the kid is unknown, so that the provider can rotate its keys.
+func (s *OIDCService) verificationKey(provider *oidcProvider, kid string) (any, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 || provider.keys == nil {
+			var jwks struct {
+				Keys []models.JWK `json:"keys"`
+			}
+			if err := s.getJSON(provider.JWKSURI, &jwks); err != nil {
+				return nil, err
+			}
+			provider.keys = make(map[string]any)
+			for _, jwk := range jwks.Keys {
+				if jwk.Use != "" && jwk.Use != "sig" {
+					continue
+				}
+				key, err := parsePublicJWK(jwk)
+				if err != nil {
+					log.Printf("Skipping OpenID Connect provider key %q: %v", jwk.Kid, err)
+					continue
+				}
+				provider.keys[jwk.Kid] = key
+			}
+		}
+
+		if key, ok := provider.keys[kid]; ok {
+			return key, nil
+		}
+		// A token without kid can only be verified by a provider with a single key
+		if kid == "" && len(provider.keys) == 1 {
+			for _, key := range provider.keys {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// getJSON fetches a JSON document from the provider
+func (s *OIDCService) getJSON(rawURL string, v any) error {
+	resp, err := s.client.Get(rawURL) // #nosec G107 -- the URL comes from configuration or its discovery document
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore close error in defer
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", ErrOIDCProvider, rawURL, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid response from %s: %v", ErrOIDCProvider, rawURL, err)
+	}
+	return nil
+}
+
+// newOIDCAuthRequest generates the state, nonce, PKCE code verifier and browser secret of an
+// authorization request
+func newOIDCAuthRequest() (*oidcAuthRequest, error) {
+	var values [4]string
+	for i := range values {
+		value := make([]byte, 32)
+		if _, err := rand.Read(value); err != nil {
+			return nil, fmt.Errorf("failed to generate login state: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(value)
+	}
+	return &oidcAuthRequest{state: values[0], nonce: values[1], codeVerifier: values[2], browserSecret: values[3]}, nil
+}
+
+// hashOIDCState hashes a login state or browser secret for storage, so that stored states cannot be replayed
+func hashOIDCState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseOIDCRoleMapping parses "group=role" pairs separated by commas, ignoring unknown roles
+func parseOIDCRoleMapping(value string) map[string]string {
+	mapping := make(map[string]string)
+	for _, item := range splitList(value) {
+		group, role, ok := strings.Cut(item, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" {
+			log.Printf("Ignoring invalid OIDC_ROLE_MAPPING entry %q", item)
+			continue
+		}
+		switch role {
+		case models.AdminRoleOwner, models.AdminRoleAuthor, models.AdminRoleHost, models.AdminRoleViewer:
+			mapping[group] = role
+		default:
+			log.Printf("Ignoring OIDC_ROLE_MAPPING entry %q with unknown role", item)
+		}
+	}
+	return mapping
+}
+
+// parsePublicJWK converts an RSA, EC or Ed25519 JWK to a public key
+func parsePublicJWK(jwk models.JWK) (any, error) {
+	decode := func(value string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider that authorizes every request and
+// issues ID tokens with the claims set by the test
+type mockOIDCProvider struct {
+	server   *httptest.Server
+	clientID string
+
+	mu             sync.Mutex
+	key            *rsa.PrivateKey
+	kid            string
+	claims         jwt.MapClaims
+	authorizations map[string]url.Values // authorization request parameters by code
+	issued         int
+}
+
+func newMockOIDCProvider(t *testing.T, clientID string) *mockOIDCProvider {
+	t.Helper()
+
+	p := &mockOIDCProvider{clientID: clientID, authorizations: make(map[string]url.Values)}
+	p.rotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("response_type") != "code" || query.Get("client_id") != p.clientID || query.Get("code_challenge_method") != "S256" {
+			http.Error(w, "invalid authorization request", http.StatusBadRequest)
+			return
+		}
+		p.mu.Lock()
+		p.issued++
+		code := fmt.Sprintf("code-%d", p.issued)
+		p.authorizations[code] = query
+		p.mu.Unlock()
+		http.Redirect(w, r, query.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// Codes are single use and must be redeemed with the verifier of their challenge
+		authorization, ok := p.authorizations[r.PostFormValue("code")]
+		delete(p.authorizations, r.PostFormValue("code"))
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("client_id") != p.clientID ||
+			r.PostFormValue("redirect_uri") != authorization.Get("redirect_uri") ||
+			base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss":   p.server.URL,
+			"aud":   p.clientID,
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"nonce": authorization.Get("nonce"),
+		}
+		for name, value := range p.claims {
+			claims[name] = value
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = p.kid
+		idToken, _ := token.SignedString(p.key)
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(models.JWKSet{Keys: []models.JWK{{
+			Kty: "RSA",
+			Kid: p.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			E:   "AQAB",
+		}}})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// rotateKey replaces the provider's signing key
+func (p *mockOIDCProvider) rotateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.kid = fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+// setClaims sets the claims of the next ID tokens
+func (p *mockOIDCProvider) setClaims(claims jwt.MapClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+// authorize follows an authorization URL and returns the code and state of the redirect
+func (p *mockOIDCProvider) authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect from the provider, got %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid redirect: %v", err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newTestOIDCService(provider *mockOIDCProvider) *OIDCService {
+	return &OIDCService{
+		client:        provider.server.Client(),
+		issuer:        provider.server.URL,
+		clientID:      provider.clientID,
+		redirectURL:   "https://quiz.example.com/admin/oidc/callback",
+		scopes:        DefaultOIDCScopes,
+		usernameClaim: DefaultOIDCUsernameClaim,
+		groupsClaim:   DefaultOIDCGroupsClaim,
+		roleMapping:   map[string]string{},
+		linkByEmail:   true,
+		now:           time.Now,
+	}
+}
+
+func TestOIDCService_ExchangeCode(t *testing.T) {
+	mock := newMockOIDCProvider(t, "quiz-admin")
+	mock.setClaims(jwt.MapClaims{
+		"sub":                "user-1",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "quiz-hosts"},
+	})
+	service := newTestOIDCService(mock)
+
+	provider, err := service.provider()
+	if err != nil {
+		t.Fatalf("provider() failed: %v", err)
+	}
+	login := func() (*oidcAuthRequest, string) {
+		request, err := newOIDCAuthRequest()
+		if err != nil {
+			t.Fatalf("newOIDCAuthRequest() failed: %v", err)
+		}
+		authURL, err := service.authCodeURL(provider, request)
+		if err != nil {
+			t.Fatalf("authCodeURL() failed: %v", err)
+		}
+		code, state := mock.authorize(t, authURL)
+		if state != request.state {
+			t.Fatalf("Expected the state to be returned, got %q", state)
+		}
+		return request, code
+	}
+
+	request, code := login()
+	identity, err := service.exchangeCode(provider, code, request.codeVerifier, request.nonce)
+	if err != nil {
+		t.Fatalf("exchangeCode() failed: %v", err)
+	}
+	if identity.Issuer != mock.server.URL || identity.Subject != "user-1" || identity.Email != "alice@example.com" ||
+		!identity.EmailVerified || identity.Username != "alice" || len(identity.Groups) != 2 {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+
+	// 使用済みのコードは使えない
+	if _, err := service.exchangeCode(provider, code, request.codeVerifier, request.nonce); !errors.Is(err, ErrOIDCAuthentication) {
+		t.Errorf("exchangeCode() with a used code error = %v, want ErrOIDCAuthentication", err)
+	}
+
+	// PKCEの検証コードが違うと拒否される
+	request, code = login()
+	if _, err := service.exchangeCode(provider, code, "wrong-verifier", request.nonce); !errors.Is(err, ErrOIDCAuthentication) {
+		t.Errorf("exchangeCode() with a wrong verifier error = %v, want ErrOIDCAuthentication", err)
+	}
+
+	// nonceが違うIDトークンは拒否される
+	request, code = login()
+	if _, err := service.exchangeCode(provider, code, request.codeVerifier, "other-nonce"); !errors.Is(err, ErrOIDCAuthentication) {
+		t.Errorf("exchangeCode() with a wrong nonce error = %v, want ErrOIDCAuthentication", err)
+	}
+
+	// 他のクライアント向けのIDトークンは拒否される
+	mock.setClaims(jwt.MapClaims{"sub": "user-1", "aud": "other-client"})
+	request, code = login()
+	if _, err := service.exchangeCode(provider, code, request.codeVerifier, request.nonce); !errors.Is(err, ErrOIDCAuthentication) {
+		t.Errorf("exchangeCode() with another audience error = %v, want ErrOIDCAuthentication", err)
+	}
+
+	// 期限切れのIDトークンは拒否される
+	mock.setClaims(jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()})
+	request, code = login()
+	if _, err := service.exchangeCode(provider, code, request.codeVerifier, request.nonce); !errors.Is(err, ErrOIDCAuthentication) {
+		t.Errorf("exchangeCode() with an expired ID token error = %v, want ErrOIDCAuthentication", err)
+	}
+
+	// 鍵が更新されても、新しい鍵セットを取得して検証できる
+	mock.rotateKey(t)
+	mock.setClaims(jwt.MapClaims{"sub": "user-1", "email": "alice@example.com", "groups": "staff, quiz-owners"})
+	request, code = login()
+	identity, err = service.exchangeCode(provider, code, request.codeVerifier, request.nonce)
+	if err != nil {
+		t.Fatalf("exchangeCode() after key rotation failed: %v", err)
+	}
+	if identity.Username != "alice" || identity.EmailVerified || len(identity.Groups) != 2 || identity.Groups[1] != "quiz-owners" {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+}
+
+func TestOIDCService_Discovery(t *testing.T) {
+	mock := newMockOIDCProvider(t, "quiz-admin")
+	service := newTestOIDCService(mock)
+
+	// 設定と異なる発行者の設定情報は使わない
+	service.issuer = mock.server.URL + "/other"
+	if _, err := service.provider(); !errors.Is(err, ErrOIDCProvider) {
+		t.Errorf("provider() for another issuer error = %v, want ErrOIDCProvider", err)
+	}
+
+	service = &OIDCService{}
+	if service.Enabled() {
+		t.Error("Expected the service to be disabled without configuration")
+	}
+	if _, _, _, err := service.AuthorizationURL(); !errors.Is(err, ErrOIDCNotConfigured) {
+		t.Errorf("AuthorizationURL() error = %v, want ErrOIDCNotConfigured", err)
+	}
+}
+
+func TestOIDCService_RoleMapping(t *testing.T) {
+	service := &OIDCService{roleMapping: parseOIDCRoleMapping("quiz-hosts=host, quiz-owners = owner,invalid,staff=admin,viewers=viewer")}
+
+	if len(service.roleMapping) != 3 {
+		t.Errorf("Expected invalid entries to be ignored, got %v", service.roleMapping)
+	}
+
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"staff"}, ""},
+		{[]string{"viewers"}, models.AdminRoleViewer},
+		{[]string{"viewers", "quiz-hosts"}, models.AdminRoleHost},
+		{[]string{"quiz-hosts", "quiz-owners"}, models.AdminRoleOwner},
+	}
+	for _, tt := range tests {
+		if got := service.roleForGroups(tt.groups); got != tt.want {
+			t.Errorf("roleForGroups(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCService_Login(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	suffix := os.Getpid()
+	existing, err := NewAuthService().CreateAdminWithRole(fmt.Sprintf("oidc%d", suffix), "oidcpassword",
+		fmt.Sprintf("oidc%d@example.com", suffix), models.AdminRoleViewer)
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	newEmail := fmt.Sprintf("oidcnew%d@example.com", suffix)
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1 OR email = $2", existing.ID, newEmail)
+	}()
+
+	mock := newMockOIDCProvider(t, "quiz-admin")
+	service := newTestOIDCService(mock)
+	service.db = db
+	service.roleMapping = parseOIDCRoleMapping("quiz-authors=author,quiz-hosts=host")
+	service.autoCreate = true
+	sessions := NewSessionService(NewJWTService(), NewMemoryRevocationStore())
+	service.sessions = sessions
+
+	signIn := func(claims jwt.MapClaims) (*models.Administrator, error) {
+		t.Helper()
+		mock.setClaims(claims)
+		authURL, browserSecret, _, err := service.AuthorizationURL()
+		if err != nil {
+			t.Fatalf("AuthorizationURL() failed: %v", err)
+		}
+		code, state := mock.authorize(t, authURL)
+		// ログインを開始していないブラウザの秘密値では使えない
+		_, otherSecret, _, err := service.AuthorizationURL()
+		if err != nil {
+			t.Fatalf("AuthorizationURL() failed: %v", err)
+		}
+		if _, err := service.Exchange(code, state, otherSecret); !errors.Is(err, ErrOIDCInvalidState) {
+			t.Errorf("Exchange() with another browser's secret error = %v, want ErrOIDCInvalidState", err)
+		}
+		identity, err := service.Exchange(code, state, browserSecret)
+		if err != nil {
+			t.Fatalf("Exchange() failed: %v", err)
+		}
+		// 同じstateは2回使えない
+		if _, err := service.Exchange(code, state, browserSecret); !errors.Is(err, ErrOIDCInvalidState) {
+			t.Errorf("Exchange() with a used state error = %v, want ErrOIDCInvalidState", err)
+		}
+		return service.ResolveAdmin(identity)
+	}
+
+	// 確認済みのメールアドレスで既存の管理者と紐付け、グループの役割に変更する
+	viewerSession, err := sessions.StartSession(existing)
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	subject := fmt.Sprintf("existing-%d", suffix)
+	admin, err := signIn(jwt.MapClaims{"sub": subject, "email": existing.Email, "email_verified": true, "groups": []string{"quiz-hosts"}})
+	if err != nil {
+		t.Fatalf("ResolveAdmin() failed: %v", err)
+	}
+	if admin.ID != existing.ID || admin.Role != models.AdminRoleHost {
+		t.Errorf("Expected the existing admin as a host, got %+v", admin)
+	}
+
+	// 役割が変わると以前の役割のセッションは失効する。変わらなければそのまま
+	if _, err := sessions.Refresh(viewerSession.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Refresh() with the previous role's session error = %v, want ErrSessionRevoked", err)
+	}
+	hostSession, err := sessions.StartSession(admin)
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if _, err := signIn(jwt.MapClaims{"sub": subject, "groups": []string{"quiz-hosts"}}); err != nil {
+		t.Fatalf("ResolveAdmin() with the same role failed: %v", err)
+	}
+	if _, err := sessions.Refresh(hostSession.RefreshToken); err != nil {
+		t.Errorf("Expected a session with an unchanged role to stay valid, got %v", err)
+	}
+
+	// 紐付け後はメールアドレスが変わっても同じ管理者になる
+	admin, err = signIn(jwt.MapClaims{"sub": subject, "email": "changed@example.com", "groups": []string{"quiz-authors"}})
+	if err != nil || admin.ID != existing.ID || admin.Role != models.AdminRoleAuthor {
+		t.Errorf("ResolveAdmin() for a linked identity = %+v, %v", admin, err)
+	}
+
+	// 対応するグループがなければ拒否する
+	if _, err := signIn(jwt.MapClaims{"sub": subject, "groups": []string{"staff"}}); !errors.Is(err, ErrOIDCNotAuthorized) {
+		t.Errorf("ResolveAdmin() without a mapped group error = %v, want ErrOIDCNotAuthorized", err)
+	}
+
+	// 未確認のメールアドレスでは紐付けず、新しい管理者を作成する
+	admin, err = signIn(jwt.MapClaims{"sub": fmt.Sprintf("new-%d", suffix), "email": newEmail, "email_verified": false,
+		"preferred_username": fmt.Sprintf("oidcnew%d", suffix), "groups": []string{"quiz-hosts"}})
+	if err != nil {
+		t.Fatalf("ResolveAdmin() for a new identity failed: %v", err)
+	}
+	if admin.ID == existing.ID || admin.Email != newEmail || admin.Role != models.AdminRoleHost {
+		t.Errorf("Expected a new host, got %+v", admin)
+	}
+	if _, err := NewAuthService().AuthenticateAdmin(admin.Username, ""); err == nil {
+		t.Error("Expected a created admin to have no password")
+	}
+
+	// 自動作成が無効なら、紐付けられない利用者は拒否する
+	service.autoCreate = false
+	if _, err := signIn(jwt.MapClaims{"sub": fmt.Sprintf("unknown-%d", suffix), "email": "unknown@example.com",
+		"groups": []string{"quiz-hosts"}}); !errors.Is(err, ErrOIDCNoAccount) {
+		t.Errorf("ResolveAdmin() for an unknown identity error = %v, want ErrOIDCNoAccount", err)
+	}
+
+	// 無効化された管理者はログインできない
+	if _, err := NewAuthService().SetAdminDisabled(existing.ID, true); err != nil {
+		t.Fatalf("Failed to disable admin: %v", err)
+	}
+	if _, err := signIn(jwt.MapClaims{"sub": subject, "groups": []string{"quiz-hosts"}}); !errors.Is(err, ErrAdminDisabled) {
+		t.Errorf("ResolveAdmin() for a disabled admin error = %v, want ErrAdminDisabled", err)
+	}
+}
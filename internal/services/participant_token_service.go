@@ -0,0 +1,135 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// participantTokenType is the type claim of participant tokens
+const participantTokenType = "participant"
+
+// RecoveryPINLength is the number of digits in a participant recovery PIN
+const RecoveryPINLength = 6
+
+// participantTokenAudience keeps participant tokens from being accepted where admin tokens are expected
+const participantTokenAudience = "quiz-participant"
+
+// ParticipantTokenService issues and validates participant tokens.
+// It signs with its own secret so participant and admin tokens are never interchangeable.
+type ParticipantTokenService struct {
+	secretKey  string
+	expiryTime time.Duration
+}
+
+// NewParticipantTokenService creates a new participant token service with configuration from environment variables
+func NewParticipantTokenService() *ParticipantTokenService {
+	secret := os.Getenv("PARTICIPANT_TOKEN_SECRET")
+	if secret == "" {
+		secret = defaultParticipantSecret
+	}
+
+	expiryStr := os.Getenv("PARTICIPANT_TOKEN_EXPIRY")
+	expiry := 24 * time.Hour
+	if expiryStr != "" {
+		if hours, err := strconv.Atoi(expiryStr); err == nil {
+			expiry = time.Duration(hours) * time.Hour
+		}
+	}
+
+	return &ParticipantTokenService{
+		secretKey:  secret,
+		expiryTime: expiry,
+	}
+}
+
+// GenerateToken issues a signed token identifying a participant
+func (p *ParticipantTokenService) GenerateToken(participant *models.Participant) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(p.expiryTime)
+
+	claims := &models.ParticipantClaims{
+		ParticipantID: participant.ID,
+		Nickname:      participant.Nickname,
+		Type:          participantTokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "quiz-app",
+			Audience:  jwt.ClaimStrings{participantTokenAudience},
+			Subject:   fmt.Sprintf("participant:%d", participant.ID),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(p.secretKey))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign participant token: %w", err)
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// ValidateToken validates a participant token and returns its claims
+func (p *ParticipantTokenService) ValidateToken(tokenString string) (*models.ParticipantClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.ParticipantClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(p.secretKey), nil
+	}, jwt.WithAudience(participantTokenAudience))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*models.ParticipantClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Type != participantTokenType {
+		return nil, ErrInvalidTokenType
+	}
+
+	return claims, nil
+}
+
+// GenerateRecoveryPIN generates a random numeric PIN that lets a participant rejoin from another device
+func (p *ParticipantTokenService) GenerateRecoveryPIN() (string, error) {
+	digits := big.NewInt(10)
+	pin := make([]byte, RecoveryPINLength)
+	for i := range pin {
+		n, err := rand.Int(rand.Reader, digits)
+		if err != nil {
+			return "", err
+		}
+		pin[i] = byte('0' + n.Int64())
+	}
+	return string(pin), nil
+}
+
+// HashRecoveryPIN generates a bcrypt hash of a recovery PIN
+func (p *ParticipantTokenService) HashRecoveryPIN(pin string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	return string(bytes), err
+}
+
+// CheckRecoveryPIN reports whether pin matches a stored recovery PIN hash
+func (p *ParticipantTokenService) CheckRecoveryPIN(hash, pin string) bool {
+	if hash == "" || pin == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pin)) == nil
+}
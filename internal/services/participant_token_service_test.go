@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+func TestParticipantTokenService_GenerateAndValidate(t *testing.T) {
+	os.Setenv("PARTICIPANT_TOKEN_SECRET", "test_participant_secret")
+
+	tokenService := NewParticipantTokenService()
+	participant := &models.Participant{ID: 42, Nickname: "tester"}
+
+	token, expiresAt, err := tokenService.GenerateToken(participant)
+	if err != nil {
+		t.Fatalf("Failed to generate participant token: %v", err)
+	}
+	if token == "" || expiresAt.IsZero() {
+		t.Fatal("Expected a token and expiry")
+	}
+
+	claims, err := tokenService.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Failed to validate participant token: %v", err)
+	}
+	if claims.ParticipantID != participant.ID {
+		t.Errorf("Expected participant ID %d, got %d", participant.ID, claims.ParticipantID)
+	}
+	if claims.Nickname != participant.Nickname {
+		t.Errorf("Expected nickname %q, got %q", participant.Nickname, claims.Nickname)
+	}
+
+	if _, err := tokenService.ValidateToken(token + "x"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a tampered token, got %v", err)
+	}
+}
+
+func TestParticipantTokenService_NotInterchangeableWithAdminTokens(t *testing.T) {
+	os.Setenv("JWT_ACCESS_SECRET", "shared_secret")
+	os.Setenv("JWT_REFRESH_SECRET", "test_refresh_secret")
+	os.Setenv("PARTICIPANT_TOKEN_SECRET", "shared_secret")
+
+	jwtService := NewJWTService()
+	tokenService := NewParticipantTokenService()
+
+	// Even with the same secret, an admin access token is not a participant token
+	pair, _, err := jwtService.GenerateTokenPairWithIDs(&models.Administrator{ID: 1, Username: "admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate admin tokens: %v", err)
+	}
+	if _, err := tokenService.ValidateToken(pair.AccessToken); err == nil {
+		t.Error("Admin access token must not be accepted as a participant token")
+	}
+
+	participantToken, _, err := tokenService.GenerateToken(&models.Participant{ID: 1, Nickname: "p"})
+	if err != nil {
+		t.Fatalf("Failed to generate participant token: %v", err)
+	}
+	if _, err := jwtService.ValidateAccessToken(participantToken); err == nil {
+		t.Error("Participant token must not be accepted as an admin access token")
+	}
+}
+
+func TestParticipantTokenService_RecoveryPIN(t *testing.T) {
+	tokenService := NewParticipantTokenService()
+
+	pin, err := tokenService.GenerateRecoveryPIN()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery PIN: %v", err)
+	}
+	if len(pin) != RecoveryPINLength {
+		t.Fatalf("Expected a %d digit PIN, got %q", RecoveryPINLength, pin)
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			t.Fatalf("Expected a numeric PIN, got %q", pin)
+		}
+	}
+
+	hash, err := tokenService.HashRecoveryPIN(pin)
+	if err != nil {
+		t.Fatalf("Failed to hash recovery PIN: %v", err)
+	}
+	if !tokenService.CheckRecoveryPIN(hash, pin) {
+		t.Error("Expected the PIN to match its hash")
+	}
+	if tokenService.CheckRecoveryPIN(hash, "abcdef") {
+		t.Error("Expected a different PIN not to match")
+	}
+	if tokenService.CheckRecoveryPIN("", pin) {
+		t.Error("Participants without a stored PIN cannot be recovered by PIN")
+	}
+}
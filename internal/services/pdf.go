@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"unicode/utf16"
+)
+
+const (
+	// A4LandscapeWidth and A4LandscapeHeight are the size of an A4 landscape page in PDF points
+	A4LandscapeWidth  = 841.89
+	A4LandscapeHeight = 595.28
+
+	pdfJPEGQuality = 90
+)
+
+// EncodePDF writes a single-page PDF of the given size in points with the image stretched
+// over the whole page. The image is embedded as a JPEG, which every PDF reader supports.
+func EncodePDF(w io.Writer, img image.Image, width, height float64, title string) error {
+	var jpegData bytes.Buffer
+	if err := jpeg.Encode(&jpegData, img, &jpeg.Options{Quality: pdfJPEGQuality}); err != nil {
+		return fmt.Errorf("failed to encode page image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	contents := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q\n", width, height)
+	objects := [][]byte{
+		[]byte("<< /Type /Catalog /Pages 2 0 R >>"),
+		[]byte("<< /Type /Pages /Kids [3 0 R] /Count 1 >>"),
+		fmt.Appendf(nil, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 5 0 R >> >> /Contents 4 0 R >>",
+			width, height),
+		fmt.Appendf(nil, "<< /Length %d >>\nstream\n%sendstream", len(contents), contents),
+		append(fmt.Appendf(nil, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n",
+			bounds.Dx(), bounds.Dy(), jpegData.Len()), append(jpegData.Bytes(), "\nendstream"...)...),
+		fmt.Appendf(nil, "<< /Title %s /Producer (quiz) >>", pdfTextString(title)),
+	}
+
+	var buf bytes.Buffer
+	// The binary comment marks the file as binary for transfer tools
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(object)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfTextString encodes s as a UTF-16 hex string so that titles in any script display correctly
+func pdfTextString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&buf, "%04X", unit)
+	}
+	buf.WriteString(">")
+	return buf.String()
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queryFilter builds the WHERE clause of a filtered list query. Each condition matches every
+// row when its value is zero, empty or nil, so unset filters need no special casing.
+type queryFilter struct {
+	conditions []string
+	args       []any
+}
+
+// arg adds a query argument and returns its placeholder number
+func (f *queryFilter) arg(value any) int {
+	f.args = append(f.args, value)
+	return len(f.args)
+}
+
+// id matches column to a non-zero ID
+func (f *queryFilter) id(column string, value int64) {
+	n := f.arg(value)
+	f.conditions = append(f.conditions, fmt.Sprintf("($%d = 0 OR %s = $%d)", n, column, n))
+}
+
+// text matches column to a non-empty string
+func (f *queryFilter) text(column, value string) {
+	n := f.arg(value)
+	f.conditions = append(f.conditions, fmt.Sprintf("($%d = '' OR %s = $%d)", n, column, n))
+}
+
+// bool matches column to a non-nil boolean
+func (f *queryFilter) bool(column string, value *bool) {
+	n := f.arg(value)
+	f.conditions = append(f.conditions, fmt.Sprintf("($%d::BOOLEAN IS NULL OR %s = $%d)", n, column, n))
+}
+
+// timeRange matches column from from (inclusive) to to (exclusive); a nil bound is open.
+// The bounds are compared as TIMESTAMPTZ so that their offset is kept: a TIMESTAMP column holds
+// the database's local time, which PostgreSQL converts in the session time zone.
+func (f *queryFilter) timeRange(column string, from, to *time.Time) {
+	n := f.arg(from)
+	f.conditions = append(f.conditions, fmt.Sprintf("($%d::TIMESTAMPTZ IS NULL OR %s >= $%d::TIMESTAMPTZ)", n, column, n))
+	n = f.arg(to)
+	f.conditions = append(f.conditions, fmt.Sprintf("($%d::TIMESTAMPTZ IS NULL OR %s < $%d::TIMESTAMPTZ)", n, column, n))
+}
+
+// where returns the WHERE clause and its arguments
+func (f *queryFilter) where() (string, []any) {
+	if len(f.conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(f.conditions, " AND "), f.args
+}
+
+// pageClause returns the LIMIT and OFFSET clause of a page following the arguments of a
+// WHERE clause, and the arguments with the page's appended
+func pageClause(args []any, page, limit int) (string, []any) {
+	n := len(args)
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", n+1, n+2), append(args, limit, (page-1)*limit)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryFilter(t *testing.T) {
+	var empty queryFilter
+	if where, args := empty.where(); where != "" || args != nil {
+		t.Errorf("Expected no WHERE clause without conditions, got %q %v", where, args)
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	success := true
+	var filter queryFilter
+	filter.id("admin_id", 3)
+	filter.text("username", "alice")
+	filter.bool("success", &success)
+	filter.timeRange("created_at", &from, nil)
+
+	where, args := filter.where()
+	want := "WHERE ($1 = 0 OR admin_id = $1) AND ($2 = '' OR username = $2) AND ($3::BOOLEAN IS NULL OR success = $3)" +
+		" AND ($4::TIMESTAMPTZ IS NULL OR created_at >= $4::TIMESTAMPTZ) AND ($5::TIMESTAMPTZ IS NULL OR created_at < $5::TIMESTAMPTZ)"
+	if where != want {
+		t.Errorf("where() = %q, want %q", where, want)
+	}
+	if len(args) != 5 || args[0] != int64(3) || args[1] != "alice" || args[2] != &success || args[3] != &from || args[4] != (*time.Time)(nil) {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+
+	// The page follows the filter's arguments
+	limit, pageArgs := pageClause(args, 3, 20)
+	if limit != "LIMIT $6 OFFSET $7" || len(pageArgs) != 7 || pageArgs[5] != 20 || pageArgs[6] != 40 {
+		t.Errorf("pageClause() = %q %v", limit, pageArgs)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultRedisEventChannel is the pub/sub channel used for real-time events
+	DefaultRedisEventChannel = "quiz:events"
+	redisConnectTimeout      = 5 * time.Second
+)
+
+// RedisBroker implements EventBroker using Redis pub/sub so that every API
+// replica receives the events published by the others
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+	seqKey  string
+
+	mu      sync.Mutex
+	pubsubs []*redis.PubSub
+}
+
+// NewRedisBroker creates a new RedisBroker connected to the Redis server at addr
+func NewRedisBroker(addr, password, channel string) (*RedisBroker, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisConnectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisBroker{
+		client:  client,
+		channel: channel,
+		seqKey:  channel + ":seq",
+	}, nil
+}
+
+// NextSequence returns the next event ID shared by all replicas
+func (b *RedisBroker) NextSequence(ctx context.Context) (int64, error) {
+	id, err := b.client.Incr(ctx, b.seqKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate event id: %w", err)
+	}
+	return id, nil
+}
+
+// Publish sends payload to the event channel
+func (b *RedisBroker) Publish(ctx context.Context, payload []byte) error {
+	if err := b.client.Publish(ctx, b.channel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe starts delivering messages from the event channel to handler
+func (b *RedisBroker) Subscribe(ctx context.Context, handler func(payload []byte)) error {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+
+	// Wait for the subscription to be confirmed so no message published afterwards is lost
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return fmt.Errorf("failed to subscribe to %s: %w", b.channel, err)
+	}
+
+	b.mu.Lock()
+	b.pubsubs = append(b.pubsubs, pubsub)
+	b.mu.Unlock()
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			handler([]byte(msg.Payload))
+		}
+		log.Printf("Redis subscription to %s closed", b.channel)
+	}()
+
+	return nil
+}
+
+// Close closes all subscriptions and the Redis client
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	for _, pubsub := range b.pubsubs {
+		_ = pubsub.Close()
+	}
+	b.pubsubs = nil
+	b.mu.Unlock()
+
+	return b.client.Close()
+}
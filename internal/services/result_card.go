@@ -0,0 +1,396 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/Tattsum/quiz/internal/models"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// CardWidth and CardHeight are the size of a result card, the usual size of a link preview image
+	CardWidth  = 1200
+	CardHeight = 630
+	// CertificateWidth and CertificateHeight are the size of a certificate, A4 landscape at 150 dpi
+	CertificateWidth  = 1754
+	CertificateHeight = 1240
+
+	lifelineSkip   = "skip"
+	lifelineDouble = "double"
+)
+
+// ErrMissingGlyphs is returned when the fonts cannot draw some of the text, such as Japanese
+// nicknames with the Go fonts. Set CERTIFICATE_FONT_FILE to a font that covers the text.
+var ErrMissingGlyphs = errors.New("font has no glyphs for the text")
+
+var (
+	cardBackground  = color.RGBA{0x1e, 0x29, 0x3b, 0xff}
+	cardAccent      = color.RGBA{0xf5, 0x9e, 0x0b, 0xff}
+	cardText        = color.RGBA{0xf8, 0xfa, 0xfc, 0xff}
+	cardMuted       = color.RGBA{0x94, 0xa3, 0xb8, 0xff}
+	certificateText = color.RGBA{0x1e, 0x29, 0x3b, 0xff}
+	certificateMute = color.RGBA{0x64, 0x74, 0x8b, 0xff}
+	questionCorrect = color.RGBA{0x16, 0xa3, 0x4a, 0xff}
+	questionWrong   = color.RGBA{0xdc, 0x26, 0x26, 0xff}
+	questionSkipped = color.RGBA{0x9c, 0xa3, 0xaf, 0xff}
+)
+
+// ResultRenderer draws result cards and certificates from a participant's result summary.
+// Labels are in Japanese when the fonts cover them. The Go fonts only cover Latin scripts, so
+// without CERTIFICATE_FONT_FILE labels are in English and text the fonts cannot draw, such as
+// Japanese event names and nicknames, is refused with ErrMissingGlyphs instead of drawn as boxes.
+type ResultRenderer struct {
+	regular *sfnt.Font
+	bold    *sfnt.Font
+	labels  resultLabels
+}
+
+// resultLabels are the fixed texts of result cards and certificates
+type resultLabels struct {
+	// Card stats: rank, participants and top percent are formats, the others labels
+	rank, ofParticipants, topPercent, percentile, points, correct, accuracy string
+	// Certificate lines: placed formats the rank, participants and top percent, and scored
+	// the points, correct answers, answers and accuracy, in that order
+	certificateTitle, certificateIntro, placed, scored, dateLayout string
+}
+
+var (
+	japaneseResultLabels = resultLabels{
+		rank:             "%d位",
+		ofParticipants:   "%d人中",
+		topPercent:       "上位%d%%",
+		percentile:       "順位",
+		points:           "点",
+		correct:          "正解",
+		accuracy:         "正答率",
+		certificateTitle: "参加証",
+		certificateIntro: "以下の方の参加を証します",
+		placed:           "参加者%[2]d人中 %[1]d位（上位%[3]d%%）",
+		scored:           "%[1]d点・%[3]d問中%[2]d問正解（正答率%.0[4]f%%）",
+		dateLayout:       "2006年1月2日",
+	}
+	englishResultLabels = resultLabels{
+		rank:             "#%d",
+		ofParticipants:   "of %d",
+		topPercent:       "Top %d%%",
+		percentile:       "percentile",
+		points:           "points",
+		correct:          "correct",
+		accuracy:         "accuracy",
+		certificateTitle: "Certificate of Participation",
+		certificateIntro: "This certifies that",
+		placed:           "placed #%d of %d participants (top %d%%)",
+		scored:           "with %d points, %d of %d correct (%.0f%% accuracy)",
+		dateLayout:       "January 2, 2006",
+	}
+)
+
+// NewResultRenderer creates a result renderer with the fonts from environment variables.
+// CERTIFICATE_FONT_FILE and CERTIFICATE_BOLD_FONT_FILE are TrueType or OpenType fonts;
+// the bold font defaults to the regular one, and both default to the Go fonts.
+func NewResultRenderer() (*ResultRenderer, error) {
+	regular, bold := goregular.TTF, gobold.TTF
+
+	if path := os.Getenv("CERTIFICATE_FONT_FILE"); path != "" {
+		data, err := os.ReadFile(path) // #nosec G304 -- path comes from server configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate font: %w", err)
+		}
+		regular, bold = data, data
+	}
+
+	if path := os.Getenv("CERTIFICATE_BOLD_FONT_FILE"); path != "" {
+		data, err := os.ReadFile(path) // #nosec G304 -- path comes from server configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate bold font: %w", err)
+		}
+		bold = data
+	}
+
+	return NewResultRendererWithFonts(regular, bold)
+}
+
+// NewResultRendererWithFonts creates a result renderer with explicit font data
+func NewResultRendererWithFonts(regular, bold []byte) (*ResultRenderer, error) {
+	regularFont, err := sfnt.Parse(regular)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse regular font: %w", err)
+	}
+	boldFont, err := sfnt.Parse(bold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bold font: %w", err)
+	}
+	r := &ResultRenderer{regular: regularFont, bold: boldFont, labels: englishResultLabels}
+	if r.canDraw(japaneseResultLabels.strings()...) {
+		r.labels = japaneseResultLabels
+	}
+	return r, nil
+}
+
+// strings returns the labels, with the date layout standing in for dates
+func (l resultLabels) strings() []string {
+	return []string{l.rank, l.ofParticipants, l.topPercent, l.percentile, l.points, l.correct, l.accuracy,
+		l.certificateTitle, l.certificateIntro, l.placed, l.scored, l.dateLayout}
+}
+
+// canDraw reports whether both fonts have a glyph for every character of the texts
+func (r *ResultRenderer) canDraw(texts ...string) bool {
+	for _, f := range []*sfnt.Font{r.regular, r.bold} {
+		for _, s := range texts {
+			if !hasGlyphs(f, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasGlyphs reports whether a font has a glyph for every character of s other than spaces
+func hasGlyphs(f *sfnt.Font, s string) bool {
+	var buf sfnt.Buffer
+	for _, char := range s {
+		if unicode.IsSpace(char) {
+			continue
+		}
+		if index, err := f.GlyphIndex(&buf, char); err != nil || index == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RenderCard draws a result card to share on social media. It returns ErrMissingGlyphs if the
+// fonts cannot draw the event name or nickname.
+func (r *ResultRenderer) RenderCard(summary *models.ResultSummary) (image.Image, error) {
+	if !r.canDraw(summary.EventName, summary.Nickname) {
+		return nil, ErrMissingGlyphs
+	}
+
+	canvas := &textCanvas{RGBA: image.NewRGBA(image.Rect(0, 0, CardWidth, CardHeight)), renderer: r}
+	canvas.fill(canvas.Bounds(), cardBackground)
+	canvas.fill(image.Rect(0, 0, CardWidth, 12), cardAccent)
+
+	const margin = 64
+	width := CardWidth - 2*margin
+	if err := canvas.text(margin, 92, width, r.regular, 30, cardMuted, summary.EventName); err != nil {
+		return nil, err
+	}
+	if err := canvas.text(margin, 172, width, r.bold, 60, cardText, summary.Nickname); err != nil {
+		return nil, err
+	}
+
+	labels := r.labels
+	stats := []struct{ value, label string }{
+		{fmt.Sprintf(labels.rank, summary.Rank), fmt.Sprintf(labels.ofParticipants, summary.TotalParticipants)},
+		{fmt.Sprintf(labels.topPercent, topPercent(summary.Rank, summary.TotalParticipants)), labels.percentile},
+		{fmt.Sprintf("%d", summary.TotalScore), labels.points},
+		{fmt.Sprintf("%d/%d", summary.CorrectAnswers, summary.TotalAnswers), labels.correct},
+		{fmt.Sprintf("%.0f%%", summary.AccuracyRate*100), labels.accuracy},
+	}
+	column := width / len(stats)
+	for i, stat := range stats {
+		x := margin + i*column
+		if err := canvas.text(x, 290, column-16, r.bold, 52, cardAccent, stat.value); err != nil {
+			return nil, err
+		}
+		if err := canvas.text(x, 330, column-16, r.regular, 24, cardMuted, stat.label); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := canvas.questionGrid(image.Rect(margin, 380, CardWidth-margin, CardHeight-48), summary.Questions, cardText); err != nil {
+		return nil, err
+	}
+	return canvas.RGBA, nil
+}
+
+// RenderCertificate draws a printable certificate of participation. It returns ErrMissingGlyphs
+// if the fonts cannot draw the event name or nickname.
+func (r *ResultRenderer) RenderCertificate(summary *models.ResultSummary) (image.Image, error) {
+	if !r.canDraw(summary.EventName, summary.Nickname) {
+		return nil, ErrMissingGlyphs
+	}
+
+	canvas := &textCanvas{RGBA: image.NewRGBA(image.Rect(0, 0, CertificateWidth, CertificateHeight)), renderer: r}
+	canvas.fill(canvas.Bounds(), color.White)
+	canvas.frame(image.Rect(48, 48, CertificateWidth-48, CertificateHeight-48), 10, cardAccent)
+	canvas.frame(image.Rect(76, 76, CertificateWidth-76, CertificateHeight-76), 2, certificateText)
+
+	const margin = 160
+	width := CertificateWidth - 2*margin
+	labels := r.labels
+	lines := []struct {
+		y     int
+		face  *sfnt.Font
+		size  float64
+		color color.Color
+		text  string
+	}{
+		{260, r.bold, 84, certificateText, labels.certificateTitle},
+		{360, r.regular, 44, certificateMute, summary.EventName},
+		{480, r.regular, 36, certificateMute, labels.certificateIntro},
+		{600, r.bold, 96, certificateText, summary.Nickname},
+		{720, r.regular, 40, certificateText, fmt.Sprintf(labels.placed,
+			summary.Rank, summary.TotalParticipants, topPercent(summary.Rank, summary.TotalParticipants))},
+		{790, r.regular, 40, certificateText, fmt.Sprintf(labels.scored,
+			summary.TotalScore, summary.CorrectAnswers, summary.TotalAnswers, summary.AccuracyRate*100)},
+		{CertificateHeight - 130, r.regular, 28, certificateMute, summary.GeneratedAt.Format(labels.dateLayout)},
+	}
+	for _, line := range lines {
+		if err := canvas.centeredText(line.y, margin, width, line.face, line.size, line.color, line.text); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := canvas.questionGrid(image.Rect(margin, 850, CertificateWidth-margin, CertificateHeight-190), summary.Questions, color.White); err != nil {
+		return nil, err
+	}
+	return canvas.RGBA, nil
+}
+
+// topPercent returns the smallest whole percentage of participants the rank falls within
+func topPercent(rank, totalParticipants int) int {
+	if totalParticipants < 1 {
+		return 100
+	}
+	return max(1, int(math.Ceil(float64(rank)*100/float64(totalParticipants))))
+}
+
+// textCanvas is an image with helpers to draw text and shapes
+type textCanvas struct {
+	*image.RGBA
+	renderer *ResultRenderer
+}
+
+// fill paints a rectangle with a solid color
+func (c *textCanvas) fill(rect image.Rectangle, col color.Color) {
+	draw.Draw(c.RGBA, rect, image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+// frame paints the border of a rectangle
+func (c *textCanvas) frame(rect image.Rectangle, thickness int, col color.Color) {
+	c.fill(image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+thickness), col)
+	c.fill(image.Rect(rect.Min.X, rect.Max.Y-thickness, rect.Max.X, rect.Max.Y), col)
+	c.fill(image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+thickness, rect.Max.Y), col)
+	c.fill(image.Rect(rect.Max.X-thickness, rect.Min.Y, rect.Max.X, rect.Max.Y), col)
+}
+
+// face creates a font face; faces are not safe for concurrent use, so each drawing creates its own
+func (c *textCanvas) face(f *sfnt.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// text draws a line of text with its baseline at y, shortened with an ellipsis to fit maxWidth
+func (c *textCanvas) text(x, y, maxWidth int, f *sfnt.Font, size float64, col color.Color, s string) error {
+	face, err := c.face(f, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = face.Close() // Ignore close error in defer
+	}()
+
+	s = fitText(face, s, maxWidth)
+	drawer := &font.Drawer{Dst: c.RGBA, Src: image.NewUniform(col), Face: face, Dot: fixed.P(x, y)}
+	drawer.DrawString(s)
+	return nil
+}
+
+// centeredText draws a line of text centered within maxWidth from x
+func (c *textCanvas) centeredText(y, x, maxWidth int, f *sfnt.Font, size float64, col color.Color, s string) error {
+	face, err := c.face(f, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = face.Close() // Ignore close error in defer
+	}()
+
+	s = fitText(face, s, maxWidth)
+	offset := (maxWidth - font.MeasureString(face, s).Ceil()) / 2
+	drawer := &font.Drawer{Dst: c.RGBA, Src: image.NewUniform(col), Face: face, Dot: fixed.P(x+offset, y)}
+	drawer.DrawString(s)
+	return nil
+}
+
+// fitText shortens s with an ellipsis until it fits maxWidth
+func fitText(face font.Face, s string, maxWidth int) string {
+	if font.MeasureString(face, s).Ceil() <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		shortened := strings.TrimSpace(string(runes)) + "…"
+		if font.MeasureString(face, shortened).Ceil() <= maxWidth {
+			return shortened
+		}
+	}
+	return ""
+}
+
+// questionGrid draws one square per question, centered in rect: green if correct, red if wrong
+// and grey if skipped, numbered in order and marked ×2 when the double lifeline was used.
+// Squares shrink so that every question fits.
+func (c *textCanvas) questionGrid(rect image.Rectangle, questions []models.ParticipantAnswer, labelColor color.Color) error {
+	if len(questions) == 0 {
+		return nil
+	}
+
+	// Find the largest square size that fits all questions
+	size := min(rect.Dy(), 72)
+	for ; size > 8; size-- {
+		gap := size / 6
+		perRow := max(1, (rect.Dx()+gap)/(size+gap))
+		rows := (len(questions) + perRow - 1) / perRow
+		if rows*(size+gap)-gap <= rect.Dy() {
+			break
+		}
+	}
+	gap := size / 6
+	perRow := min(max(1, (rect.Dx()+gap)/(size+gap)), len(questions))
+	rows := (len(questions) + perRow - 1) / perRow
+	left := rect.Min.X + (rect.Dx()-(perRow*(size+gap)-gap))/2
+	top := rect.Min.Y + (rect.Dy()-(rows*(size+gap)-gap))/2
+
+	for i, question := range questions {
+		x := left + (i%perRow)*(size+gap)
+		y := top + (i/perRow)*(size+gap)
+		square := image.Rect(x, y, x+size, y+size)
+
+		col := questionWrong
+		switch {
+		case question.Lifeline != nil && *question.Lifeline == lifelineSkip:
+			col = questionSkipped
+		case question.IsCorrect:
+			col = questionCorrect
+		}
+		c.fill(square, col)
+
+		if size < 24 {
+			continue
+		}
+		label := fmt.Sprintf("%d", i+1)
+		if question.Lifeline != nil && *question.Lifeline == lifelineDouble {
+			label += " ×2"
+		}
+		labelSize := float64(size) * 0.36
+		if err := c.centeredText(y+size/2+int(labelSize*0.35), x, size, c.renderer.bold, labelSize, labelColor, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
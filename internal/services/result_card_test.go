@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+func testResultSummary(questionCount int) *models.ResultSummary {
+	skip, double := lifelineSkip, lifelineDouble
+	summary := &models.ResultSummary{
+		EventName:         "Year End Party Quiz",
+		ParticipantID:     1,
+		Nickname:          "Taro",
+		Rank:              3,
+		TotalParticipants: 40,
+		Percentile:        95,
+		TotalAnswers:      questionCount - 1,
+		CorrectAnswers:    questionCount / 2,
+		SkippedAnswers:    1,
+		AccuracyRate:      0.5,
+		TotalScore:        questionCount/2 + 1,
+		Final:             true,
+		GeneratedAt:       time.Date(2026, 12, 24, 21, 0, 0, 0, time.UTC),
+	}
+	for i := range questionCount {
+		answer := models.ParticipantAnswer{QuizID: int64(i + 1), IsCorrect: i%2 == 0}
+		switch i {
+		case 0:
+			answer.Lifeline = &double
+		case 1:
+			answer.Lifeline = &skip
+		}
+		summary.Questions = append(summary.Questions, answer)
+	}
+	return summary
+}
+
+func TestResultRenderer_RenderCard(t *testing.T) {
+	renderer, err := NewResultRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	for _, questionCount := range []int{0, 10, 200} {
+		t.Run(fmt.Sprintf("%d questions", questionCount), func(t *testing.T) {
+			img, err := renderer.RenderCard(testResultSummary(questionCount))
+			if err != nil {
+				t.Fatalf("Failed to render card: %v", err)
+			}
+			if img.Bounds() != image.Rect(0, 0, CardWidth, CardHeight) {
+				t.Errorf("Unexpected card size %v", img.Bounds())
+			}
+
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				t.Fatalf("Failed to encode card: %v", err)
+			}
+			if _, err := png.Decode(&buf); err != nil {
+				t.Errorf("Card is not a valid PNG: %v", err)
+			}
+		})
+	}
+}
+
+func TestResultRenderer_QuestionColors(t *testing.T) {
+	renderer, err := NewResultRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	// Three questions fit in one row, so each square's top-left corner has its own color
+	summary := testResultSummary(3)
+	img, err := renderer.RenderCard(summary)
+	if err != nil {
+		t.Fatalf("Failed to render card: %v", err)
+	}
+
+	rect := image.Rect(64, 380, CardWidth-64, CardHeight-48)
+	size := min(rect.Dy(), 72)
+	gap := size / 6
+	left := rect.Min.X + (rect.Dx()-(3*(size+gap)-gap))/2
+	top := rect.Min.Y + (rect.Dy()-size)/2
+	for i, expected := range []any{questionCorrect, questionSkipped, questionCorrect} {
+		got := img.At(left+i*(size+gap)+1, top+1)
+		if got != expected {
+			t.Errorf("Question %d: expected color %v, got %v", i+1, expected, got)
+		}
+	}
+}
+
+func TestResultRenderer_LongText(t *testing.T) {
+	renderer, err := NewResultRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	summary := testResultSummary(5)
+	summary.EventName = strings.Repeat("Very Long Event Name ", 20)
+	summary.Nickname = strings.Repeat("W", 50)
+	if _, err := renderer.RenderCertificate(summary); err != nil {
+		t.Errorf("Failed to render certificate with long text: %v", err)
+	}
+}
+
+func TestResultRenderer_MissingGlyphs(t *testing.T) {
+	renderer, err := NewResultRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	// The Go fonts have no Japanese glyphs, so labels fall back to English
+	if renderer.labels != englishResultLabels {
+		t.Errorf("Expected English labels with the Go fonts, got %+v", renderer.labels)
+	}
+
+	summary := testResultSummary(3)
+	summary.Nickname = "たなか"
+	if _, err := renderer.RenderCard(summary); !errors.Is(err, ErrMissingGlyphs) {
+		t.Errorf("RenderCard() error = %v, want ErrMissingGlyphs", err)
+	}
+	summary.Nickname = "Taro"
+	summary.EventName = "忘年会クイズ"
+	if _, err := renderer.RenderCertificate(summary); !errors.Is(err, ErrMissingGlyphs) {
+		t.Errorf("RenderCertificate() error = %v, want ErrMissingGlyphs", err)
+	}
+}
+
+func TestJapaneseResultLabels(t *testing.T) {
+	labels := japaneseResultLabels
+	if got := fmt.Sprintf(labels.placed, 3, 40, 8); got != "参加者40人中 3位（上位8%）" {
+		t.Errorf("Unexpected rank line %q", got)
+	}
+	if got := fmt.Sprintf(labels.scored, 6, 5, 9, 55.6); got != "6点・9問中5問正解（正答率56%）" {
+		t.Errorf("Unexpected score line %q", got)
+	}
+	if got := time.Date(2026, 12, 24, 21, 0, 0, 0, time.UTC).Format(labels.dateLayout); got != "2026年12月24日" {
+		t.Errorf("Unexpected date %q", got)
+	}
+}
+
+func TestNewResultRendererWithFonts_Invalid(t *testing.T) {
+	if _, err := NewResultRendererWithFonts([]byte("not a font"), nil); err == nil {
+		t.Error("Expected an error for invalid font data")
+	}
+}
+
+func TestTopPercent(t *testing.T) {
+	tests := []struct {
+		rank, total, expected int
+	}{
+		{1, 1, 100},
+		{1, 200, 1},
+		{3, 40, 8},
+		{40, 40, 100},
+		{1, 0, 100},
+	}
+
+	for _, tt := range tests {
+		if got := topPercent(tt.rank, tt.total); got != tt.expected {
+			t.Errorf("topPercent(%d, %d) = %d, want %d", tt.rank, tt.total, got, tt.expected)
+		}
+	}
+}
+
+func TestEncodePDF(t *testing.T) {
+	renderer, err := NewResultRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	img, err := renderer.RenderCertificate(testResultSummary(10))
+	if err != nil {
+		t.Fatalf("Failed to render certificate: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodePDF(&buf, img, A4LandscapeWidth, A4LandscapeHeight, "忘年会クイズ"); err != nil {
+		t.Fatalf("Failed to encode PDF: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("Expected a PDF header and trailer")
+	}
+	if !bytes.Contains(pdf, []byte("/MediaBox [0 0 841.89 595.28]")) {
+		t.Error("Expected an A4 landscape page")
+	}
+	if !bytes.Contains(pdf, []byte("<FEFF5FD85E744F1A30AF30A430BA>")) {
+		t.Error("Expected the title as a UTF-16 string")
+	}
+
+	// Every xref entry must point at the start of its object
+	var xref int
+	startxref := bytes.LastIndex(pdf, []byte("startxref\n"))
+	if _, err := fmt.Sscanf(string(pdf[startxref:]), "startxref\n%d", &xref); err != nil {
+		t.Fatalf("Failed to read startxref: %v", err)
+	}
+	lines := strings.Split(string(pdf[xref:]), "\n")
+	for i := 1; i <= 6; i++ {
+		var offset int
+		if _, err := fmt.Sscanf(lines[2+i], "%d", &offset); err != nil {
+			t.Fatalf("Failed to read xref entry %d: %v", i, err)
+		}
+		if !bytes.HasPrefix(pdf[offset:], fmt.Appendf(nil, "%d 0 obj", i)) {
+			t.Errorf("xref entry %d points at the wrong offset %d", i, offset)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultRedisRevocationPrefix is the key prefix of revoked token IDs in Redis
+	DefaultRedisRevocationPrefix = "quiz:revoked:"
+	// revocationSweepInterval is how often expired entries are purged from the in-memory
+	// and PostgreSQL stores
+	revocationSweepInterval = time.Minute
+)
+
+// RevocationStore records revoked token IDs (the jti claim) until the token expires.
+// Expired entries are removed automatically, since an expired token is rejected anyway.
+type RevocationStore interface {
+	// Revoke marks a token ID as revoked until expiresAt
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsRevoked reports whether a token ID has been revoked and has not yet expired
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	// Close releases the store's resources
+	Close() error
+}
+
+// MemoryRevocationStore implements RevocationStore within a single process. Revocations
+// are lost on restart and are not shared between replicas.
+type MemoryRevocationStore struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRevocationStore creates a new MemoryRevocationStore instance
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		entries: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Revoke marks a token ID as revoked until expiresAt, purging expired entries
+// at most once per sweep interval
+func (s *MemoryRevocationStore) Revoke(_ context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= revocationSweepInterval {
+		for id, expiry := range s.entries {
+			if !expiry.After(now) {
+				delete(s.entries, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expiresAt.After(now) {
+		s.entries[tokenID] = expiresAt
+	}
+	return nil
+}
+
+// IsRevoked reports whether a token ID has been revoked and has not yet expired
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.entries[tokenID]
+	return ok && expiresAt.After(s.now()), nil
+}
+
+// Len returns the number of stored entries, including expired ones not yet purged
+func (s *MemoryRevocationStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Close removes all entries
+func (s *MemoryRevocationStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]time.Time)
+	return nil
+}
+
+// PostgresRevocationStore implements RevocationStore with the revoked_tokens table,
+// so that revocations survive restarts and are shared by every replica. Expiry times are
+// stored and compared in UTC, because the column has no time zone and the application and
+// database may run in different zones.
+type PostgresRevocationStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresRevocationStore creates a new PostgresRevocationStore using db
+func NewPostgresRevocationStore(db *sql.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{db: db}
+}
+
+// Revoke inserts a token ID, purging expired rows at most once per sweep interval
+func (s *PostgresRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if s.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+									 ON CONFLICT (jti) DO UPDATE SET expires_at = GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)`,
+		tokenID, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	s.mu.Lock()
+	sweep := time.Since(s.lastSweep) >= revocationSweepInterval
+	if sweep {
+		s.lastSweep = time.Now()
+	}
+	s.mu.Unlock()
+	if sweep {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at <= $1", time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to purge expired revocations: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsRevoked reports whether a token ID has an unexpired row
+func (s *PostgresRevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if s.db == nil {
+		return false, errors.New("database connection not initialized")
+	}
+
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > $2)", tokenID, time.Now().UTC()).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// Close does nothing; the database connection is owned by the caller
+func (s *PostgresRevocationStore) Close() error {
+	return nil
+}
+
+// RedisRevocationStore implements RevocationStore with Redis keys that expire with the token
+type RedisRevocationStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisRevocationStore creates a new RedisRevocationStore connected to the Redis server at addr
+func NewRedisRevocationStore(addr, password, prefix string) (*RedisRevocationStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisConnectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisRevocationStore{client: client, prefix: prefix}, nil
+}
+
+// Revoke sets a key for the token ID that expires when the token does
+func (s *RedisRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.client.Set(ctx, s.prefix+tokenID, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether the key for the token ID exists
+func (s *RedisRevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+tokenID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Close closes the Redis client
+func (s *RedisRevocationStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/Tattsum/quiz/internal/database"
+)
+
+func TestMemoryRevocationStore_Expiry(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := store.Revoke(ctx, "short", now.Add(time.Minute)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+	if err := store.Revoke(ctx, "long", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+	if err := store.Revoke(ctx, "expired", now.Add(-time.Second)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+
+	for id, want := range map[string]bool{"short": true, "long": true, "expired": false, "unknown": false} {
+		if revoked, _ := store.IsRevoked(ctx, id); revoked != want {
+			t.Errorf("IsRevoked(%q) = %v, want %v", id, revoked, want)
+		}
+	}
+	if store.Len() != 2 {
+		t.Errorf("expected an already expired token not to be stored, got %d entries", store.Len())
+	}
+
+	// The short entry expires with its token and is purged by a later revocation
+	now = now.Add(2 * time.Minute)
+	if revoked, _ := store.IsRevoked(ctx, "short"); revoked {
+		t.Error("expected the revocation to expire with the token")
+	}
+	if err := store.Revoke(ctx, "new", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("expected expired entries to be purged, got %d entries", store.Len())
+	}
+	if revoked, _ := store.IsRevoked(ctx, "long"); !revoked {
+		t.Error("expected an unexpired revocation to be kept")
+	}
+}
+
+func TestRedisRevocationStore_Expiry(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	store, err := NewRedisRevocationStore(server.Addr(), "", DefaultRedisRevocationPrefix)
+	if err != nil {
+		t.Fatalf("NewRedisRevocationStore() failed: %v", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+	ctx := context.Background()
+
+	if err := store.Revoke(ctx, "token-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+	if revoked, err := store.IsRevoked(ctx, "token-1"); err != nil || !revoked {
+		t.Errorf("IsRevoked() = %v, %v, want true", revoked, err)
+	}
+	if revoked, _ := store.IsRevoked(ctx, "token-2"); revoked {
+		t.Error("expected an unknown token not to be revoked")
+	}
+	if ttl := server.TTL(DefaultRedisRevocationPrefix + "token-1"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("expected the key to expire with the token, got TTL %v", ttl)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if revoked, _ := store.IsRevoked(ctx, "token-1"); revoked {
+		t.Error("expected the revocation to expire with the token")
+	}
+}
+
+func TestPostgresRevocationStore(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	store := NewPostgresRevocationStore(db)
+	ctx := context.Background()
+	active, expired := fmt.Sprintf("active-%d", os.Getpid()), fmt.Sprintf("expired-%d", os.Getpid())
+	defer func() {
+		_, _ = db.Exec("DELETE FROM revoked_tokens WHERE jti IN ($1, $2)", active, expired)
+	}()
+
+	if err := store.Revoke(ctx, active, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+	// 再度失効させてもエラーにならない
+	if err := store.Revoke(ctx, active, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Revoke() twice failed: %v", err)
+	}
+	if err := store.Revoke(ctx, expired, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+
+	if revoked, err := store.IsRevoked(ctx, active); err != nil || !revoked {
+		t.Errorf("IsRevoked(active) = %v, %v, want true", revoked, err)
+	}
+	if revoked, err := store.IsRevoked(ctx, expired); err != nil || revoked {
+		t.Errorf("IsRevoked(expired) = %v, %v, want false", revoked, err)
+	}
+}
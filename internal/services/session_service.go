@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+var (
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated is used
+	// again. The whole family is revoked, since the token may have been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+	// ErrSessionRevoked is returned when a refresh token belongs to a revoked family
+	ErrSessionRevoked = errors.New("session has been revoked")
+)
+
+// Reasons for revoking a refresh token family
+const (
+	RevokeReasonLogout          = "logout"
+	RevokeReasonLogoutAll       = "logout_all"
+	RevokeReasonReuse           = "reuse"
+	RevokeReasonDisabled        = "disabled"
+	RevokeReasonPasswordChanged = "password_changed"
+	RevokeReasonDeleted         = "deleted"
+	RevokeReasonRoleChanged     = "role_changed"
+)
+
+// SessionService issues administrator token pairs and tracks their refresh tokens.
+// Each sign-in starts a refresh token family; every refresh rotates the token within the
+// family, and presenting a rotated token again revokes the family.
+type SessionService struct {
+	db          *sql.DB
+	jwt         *JWTService
+	revocations RevocationStore
+}
+
+// NewSessionService creates a new session service that signs tokens with jwt. Revoking a
+// family also revokes its unexpired access tokens in revocations.
+func NewSessionService(jwt *JWTService, revocations RevocationStore) *SessionService {
+	return &SessionService{
+		db:          database.GetDB(),
+		jwt:         jwt,
+		revocations: revocations,
+	}
+}
+
+// StartSession signs an administrator in, returning a token pair in a new family
+func (s *SessionService) StartSession(admin *models.Administrator) (*models.LoginResponse, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	response, ids, err := s.jwt.GenerateTokenPairWithIDs(admin)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	// Families whose tokens have all expired can no longer be used or reused
+	_, err = tx.Exec(`DELETE FROM refresh_token_families f
+					  WHERE f.admin_id = $1
+					    AND NOT EXISTS (SELECT 1 FROM refresh_tokens t WHERE t.family_id = f.id AND t.expires_at > $2)`, admin.ID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	var familyID int64
+	if err := tx.QueryRow("INSERT INTO refresh_token_families (admin_id) VALUES ($1) RETURNING id", admin.ID).Scan(&familyID); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if err := insertRefreshToken(tx, familyID, ids); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return response, nil
+}
+
+// Refresh rotates a refresh token: the token is marked as used and a new pair is issued in
+// the same family with the administrator's current role. Using a token twice revokes the
+// family and returns ErrRefreshTokenReused.
+func (s *SessionService) Refresh(refreshToken string) (*models.RefreshTokenResponse, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	claims, err := s.jwt.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID == "" {
+		// Issued before refresh tokens were recorded
+		return nil, ErrInvalidToken
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	// Lock the family so that concurrent refreshes of one family are serialized
+	var (
+		familyID int64
+		adminID  int64
+		used     bool
+		revoked  bool
+	)
+	err = tx.QueryRow(`SELECT f.id, f.admin_id, t.used_at IS NOT NULL, f.revoked_at IS NOT NULL
+					   FROM refresh_tokens t
+					   JOIN refresh_token_families f ON f.id = t.family_id
+					   WHERE t.jti = $1
+					   FOR UPDATE OF f`, claims.ID).Scan(&familyID, &adminID, &used, &revoked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if adminID != claims.AdminID {
+		return nil, ErrInvalidToken
+	}
+	if revoked {
+		return nil, ErrSessionRevoked
+	}
+	if used {
+		accessTokens, err := revokeFamilies(tx, RevokeReasonReuse, "f.id = $1", familyID)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		s.revokeAccessTokens(accessTokens)
+		log.Printf("Refresh token reuse detected for admin %d; revoked session %d", adminID, familyID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	var admin models.Administrator
+	err = scanAdmin(tx.QueryRow("SELECT "+adminColumns+" FROM administrators WHERE id = $1", adminID), &admin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAdminNotFound
+		}
+		return nil, fmt.Errorf("failed to get admin: %w", err)
+	}
+	// Disabled administrators cannot refresh; their sessions were revoked when disabled
+	if admin.DisabledAt != nil {
+		return nil, ErrAdminDisabled
+	}
+	// Once owners require two-factor authentication, administrators without it must sign in
+	// again and set it up
+	if !admin.TwoFactorEnabled {
+		required, err := twoFactorRequired(tx)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			return nil, ErrTwoFactorSetupRequired
+		}
+	}
+
+	response, ids, err := s.jwt.GenerateTokenPairWithIDs(&admin)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = NOW() WHERE jti = $1", claims.ID); err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if err := insertRefreshToken(tx, familyID, ids); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE refresh_token_families SET last_used_at = NOW() WHERE id = $1", familyID); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &models.RefreshTokenResponse{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    response.ExpiresAt,
+	}, nil
+}
+
+// EndSession revokes the family that issued an access token (logout on one device)
+func (s *SessionService) EndSession(accessTokenID string) error {
+	_, err := s.revoke(RevokeReasonLogout,
+		"f.id IN (SELECT family_id FROM refresh_tokens WHERE access_jti = $1)", accessTokenID)
+	return err
+}
+
+// RevokeAllSessions revokes every active family of an administrator and their access tokens,
+// except the family that issued exceptAccessTokenID if it is not empty. It returns the
+// number of revoked families.
+func (s *SessionService) RevokeAllSessions(adminID int64, reason, exceptAccessTokenID string) (int, error) {
+	return s.revoke(reason,
+		`f.admin_id = $1 AND f.id NOT IN (SELECT family_id FROM refresh_tokens WHERE access_jti = $2)`,
+		adminID, exceptAccessTokenID)
+}
+
+// revoke revokes the active families matching condition and then their access tokens
+func (s *SessionService) revoke(reason, condition string, args ...any) (int, error) {
+	if s.db == nil {
+		return 0, errors.New("database connection not initialized")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	accessTokens, err := revokeFamilies(tx, reason, condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.revokeAccessTokens(accessTokens)
+	return accessTokens.families, nil
+}
+
+// revokedAccessTokens are the unexpired access tokens of revoked families
+type revokedAccessTokens struct {
+	families int
+	ids      []TokenPairIDs
+}
+
+// revokeFamilies marks the active families matching condition (on alias f) as revoked and
+// returns their unexpired access tokens
+func revokeFamilies(tx *sql.Tx, reason, condition string, args ...any) (revokedAccessTokens, error) {
+	var result revokedAccessTokens
+
+	reasonArg := len(args) + 1
+	rows, err := tx.Query(fmt.Sprintf(`UPDATE refresh_token_families f
+									   SET revoked_at = NOW(), revoked_reason = $%d
+									   WHERE f.revoked_at IS NULL AND %s
+									   RETURNING f.id`, reasonArg, condition), append(args, reason)...)
+	if err != nil {
+		return result, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	var familyIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return result, fmt.Errorf("failed to scan session: %w", err)
+		}
+		familyIDs = append(familyIDs, id)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	result.families = len(familyIDs)
+	if len(familyIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err = tx.Query(`SELECT access_jti, access_expires_at FROM refresh_tokens
+						  WHERE family_id = ANY($1) AND access_expires_at > $2`, pq.Array(familyIDs), time.Now().UTC())
+	if err != nil {
+		return result, fmt.Errorf("failed to get access tokens: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var ids TokenPairIDs
+		if err := rows.Scan(&ids.AccessID, &ids.AccessExpiresAt); err != nil {
+			return result, fmt.Errorf("failed to scan access token: %w", err)
+		}
+		result.ids = append(result.ids, ids)
+	}
+	return result, rows.Err()
+}
+
+// revokeAccessTokens adds access tokens of revoked families to the revocation store.
+// Failures are logged: the tokens expire shortly and can no longer be refreshed.
+func (s *SessionService) revokeAccessTokens(tokens revokedAccessTokens) {
+	if s.revocations == nil {
+		return
+	}
+	for _, ids := range tokens.ids {
+		if err := s.revocations.Revoke(context.Background(), ids.AccessID, ids.AccessExpiresAt); err != nil {
+			log.Printf("Failed to revoke access token: %v", err)
+		}
+	}
+}
+
+// insertRefreshToken records a newly issued pair in a family. Expiry times are stored in UTC,
+// as the columns have no time zone.
+func insertRefreshToken(tx *sql.Tx, familyID int64, ids *TokenPairIDs) error {
+	_, err := tx.Exec(`INSERT INTO refresh_tokens (jti, family_id, access_jti, access_expires_at, expires_at)
+					   VALUES ($1, $2, $3, $4, $5)`,
+		ids.RefreshID, familyID, ids.AccessID, ids.AccessExpiresAt.UTC(), ids.RefreshExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record refresh token: %w", err)
+	}
+	return nil
+}
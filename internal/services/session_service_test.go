@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Tattsum/quiz/internal/database"
+)
+
+func TestSessionService_Refresh(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	suffix := os.Getpid()
+	admin, err := NewAuthService().CreateAdmin(fmt.Sprintf("refresh%d", suffix), "refreshpassword", fmt.Sprintf("refresh%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", admin.ID)
+	}()
+
+	jwtService := NewJWTService()
+	sessions := NewSessionService(jwtService, NewMemoryRevocationStore())
+	initial, err := sessions.StartSession(admin)
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+
+	// 更新すると新しいトークンの組が発行される
+	refreshed, err := sessions.Refresh(initial.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	if refreshed.AccessToken == initial.AccessToken || refreshed.RefreshToken == initial.RefreshToken {
+		t.Error("Expected a new token pair")
+	}
+	if _, err := jwtService.ValidateAccessToken(refreshed.AccessToken); err != nil {
+		t.Errorf("Expected the new access token to be valid, got %v", err)
+	}
+	if _, err := jwtService.ValidateRefreshToken(refreshed.RefreshToken); err != nil {
+		t.Errorf("Expected the new refresh token to be valid, got %v", err)
+	}
+
+	// 使用済みのリフレッシュトークンは使えず、ファミリーごと失効する
+	if _, err := sessions.Refresh(initial.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Expected reuse to be detected, got %v", err)
+	}
+	if _, err := sessions.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Expected the family to be revoked, got %v", err)
+	}
+
+	// アクセストークンはリフレッシュトークンとして使えない
+	if _, err := sessions.Refresh(initial.AccessToken); err == nil {
+		t.Error("Expected an access token to be rejected")
+	}
+}
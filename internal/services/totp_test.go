@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTP_RFC6238Vectors(t *testing.T) {
+	// Test vectors of RFC 6238 appendix B (SHA-1, 8 digits)
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		if got := hotp(key, totpStep(time.Unix(tt.unix, 0)), 8); got != tt.want {
+			t.Errorf("hotp(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() failed: %v", err)
+	}
+	if code != "050471" {
+		t.Fatalf("TOTPCode() = %s, want the last 6 digits of the RFC vector", code)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		want bool
+	}{
+		{"current period", code, now, true},
+		{"typed with a space", code[:3] + " " + code[3:], now, true},
+		{"previous period (clock drift)", code, now.Add(totpPeriod), true},
+		{"next period (clock drift)", code, now.Add(-totpPeriod), true},
+		{"too old", code, now.Add(2 * totpPeriod), false},
+		{"wrong code", "123456", now, false},
+		{"wrong length", code[:5], now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tt.code, tt.at)
+			if ok != tt.want {
+				t.Errorf("ValidateTOTP() = %v, want %v", ok, tt.want)
+			}
+			// The step is the code's own period, so replay checks work across the drift window
+			if ok && step != totpStep(now) {
+				t.Errorf("ValidateTOTP() step = %d, want %d", step, totpStep(now))
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() failed: %v", err)
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) != totpSecretSize {
+		t.Fatalf("Expected a %d byte secret, got %d bytes (%v)", totpSecretSize, len(key), err)
+	}
+	if strings.Contains(secret, "=") {
+		t.Errorf("Expected a secret without padding, got %q", secret)
+	}
+
+	other, _ := GenerateTOTPSecret()
+	if other == secret {
+		t.Error("Expected random secrets")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Quiz Night", "admin user", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("Invalid URI %q: %v", uri, err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Quiz Night:admin user" {
+		t.Errorf("Unexpected URI %q", uri)
+	}
+	query := parsed.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "Quiz Night" {
+		t.Errorf("Unexpected parameters in %q", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := generateRecoveryCode()
+	if err != nil {
+		t.Fatalf("generateRecoveryCode() failed: %v", err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Errorf("Unexpected recovery code format %q", code)
+	}
+
+	// Codes match however they are typed
+	hash := hashRecoveryCode(code)
+	for _, typed := range []string{strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), " " + code + " "} {
+		if hashRecoveryCode(typed) != hash {
+			t.Errorf("Expected %q to match %q", typed, code)
+		}
+	}
+}
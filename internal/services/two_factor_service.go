@@ -0,0 +1,386 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+	"github.com/Tattsum/quiz/internal/models"
+)
+
+var (
+	// ErrTwoFactorNotEnrolled is returned when confirming before a secret was generated
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication setup has not been started")
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling an administrator who already uses two-factor authentication
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnabled is returned when verifying a code of an administrator without two-factor authentication
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidTwoFactorCode is returned when a one-time or recovery code is wrong or was already used
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor authentication code")
+	// ErrTwoFactorRequired is returned when disabling two-factor authentication while owners require it
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for all administrators")
+	// ErrTwoFactorSetupRequired is returned when an administrator without two-factor
+	// authentication refreshes a session after owners started to require it
+	ErrTwoFactorSetupRequired = errors.New("two-factor authentication must be set up")
+)
+
+const (
+	// DefaultTOTPIssuer names the service in authenticator apps
+	DefaultTOTPIssuer = "Quiz"
+	// RecoveryCodeCount is how many recovery codes are generated at once
+	RecoveryCodeCount = 10
+)
+
+// recoveryCodeEncoding writes recovery codes in lower case without ambiguous padding
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// TwoFactorService manages TOTP two-factor authentication (RFC 6238) of administrators and
+// the owners' policy requiring it. Recovery codes are stored as SHA-256 hashes and can each
+// be used once in place of a one-time code.
+type TwoFactorService struct {
+	db     *sql.DB
+	issuer string
+	now    func() time.Time
+}
+
+// NewTwoFactorService creates a new two-factor service.
+// TOTP_ISSUER sets the service name shown in authenticator apps.
+func NewTwoFactorService() *TwoFactorService {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = DefaultTOTPIssuer
+	}
+
+	return &TwoFactorService{
+		db:     database.GetDB(),
+		issuer: issuer,
+		now:    time.Now,
+	}
+}
+
+// Status returns the two-factor state of an administrator
+func (s *TwoFactorService) Status(adminID int64) (*models.TwoFactorStatus, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	var status models.TwoFactorStatus
+	err := s.db.QueryRow(`SELECT a.totp_enabled_at,
+								 (SELECT COUNT(*) FROM admin_recovery_codes r WHERE r.admin_id = a.id AND r.used_at IS NULL)
+						  FROM administrators a WHERE a.id = $1`, adminID).Scan(&status.EnabledAt, &status.RecoveryCodesRemaining)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAdminNotFound
+		}
+		return nil, fmt.Errorf("failed to get two-factor status: %w", err)
+	}
+	status.Enabled = status.EnabledAt != nil
+
+	if status.Required, err = twoFactorRequired(s.db); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// BeginEnrollment generates a new secret for an administrator without two-factor
+// authentication. It is enabled once ConfirmEnrollment receives a code of the secret.
+func (s *TwoFactorService) BeginEnrollment(adminID int64) (*models.TwoFactorEnrollment, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	var username string
+	err = s.db.QueryRow(`UPDATE administrators SET totp_secret = $2, totp_last_step = NULL
+						 WHERE id = $1 AND totp_enabled_at IS NULL
+						 RETURNING username`, adminID, secret).Scan(&username)
+	if err == sql.ErrNoRows {
+		if _, err := s.lockAdmin(s.db, adminID); err != nil {
+			return nil, err
+		}
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start two-factor setup: %w", err)
+	}
+
+	return &models.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(s.issuer, username, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables two-factor authentication with a code of the pending secret and
+// returns the first recovery codes
+func (s *TwoFactorService) ConfirmEnrollment(adminID int64, code string) ([]string, error) {
+	var codes []string
+	err := s.inTx(func(tx *sql.Tx) error {
+		state, err := s.lockAdmin(tx, adminID)
+		if err != nil {
+			return err
+		}
+		if state.enabled {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		if !state.secret.Valid {
+			return ErrTwoFactorNotEnrolled
+		}
+
+		step, ok := ValidateTOTP(state.secret.String, code, s.now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		_, err = tx.Exec(`UPDATE administrators SET totp_enabled_at = NOW(), totp_last_step = $2, updated_at = NOW()
+						  WHERE id = $1`, adminID, step)
+		if err != nil {
+			return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+		}
+
+		codes, err = replaceRecoveryCodes(tx, adminID)
+		return err
+	})
+	return codes, err
+}
+
+// Verify checks a one-time code or consumes a recovery code of an administrator. A one-time
+// code is accepted only once, so that an observed code cannot be replayed.
+func (s *TwoFactorService) Verify(adminID int64, code string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		return s.verify(tx, adminID, code, true)
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a one-time code.
+// Recovery codes themselves are not accepted, so that a leaked code cannot replace the rest.
+func (s *TwoFactorService) RegenerateRecoveryCodes(adminID int64, code string) ([]string, error) {
+	var codes []string
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := s.verify(tx, adminID, code, false); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, adminID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable turns off two-factor authentication of an administrator after checking a code.
+// It fails with ErrTwoFactorRequired while owners require two-factor authentication.
+func (s *TwoFactorService) Disable(adminID int64, code string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		required, err := twoFactorRequired(tx)
+		if err != nil {
+			return err
+		}
+		if required {
+			return ErrTwoFactorRequired
+		}
+		if err := s.verify(tx, adminID, code, true); err != nil {
+			return err
+		}
+		return resetTwoFactor(tx, adminID)
+	})
+}
+
+// Reset turns off two-factor authentication of an administrator who lost their device. If
+// owners require two-factor authentication, the administrator sets it up at the next login.
+func (s *TwoFactorService) Reset(adminID int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := s.lockAdmin(tx, adminID); err != nil {
+			return err
+		}
+		return resetTwoFactor(tx, adminID)
+	})
+}
+
+// SecuritySettings returns the security policies set by owners
+func (s *TwoFactorService) SecuritySettings() (*models.SecuritySettings, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	var settings models.SecuritySettings
+	err := s.db.QueryRow("SELECT require_two_factor, updated_by, updated_at FROM security_settings WHERE id = TRUE").
+		Scan(&settings.RequireTwoFactor, &settings.UpdatedBy, &settings.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get security settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// UpdateSecuritySettings sets whether every administrator must use two-factor authentication
+func (s *TwoFactorService) UpdateSecuritySettings(requireTwoFactor bool, updatedBy int64) (*models.SecuritySettings, error) {
+	if s.db == nil {
+		return nil, errors.New("database connection not initialized")
+	}
+
+	settings := models.SecuritySettings{RequireTwoFactor: requireTwoFactor}
+	err := s.db.QueryRow(`INSERT INTO security_settings (id, require_two_factor, updated_by, updated_at)
+						  VALUES (TRUE, $1, $2, NOW())
+						  ON CONFLICT (id) DO UPDATE
+						  SET require_two_factor = EXCLUDED.require_two_factor, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+						  RETURNING updated_by, updated_at`, requireTwoFactor, updatedBy).Scan(&settings.UpdatedBy, &settings.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update security settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// twoFactorState is the locked two-factor columns of an administrator
+type twoFactorState struct {
+	secret   sql.NullString
+	enabled  bool
+	lastStep sql.NullInt64
+}
+
+// lockAdmin reads the two-factor columns of an administrator, locking the row in a transaction
+func (s *TwoFactorService) lockAdmin(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, adminID int64) (*twoFactorState, error) {
+	query := "SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM administrators WHERE id = $1"
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+
+	var state twoFactorState
+	if err := q.QueryRow(query, adminID).Scan(&state.secret, &state.enabled, &state.lastStep); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAdminNotFound
+		}
+		return nil, fmt.Errorf("failed to get admin: %w", err)
+	}
+	return &state, nil
+}
+
+// verify checks a one-time code, or with allowRecovery consumes a recovery code
+func (s *TwoFactorService) verify(tx *sql.Tx, adminID int64, code string, allowRecovery bool) error {
+	state, err := s.lockAdmin(tx, adminID)
+	if err != nil {
+		return err
+	}
+	if !state.enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := ValidateTOTP(state.secret.String, code, s.now()); ok {
+		if state.lastStep.Valid && step <= state.lastStep.Int64 {
+			return ErrInvalidTwoFactorCode
+		}
+		if _, err := tx.Exec("UPDATE administrators SET totp_last_step = $2 WHERE id = $1", adminID, step); err != nil {
+			return fmt.Errorf("failed to record one-time code: %w", err)
+		}
+		return nil
+	}
+	if !allowRecovery {
+		return ErrInvalidTwoFactorCode
+	}
+
+	result, err := tx.Exec(`UPDATE admin_recovery_codes SET used_at = NOW()
+							WHERE admin_id = $1 AND code_hash = $2 AND used_at IS NULL`, adminID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds
+func (s *TwoFactorService) inTx(fn func(tx *sql.Tx) error) error {
+	if s.db == nil {
+		return errors.New("database connection not initialized")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // Ignore rollback error in defer
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// resetTwoFactor clears the secret and recovery codes of an administrator
+func resetTwoFactor(tx *sql.Tx, adminID int64) error {
+	_, err := tx.Exec(`UPDATE administrators
+					   SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+					   WHERE id = $1`, adminID)
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM admin_recovery_codes WHERE admin_id = $1", adminID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of an administrator and generates new ones
+func replaceRecoveryCodes(tx *sql.Tx, adminID int64) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM admin_recovery_codes WHERE admin_id = $1", adminID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for len(codes) < RecoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("INSERT INTO admin_recovery_codes (admin_id, code_hash) VALUES ($1, $2)", adminID, hashRecoveryCode(code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode generates a random code such as "k3mzq-7hb2x" (50 bits)
+func generateRecoveryCode() (string, error) {
+	data := make([]byte, 7)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := recoveryCodeEncoding.EncodeToString(data)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode hashes a recovery code as typed, ignoring case, spaces and hyphens
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(normalizeCode(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// twoFactorRequired reports whether owners require two-factor authentication
+func twoFactorRequired(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) (bool, error) {
+	var required bool
+	err := q.QueryRow("SELECT require_two_factor FROM security_settings WHERE id = TRUE").Scan(&required)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to get security settings: %w", err)
+	}
+	return required, nil
+}
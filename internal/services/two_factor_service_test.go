@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Tattsum/quiz/internal/database"
+)
+
+func TestTwoFactorService(t *testing.T) {
+	// テスト環境設定
+	if os.Getenv("TEST_ENV") != "true" {
+		_ = os.Setenv("DB_HOST", "localhost")
+		_ = os.Setenv("DB_PORT", "5433")
+		_ = os.Setenv("DB_USER", "quiz_user")
+		_ = os.Setenv("DB_PASSWORD", "quiz_password")
+		_ = os.Setenv("DB_NAME", "quiz_db_test")
+		_ = os.Setenv("DB_SSLMODE", "disable")
+	}
+
+	// データベース接続を初期化
+	db, err := database.Initialize()
+	if err != nil {
+		t.Skipf("Database connection failed: %v", err)
+	}
+
+	suffix := os.Getpid()
+	admin, err := NewAuthService().CreateAdmin(fmt.Sprintf("totp%d", suffix), "totppassword", fmt.Sprintf("totp%d@example.com", suffix))
+	if err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM administrators WHERE id = $1", admin.ID)
+		_, _ = db.Exec("DELETE FROM security_settings")
+	}()
+
+	// 時刻を固定して、コードの時間ステップを制御する
+	now := time.Now()
+	service := NewTwoFactorService()
+	service.now = func() time.Time { return now }
+
+	// 確認前は有効にならず、コードの検証もできない
+	enrollment, err := service.BeginEnrollment(admin.ID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment() failed: %v", err)
+	}
+	if err := service.Verify(admin.ID, "000000"); !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Errorf("Verify() before confirmation error = %v, want ErrTwoFactorNotEnabled", err)
+	}
+	if _, err := service.ConfirmEnrollment(admin.ID, "12345"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("ConfirmEnrollment() with a wrong code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	code, _ := TOTPCode(enrollment.Secret, now)
+	recoveryCodes, err := service.ConfirmEnrollment(admin.ID, code)
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment() failed: %v", err)
+	}
+	if len(recoveryCodes) != RecoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, got %d", RecoveryCodeCount, len(recoveryCodes))
+	}
+	if _, err := service.BeginEnrollment(admin.ID); !errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+		t.Errorf("BeginEnrollment() when enabled error = %v, want ErrTwoFactorAlreadyEnabled", err)
+	}
+	if enabled, _ := NewAuthService().GetAdminByID(admin.ID); enabled == nil || !enabled.TwoFactorEnabled {
+		t.Error("Expected the admin to have two-factor authentication enabled")
+	}
+
+	// 確認に使ったコードは再利用できない。次の期間のコードは使える
+	if err := service.Verify(admin.ID, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Verify() with a used code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	now = now.Add(totpPeriod)
+	code, _ = TOTPCode(enrollment.Secret, now)
+	if err := service.Verify(admin.ID, code); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+
+	// リカバリーコードは1回だけ使える
+	if err := service.Verify(admin.ID, recoveryCodes[0]); err != nil {
+		t.Errorf("Verify() with a recovery code failed: %v", err)
+	}
+	if err := service.Verify(admin.ID, recoveryCodes[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Verify() with a used recovery code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	status, err := service.Status(admin.ID)
+	if err != nil || !status.Enabled || status.RecoveryCodesRemaining != RecoveryCodeCount-1 {
+		t.Errorf("Status() = %+v, %v", status, err)
+	}
+
+	// 再発行にはワンタイムコードが必要で、古いリカバリーコードは使えなくなる
+	if _, err := service.RegenerateRecoveryCodes(admin.ID, recoveryCodes[1]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("RegenerateRecoveryCodes() with a recovery code error = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	now = now.Add(totpPeriod)
+	code, _ = TOTPCode(enrollment.Secret, now)
+	newCodes, err := service.RegenerateRecoveryCodes(admin.ID, code)
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes() failed: %v", err)
+	}
+	if err := service.Verify(admin.ID, recoveryCodes[1]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Expected an old recovery code to be rejected, got %v", err)
+	}
+
+	// 必須の間は無効にできない
+	if _, err := service.UpdateSecuritySettings(true, admin.ID); err != nil {
+		t.Fatalf("UpdateSecuritySettings() failed: %v", err)
+	}
+	if err := service.Disable(admin.ID, newCodes[0]); !errors.Is(err, ErrTwoFactorRequired) {
+		t.Errorf("Disable() while required error = %v, want ErrTwoFactorRequired", err)
+	}
+	if _, err := service.UpdateSecuritySettings(false, admin.ID); err != nil {
+		t.Fatalf("UpdateSecuritySettings() failed: %v", err)
+	}
+	if err := service.Disable(admin.ID, newCodes[0]); err != nil {
+		t.Fatalf("Disable() failed: %v", err)
+	}
+	status, err = service.Status(admin.ID)
+	if err != nil || status.Enabled || status.RecoveryCodesRemaining != 0 {
+		t.Errorf("Expected two-factor authentication and recovery codes to be removed, got %+v, %v", status, err)
+	}
+}
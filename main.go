@@ -2,9 +2,14 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Tattsum/quiz/internal/database"
@@ -12,9 +17,20 @@ import (
 	"github.com/Tattsum/quiz/internal/middleware"
 	"github.com/Tattsum/quiz/internal/services"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/term"
 )
 
 func main() {
+	// サブコマンド: 最初の管理者を作成して終了
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		os.Exit(runBootstrapAdmin(os.Stdin, os.Stdout))
+	}
+
+	// 本番モードで既定のシークレットのままなら起動しない
+	if err := services.CheckProductionSecrets(); err != nil {
+		log.Fatal(err)
+	}
+
 	// データベース接続初期化
 	db, err := database.Initialize()
 	if err != nil {
@@ -27,12 +43,57 @@ func main() {
 	}()
 
 	// JWT サービス初期化
-	jwtService := services.NewJWTService()
+	jwtService, err := services.LoadJWTService()
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	handlers.UseJWTService(jwtService)
+	participantTokenService := services.NewParticipantTokenService()
+
+	// イベントブローカー初期化（複数レプリカ構成ではRedisを使用）
+	if os.Getenv("EVENT_BROKER") == "redis" {
+		redisAddr := getEnv("REDIS_HOST", "localhost") + ":" + getEnv("REDIS_PORT", "6379")
+		broker, err := services.NewRedisBroker(redisAddr, os.Getenv("REDIS_PASSWORD"), services.DefaultRedisEventChannel)
+		if err != nil {
+			log.Fatal("Failed to initialize Redis event broker:", err)
+		}
+		defer func() {
+			_ = broker.Close()
+		}()
+
+		if err := handlers.UseEventBroker(broker); err != nil {
+			log.Fatal("Failed to subscribe to Redis event broker:", err)
+		}
+		log.Printf("Using Redis event broker at %s", redisAddr)
+	}
+
+	// トークン失効ストア初期化（既定はPostgreSQL。Redis・メモリも選択可能）
+	switch os.Getenv("TOKEN_REVOCATION_STORE") {
+	case "memory":
+		log.Printf("Using in-memory token revocation store")
+	case "redis":
+		redisAddr := getEnv("REDIS_HOST", "localhost") + ":" + getEnv("REDIS_PORT", "6379")
+		store, err := services.NewRedisRevocationStore(redisAddr, os.Getenv("REDIS_PASSWORD"), services.DefaultRedisRevocationPrefix)
+		if err != nil {
+			log.Fatal("Failed to initialize Redis token revocation store:", err)
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+		middleware.UseRevocationStore(store)
+		log.Printf("Using Redis token revocation store at %s", redisAddr)
+	default:
+		middleware.UseRevocationStore(services.NewPostgresRevocationStore(db))
+	}
+
+	// 接続中の参加者を定期的に記録（回答率の母数）
+	go handlers.RecordPresenceHeartbeats()
 
 	// Ginルーターの設定
 	router := gin.Default()
 
 	// ミドルウェア設定
+	router.Use(middleware.RequestID())
 	router.Use(middleware.CORS())
 	router.Use(middleware.Logger())
 	router.Use(middleware.RateLimit())
@@ -44,57 +105,127 @@ func main() {
 	auth := v1.Group("/auth")
 	{
 		auth.POST("/login", handlers.AdminLogin)
+		auth.POST("/login/2fa", handlers.AdminLoginTwoFactor)
+		auth.POST("/2fa/setup", handlers.BeginTwoFactorSetup)
+		auth.GET("/oidc/login", handlers.OIDCLogin)
+		auth.POST("/oidc/callback", handlers.OIDCCallback)
 		auth.POST("/refresh", handlers.RefreshToken)
+		auth.POST("/invitations/accept", handlers.AcceptInvitation)
 	}
 
-	// 管理者エンドポイント（認証が必要）
+	// 管理者エンドポイント（認証が必要。ロールごとの権限をルートごとに確認）
 	admin := v1.Group("/admin")
 	admin.Use(middleware.JWTAuth(jwtService))
+	canRead := middleware.RequirePermission(middleware.PermissionRead)
+	canEditQuizzes := middleware.RequirePermission(middleware.PermissionEditQuizzes)
+	canRunSession := middleware.RequirePermission(middleware.PermissionRunSession)
+	canModerate := middleware.RequirePermission(middleware.PermissionModerateParticipants)
+	canManageAdmins := middleware.RequirePermission(middleware.PermissionManageAdmins)
+	interactive := middleware.RequireInteractiveLogin()
 	{
-		// 認証関連
-		admin.POST("/logout", handlers.AdminLogout)
+		// 認証関連（自分のアカウントの操作にAPIキーは使えない）
+		admin.POST("/logout", interactive, handlers.AdminLogout)
+		admin.POST("/logout-all", interactive, handlers.LogoutAllDevices)
 		admin.GET("/verify", handlers.VerifyToken)
+		admin.PUT("/me/password", interactive, handlers.ChangeOwnPassword)
+		admin.GET("/me/2fa", interactive, handlers.GetTwoFactorStatus)
+		admin.POST("/me/2fa/enroll", interactive, handlers.EnrollTwoFactor)
+		admin.POST("/me/2fa/confirm", interactive, handlers.ConfirmTwoFactor)
+		admin.POST("/me/2fa/recovery-codes", interactive, handlers.RegenerateRecoveryCodes)
+		admin.POST("/me/2fa/disable", interactive, handlers.DisableTwoFactor)
 
 		// 問題管理
-		admin.GET("/quizzes", handlers.GetQuizzes)
-		admin.GET("/quizzes/:id", handlers.GetQuiz)
-		admin.POST("/quizzes", handlers.CreateQuiz)
-		admin.PUT("/quizzes/:id", handlers.UpdateQuiz)
-		admin.DELETE("/quizzes/:id", handlers.DeleteQuiz)
+		admin.GET("/quizzes", canRead, handlers.GetQuizzes)
+		admin.GET("/quizzes/:id", canRead, handlers.GetQuiz)
+		admin.POST("/quizzes", canEditQuizzes, handlers.CreateQuiz)
+		admin.PUT("/quizzes/:id", canEditQuizzes, handlers.UpdateQuiz)
+		admin.DELETE("/quizzes/:id", canEditQuizzes, handlers.DeleteQuiz)
 
 		// セッション管理
-		admin.POST("/session/start", handlers.StartSession)
-		admin.POST("/session/next", handlers.NextQuestion)
-		admin.POST("/session/toggle-answers", handlers.ToggleAnswers)
-		admin.POST("/session/end", handlers.EndSession)
+		admin.POST("/session/lobby", canRunSession, handlers.OpenLobby)
+		admin.PUT("/session/lobby", canRunSession, handlers.UpdateLobbySettings)
+		admin.GET("/session/lobby", canRead, handlers.GetAdminLobbyRoster)
+		admin.POST("/session/start", canRunSession, handlers.StartSession)
+		admin.POST("/session/next", canRunSession, handlers.NextQuestion)
+		admin.POST("/session/toggle-answers", canRunSession, handlers.ToggleAnswers)
+		admin.POST("/session/end", canRunSession, handlers.EndSession)
 
 		// ファイルアップロード
-		admin.POST("/upload/image", handlers.UploadImage)
+		admin.POST("/upload/image", canEditQuizzes, handlers.UploadImage)
 
 		// 結果・ランキング（具体的なパスを先に定義）
-		admin.GET("/results/current", handlers.GetCurrentResults)
-		admin.GET("/ranking/overall", handlers.GetOverallRanking)
-		admin.GET("/results/quiz/:id", handlers.GetQuizResults)
-		admin.GET("/ranking/quiz/:id", handlers.GetQuizRanking)
-		admin.GET("/ranking/participant/:id", handlers.GetParticipantRanking)
+		admin.GET("/results/current", canRead, handlers.GetCurrentResults)
+		admin.GET("/ranking/overall", canRead, handlers.GetOverallRanking)
+		admin.GET("/ranking/teams", canRead, handlers.GetTeamRanking)
+		admin.GET("/results/quiz/:id", canRead, handlers.GetQuizResults)
+		admin.GET("/ranking/quiz/:id", canRead, handlers.GetQuizRanking)
+		admin.GET("/ranking/participant/:id", canRead, handlers.GetParticipantRanking)
+
+		// 参加者管理
+		admin.GET("/participants", canRead, handlers.ListParticipants)
+		admin.POST("/participants/merge", canModerate, handlers.MergeParticipants)
+		admin.PUT("/participants/:id/nickname", canModerate, handlers.RenameParticipant)
+		admin.PUT("/participants/:id/visibility", canModerate, handlers.SetParticipantVisibility)
+		admin.POST("/participants/:id/kick", canModerate, handlers.KickParticipant)
+		admin.PUT("/participants/:id/team", canModerate, handlers.AssignParticipantTeam)
+		admin.POST("/participants/:id/approve", canModerate, handlers.ApproveParticipant)
+		admin.POST("/participants/:id/reject", canModerate, handlers.RejectParticipant)
+		admin.POST("/teams", canModerate, handlers.CreateTeam)
+		admin.PUT("/teams/:id", canModerate, handlers.UpdateTeam)
+		admin.DELETE("/teams/:id", canModerate, handlers.DeleteTeam)
+		admin.GET("/bans", canRead, handlers.ListBans)
+		admin.POST("/bans", canModerate, handlers.BanParticipant)
+		admin.DELETE("/bans/:id", canModerate, handlers.LiftBan)
+		admin.GET("/moderation/audit-log", canRead, handlers.GetModerationAuditLog)
+
+		// リアルタイム接続の監視
+		admin.GET("/connections", canRead, handlers.GetConnections)
+
+		// 管理者の管理（オーナーのみ）
+		admin.GET("/admins", canManageAdmins, handlers.ListAdmins)
+		admin.POST("/admins", canManageAdmins, handlers.CreateAdmin)
+		admin.POST("/admins/invitations", canManageAdmins, handlers.InviteAdmin)
+		admin.PUT("/admins/:id", canManageAdmins, handlers.UpdateAdmin)
+		admin.DELETE("/admins/:id", canManageAdmins, handlers.DeleteAdmin)
+		admin.PUT("/admins/:id/role", canManageAdmins, handlers.UpdateAdminRole)
+		admin.POST("/admins/:id/disable", canManageAdmins, handlers.DisableAdmin)
+		admin.POST("/admins/:id/enable", canManageAdmins, handlers.EnableAdmin)
+		admin.DELETE("/admins/:id/2fa", canManageAdmins, handlers.ResetAdminTwoFactor)
+		admin.POST("/admins/:id/unlock", canManageAdmins, handlers.UnlockAdminLogin)
+		admin.GET("/login-events", canManageAdmins, handlers.GetLoginEvents)
+		admin.GET("/settings/security", canManageAdmins, handlers.GetSecuritySettings)
+		admin.PUT("/settings/security", canManageAdmins, handlers.UpdateSecuritySettings)
+		admin.GET("/api-keys", canManageAdmins, handlers.ListAPIKeys)
+		admin.POST("/api-keys", canManageAdmins, handlers.CreateAPIKey)
+		admin.DELETE("/api-keys/:id", canManageAdmins, handlers.RevokeAPIKey)
+		admin.GET("/audit-logs", canManageAdmins, handlers.GetAuditLogs)
+		admin.GET("/audit-logs/export", canManageAdmins, handlers.ExportAuditLogs)
 	}
 
 	// セッション状態取得（公開）
 	v1.GET("/session/status", handlers.GetSessionStatus)
+	v1.GET("/session/lobby", handlers.GetLobbyRoster)
+	v1.GET("/session/survivors", handlers.GetSurvivors)
+	v1.GET("/teams", handlers.ListTeams)
 
 	// 参加者関連エンドポイント
 	participants := v1.Group("/participants")
 	{
 		participants.POST("/register", handlers.RegisterParticipant)
+		participants.POST("/rejoin", handlers.RejoinParticipant)
 		participants.GET("/:id", handlers.GetParticipant)
-		participants.GET("/:id/answers", handlers.GetParticipantAnswers)
+		participants.GET("/:id/answers", middleware.ParticipantAuth(participantTokenService), handlers.GetParticipantAnswers)
+		participants.GET("/:id/lifelines", middleware.ParticipantAuth(participantTokenService), handlers.GetParticipantLifelines)
+		participants.GET("/:id/summary", middleware.ParticipantAuth(participantTokenService), handlers.GetParticipantSummary)
 	}
 
-	// 回答関連エンドポイント
+	// 回答関連エンドポイント（参加者トークン必須）
 	answers := v1.Group("/answers")
+	answers.Use(middleware.ParticipantAuth(participantTokenService))
 	{
 		answers.POST("", handlers.SubmitAnswer)
 		answers.PUT("/:id", handlers.UpdateAnswer)
+		answers.POST("/lifelines", handlers.UseLifeline)
 	}
 
 	// 集計結果エンドポイント
@@ -108,13 +239,20 @@ func main() {
 	ranking := v1.Group("/ranking")
 	{
 		ranking.GET("/overall", handlers.GetOverallRanking)
+		ranking.GET("/teams", handlers.GetTeamRanking)
 		ranking.GET("/quiz/:id", handlers.GetQuizRanking)
 		ranking.GET("/participant/:id", handlers.GetParticipantRanking)
 	}
 
+	// アクセストークン検証用の公開鍵（RS256・EdDSA署名時）
+	router.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// WebSocketエンドポイント
 	router.GET("/ws", handlers.WebSocketResults)
 
+	// Server-Sent Eventsエンドポイント（WebSocketが使えない環境向け）
+	v1.GET("/events", handlers.EventStream)
+
 	// 静的ファイル配信 (アップロードされた画像など)
 	router.Static("/uploads", "./uploads")
 
@@ -137,3 +275,76 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// getEnv gets environment variable with fallback to default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// runBootstrapAdmin creates the first owner for the "bootstrap-admin" subcommand and returns
+// the exit code. Values missing from ADMIN_BOOTSTRAP_USERNAME, ADMIN_BOOTSTRAP_EMAIL and
+// ADMIN_BOOTSTRAP_PASSWORD are read from stdin, one per line. When stdin is a terminal the
+// password is read without echoing it.
+func runBootstrapAdmin(in io.Reader, out io.Writer) int {
+	reader := bufio.NewReader(in)
+	prompt := func(envKey, label string) (string, error) {
+		if value := os.Getenv(envKey); value != "" {
+			return value, nil
+		}
+		_, _ = fmt.Fprintf(out, "%s: ", label)
+		if file, ok := in.(*os.File); ok && envKey == "ADMIN_BOOTSTRAP_PASSWORD" && term.IsTerminal(int(file.Fd())) {
+			password, err := term.ReadPassword(int(file.Fd()))
+			_, _ = fmt.Fprintln(out) // The newline typed by the user was not echoed
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", label, err)
+			}
+			return string(password), nil
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("failed to read %s: %w", label, err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	var values [3]string
+	for i, field := range [][2]string{
+		{"ADMIN_BOOTSTRAP_USERNAME", "Username"},
+		{"ADMIN_BOOTSTRAP_EMAIL", "Email"},
+		{"ADMIN_BOOTSTRAP_PASSWORD", "Password"},
+	} {
+		value, err := prompt(field[0], field[1])
+		if err != nil {
+			_, _ = fmt.Fprintln(out, err)
+			return 1
+		}
+		values[i] = value
+	}
+	username, email, password := values[0], values[1], values[2]
+
+	db, err := database.Initialize()
+	if err != nil {
+		_, _ = fmt.Fprintln(out, "Failed to initialize database:", err)
+		return 1
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	admin, err := services.NewAuthService().BootstrapAdmin(username, password, email)
+	switch {
+	case errors.Is(err, services.ErrAdminsExist):
+		// Already bootstrapped: nothing to do, so that deployments can always run the command
+		_, _ = fmt.Fprintln(out, "Administrators already exist; no administrator was created")
+		return 0
+	case err != nil:
+		_, _ = fmt.Fprintln(out, "Failed to create administrator:", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(out, "Created owner %q (id %d)\n", admin.Username, admin.ID)
+	return 0
+}
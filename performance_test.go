@@ -43,6 +43,9 @@ const (
 	WebSocketTimeout = 15 * time.Second // GitHub Actions環境向けに延長
 )
 
+// ニックネームはセッション内で一意なので、実行ごとに異なる接尾辞を付ける
+var runID = time.Now().Unix()
+
 // パフォーマンステストの結果を記録する構造体
 type PerformanceResult struct {
 	TotalRequests  int
@@ -71,6 +74,17 @@ func createHTTPClient() *http.Client {
 }
 
 // WebSocketダイアラーにタイムアウトを設定するヘルパー関数
+// postAnswer submits an answer with the participant token issued at registration
+func postAnswer(client *http.Client, participantToken string, jsonData []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, BaseURL+"/api/answers", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+participantToken)
+	return client.Do(req)
+}
+
 func createWebSocketDialer() *websocket.Dialer {
 	return &websocket.Dialer{
 		HandshakeTimeout: WebSocketTimeout,
@@ -151,7 +165,7 @@ func checkDatabaseConnection(t *testing.T) {
 	t.Helper()
 	t.Log("データベース接続の確認中...")
 	testParticipant := models.ParticipantRequest{
-		Nickname: "HealthCheckUser",
+		Nickname: fmt.Sprintf("HealthCheckUser%d", runID),
 	}
 	jsonData, _ := json.Marshal(testParticipant)
 	client := createHTTPClient()
@@ -333,7 +347,7 @@ func TestConcurrentParticipantRegistration(t *testing.T) {
 
 			// 参加者登録リクエスト
 			participantReq := models.ParticipantRequest{
-				Nickname: fmt.Sprintf("LoadTestUser%d", participantNum),
+				Nickname: fmt.Sprintf("LoadTestUser%d_%d", runID, participantNum),
 			}
 
 			jsonData, err := json.Marshal(participantReq)
@@ -559,6 +573,7 @@ func TestConcurrentAnswerSubmissions(t *testing.T) {
 
 	numParticipants := getMaxConcurrentUsers()
 	var participantIDs []int64
+	var participantTokens []string
 	var wg sync.WaitGroup
 
 	// まず参加者を登録
@@ -566,7 +581,7 @@ func TestConcurrentAnswerSubmissions(t *testing.T) {
 	client := createHTTPClient()
 	for i := 0; i < numParticipants; i++ {
 		participantReq := models.ParticipantRequest{
-			Nickname: fmt.Sprintf("AnswerTestUser%d", i),
+			Nickname: fmt.Sprintf("AnswerTestUser%d_%d", runID, i),
 		}
 
 		jsonData, _ := json.Marshal(participantReq)
@@ -583,6 +598,8 @@ func TestConcurrentAnswerSubmissions(t *testing.T) {
 			if data, ok := result["data"].(map[string]interface{}); ok {
 				if participantID, ok := data["participant_id"].(float64); ok {
 					participantIDs = append(participantIDs, int64(participantID))
+					participantToken, _ := data["token"].(string)
+					participantTokens = append(participantTokens, participantToken)
 				}
 			}
 		}
@@ -604,7 +621,7 @@ func TestConcurrentAnswerSubmissions(t *testing.T) {
 
 	for i, participantID := range participantIDs {
 		wg.Add(1)
-		go func(pID int64, userNum int) {
+		go func(pID int64, pToken string, userNum int) {
 			defer wg.Done()
 
 			reqStart := time.Now()
@@ -627,11 +644,7 @@ func TestConcurrentAnswerSubmissions(t *testing.T) {
 			}
 
 			client := createHTTPClient()
-			resp, err := client.Post(
-				BaseURL+"/api/answers",
-				"application/json",
-				bytes.NewBuffer(jsonData),
-			)
+			resp, err := postAnswer(client, pToken, jsonData)
 
 			latency := time.Since(reqStart)
 			success := err == nil && resp != nil && (resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK)
@@ -646,7 +659,7 @@ func TestConcurrentAnswerSubmissions(t *testing.T) {
 				Error:     err,
 				Timestamp: time.Now(),
 			}
-		}(participantID, i)
+		}(participantID, participantTokens[i], i)
 	}
 
 	wg.Wait()
@@ -767,6 +780,7 @@ func TestSystemLoadUnder70Users(t *testing.T) {
 			}
 
 			var participantID int64
+			var participantToken string
 			if resp != nil {
 				if resp.StatusCode == http.StatusCreated {
 					var result map[string]interface{}
@@ -775,6 +789,7 @@ func TestSystemLoadUnder70Users(t *testing.T) {
 							if pID, ok := data["participant_id"].(float64); ok {
 								participantID = int64(pID)
 							}
+							participantToken, _ = data["token"].(string)
 						}
 					}
 				}
@@ -793,7 +808,7 @@ func TestSystemLoadUnder70Users(t *testing.T) {
 
 					jsonData, _ := json.Marshal(answerReq)
 					reqStart := time.Now()
-					resp, err := client.Post(BaseURL+"/api/answers", "application/json", bytes.NewBuffer(jsonData))
+					resp, err := postAnswer(client, participantToken, jsonData)
 
 					results <- RequestResult{
 						Success:   err == nil && resp != nil && (resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK),